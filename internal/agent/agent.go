@@ -34,6 +34,7 @@ import (
 	"github.com/mudaaaa/crushplus/internal/permission"
 	"github.com/mudaaaa/crushplus/internal/session"
 	"github.com/mudaaaa/crushplus/internal/stringext"
+	"github.com/mudaaaa/crushplus/internal/todo"
 )
 
 //go:embed templates/title.md
@@ -53,12 +54,18 @@ type SessionAgentCall struct {
 	TopK             *int64
 	FrequencyPenalty *float64
 	PresencePenalty  *float64
+	// Plan runs the agent in plan mode, with read-only tools, to come up
+	// with a plan for the user to approve.
+	Plan bool
 }
 
 type SessionAgent interface {
 	Run(context.Context, SessionAgentCall) (*fantasy.AgentResult, error)
 	SetModels(large Model, small Model)
+	SetSessionSystemPrompt(sessionID, systemPrompt string)
 	SetTools(tools []fantasy.AgentTool)
+	SetPlanTools(tools []fantasy.AgentTool)
+	PinPlan(ctx context.Context, sessionID, plan string) error
 	Cancel(sessionID string)
 	CancelAll()
 	IsSessionBusy(sessionID string) bool
@@ -66,6 +73,9 @@ type SessionAgent interface {
 	QueuedPrompts(sessionID string) int
 	ClearQueue(sessionID string)
 	Summarize(context.Context, string, fantasy.ProviderOptions) error
+	GenerateSummary(ctx context.Context, sessionID, instructions string, opts fantasy.ProviderOptions) (string, error)
+	ApplySummary(ctx context.Context, sessionID, summary string) error
+	Sample(context.Context, SampleCall) (*SampleResult, error)
 	Model() Model
 }
 
@@ -81,13 +91,22 @@ type sessionAgent struct {
 	systemPromptPrefix   string
 	systemPrompt         string
 	tools                []fantasy.AgentTool
+	planTools            []fantasy.AgentTool
 	sessions             session.Service
 	messages             message.Service
+	todos                todo.Service
 	disableAutoSummarize bool
 	isYolo               bool
+	historyPruning       config.HistoryPruning
 
 	messageQueue   *csync.Map[string, []SessionAgentCall]
 	activeRequests *csync.Map[string, context.CancelFunc]
+	// prunedResults holds the number of tool results pruned from the history
+	// of the sessions where pruning has started.
+	prunedResults *csync.Map[string, int]
+	// sessionPrompts holds the system prompts rebuilt for the sessions
+	// started after the files changed, which they keep to their end.
+	sessionPrompts *csync.Map[string, string]
 }
 
 type SessionAgentOptions struct {
@@ -99,7 +118,9 @@ type SessionAgentOptions struct {
 	IsYolo               bool
 	Sessions             session.Service
 	Messages             message.Service
+	Todos                todo.Service
 	Tools                []fantasy.AgentTool
+	HistoryPruning       config.HistoryPruning
 }
 
 func NewSessionAgent(
@@ -112,11 +133,15 @@ func NewSessionAgent(
 		systemPrompt:         opts.SystemPrompt,
 		sessions:             opts.Sessions,
 		messages:             opts.Messages,
+		todos:                opts.Todos,
 		disableAutoSummarize: opts.DisableAutoSummarize,
 		tools:                opts.Tools,
 		isYolo:               opts.IsYolo,
+		historyPruning:       opts.HistoryPruning,
 		messageQueue:         csync.NewMap[string, []SessionAgentCall](),
 		activeRequests:       csync.NewMap[string, context.CancelFunc](),
+		prunedResults:        csync.NewMap[string, int](),
+		sessionPrompts:       csync.NewMap[string, string](),
 	}
 }
 
@@ -139,27 +164,74 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 		return nil, nil
 	}
 
-	if len(a.tools) > 0 {
+	sessionLock := sync.Mutex{}
+	currentSession, err := a.sessions.Get(ctx, call.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	systemPrompt, agentTools := a.runSetup(call, currentSession.Plan)
+	if len(agentTools) > 0 {
 		// Add Anthropic caching to the last tool.
-		a.tools[len(a.tools)-1].SetProviderOptions(a.getCacheControlOptions())
+		agentTools[len(agentTools)-1].SetProviderOptions(a.getCacheControlOptions())
 	}
 
 	agent := fantasy.NewAgent(
 		a.largeModel.Model,
-		fantasy.WithSystemPrompt(a.systemPrompt),
-		fantasy.WithTools(a.tools...),
+		fantasy.WithSystemPrompt(systemPrompt),
+		fantasy.WithTools(agentTools...),
 	)
 
-	sessionLock := sync.Mutex{}
-	currentSession, err := a.sessions.Get(ctx, call.SessionID)
+	msgs, err := a.getSessionMessages(ctx, currentSession)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get session: %w", err)
+		return nil, fmt.Errorf("failed to get session messages: %w", err)
 	}
 
-	msgs, err := a.getSessionMessages(ctx, currentSession)
+	// Size up the request before sending it, so the history is pruned, or
+	// summarized, before it overflows the context window.
+	used := max(currentSession.PromptTokens+currentSession.CompletionTokens, a.estimateRun(systemPrompt, agentTools, msgs, call))
+	msgs = a.pruneHistory(ctx, currentSession, msgs, used)
+	if len(msgs) > 0 && a.needsSummary(a.estimateRun(systemPrompt, agentTools, msgs, call)) {
+		slog.Info("Summarizing the session before the request overflows the context window", "session_id", call.SessionID)
+		if err := a.Summarize(ctx, call.SessionID, call.ProviderOptions); err != nil {
+			return nil, err
+		}
+		if currentSession, err = a.sessions.Get(ctx, call.SessionID); err != nil {
+			return nil, fmt.Errorf("failed to get session: %w", err)
+		}
+		if msgs, err = a.getSessionMessages(ctx, currentSession); err != nil {
+			return nil, fmt.Errorf("failed to get session messages: %w", err)
+		}
+	}
+	a.publishEstimate(call.SessionID, a.estimateRun(systemPrompt, agentTools, msgs, call))
+
+	// Roll up what the task sub-agents spend to this session, and on to its
+	// own parent when this is a task too. The session is kept in memory for
+	// the whole run, so it's updated here rather than in the database, and so
+	// is what MCP sampling requests spend meanwhile.
+	rollUp := taskUsageFromContext(ctx)
+	addUsage := func(usage taskUsage) {
+		sessionLock.Lock()
+		currentSession.Cost += usage.cost
+		currentSession.TaskTokens += usage.tokens
+		_, err := a.sessions.Save(ctx, currentSession)
+		sessionLock.Unlock()
+		if err != nil {
+			slog.Error("Failed to save the usage of a task", "session_id", call.SessionID, "error", err)
+		}
+		if rollUp != nil {
+			rollUp(usage)
+		}
+	}
+	stopRun, err := startSessionRun(call.SessionID, addUsage, func() (err error) {
+		// Reload the session, for the usage added before the run started.
+		currentSession, err = a.sessions.Get(ctx, call.SessionID)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get session messages: %w", err)
+		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
+	defer stopRun()
 
 	var wg sync.WaitGroup
 	// Generate title if first message.
@@ -180,6 +252,8 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 	// Add the session to the context.
 	ctx = context.WithValue(ctx, tools.SessionIDContextKey, call.SessionID)
 
+	ctx = withTaskUsage(ctx, addUsage)
+
 	genCtx, cancel := context.WithCancel(ctx)
 	a.activeRequests.Set(call.SessionID, cancel)
 
@@ -192,10 +266,11 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 	a.eventPromptSent(call.SessionID)
 
 	var currentAssistant *message.Message
+	var lastRequest requestSize
 	var shouldSummarize bool
 	isThinking := false
 	result, err := agent.Stream(genCtx, fantasy.AgentStreamCall{
-		Prompt:           call.Prompt,
+		Prompt:           promptWithTextAttachments(call.Prompt, call.Attachments),
 		Files:            files,
 		Messages:         history,
 		ProviderOptions:  call.ProviderOptions,
@@ -242,6 +317,7 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 			if a.systemPromptPrefix != "" {
 				prepared.Messages = append([]fantasy.Message{fantasy.NewSystemMessage(a.systemPromptPrefix)}, prepared.Messages...)
 			}
+			lastRequest = a.largeModel.measureRequest(agentTools, prepared.Messages)
 
 			var assistantMsg message.Message
 			assistantMsg, err = a.messages.Create(callContext, call.SessionID, message.CreateMessageParams{
@@ -392,27 +468,31 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 				finishReason = message.FinishReasonToolUse
 			}
 			currentAssistant.AddFinish(finishReason, "", "")
-			a.updateSessionUsage(a.largeModel, &currentSession, stepResult.Usage, a.openrouterCost(stepResult.ProviderMetadata))
+			a.largeModel.calibrate(lastRequest, stepResult.Usage)
 			sessionLock.Lock()
+			cost := a.updateSessionUsage(a.largeModel, &currentSession, stepResult.Usage, a.openrouterCost(stepResult.ProviderMetadata))
 			_, sessionErr := a.sessions.Save(genCtx, currentSession)
 			sessionLock.Unlock()
 			if sessionErr != nil {
 				return sessionErr
 			}
+			if rollUp != nil {
+				rollUp(taskUsage{cost: cost, tokens: usageTokens(stepResult.Usage)})
+			}
 			return a.messages.Update(genCtx, *currentAssistant)
 		},
 		StopWhen: []fantasy.StopCondition{
-			func(_ []fantasy.StepResult) bool {
-				cw := int64(a.largeModel.CatwalkCfg.ContextWindow)
-				tokens := currentSession.CompletionTokens + currentSession.PromptTokens
-				remaining := cw - tokens
-				var threshold int64
-				if cw > 200_000 {
-					threshold = 20_000
-				} else {
-					threshold = int64(float64(cw) * 0.2)
+			func(steps []fantasy.StepResult) bool {
+				// The next request is the last one plus what its step added,
+				// tool results included, which the usage doesn't count yet.
+				next := lastRequest
+				if len(steps) > 0 {
+					next = next.add(a.largeModel.measureRequest(nil, steps[len(steps)-1].Messages))
 				}
-				if (remaining <= threshold) && !a.disableAutoSummarize {
+				estimate := a.largeModel.estimateTokens(next)
+				a.publishEstimate(call.SessionID, estimate)
+				tokens := max(currentSession.CompletionTokens+currentSession.PromptTokens, estimate)
+				if a.needsSummary(tokens) {
 					shouldSummarize = true
 					return true
 				}
@@ -510,6 +590,8 @@ func (a *sessionAgent) Run(ctx context.Context, call SessionAgentCall) (*fantasy
 		return nil, err
 	}
 	wg.Wait()
+	// The session isn't saved by the run anymore.
+	stopRun()
 
 	if shouldSummarize {
 		a.activeRequests.Del(call.SessionID)
@@ -580,36 +662,26 @@ func (a *sessionAgent) Summarize(ctx context.Context, sessionID string, opts fan
 		return err
 	}
 
-	resp, err := agent.Stream(genCtx, fantasy.AgentStreamCall{
-		Prompt:          "Provide a detailed summary of our conversation above.",
-		Messages:        aiMsgs,
-		ProviderOptions: opts,
-		PrepareStep: func(callContext context.Context, options fantasy.PrepareStepFunctionOptions) (_ context.Context, prepared fantasy.PrepareStepResult, err error) {
-			prepared.Messages = options.Messages
-			if a.systemPromptPrefix != "" {
-				prepared.Messages = append([]fantasy.Message{fantasy.NewSystemMessage(a.systemPromptPrefix)}, prepared.Messages...)
-			}
-			return callContext, prepared, nil
-		},
-		OnReasoningDelta: func(id string, text string) error {
-			summaryMessage.AppendReasoningContent(text)
-			return a.messages.Update(genCtx, summaryMessage)
-		},
-		OnReasoningEnd: func(id string, reasoning fantasy.ReasoningContent) error {
-			// Handle anthropic signature.
-			if anthropicData, ok := reasoning.ProviderMetadata["anthropic"]; ok {
-				if signature, ok := anthropicData.(*anthropic.ReasoningOptionMetadata); ok && signature.Signature != "" {
-					summaryMessage.AppendReasoningSignature(signature.Signature)
-				}
+	call := a.summaryStreamCall(aiMsgs, "", opts)
+	call.OnReasoningDelta = func(id string, text string) error {
+		summaryMessage.AppendReasoningContent(text)
+		return a.messages.Update(genCtx, summaryMessage)
+	}
+	call.OnReasoningEnd = func(id string, reasoning fantasy.ReasoningContent) error {
+		// Handle anthropic signature.
+		if anthropicData, ok := reasoning.ProviderMetadata["anthropic"]; ok {
+			if signature, ok := anthropicData.(*anthropic.ReasoningOptionMetadata); ok && signature.Signature != "" {
+				summaryMessage.AppendReasoningSignature(signature.Signature)
 			}
-			summaryMessage.FinishThinking()
-			return a.messages.Update(genCtx, summaryMessage)
-		},
-		OnTextDelta: func(id, text string) error {
-			summaryMessage.AppendContent(text)
-			return a.messages.Update(genCtx, summaryMessage)
-		},
-	})
+		}
+		summaryMessage.FinishThinking()
+		return a.messages.Update(genCtx, summaryMessage)
+	}
+	call.OnTextDelta = func(id, text string) error {
+		summaryMessage.AppendContent(text)
+		return a.messages.Update(genCtx, summaryMessage)
+	}
+	resp, err := agent.Stream(genCtx, call)
 	if err != nil {
 		isCancelErr := errors.Is(err, context.Canceled)
 		if isCancelErr {
@@ -620,6 +692,7 @@ func (a *sessionAgent) Summarize(ctx context.Context, sessionID string, opts fan
 		return err
 	}
 
+	summaryMessage.AppendContent(a.todosSection(genCtx, sessionID))
 	summaryMessage.AddFinish(message.FinishReasonEndTurn, "", "")
 	err = a.messages.Update(genCtx, summaryMessage)
 	if err != nil {
@@ -696,6 +769,9 @@ func (a *sessionAgent) preparePrompt(msgs []message.Message, attachments ...mess
 
 	var files []fantasy.FilePart
 	for _, attachment := range attachments {
+		if attachment.IsText() {
+			continue
+		}
 		files = append(files, fantasy.FilePart{
 			Filename:  attachment.FileName,
 			Data:      attachment.Content,
@@ -706,6 +782,26 @@ func (a *sessionAgent) preparePrompt(msgs []message.Message, attachments ...mess
 	return history, files
 }
 
+// estimateRun estimates the tokens of the first request of a run: the system
+// prompt, the tools, the history and the prompt with its attachments.
+func (a *sessionAgent) estimateRun(systemPrompt string, tools []fantasy.AgentTool, msgs []message.Message, call SessionAgentCall) int64 {
+	history, files := a.preparePrompt(msgs, call.Attachments...)
+	request := append([]fantasy.Message{fantasy.NewSystemMessage(a.systemPromptPrefix, systemPrompt)}, history...)
+	request = append(request, fantasy.NewUserMessage(promptWithTextAttachments(call.Prompt, call.Attachments), files...))
+	return a.largeModel.estimateTokens(a.largeModel.measureRequest(tools, request))
+}
+
+// promptWithTextAttachments appends text attachments to the prompt, since
+// only binary attachments are sent as file parts.
+func promptWithTextAttachments(prompt string, attachments []message.Attachment) string {
+	for _, attachment := range attachments {
+		if attachment.IsText() {
+			prompt += "\n\n" + message.TextAttachment(attachment.FilePath, attachment.Content)
+		}
+	}
+	return prompt
+}
+
 func (a *sessionAgent) getSessionMessages(ctx context.Context, session session.Session) ([]message.Message, error) {
 	msgs, err := a.messages.List(ctx, session.ID)
 	if err != nil {
@@ -808,23 +904,29 @@ func (a *sessionAgent) openrouterCost(metadata fantasy.ProviderMetadata) *float6
 	return &opts.Usage.Cost
 }
 
-func (a *sessionAgent) updateSessionUsage(model Model, session *session.Session, usage fantasy.Usage, overrideCost *float64) {
-	modelConfig := model.CatwalkCfg
-	cost := modelConfig.CostPer1MInCached/1e6*float64(usage.CacheCreationTokens) +
-		modelConfig.CostPer1MOutCached/1e6*float64(usage.CacheReadTokens) +
-		modelConfig.CostPer1MIn/1e6*float64(usage.InputTokens) +
-		modelConfig.CostPer1MOut/1e6*float64(usage.OutputTokens)
+// updateSessionUsage updates the session with the usage, and returns the cost
+// added to it.
+func (a *sessionAgent) updateSessionUsage(model Model, session *session.Session, usage fantasy.Usage, overrideCost *float64) float64 {
+	cost := usageCost(model, usage)
 
 	a.eventTokensUsed(session.ID, model, usage, cost)
 
 	if overrideCost != nil {
-		session.Cost += *overrideCost
-	} else {
-		session.Cost += cost
+		cost = *overrideCost
 	}
+	session.Cost += cost
 
 	session.CompletionTokens = usage.OutputTokens + usage.CacheReadTokens
 	session.PromptTokens = usage.InputTokens + usage.CacheCreationTokens
+	return cost
+}
+
+func usageCost(model Model, usage fantasy.Usage) float64 {
+	modelConfig := model.CatwalkCfg
+	return modelConfig.CostPer1MInCached/1e6*float64(usage.CacheCreationTokens) +
+		modelConfig.CostPer1MOutCached/1e6*float64(usage.CacheReadTokens) +
+		modelConfig.CostPer1MIn/1e6*float64(usage.InputTokens) +
+		modelConfig.CostPer1MOut/1e6*float64(usage.OutputTokens)
 }
 
 func (a *sessionAgent) Cancel(sessionID string) {
@@ -901,6 +1003,12 @@ func (a *sessionAgent) SetModels(large Model, small Model) {
 	a.smallModel = small
 }
 
+// SetSessionSystemPrompt replaces the system prompt of the session, for its
+// next runs. The other sessions keep theirs.
+func (a *sessionAgent) SetSessionSystemPrompt(sessionID, systemPrompt string) {
+	a.sessionPrompts.Set(sessionID, systemPrompt)
+}
+
 func (a *sessionAgent) SetTools(tools []fantasy.AgentTool) {
 	a.tools = tools
 }
@@ -85,21 +85,6 @@ func (c *coordinator) agentTool(ctx context.Context) (fantasy.AgentTool, error)
 			if err != nil {
 				return fantasy.NewTextErrorResponse("error generating response"), nil
 			}
-			updatedSession, err := c.sessions.Get(ctx, session.ID)
-			if err != nil {
-				return fantasy.ToolResponse{}, fmt.Errorf("error getting session: %s", err)
-			}
-			parentSession, err := c.sessions.Get(ctx, sessionID)
-			if err != nil {
-				return fantasy.ToolResponse{}, fmt.Errorf("error getting parent session: %s", err)
-			}
-
-			parentSession.Cost += updatedSession.Cost
-
-			_, err = c.sessions.Save(ctx, parentSession)
-			if err != nil {
-				return fantasy.ToolResponse{}, fmt.Errorf("error saving parent session: %s", err)
-			}
 			return fantasy.NewTextResponse(result.Response.Content.Text()), nil
 		}), nil
 }
@@ -5,7 +5,6 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"time"
 
@@ -54,17 +53,8 @@ func validateAgenticFetchParams(ctx context.Context, params tools.AgenticFetchPa
 //go:embed templates/agentic_fetch_prompt.md.tpl
 var agenticFetchPromptTmpl []byte
 
-func (c *coordinator) agenticFetchTool(_ context.Context, client *http.Client) (fantasy.AgentTool, error) {
-	if client == nil {
-		client = &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     90 * time.Second,
-			},
-		}
-	}
+func (c *coordinator) agenticFetchTool(_ context.Context, opts tools.FetchOptions) (fantasy.AgentTool, error) {
+	client := opts.HTTPClient(30 * time.Second)
 
 	return fantasy.NewAgentTool(
 		tools.AgenticFetchToolName,
@@ -75,6 +65,10 @@ func (c *coordinator) agenticFetchTool(_ context.Context, client *http.Client) (
 				return fantasy.NewTextErrorResponse(err.Error()), nil
 			}
 
+			if err := opts.CheckURL(ctx, client, params.URL); err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+
 			p := c.permissions.Request(
 				permission.CreatePermissionRequest{
 					SessionID:   validationResult.SessionID,
@@ -91,7 +85,7 @@ func (c *coordinator) agenticFetchTool(_ context.Context, client *http.Client) (
 				return fantasy.ToolResponse{}, permission.ErrorPermissionDenied
 			}
 
-			content, err := tools.FetchURLAndConvert(ctx, client, params.URL)
+			content, err := tools.FetchURLAndConvert(ctx, client, params.URL, opts.ResponseLimit())
 			if err != nil {
 				return fantasy.NewTextErrorResponse(fmt.Sprintf("Failed to fetch URL: %s", err)), nil
 			}
@@ -147,7 +141,12 @@ func (c *coordinator) agenticFetchTool(_ context.Context, client *http.Client) (
 				return fantasy.ToolResponse{}, errors.New("small model provider not configured")
 			}
 
-			webFetchTool := tools.NewWebFetchTool(tmpDir, client)
+			webFetchTool := tools.NewWebFetchTool(tmpDir, tools.FetchOptions{
+				Client:           client,
+				Domains:          opts.Domains,
+				MaxResponseSize:  opts.MaxResponseSize,
+				RespectRobotsTxt: opts.RespectRobotsTxt,
+			})
 			fetchTools := []fantasy.AgentTool{
 				webFetchTool,
 				tools.NewGlobTool(tmpDir),
@@ -196,22 +195,6 @@ func (c *coordinator) agenticFetchTool(_ context.Context, client *http.Client) (
 				return fantasy.NewTextErrorResponse("error generating response"), nil
 			}
 
-			updatedSession, err := c.sessions.Get(ctx, session.ID)
-			if err != nil {
-				return fantasy.ToolResponse{}, fmt.Errorf("error getting session: %s", err)
-			}
-			parentSession, err := c.sessions.Get(ctx, validationResult.SessionID)
-			if err != nil {
-				return fantasy.ToolResponse{}, fmt.Errorf("error getting parent session: %s", err)
-			}
-
-			parentSession.Cost += updatedSession.Cost
-
-			_, err = c.sessions.Save(ctx, parentSession)
-			if err != nil {
-				return fantasy.ToolResponse{}, fmt.Errorf("error saving parent session: %s", err)
-			}
-
 			return fantasy.NewTextResponse(result.Response.Content.Text()), nil
 		}), nil
 }
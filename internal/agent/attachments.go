@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/mudaaaa/crushplus/internal/message"
+	"github.com/mudaaaa/crushplus/internal/pdf"
+)
+
+// nativePDFProviders are the types of the providers that take PDF documents
+// as file parts. The others drop them, so they get the text of the documents
+// instead.
+var nativePDFProviders = []catwalk.Type{
+	catwalk.TypeOpenAI,
+	catwalk.TypeOpenAICompat,
+	catwalk.TypeOpenRouter,
+	catwalk.TypeAzure,
+	catwalk.TypeGoogle,
+	catwalk.TypeVertexAI,
+}
+
+// prepareAttachments checks the attachments against the capabilities of the
+// model, and replaces the PDF documents the model can't read natively with
+// their text.
+func prepareAttachments(model Model, providerType catwalk.Type, attachments []message.Attachment) ([]message.Attachment, error) {
+	prepared := make([]message.Attachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		switch {
+		case attachment.IsText():
+		case strings.HasPrefix(attachment.MimeType, "image/"):
+			if !model.CatwalkCfg.SupportsImages {
+				return nil, fmt.Errorf("cannot attach %s: the model %s doesn't support images", attachment.FileName, model.CatwalkCfg.Name)
+			}
+		case attachment.MimeType == pdf.MIMEType:
+			if model.CatwalkCfg.SupportsImages && slices.Contains(nativePDFProviders, providerType) {
+				break
+			}
+			text, err := pdf.ExtractText(attachment.Content)
+			if err != nil {
+				return nil, fmt.Errorf("cannot attach %s: the model %s doesn't read PDF documents natively, and extracting their text failed: %w", attachment.FileName, model.CatwalkCfg.Name, err)
+			}
+			attachment.MimeType = "text/plain"
+			attachment.Content = []byte(text)
+		default:
+			return nil, fmt.Errorf("cannot attach %s: unsupported file type %s, only images, PDF documents and text files can be attached", attachment.FileName, attachment.MimeType)
+		}
+		prepared = append(prepared, attachment)
+	}
+	return prepared, nil
+}
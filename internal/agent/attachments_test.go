@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/mudaaaa/crushplus/internal/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareAttachments(t *testing.T) {
+	t.Parallel()
+
+	image := message.Attachment{FileName: "mockup.png", MimeType: "image/png", Content: []byte("png")}
+	doc := message.Attachment{FileName: "spec.pdf", MimeType: "application/pdf", Content: []byte("%PDF-1.4\n1 0 obj\n<< /Length 17 >>\nstream\nBT (Spec) Tj ET\nendstream\nendobj\n")}
+	text := message.Attachment{FileName: "notes.txt", MimeType: "text/plain", Content: []byte("notes")}
+	vision := Model{CatwalkCfg: catwalk.Model{Name: "vision", SupportsImages: true}}
+	textOnly := Model{CatwalkCfg: catwalk.Model{Name: "text-only"}}
+
+	t.Run("native", func(t *testing.T) {
+		t.Parallel()
+		prepared, err := prepareAttachments(vision, catwalk.TypeOpenAI, []message.Attachment{image, doc, text})
+		require.NoError(t, err)
+		require.Equal(t, []message.Attachment{image, doc, text}, prepared)
+	})
+
+	t.Run("pdf text", func(t *testing.T) {
+		t.Parallel()
+		for _, model := range []Model{vision, textOnly} {
+			prepared, err := prepareAttachments(model, catwalk.TypeAnthropic, []message.Attachment{doc, text})
+			require.NoError(t, err)
+			require.Len(t, prepared, 2)
+			require.Equal(t, "text/plain", prepared[0].MimeType)
+			require.Equal(t, "Spec", string(prepared[0].Content))
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		_, err := prepareAttachments(textOnly, catwalk.TypeOpenAI, []message.Attachment{image})
+		require.ErrorContains(t, err, "the model text-only doesn't support images")
+
+		_, err = prepareAttachments(vision, catwalk.TypeOpenAI, []message.Attachment{{FileName: "a.zip", MimeType: "application/zip"}})
+		require.ErrorContains(t, err, "unsupported file type application/zip")
+
+		_, err = prepareAttachments(vision, catwalk.TypeAnthropic, []message.Attachment{{FileName: "scan.pdf", MimeType: "application/pdf", Content: []byte("%PDF-1.4\n")}})
+		require.ErrorContains(t, err, "extracting their text failed")
+	})
+}
+
+func TestTextResourceAttachments(t *testing.T) {
+	t.Parallel()
+
+	schema := message.Attachment{
+		FilePath: "file:///schemas/user.json",
+		FileName: "user.json",
+		MimeType: "application/schema+json",
+		Content:  []byte(`{"type":"object"}`),
+	}
+	config := message.Attachment{FilePath: "config://app", FileName: "app", MimeType: "application/json; charset=utf-8", Content: []byte(`{"debug":true}`)}
+	model := Model{CatwalkCfg: catwalk.Model{Name: "text-only"}}
+
+	prepared, err := prepareAttachments(model, catwalk.TypeAnthropic, []message.Attachment{schema, config})
+	require.NoError(t, err)
+	require.Equal(t, []message.Attachment{schema, config}, prepared)
+
+	// The resources go in the prompt rather than as file parts.
+	_, files := (&sessionAgent{}).preparePrompt(nil, prepared...)
+	require.Empty(t, files)
+	prompt := promptWithTextAttachments("Check the schema", prepared)
+	require.Contains(t, prompt, message.TextAttachment(schema.FilePath, schema.Content))
+	require.Contains(t, prompt, message.TextAttachment(config.FilePath, config.Content))
+
+	// So do they once stored in the history.
+	msg := message.Message{Role: message.User, Parts: []message.ContentPart{
+		message.TextContent{Text: "Check the schema"},
+		message.BinaryContent{Path: schema.FilePath, MIMEType: schema.MimeType, Data: schema.Content},
+	}}
+	parts := msg.ToAIMessage()[0].Content
+	require.Len(t, parts, 2)
+	require.Equal(t, fantasy.TextPart{Text: message.TextAttachment(schema.FilePath, schema.Content)}, parts[1])
+}
@@ -25,6 +25,8 @@ import (
 	"github.com/mudaaaa/crushplus/internal/message"
 	"github.com/mudaaaa/crushplus/internal/permission"
 	"github.com/mudaaaa/crushplus/internal/session"
+	"github.com/mudaaaa/crushplus/internal/shellstate"
+	"github.com/mudaaaa/crushplus/internal/todo"
 	"github.com/stretchr/testify/require"
 
 	_ "github.com/joho/godotenv/autoload"
@@ -37,6 +39,8 @@ type fakeEnv struct {
 	messages    message.Service
 	permissions permission.Service
 	history     history.Service
+	todos       todo.Service
+	shells      shellstate.Service
 	lspClients  *csync.Map[string, *lsp.Client]
 }
 
@@ -117,6 +121,8 @@ func testEnv(t *testing.T) fakeEnv {
 
 	permissions := permission.NewPermissionService(workingDir, true, []string{})
 	history := history.NewService(q, conn)
+	todos := todo.NewService(q, conn)
+	shells := shellstate.NewService(q)
 	lspClients := csync.NewMap[string, *lsp.Client]()
 
 	t.Cleanup(func() {
@@ -130,6 +136,8 @@ func testEnv(t *testing.T) fakeEnv {
 		messages,
 		permissions,
 		history,
+		todos,
+		shells,
 		lspClients,
 	}
 }
@@ -149,7 +157,7 @@ func testSessionAgent(env fakeEnv, large, small fantasy.LanguageModel, systemPro
 			DefaultMaxTokens: 10000,
 		},
 	}
-	agent := NewSessionAgent(SessionAgentOptions{largeModel, smallModel, "", systemPrompt, false, true, env.sessions, env.messages, tools})
+	agent := NewSessionAgent(SessionAgentOptions{largeModel, smallModel, "", systemPrompt, false, true, env.sessions, env.messages, env.todos, tools, config.HistoryPruning{}})
 	return agent
 }
 
@@ -190,11 +198,11 @@ func coderAgent(r *vcr.Recorder, env fakeEnv, large, small fantasy.LanguageModel
 	}
 
 	allTools := []fantasy.AgentTool{
-		tools.NewBashTool(env.permissions, env.workingDir, cfg.Options.Attribution, modelName),
-		tools.NewDownloadTool(env.permissions, env.workingDir, r.GetDefaultClient()),
+		tools.NewBashTool(env.permissions, env.shells, env.workingDir, cfg.Options.Attribution, modelName),
+		tools.NewDownloadTool(env.permissions, env.workingDir, tools.FetchOptions{Client: r.GetDefaultClient()}),
 		tools.NewEditTool(env.lspClients, env.permissions, env.history, env.workingDir),
 		tools.NewMultiEditTool(env.lspClients, env.permissions, env.history, env.workingDir),
-		tools.NewFetchTool(env.permissions, env.workingDir, r.GetDefaultClient()),
+		tools.NewFetchTool(env.permissions, env.workingDir, tools.FetchOptions{Client: r.GetDefaultClient()}),
 		tools.NewGlobTool(env.workingDir),
 		tools.NewGrepTool(env.workingDir),
 		tools.NewLsTool(env.permissions, env.workingDir, cfg.Tools.Ls),
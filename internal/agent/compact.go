@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/message"
+)
+
+// summaryRequest is the prompt that asks for the summary, steered by the
+// user's instructions, if any.
+func summaryRequest(instructions string) string {
+	request := "Provide a detailed summary of our conversation above."
+	if instructions = strings.TrimSpace(instructions); instructions != "" {
+		request += "\n\nThe user asked the summary to focus on, and preserve in full detail, the following:\n\n<instructions>\n" + instructions + "\n</instructions>"
+	}
+	return request
+}
+
+// todosSection returns the todo list of the session to append to its summary,
+// so the agent can carry on with the pending todos after the summary.
+func (a *sessionAgent) todosSection(ctx context.Context, sessionID string) string {
+	if a.todos == nil {
+		return ""
+	}
+	list, err := a.todos.Get(ctx, sessionID)
+	if err != nil {
+		slog.Error("Failed to get the todos of the session", "error", err)
+		return ""
+	}
+	if len(list.Todos) == 0 {
+		return ""
+	}
+	return "\n\n## Todo List\n\nThe checklist kept with the todos tool, as it stands:\n\n" + list.String()
+}
+
+func (a *sessionAgent) summaryStreamCall(aiMsgs []fantasy.Message, instructions string, opts fantasy.ProviderOptions) fantasy.AgentStreamCall {
+	return fantasy.AgentStreamCall{
+		Prompt:          summaryRequest(instructions),
+		Messages:        aiMsgs,
+		ProviderOptions: opts,
+		PrepareStep: func(callContext context.Context, options fantasy.PrepareStepFunctionOptions) (_ context.Context, prepared fantasy.PrepareStepResult, err error) {
+			prepared.Messages = options.Messages
+			if a.systemPromptPrefix != "" {
+				prepared.Messages = append([]fantasy.Message{fantasy.NewSystemMessage(a.systemPromptPrefix)}, prepared.Messages...)
+			}
+			return callContext, prepared, nil
+		},
+	}
+}
+
+// GenerateSummary returns a summary of the session, focused on what the
+// instructions ask to preserve, without changing its history. The summary
+// can be edited before it's applied with ApplySummary.
+func (a *sessionAgent) GenerateSummary(ctx context.Context, sessionID, instructions string, opts fantasy.ProviderOptions) (string, error) {
+	if a.IsSessionBusy(sessionID) {
+		return "", ErrSessionBusy
+	}
+
+	currentSession, err := a.sessions.Get(ctx, sessionID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get session: %w", err)
+	}
+	msgs, err := a.getSessionMessages(ctx, currentSession)
+	if err != nil {
+		return "", err
+	}
+	if len(msgs) == 0 {
+		return "", ErrNothingToSummarize
+	}
+
+	aiMsgs, _ := a.preparePrompt(msgs)
+
+	genCtx, cancel := context.WithCancel(ctx)
+	a.activeRequests.Set(sessionID, cancel)
+	defer a.activeRequests.Del(sessionID)
+	defer cancel()
+
+	agent := fantasy.NewAgent(a.largeModel.Model,
+		fantasy.WithSystemPrompt(string(summaryPrompt)),
+	)
+	resp, err := agent.Stream(genCtx, a.summaryStreamCall(aiMsgs, instructions, opts))
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return "", ErrRequestCancelled
+		}
+		return "", err
+	}
+
+	if err := a.addSessionCost(ctx, sessionID, a.largeModel, resp.TotalUsage); err != nil {
+		return "", fmt.Errorf("failed to update session cost: %w", err)
+	}
+	return strings.TrimSpace(resp.Response.Content.Text()), nil
+}
+
+// ApplySummary adds the summary to the session and makes it the start of the
+// history sent to the model. The messages before it are kept, so they can
+// still be browsed.
+func (a *sessionAgent) ApplySummary(ctx context.Context, sessionID, summary string) error {
+	if a.IsSessionBusy(sessionID) {
+		return ErrSessionBusy
+	}
+	if strings.TrimSpace(summary) == "" {
+		return errors.New("summary is empty")
+	}
+
+	currentSession, err := a.sessions.Get(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session: %w", err)
+	}
+
+	summaryMessage, err := a.messages.Create(ctx, sessionID, message.CreateMessageParams{
+		Role:             message.Assistant,
+		Parts:            []message.ContentPart{message.TextContent{Text: summary + a.todosSection(ctx, sessionID)}},
+		Model:            a.largeModel.Model.Model(),
+		Provider:         a.largeModel.Model.Provider(),
+		IsSummaryMessage: true,
+	})
+	if err != nil {
+		return err
+	}
+	summaryMessage.AddFinish(message.FinishReasonEndTurn, "", "")
+	if err := a.messages.Update(ctx, summaryMessage); err != nil {
+		return err
+	}
+
+	currentSession.SummaryMessageID = summaryMessage.ID
+	currentSession.CompletionTokens = estimateTokens(len(summary))
+	currentSession.PromptTokens = 0
+	_, err = a.sessions.Save(ctx, currentSession)
+	return err
+}
@@ -0,0 +1,19 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummaryRequest(t *testing.T) {
+	t.Parallel()
+
+	base := summaryRequest("")
+	require.NotContains(t, base, "<instructions>")
+	require.Equal(t, base, summaryRequest("  \n "))
+
+	focused := summaryRequest("  keep the API decisions\n")
+	require.Contains(t, focused, base)
+	require.Contains(t, focused, "<instructions>\nkeep the API decisions\n</instructions>")
+}
@@ -11,6 +11,7 @@ import (
 	"log/slog"
 	"maps"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 
@@ -18,6 +19,8 @@ import (
 	"github.com/charmbracelet/catwalk/pkg/catwalk"
 	"github.com/mudaaaa/crushplus/internal/agent/prompt"
 	"github.com/mudaaaa/crushplus/internal/agent/tools"
+	"github.com/mudaaaa/crushplus/internal/agent/tools/mcp"
+	"github.com/mudaaaa/crushplus/internal/codeindex"
 	"github.com/mudaaaa/crushplus/internal/config"
 	"github.com/mudaaaa/crushplus/internal/csync"
 	"github.com/mudaaaa/crushplus/internal/history"
@@ -25,7 +28,11 @@ import (
 	"github.com/mudaaaa/crushplus/internal/lsp"
 	"github.com/mudaaaa/crushplus/internal/message"
 	"github.com/mudaaaa/crushplus/internal/permission"
+	"github.com/mudaaaa/crushplus/internal/redact"
+	"github.com/mudaaaa/crushplus/internal/repomap"
 	"github.com/mudaaaa/crushplus/internal/session"
+	"github.com/mudaaaa/crushplus/internal/shellstate"
+	"github.com/mudaaaa/crushplus/internal/todo"
 	"golang.org/x/sync/errgroup"
 
 	"charm.land/fantasy/providers/anthropic"
@@ -43,6 +50,13 @@ type Coordinator interface {
 	// INFO: (kujtim) this is not used yet we will use this when we have multiple agents
 	// SetMainAgent(string)
 	Run(ctx context.Context, sessionID, prompt string, attachments ...message.Attachment) (*fantasy.AgentResult, error)
+	// Plan runs the agent in plan mode, with read-only tools, to come up with
+	// a plan that is returned as the text of the result.
+	Plan(ctx context.Context, sessionID, prompt string, attachments ...message.Attachment) (*fantasy.AgentResult, error)
+	// ExecutePlan pins the approved plan to the session and runs the agent to
+	// carry it out. The plan is unpinned once it's carried out, or when a new
+	// plan is made.
+	ExecutePlan(ctx context.Context, sessionID, plan string) (*fantasy.AgentResult, error)
 	Cancel(sessionID string)
 	CancelAll()
 	IsSessionBusy(sessionID string) bool
@@ -50,6 +64,9 @@ type Coordinator interface {
 	QueuedPrompts(sessionID string) int
 	ClearQueue(sessionID string)
 	Summarize(context.Context, string) error
+	GenerateSummary(ctx context.Context, sessionID, instructions string) (string, error)
+	ApplySummary(ctx context.Context, sessionID, summary string) error
+	Sample(context.Context, SampleCall) (*SampleResult, error)
 	Model() Model
 	UpdateModels(ctx context.Context) error
 }
@@ -60,8 +77,18 @@ type coordinator struct {
 	messages    message.Service
 	permissions permission.Service
 	history     history.Service
+	todos       todo.Service
+	shells      shellstate.Service
+	redactor    *redact.Redactor
+	codeIndex   *codeindex.Index
+	repoMap     *repomap.Map
 	lspClients  *csync.Map[string, *lsp.Client]
 
+	// prompt is the system prompt of the coder agent.
+	prompt *prompt.Prompt
+	// systemPrompt is the system prompt last rebuilt for new sessions, empty
+	// until the files change.
+	systemPrompt *csync.Value[string]
 	currentAgent SessionAgent
 	agents       map[string]SessionAgent
 
@@ -75,6 +102,10 @@ func NewCoordinator(
 	messages message.Service,
 	permissions permission.Service,
 	history history.Service,
+	todos todo.Service,
+	shells shellstate.Service,
+	redactor *redact.Redactor,
+	codeIndex *codeindex.Index,
 	lspClients *csync.Map[string, *lsp.Client],
 ) (Coordinator, error) {
 	c := &coordinator{
@@ -83,8 +114,14 @@ func NewCoordinator(
 		messages:    messages,
 		permissions: permissions,
 		history:     history,
+		todos:       todos,
+		shells:      shells,
+		redactor:    redactor,
+		codeIndex:   codeIndex,
 		lspClients:  lspClients,
 		agents:      make(map[string]SessionAgent),
+
+		systemPrompt: csync.NewValue(""),
 	}
 
 	agentCfg, ok := cfg.Agents[config.AgentCoder]
@@ -92,16 +129,29 @@ func NewCoordinator(
 		return nil, errors.New("coder agent not configured")
 	}
 
+	if codeIndex != nil {
+		c.repoMap = repomap.New(codeIndex, history)
+	}
+
 	// TODO: make this dynamic when we support multiple agents
-	prompt, err := coderPrompt(prompt.WithWorkingDir(c.cfg.WorkingDir()))
+	prompt, err := coderPrompt(prompt.WithWorkingDir(c.cfg.WorkingDir()), prompt.WithRepoMap(c.repoMap))
 	if err != nil {
 		return nil, err
 	}
+	c.prompt = prompt
 
 	agent, err := c.buildAgent(ctx, prompt, agentCfg)
 	if err != nil {
 		return nil, err
 	}
+	c.readyWg.Go(func() error {
+		planTools, err := c.buildTools(ctx, planAgent(agentCfg))
+		if err != nil {
+			return err
+		}
+		agent.SetPlanTools(planTools)
+		return nil
+	})
 	c.currentAgent = agent
 	c.agents[config.AgentCoder] = agent
 	return c, nil
@@ -109,9 +159,65 @@ func NewCoordinator(
 
 // Run implements Coordinator.
 func (c *coordinator) Run(ctx context.Context, sessionID string, prompt string, attachments ...message.Attachment) (*fantasy.AgentResult, error) {
+	return c.run(ctx, SessionAgentCall{
+		SessionID:   sessionID,
+		Prompt:      prompt,
+		Attachments: attachments,
+	})
+}
+
+// Plan implements Coordinator.
+func (c *coordinator) Plan(ctx context.Context, sessionID string, prompt string, attachments ...message.Attachment) (*fantasy.AgentResult, error) {
+	result, err := c.run(ctx, SessionAgentCall{
+		SessionID:   sessionID,
+		Prompt:      prompt,
+		Attachments: attachments,
+		Plan:        true,
+	})
+	// The new plan replaces the one pinned before, approved or not.
+	if err == nil && result != nil {
+		c.unpinPlan(ctx, sessionID)
+	}
+	return result, err
+}
+
+// ExecutePlan implements Coordinator.
+func (c *coordinator) ExecutePlan(ctx context.Context, sessionID, plan string) (*fantasy.AgentResult, error) {
+	if strings.TrimSpace(plan) == "" {
+		return nil, errors.New("plan is empty")
+	}
+	if err := c.currentAgent.PinPlan(ctx, sessionID, plan); err != nil {
+		return nil, fmt.Errorf("failed to pin the plan: %w", err)
+	}
+	result, err := c.run(ctx, SessionAgentCall{
+		SessionID: sessionID,
+		Prompt:    ExecutePlanPrompt,
+	})
+	// A run that fails or is canceled leaves the plan pinned, for the next
+	// prompts of the session to carry it on. A nil result means the run was
+	// queued, and the plan isn't carried out yet.
+	if err == nil && result != nil {
+		c.unpinPlan(ctx, sessionID)
+	}
+	return result, err
+}
+
+// unpinPlan unpins the plan of the session. Failing to is only logged, since
+// the run it follows succeeded.
+func (c *coordinator) unpinPlan(ctx context.Context, sessionID string) {
+	if err := c.currentAgent.PinPlan(ctx, sessionID, ""); err != nil {
+		slog.Error("Failed to unpin the plan", "session_id", sessionID, "error", err)
+	}
+}
+
+// run fills in the call with the options of the model and runs it.
+func (c *coordinator) run(ctx context.Context, call SessionAgentCall) (*fantasy.AgentResult, error) {
 	if err := c.readyWg.Wait(); err != nil {
 		return nil, err
 	}
+	if err := c.refreshSystemPrompt(ctx, call.SessionID); err != nil {
+		return nil, err
+	}
 
 	model := c.currentAgent.Model()
 	maxTokens := model.CatwalkCfg.DefaultMaxTokens
@@ -119,29 +225,63 @@ func (c *coordinator) Run(ctx context.Context, sessionID string, prompt string,
 		maxTokens = model.ModelCfg.MaxTokens
 	}
 
-	if !model.CatwalkCfg.SupportsImages && attachments != nil {
-		attachments = nil
-	}
-
 	providerCfg, ok := c.cfg.Providers.Get(model.ModelCfg.Provider)
 	if !ok {
 		return nil, errors.New("model provider not configured")
 	}
 
+	attachments, err := prepareAttachments(model, providerCfg.Type, call.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	call.Attachments = attachments
+
 	mergedOptions, temp, topP, topK, freqPenalty, presPenalty := mergeCallOptions(model, providerCfg)
 
-	return c.currentAgent.Run(ctx, SessionAgentCall{
-		SessionID:        sessionID,
-		Prompt:           prompt,
-		Attachments:      attachments,
-		MaxOutputTokens:  maxTokens,
-		ProviderOptions:  mergedOptions,
-		Temperature:      temp,
-		TopP:             topP,
-		TopK:             topK,
-		FrequencyPenalty: freqPenalty,
-		PresencePenalty:  presPenalty,
-	})
+	call.MaxOutputTokens = maxTokens
+	call.ProviderOptions = mergedOptions
+	call.Temperature = temp
+	call.TopP = topP
+	call.TopK = topK
+	call.FrequencyPenalty = freqPenalty
+	call.PresencePenalty = presPenalty
+	return c.currentAgent.Run(ctx, call)
+}
+
+// refreshSystemPrompt builds the system prompt again when a session starts
+// after files changed, for its repository map to be up to date, and gives
+// the last one rebuilt to the new sessions. The prompt of a session isn't
+// rebuilt once it started, neither by its own edits nor by the other
+// sessions, to not defeat prompt caching.
+func (c *coordinator) refreshSystemPrompt(ctx context.Context, sessionID string) error {
+	if c.repoMap == nil || c.cfg.Options.RepoMap == nil || !c.cfg.Options.RepoMap.Enabled {
+		return nil
+	}
+	msgs, err := c.messages.List(ctx, sessionID)
+	if err != nil || len(msgs) > 0 {
+		return err
+	}
+	systemPrompt := c.systemPrompt.Get()
+	if c.repoMap.Changed() {
+		model := c.currentAgent.Model()
+		systemPrompt, err = c.prompt.Build(ctx, model.Model.Provider(), model.Model.Model(), *c.cfg)
+		if err != nil {
+			return err
+		}
+		c.systemPrompt.Set(systemPrompt)
+	}
+	if systemPrompt != "" {
+		c.currentAgent.SetSessionSystemPrompt(sessionID, systemPrompt)
+	}
+	return nil
+}
+
+// planAgent returns the configuration of the agent in plan mode: its
+// read-only and LSP tools, without MCPs.
+func planAgent(agent config.Agent) config.Agent {
+	agent.AllowedTools = config.PlanTools(agent.AllowedTools)
+	agent.AllowedMCP = map[string][]string{}
+	return agent
 }
 
 func getProviderOptions(model Model, providerCfg config.ProviderConfig) fantasy.ProviderOptions {
@@ -275,10 +415,32 @@ func mergeCallOptions(model Model, cfg config.ProviderConfig) (fantasy.ProviderO
 }
 
 func (c *coordinator) buildAgent(ctx context.Context, prompt *prompt.Prompt, agent config.Agent) (SessionAgent, error) {
+	result, err := c.newSessionAgent(ctx, prompt, agent.Model)
+	if err != nil {
+		return nil, err
+	}
+	c.readyWg.Go(func() error {
+		tools, err := c.buildTools(ctx, agent)
+		if err != nil {
+			return err
+		}
+		result.SetTools(tools)
+		return nil
+	})
+
+	return result, nil
+}
+
+// newSessionAgent returns an agent with the system prompt, without any tools,
+// that runs on the selected model of the given type.
+func (c *coordinator) newSessionAgent(ctx context.Context, prompt *prompt.Prompt, model config.SelectedModelType) (SessionAgent, error) {
 	large, small, err := c.buildAgentModels(ctx)
 	if err != nil {
 		return nil, err
 	}
+	if model == config.SelectedModelTypeSmall {
+		large = small
+	}
 
 	systemPrompt, err := prompt.Build(ctx, large.Model.Provider(), large.Model.Model(), *c.cfg)
 	if err != nil {
@@ -286,7 +448,11 @@ func (c *coordinator) buildAgent(ctx context.Context, prompt *prompt.Prompt, age
 	}
 
 	largeProviderCfg, _ := c.cfg.Providers.Get(large.ModelCfg.Provider)
-	result := NewSessionAgent(SessionAgentOptions{
+	var historyPruning config.HistoryPruning
+	if c.cfg.Options.HistoryPruning != nil {
+		historyPruning = *c.cfg.Options.HistoryPruning
+	}
+	return NewSessionAgent(SessionAgentOptions{
 		large,
 		small,
 		largeProviderCfg.SystemPromptPrefix,
@@ -295,18 +461,10 @@ func (c *coordinator) buildAgent(ctx context.Context, prompt *prompt.Prompt, age
 		c.permissions.SkipRequests(),
 		c.sessions,
 		c.messages,
+		c.todos,
 		nil,
-	})
-	c.readyWg.Go(func() error {
-		tools, err := c.buildTools(ctx, agent)
-		if err != nil {
-			return err
-		}
-		result.SetTools(tools)
-		return nil
-	})
-
-	return result, nil
+		historyPruning,
+	}), nil
 }
 
 func (c *coordinator) buildTools(ctx context.Context, agent config.Agent) ([]fantasy.AgentTool, error) {
@@ -320,33 +478,38 @@ func (c *coordinator) buildTools(ctx context.Context, agent config.Agent) ([]fan
 	}
 
 	if slices.Contains(agent.AllowedTools, tools.AgenticFetchToolName) {
-		agenticFetchTool, err := c.agenticFetchTool(ctx, nil)
+		agenticFetchTool, err := c.agenticFetchTool(ctx, c.fetchOptions())
 		if err != nil {
 			return nil, err
 		}
 		allTools = append(allTools, agenticFetchTool)
 	}
 
-	// Get the model name for the agent
-	modelName := ""
-	if modelCfg, ok := c.cfg.Models[agent.Model]; ok {
-		if model := c.cfg.GetModel(modelCfg.Provider, modelCfg.Model); model != nil {
-			modelName = model.Name
-		}
+	if slices.Contains(agent.AllowedTools, ParallelAgentsToolName) {
+		allTools = append(allTools, c.parallelAgentsTool())
 	}
 
 	allTools = append(allTools,
-		tools.NewBashTool(c.permissions, c.cfg.WorkingDir(), c.cfg.Options.Attribution, modelName),
+		tools.NewBashTool(c.permissions, c.shells, c.cfg.WorkingDir(), c.cfg.Options.Attribution, c.modelName(agent)),
 		tools.NewJobOutputTool(),
 		tools.NewJobKillTool(),
-		tools.NewDownloadTool(c.permissions, c.cfg.WorkingDir(), nil),
+		tools.NewJobWaitTool(),
+		tools.NewJobInputTool(c.permissions),
+		tools.NewCodeSearchTool(c.codeIndex, c.cfg.WorkingDir()),
+		tools.NewDownloadTool(c.permissions, c.cfg.WorkingDir(), c.fetchOptions()),
 		tools.NewEditTool(c.lspClients, c.permissions, c.history, c.cfg.WorkingDir()),
 		tools.NewMultiEditTool(c.lspClients, c.permissions, c.history, c.cfg.WorkingDir()),
-		tools.NewFetchTool(c.permissions, c.cfg.WorkingDir(), nil),
+		tools.NewFetchTool(c.permissions, c.cfg.WorkingDir(), c.fetchOptions()),
+		tools.NewGitStatusTool(c.cfg.WorkingDir()),
+		tools.NewGitDiffTool(c.cfg.WorkingDir()),
+		tools.NewGitCommitTool(c.permissions, c.cfg.WorkingDir(), c.cfg.Options.Attribution, c.modelName(agent), c.redactor),
 		tools.NewGlobTool(c.cfg.WorkingDir()),
 		tools.NewGrepTool(c.cfg.WorkingDir()),
 		tools.NewLsTool(c.permissions, c.cfg.WorkingDir(), c.cfg.Tools.Ls),
+		tools.NewMergeAgentPatchTool(c.permissions, c.cfg.WorkingDir(), c.cfg.Options.DataDirectory),
 		tools.NewSourcegraphTool(nil),
+		tools.NewTestTool(c.permissions, c.shells, c.cfg.WorkingDir()),
+		tools.NewTodosTool(c.todos),
 		tools.NewViewTool(c.lspClients, c.permissions, c.cfg.WorkingDir()),
 		tools.NewWriteTool(c.lspClients, c.permissions, c.history, c.cfg.WorkingDir()),
 	)
@@ -355,6 +518,13 @@ func (c *coordinator) buildTools(ctx context.Context, agent config.Agent) ([]fan
 		allTools = append(allTools, tools.NewDiagnosticsTool(c.lspClients), tools.NewReferencesTool(c.lspClients))
 	}
 
+	if mcp.HasResources() {
+		allTools = append(allTools,
+			tools.NewMCPListResourcesTool(),
+			tools.NewMCPReadResourceTool(c.permissions, c.cfg.WorkingDir()),
+		)
+	}
+
 	var filteredTools []fantasy.AgentTool
 	for _, tool := range allTools {
 		if slices.Contains(agent.AllowedTools, tool.Info().Name) {
@@ -387,7 +557,37 @@ func (c *coordinator) buildTools(ctx context.Context, agent config.Agent) ([]fan
 	slices.SortFunc(filteredTools, func(a, b fantasy.AgentTool) int {
 		return strings.Compare(a.Info().Name, b.Info().Name)
 	})
-	return filteredTools, nil
+
+	return tools.WithResultLimits(filteredTools, c.redactor, c.cfg.Tools.Output, c.cfg.Options.DataDirectory), nil
+}
+
+// fetchOptions returns the cache, the limits and the domain policy of the
+// tools that fetch and download URLs.
+func (c *coordinator) fetchOptions() tools.FetchOptions {
+	opts := tools.FetchOptions{CacheDir: filepath.Join(c.cfg.Options.DataDirectory, "fetch_cache")}
+	if p := c.cfg.Permissions; p != nil {
+		opts.Domains = permission.NewDomainPolicy(p.AllowedDomains, p.DeniedDomains)
+	}
+	if f := c.cfg.Options.Fetch; f != nil {
+		opts.MaxResponseSize = f.MaxResponseSize
+		opts.MaxDownloadSize = f.MaxDownloadSize
+		opts.RespectRobotsTxt = f.RespectRobotsTxt
+		if f.DisableCache {
+			opts.CacheDir = ""
+		}
+	}
+	return opts
+}
+
+// modelName returns the name of the model of the agent, for the attribution
+// of the commits made with the bash tool.
+func (c *coordinator) modelName(agent config.Agent) string {
+	if modelCfg, ok := c.cfg.Models[agent.Model]; ok {
+		if model := c.cfg.GetModel(modelCfg.Provider, modelCfg.Model); model != nil {
+			return model.Name
+		}
+	}
+	return ""
 }
 
 // TODO: when we support multiple agents we need to change this so that we pass in the agent specific model config
@@ -751,6 +951,12 @@ func (c *coordinator) UpdateModels(ctx context.Context) error {
 		return err
 	}
 	c.currentAgent.SetTools(tools)
+
+	planTools, err := c.buildTools(ctx, planAgent(agentCfg))
+	if err != nil {
+		return err
+	}
+	c.currentAgent.SetPlanTools(planTools)
 	return nil
 }
 
@@ -758,6 +964,10 @@ func (c *coordinator) QueuedPrompts(sessionID string) int {
 	return c.currentAgent.QueuedPrompts(sessionID)
 }
 
+func (c *coordinator) Sample(ctx context.Context, call SampleCall) (*SampleResult, error) {
+	return c.currentAgent.Sample(ctx, call)
+}
+
 func (c *coordinator) Summarize(ctx context.Context, sessionID string) error {
 	providerCfg, ok := c.cfg.Providers.Get(c.currentAgent.Model().ModelCfg.Provider)
 	if !ok {
@@ -766,3 +976,15 @@ func (c *coordinator) Summarize(ctx context.Context, sessionID string) error {
 	return c.currentAgent.Summarize(ctx, sessionID, getProviderOptions(c.currentAgent.Model(), providerCfg))
 }
 
+func (c *coordinator) GenerateSummary(ctx context.Context, sessionID, instructions string) (string, error) {
+	providerCfg, ok := c.cfg.Providers.Get(c.currentAgent.Model().ModelCfg.Provider)
+	if !ok {
+		return "", errors.New("model provider not configured")
+	}
+	return c.currentAgent.GenerateSummary(ctx, sessionID, instructions, getProviderOptions(c.currentAgent.Model(), providerCfg))
+}
+
+func (c *coordinator) ApplySummary(ctx context.Context, sessionID, summary string) error {
+	return c.currentAgent.ApplySummary(ctx, sessionID, summary)
+}
+
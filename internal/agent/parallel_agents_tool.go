@@ -0,0 +1,257 @@
+package agent
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"charm.land/fantasy"
+	"github.com/google/uuid"
+
+	"github.com/mudaaaa/crushplus/internal/agent/prompt"
+	"github.com/mudaaaa/crushplus/internal/agent/tools"
+	"github.com/mudaaaa/crushplus/internal/config"
+	"github.com/mudaaaa/crushplus/internal/csync"
+	"github.com/mudaaaa/crushplus/internal/lsp"
+	"github.com/mudaaaa/crushplus/internal/shell"
+	"github.com/mudaaaa/crushplus/internal/worktree"
+)
+
+//go:embed templates/parallel_agents_tool.md
+var parallelAgentsToolDescription []byte
+
+const (
+	ParallelAgentsToolName = "parallel_agents"
+
+	// maxParallelAgents is the most sub-agents that can run at once.
+	maxParallelAgents = 5
+)
+
+type ParallelAgentTask struct {
+	Description string `json:"description" description:"A short description of the task, used as its title"`
+	Prompt      string `json:"prompt" description:"The self-contained task for the sub-agent to perform"`
+}
+
+type ParallelAgentsParams struct {
+	Tasks []ParallelAgentTask `json:"tasks" description:"The independent tasks to run in parallel, one sub-agent each"`
+}
+
+// worktreeTaskPrompt tells the sub-agent where it works and what happens to
+// its changes.
+const worktreeTaskPrompt = `You are working in an isolated git worktree at %s, a checkout of the current state of the repository. Your changes will be handed back as a patch to review and merge, so make them in place and don't commit them. Verify your changes, then reply with a short report of what you changed and how you verified it.
+
+<task>
+%s
+</task>`
+
+// parallelAgentResult is the outcome of a task of the parallel agents tool.
+type parallelAgentResult struct {
+	task     ParallelAgentTask
+	patchID  string
+	stat     string
+	response string
+	err      error
+}
+
+func (c *coordinator) parallelAgentsTool() fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		ParallelAgentsToolName,
+		string(parallelAgentsToolDescription),
+		func(ctx context.Context, params ParallelAgentsParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if len(params.Tasks) == 0 {
+				return fantasy.NewTextErrorResponse("at least one task is required"), nil
+			}
+			if len(params.Tasks) > maxParallelAgents {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("at most %d tasks can run in parallel", maxParallelAgents)), nil
+			}
+			for i, task := range params.Tasks {
+				if strings.TrimSpace(task.Prompt) == "" {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("task %d has no prompt", i+1)), nil
+				}
+			}
+
+			sessionID := tools.GetSessionFromContext(ctx)
+			if sessionID == "" {
+				return fantasy.ToolResponse{}, errors.New("session id missing from context")
+			}
+			agentMessageID := tools.GetMessageFromContext(ctx)
+			if agentMessageID == "" {
+				return fantasy.ToolResponse{}, errors.New("agent message id missing from context")
+			}
+
+			base, err := worktree.Base(ctx, c.cfg.WorkingDir())
+			if errors.Is(err, worktree.ErrNotRepository) {
+				return fantasy.NewTextErrorResponse("parallel agents need the working directory to be in a git repository"), nil
+			} else if err != nil {
+				return fantasy.ToolResponse{}, fmt.Errorf("error getting the base of the worktrees: %w", err)
+			}
+
+			runID := uuid.NewString()[:8]
+			results := make([]parallelAgentResult, len(params.Tasks))
+			var wg sync.WaitGroup
+			for i, task := range params.Tasks {
+				wg.Go(func() {
+					results[i] = c.runWorktreeTask(ctx, task, worktreeTaskParams{
+						id:              fmt.Sprintf("%s-%d", runID, i+1),
+						base:            base,
+						parentSessionID: sessionID,
+						sessionID:       c.sessions.CreateAgentToolSessionID(agentMessageID, fmt.Sprintf("%s-%d", call.ID, i+1)),
+					})
+				})
+			}
+			wg.Wait()
+
+			return fantasy.NewTextResponse(c.parallelAgentsReport(results)), nil
+		})
+}
+
+type worktreeTaskParams struct {
+	id              string
+	base            string
+	parentSessionID string
+	sessionID       string
+}
+
+// runWorktreeTask runs the task with a sub-agent in a new worktree, and saves
+// its changes as a patch. The worktree is removed once done.
+func (c *coordinator) runWorktreeTask(ctx context.Context, task ParallelAgentTask, params worktreeTaskParams) (result parallelAgentResult) {
+	result.task = task
+	repoDir := c.cfg.WorkingDir()
+	dataDir := c.cfg.Options.DataDirectory
+
+	wt, err := worktree.Create(ctx, repoDir, dataDir, params.id, params.base)
+	if err != nil {
+		result.err = fmt.Errorf("error creating worktree: %w", err)
+		return result
+	}
+	defer wt.Remove(context.WithoutCancel(ctx), repoDir)
+
+	agentCfg := c.cfg.Agents[config.AgentCoder]
+	prompt, err := coderPrompt(prompt.WithWorkingDir(wt.Dir))
+	if err != nil {
+		result.err = err
+		return result
+	}
+	agent, err := c.newSessionAgent(ctx, prompt, agentCfg.Model)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	agent.SetTools(c.worktreeTools(wt.Dir, agentCfg))
+
+	title := task.Description
+	if title == "" {
+		title = "Parallel Agent Session"
+	}
+	session, err := c.sessions.CreateTaskSession(ctx, params.sessionID, params.parentSessionID, title)
+	if err != nil {
+		result.err = fmt.Errorf("error creating session: %w", err)
+		return result
+	}
+
+	model := agent.Model()
+	maxTokens := model.CatwalkCfg.DefaultMaxTokens
+	if model.ModelCfg.MaxTokens != 0 {
+		maxTokens = model.ModelCfg.MaxTokens
+	}
+	providerCfg, ok := c.cfg.Providers.Get(model.ModelCfg.Provider)
+	if !ok {
+		result.err = errors.New("model provider not configured")
+		return result
+	}
+	response, err := agent.Run(ctx, SessionAgentCall{
+		SessionID:        session.ID,
+		Prompt:           fmt.Sprintf(worktreeTaskPrompt, wt.Dir, task.Prompt),
+		MaxOutputTokens:  maxTokens,
+		ProviderOptions:  getProviderOptions(model, providerCfg),
+		Temperature:      model.ModelCfg.Temperature,
+		TopP:             model.ModelCfg.TopP,
+		TopK:             model.ModelCfg.TopK,
+		FrequencyPenalty: model.ModelCfg.FrequencyPenalty,
+		PresencePenalty:  model.ModelCfg.PresencePenalty,
+	})
+	if err != nil {
+		result.err = fmt.Errorf("error generating response: %w", err)
+	} else {
+		result.response = response.Response.Content.Text()
+	}
+	// The jobs of the sub-agent would outlive its worktree.
+	shell.GetBackgroundShellManager().KillSession(session.ID)
+
+	// Keep the changes even when the agent failed half way.
+	patch, stat, err := wt.Diff(ctx)
+	if err != nil {
+		result.err = errors.Join(result.err, fmt.Errorf("error getting changes: %w", err))
+		return result
+	}
+	if patch == "" {
+		return result
+	}
+	if err := os.WriteFile(worktree.PatchPath(dataDir, wt.ID), []byte(patch), 0o600); err != nil {
+		result.err = errors.Join(result.err, fmt.Errorf("error saving patch: %w", err))
+		return result
+	}
+	result.patchID = wt.ID
+	result.stat = stat
+	return result
+}
+
+// worktreeTools returns the coding tools of the agent, working in the
+// worktree. They go without the LSPs, which only know the main tree.
+func (c *coordinator) worktreeTools(workingDir string, agent config.Agent) []fantasy.AgentTool {
+	lspClients := csync.NewMap[string, *lsp.Client]()
+	allTools := []fantasy.AgentTool{
+		tools.NewBashTool(c.permissions, c.shells, workingDir, c.cfg.Options.Attribution, c.modelName(agent)),
+		tools.NewJobOutputTool(),
+		tools.NewJobKillTool(),
+		tools.NewJobWaitTool(),
+		tools.NewJobInputTool(c.permissions),
+		tools.NewEditTool(lspClients, c.permissions, c.history, workingDir),
+		tools.NewMultiEditTool(lspClients, c.permissions, c.history, workingDir),
+		tools.NewGitStatusTool(workingDir),
+		tools.NewGitDiffTool(workingDir),
+		tools.NewGlobTool(workingDir),
+		tools.NewGrepTool(workingDir),
+		tools.NewLsTool(c.permissions, workingDir, c.cfg.Tools.Ls),
+		tools.NewTestTool(c.permissions, c.shells, workingDir),
+		tools.NewViewTool(lspClients, c.permissions, workingDir),
+		tools.NewWriteTool(lspClients, c.permissions, c.history, workingDir),
+	}
+	var filteredTools []fantasy.AgentTool
+	for _, tool := range allTools {
+		if slices.Contains(agent.AllowedTools, tool.Info().Name) {
+			filteredTools = append(filteredTools, tool)
+		}
+	}
+	return tools.WithResultLimits(filteredTools, c.redactor, c.cfg.Tools.Output, c.cfg.Options.DataDirectory)
+}
+
+func (c *coordinator) parallelAgentsReport(results []parallelAgentResult) string {
+	var sb strings.Builder
+	for i, result := range results {
+		title := result.task.Description
+		if title == "" {
+			title = fmt.Sprintf("Task %d", i+1)
+		}
+		fmt.Fprintf(&sb, "## %d. %s\n\n", i+1, title)
+		if result.patchID != "" {
+			fmt.Fprintf(&sb, "Patch: %s (%s)\nPatch file: %s\n", result.patchID, result.stat, worktree.PatchPath(c.cfg.Options.DataDirectory, result.patchID))
+		} else {
+			sb.WriteString("No changes.\n")
+		}
+		if result.err != nil {
+			fmt.Fprintf(&sb, "Error: %s\n", result.err)
+		}
+		if response := strings.TrimSpace(result.response); response != "" {
+			fmt.Fprintf(&sb, "\n%s\n", response)
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("Review the patches, then merge or discard each of them with the merge_agent_patch tool.")
+	return sb.String()
+}
@@ -0,0 +1,41 @@
+package agent
+
+import (
+	"context"
+	"strings"
+
+	"charm.land/fantasy"
+)
+
+// ExecutePlanPrompt is the prompt that starts the execution of an approved
+// plan.
+const ExecutePlanPrompt = "The plan is approved. Carry it out now, step by step."
+
+// SetPlanTools sets the tools the agent can use in plan mode.
+func (a *sessionAgent) SetPlanTools(tools []fantasy.AgentTool) {
+	a.planTools = tools
+}
+
+// PinPlan pins the plan to the context of the session, so it stays in view
+// of the agent while it's carried out, summaries included. It's saved with
+// the session, for resumed sessions to keep it. An empty plan unpins it.
+func (a *sessionAgent) PinPlan(ctx context.Context, sessionID, plan string) error {
+	return a.sessions.SetPlan(ctx, sessionID, strings.TrimSpace(plan))
+}
+
+// runSetup returns the system prompt and the tools of a run: the read-only
+// tools and the planning instructions in plan mode, and the full toolset
+// with the approved plan pinned to the session otherwise.
+func (a *sessionAgent) runSetup(call SessionAgentCall, plan string) (string, []fantasy.AgentTool) {
+	systemPrompt := a.systemPrompt
+	if p, ok := a.sessionPrompts.Get(call.SessionID); ok {
+		systemPrompt = p
+	}
+	if call.Plan {
+		return systemPrompt + "\n\n" + planPrompt, a.planTools
+	}
+	if plan != "" {
+		return systemPrompt + "\n\n<approved_plan>\nThe user approved the following plan. Follow it, and tell the user when you need to deviate from it.\n\n" + plan + "\n</approved_plan>", a.tools
+	}
+	return systemPrompt, a.tools
+}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"sync"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/csync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunSetup(t *testing.T) {
+	t.Parallel()
+
+	tools := []fantasy.AgentTool{nil, nil}
+	planTools := []fantasy.AgentTool{nil}
+	a := &sessionAgent{
+		systemPrompt:   "system",
+		tools:          tools,
+		planTools:      planTools,
+		sessionPrompts: csync.NewMap[string, string](),
+	}
+
+	systemPrompt, got := a.runSetup(SessionAgentCall{SessionID: "s"}, "")
+	require.Equal(t, "system", systemPrompt)
+	require.Len(t, got, 2)
+
+	systemPrompt, got = a.runSetup(SessionAgentCall{SessionID: "s", Plan: true}, "# Plan: do it")
+	require.Contains(t, systemPrompt, "<plan_mode>")
+	require.NotContains(t, systemPrompt, "<approved_plan>")
+	require.Len(t, got, 1)
+
+	systemPrompt, got = a.runSetup(SessionAgentCall{SessionID: "s"}, "# Plan: do it")
+	require.Contains(t, systemPrompt, "<approved_plan>")
+	require.Contains(t, systemPrompt, "# Plan: do it\n</approved_plan>")
+	require.Len(t, got, 2)
+}
+
+func TestPinPlan(t *testing.T) {
+	t.Parallel()
+
+	env := testEnv(t)
+	a := &sessionAgent{sessions: env.sessions}
+	sess, err := env.sessions.Create(t.Context(), "plan")
+	require.NoError(t, err)
+
+	require.NoError(t, a.PinPlan(t.Context(), sess.ID, "  # Plan: do it\n"))
+	pinned, err := env.sessions.Get(t.Context(), sess.ID)
+	require.NoError(t, err)
+	require.Equal(t, "# Plan: do it", pinned.Plan)
+
+	// Runs save the session they keep in memory without overwriting the
+	// plan.
+	_, err = env.sessions.Save(t.Context(), sess)
+	require.NoError(t, err)
+	saved, err := env.sessions.Get(t.Context(), sess.ID)
+	require.NoError(t, err)
+	require.Equal(t, "# Plan: do it", saved.Plan)
+
+	require.NoError(t, a.PinPlan(t.Context(), sess.ID, ""))
+	unpinned, err := env.sessions.Get(t.Context(), sess.ID)
+	require.NoError(t, err)
+	require.Empty(t, unpinned.Plan)
+}
+
+func TestSetSessionSystemPrompt(t *testing.T) {
+	t.Parallel()
+
+	a := &sessionAgent{
+		systemPrompt:   "system",
+		sessionPrompts: csync.NewMap[string, string](),
+	}
+
+	// The prompt is rebuilt for new sessions while other ones run, which
+	// keep theirs. The race detector checks the concurrent runs.
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for range 100 {
+			a.SetSessionSystemPrompt("new", "rebuilt")
+		}
+	})
+	for range 100 {
+		systemPrompt, _ := a.runSetup(SessionAgentCall{SessionID: "running"}, "")
+		require.Equal(t, "system", systemPrompt)
+	}
+	wg.Wait()
+	systemPrompt, _ := a.runSetup(SessionAgentCall{SessionID: "new"}, "")
+	require.Equal(t, "rebuilt", systemPrompt)
+	systemPrompt, _ = a.runSetup(SessionAgentCall{SessionID: "running"}, "")
+	require.Equal(t, "system", systemPrompt)
+}
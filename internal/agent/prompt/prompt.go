@@ -13,6 +13,7 @@ import (
 
 	"github.com/mudaaaa/crushplus/internal/config"
 	"github.com/mudaaaa/crushplus/internal/home"
+	"github.com/mudaaaa/crushplus/internal/repomap"
 	"github.com/mudaaaa/crushplus/internal/shell"
 )
 
@@ -23,6 +24,7 @@ type Prompt struct {
 	now        func() time.Time
 	platform   string
 	workingDir string
+	repoMap    *repomap.Map
 }
 
 type PromptDat struct {
@@ -35,6 +37,7 @@ type PromptDat struct {
 	Date         string
 	GitStatus    string
 	ContextFiles []ContextFile
+	RepoMap      string
 }
 
 type ContextFile struct {
@@ -62,6 +65,14 @@ func WithWorkingDir(workingDir string) Option {
 	}
 }
 
+// WithRepoMap adds the map of the repository to the prompt, when it's
+// enabled in the config.
+func WithRepoMap(repoMap *repomap.Map) Option {
+	return func(p *Prompt) {
+		p.repoMap = repoMap
+	}
+}
+
 func NewPrompt(name, promptTemplate string, opts ...Option) (*Prompt, error) {
 	p := &Prompt{
 		name:     name,
@@ -183,6 +194,9 @@ func (p *Prompt) promptData(ctx context.Context, provider, model string, cfg con
 	for _, contextFiles := range files {
 		data.ContextFiles = append(data.ContextFiles, contextFiles...)
 	}
+	if p.repoMap != nil && cfg.Options.RepoMap != nil && cfg.Options.RepoMap.Enabled {
+		data.RepoMap = p.repoMap.Render(ctx, cfg.Options.RepoMap.TokenBudget())
+	}
 	return data, nil
 }
 
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/mudaaaa/crushplus/internal/message"
+	"github.com/mudaaaa/crushplus/internal/session"
+)
+
+// maxPrunedInputLength is how much of the input of a tool call is repeated
+// in the placeholder of its pruned result.
+const maxPrunedInputLength = 300
+
+type pruneStats struct {
+	Results int
+	Tokens  int64
+}
+
+// pruneHistory elides old tool results from the messages of the session once
+// enough of the context window is in use, going by the used tokens. Once
+// pruning starts for a session it carries on, so results don't come back into
+// the prompt, and break its cache, when pruning brings the usage below the
+// threshold.
+func (a *sessionAgent) pruneHistory(ctx context.Context, sess session.Session, msgs []message.Message, used int64) []message.Message {
+	if a.historyPruning.Disabled {
+		return msgs
+	}
+	keepTurns, minChars, threshold := a.historyPruning.Limits()
+
+	reported, pruning := a.prunedResults.Get(sess.ID)
+	if !pruning {
+		cw := float64(a.largeModel.CatwalkCfg.ContextWindow)
+		if threshold > 0 && (cw == 0 || float64(used) < threshold*cw) {
+			return msgs
+		}
+	}
+
+	pruned, stats := pruneToolResults(msgs, keepTurns, minChars)
+	a.prunedResults.Set(sess.ID, stats.Results)
+	if stats.Results <= reported {
+		return pruned
+	}
+
+	slog.Info("Pruned old tool results", "session_id", sess.ID, "results", stats.Results, "tokens", stats.Tokens)
+	_, err := a.messages.Create(ctx, sess.ID, message.CreateMessageParams{
+		Role: message.System,
+		Parts: []message.ContentPart{message.TextContent{
+			Text: fmt.Sprintf("Pruned %d old tool results from the history, saving ~%d tokens.", stats.Results, stats.Tokens),
+		}},
+	})
+	if err != nil {
+		slog.Error("Failed to log pruned tool results", "session_id", sess.ID, "error", err)
+	}
+	return pruned
+}
+
+// pruneToolResults replaces the results of tool calls made more than
+// keepTurns turns ago, and at least minChars long, with a placeholder that
+// says how to get them back. Tool calls and text are kept, so the model still
+// knows what it did. The prompt about to be sent counts as a turn.
+func pruneToolResults(msgs []message.Message, keepTurns, minChars int) ([]message.Message, pruneStats) {
+	calls := make(map[string]message.ToolCall)
+	for _, m := range msgs {
+		for _, call := range m.ToolCalls() {
+			calls[call.ID] = call
+		}
+	}
+
+	var stats pruneStats
+	pruned := slices.Clone(msgs)
+	age := 1
+	for i := len(pruned) - 1; i >= 0; i-- {
+		switch pruned[i].Role {
+		case message.User:
+			age++
+		case message.Tool:
+			if age <= keepTurns {
+				continue
+			}
+			parts := slices.Clone(pruned[i].Parts)
+			for j, part := range parts {
+				result, ok := part.(message.ToolResult)
+				if !ok || result.IsError {
+					continue
+				}
+				size := len(result.Content) + len(result.Data)
+				if size < minChars {
+					continue
+				}
+				placeholder := prunedPlaceholder(result, calls[result.ToolCallID], size)
+				parts[j] = message.ToolResult{
+					ToolCallID: result.ToolCallID,
+					Name:       result.Name,
+					Content:    placeholder,
+					Metadata:   result.Metadata,
+				}
+				stats.Results++
+				stats.Tokens += estimateTokens(size) - estimateTokens(len(placeholder))
+			}
+			pruned[i].Parts = parts
+		}
+	}
+	return pruned, stats
+}
+
+func prunedPlaceholder(result message.ToolResult, call message.ToolCall, size int) string {
+	name := result.Name
+	if name == "" {
+		name = call.Name
+	}
+	input := call.Input
+	if len(input) > maxPrunedInputLength {
+		input = input[:maxPrunedInputLength] + "..."
+	}
+	return fmt.Sprintf("[This result (~%d tokens) was pruned from the history to save context. If you still need it, call the %s tool again with the same input: %s]", estimateTokens(size), name, input)
+}
+
+// estimateTokens roughly estimates the number of tokens of a text of the
+// given length.
+func estimateTokens(chars int) int64 {
+	return int64(chars / 4)
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mudaaaa/crushplus/internal/message"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPruneToolResults(t *testing.T) {
+	t.Parallel()
+
+	big := strings.Repeat("x", 4000)
+	turn := func(id string) []message.Message {
+		return []message.Message{
+			{Role: message.User, Parts: []message.ContentPart{message.TextContent{Text: "look at " + id}}},
+			{Role: message.Assistant, Parts: []message.ContentPart{
+				message.TextContent{Text: "Sure."},
+				message.ToolCall{ID: id, Name: "view", Input: `{"file_path":"` + id + `.go"}`, Finished: true},
+			}},
+			{Role: message.Tool, Parts: []message.ContentPart{
+				message.ToolResult{ToolCallID: id, Name: "view", Content: big},
+			}},
+		}
+	}
+
+	var msgs []message.Message
+	for _, id := range []string{"a", "b", "c"} {
+		msgs = append(msgs, turn(id)...)
+	}
+	msgs = append(msgs, message.Message{Role: message.Tool, Parts: []message.ContentPart{
+		message.ToolResult{ToolCallID: "small", Name: "ls", Content: "short"},
+	}})
+
+	pruned, stats := pruneToolResults(msgs, 2, 2000)
+	require.Equal(t, 1, stats.Results)
+	require.Equal(t, int64(1000)-estimateTokens(len(pruned[2].ToolResults()[0].Content)), stats.Tokens)
+
+	result := pruned[2].ToolResults()[0]
+	require.Equal(t, "a", result.ToolCallID)
+	require.Contains(t, result.Content, "pruned from the history")
+	require.Contains(t, result.Content, `call the view tool again with the same input: {"file_path":"a.go"}`)
+
+	// Recent results, small results and the tool calls are kept.
+	require.Equal(t, big, pruned[5].ToolResults()[0].Content)
+	require.Equal(t, big, pruned[8].ToolResults()[0].Content)
+	require.Equal(t, "short", pruned[9].ToolResults()[0].Content)
+	require.Len(t, pruned[1].ToolCalls(), 1)
+
+	// The original messages are left untouched.
+	require.Equal(t, big, msgs[2].ToolResults()[0].Content)
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"charm.land/fantasy"
+)
+
+// SampleCall is a one-off completion that is not part of a session's
+// conversation, such as the ones MCP servers request through sampling.
+type SampleCall struct {
+	// SessionID is the session the cost is added to.
+	SessionID       string
+	SystemPrompt    string
+	Messages        []fantasy.Message
+	MaxOutputTokens int64
+	Temperature     *float64
+	// UseSmallModel selects the small model instead of the large one.
+	UseSmallModel bool
+}
+
+type SampleResult struct {
+	Text         string
+	Model        string
+	FinishReason fantasy.FinishReason
+}
+
+func (a *sessionAgent) Sample(ctx context.Context, call SampleCall) (*SampleResult, error) {
+	if len(call.Messages) == 0 {
+		return nil, errors.New("no messages to sample from")
+	}
+
+	model := a.largeModel
+	if call.UseSmallModel {
+		model = a.smallModel
+	}
+
+	var prompt fantasy.Prompt
+	if a.systemPromptPrefix != "" {
+		prompt = append(prompt, fantasy.NewSystemMessage(a.systemPromptPrefix))
+	}
+	if call.SystemPrompt != "" {
+		prompt = append(prompt, fantasy.NewSystemMessage(call.SystemPrompt))
+	}
+	prompt = append(prompt, call.Messages...)
+
+	maxOutputTokens := call.MaxOutputTokens
+	if limit := model.CatwalkCfg.DefaultMaxTokens; limit > 0 && (maxOutputTokens <= 0 || maxOutputTokens > limit) {
+		maxOutputTokens = limit
+	}
+
+	resp, err := model.Model.Generate(ctx, fantasy.Call{
+		Prompt:          prompt,
+		MaxOutputTokens: &maxOutputTokens,
+		Temperature:     call.Temperature,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if call.SessionID != "" {
+		if err := a.addSessionCost(ctx, call.SessionID, model, resp.Usage); err != nil {
+			slog.Error("failed to update session cost", "error", err)
+		}
+	}
+
+	return &SampleResult{
+		Text:         resp.Content.Text(),
+		Model:        model.CatwalkCfg.ID,
+		FinishReason: resp.FinishReason,
+	}, nil
+}
+
+// addSessionCost adds the cost of a request that is not part of the
+// conversation to the session, without touching its context usage.
+func (a *sessionAgent) addSessionCost(ctx context.Context, sessionID string, model Model, usage fantasy.Usage) error {
+	return addSessionUsage(ctx, a.sessions, sessionID, taskUsage{cost: usageCost(model, usage)})
+}
@@ -0,0 +1,100 @@
+package agent
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/session"
+)
+
+// taskUsage is what was spent for a session outside of its own steps: by a
+// step of a task sub-agent, rolled up to the sessions the sub-agent runs
+// under, or by an MCP sampling request.
+type taskUsage struct {
+	cost   float64
+	tokens int64
+}
+
+type taskUsageContextKey struct{}
+
+// withTaskUsage returns a context that rolls up the usage of the task
+// sub-agents run with it through rollUp.
+func withTaskUsage(ctx context.Context, rollUp func(taskUsage)) context.Context {
+	return context.WithValue(ctx, taskUsageContextKey{}, rollUp)
+}
+
+// WithSessionUsage returns a context that rolls up the usage of the runs
+// started with it to the session with the given ID. It's for the tasks run on
+// behalf of a session that no agent runs, like the ones of MCP clients.
+func WithSessionUsage(ctx context.Context, sessions session.Service, sessionID string) context.Context {
+	return withTaskUsage(ctx, func(usage taskUsage) {
+		if err := addSessionUsage(ctx, sessions, sessionID, usage); err != nil {
+			slog.Error("Failed to save the usage of a task", "session_id", sessionID, "error", err)
+		}
+	})
+}
+
+// taskUsageFromContext returns the function that rolls up the usage of the
+// run to its parent session, or nil when the run isn't a task of another one.
+func taskUsageFromContext(ctx context.Context) func(taskUsage) {
+	rollUp, _ := ctx.Value(taskUsageContextKey{}).(func(taskUsage))
+	return rollUp
+}
+
+// usageTokens returns all the tokens of the usage, cached ones included.
+func usageTokens(usage fantasy.Usage) int64 {
+	return usage.InputTokens + usage.OutputTokens + usage.CacheCreationTokens + usage.CacheReadTokens
+}
+
+// runningSessions holds how to add usage to the sessions being run. A run
+// keeps its session in memory and saves it after every step, which would
+// overwrite the usage saved to the database meanwhile. It's shared by all the
+// agents, since MCP sampling requests don't know which one runs a session.
+var runningSessions = struct {
+	sync.Mutex
+	runs map[string]*sessionRun
+}{runs: make(map[string]*sessionRun)}
+
+type sessionRun struct {
+	addUsage func(taskUsage)
+}
+
+// startSessionRun loads the session of a run with load, and sends the usage
+// added to the session to addUsage until the returned function is called.
+func startSessionRun(sessionID string, addUsage func(taskUsage), load func() error) (stop func(), err error) {
+	runningSessions.Lock()
+	defer runningSessions.Unlock()
+	if err := load(); err != nil {
+		return nil, err
+	}
+	run := &sessionRun{addUsage: addUsage}
+	runningSessions.runs[sessionID] = run
+	return func() {
+		runningSessions.Lock()
+		defer runningSessions.Unlock()
+		if runningSessions.runs[sessionID] == run {
+			delete(runningSessions.runs, sessionID)
+		}
+	}, nil
+}
+
+// addSessionUsage adds usage spent outside of the conversation to the
+// session: to its run when it's being run, or else to the database.
+func addSessionUsage(ctx context.Context, sessions session.Service, sessionID string, usage taskUsage) error {
+	runningSessions.Lock()
+	defer runningSessions.Unlock()
+	if run, ok := runningSessions.runs[sessionID]; ok {
+		run.addUsage(usage)
+		return nil
+	}
+	s, err := sessions.Get(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	s.Cost += usage.cost
+	s.TaskTokens += usage.tokens
+	_, err = sessions.Save(ctx, s)
+	return err
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddSessionUsage(t *testing.T) {
+	t.Parallel()
+
+	env := testEnv(t)
+	sess, err := env.sessions.Create(t.Context(), "usage")
+	require.NoError(t, err)
+
+	// While the session runs, the usage goes to its run, which saves the
+	// session it keeps in memory.
+	var added []taskUsage
+	addUsage := func(usage taskUsage) { added = append(added, usage) }
+	load := func() error { return nil }
+	stop, err := startSessionRun(sess.ID, addUsage, load)
+	require.NoError(t, err)
+	require.NoError(t, addSessionUsage(t.Context(), env.sessions, sess.ID, taskUsage{cost: 0.5}))
+	require.Equal(t, []taskUsage{{cost: 0.5}}, added)
+	saved, err := env.sessions.Get(t.Context(), sess.ID)
+	require.NoError(t, err)
+	require.Zero(t, saved.Cost)
+
+	// Stopping a previous run doesn't stop the current one.
+	next, err := startSessionRun(sess.ID, addUsage, load)
+	require.NoError(t, err)
+	stop()
+	require.NoError(t, addSessionUsage(t.Context(), env.sessions, sess.ID, taskUsage{cost: 0.25}))
+	require.Len(t, added, 2)
+	next()
+
+	// Once the run is over, the usage is saved to the database.
+	require.NoError(t, addSessionUsage(t.Context(), env.sessions, sess.ID, taskUsage{cost: 1, tokens: 10}))
+	saved, err = env.sessions.Get(t.Context(), sess.ID)
+	require.NoError(t, err)
+	require.Equal(t, 1.0, saved.Cost)
+	require.EqualValues(t, 10, saved.TaskTokens)
+	require.Len(t, added, 2)
+}
+
+func TestWithSessionUsage(t *testing.T) {
+	t.Parallel()
+
+	env := testEnv(t)
+	sess, err := env.sessions.Create(t.Context(), "usage")
+	require.NoError(t, err)
+
+	rollUp := taskUsageFromContext(WithSessionUsage(t.Context(), env.sessions, sess.ID))
+	require.NotNil(t, rollUp)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() { rollUp(taskUsage{cost: 0.5, tokens: 10}) })
+	}
+	wg.Wait()
+
+	saved, err := env.sessions.Get(t.Context(), sess.ID)
+	require.NoError(t, err)
+	require.Equal(t, 5.0, saved.Cost)
+	require.EqualValues(t, 100, saved.TaskTokens)
+}
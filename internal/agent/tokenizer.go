@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"hash/maphash"
+	"strings"
+
+	"github.com/mudaaaa/crushplus/internal/csync"
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// messageOverheadTokens is what the chat format adds to every message, such
+// as its role, in the tokenizers we have.
+const messageOverheadTokens = 4
+
+// maxCachedTokenCounts bounds the token counts kept in memory.
+const maxCachedTokenCounts = 10_000
+
+var (
+	// codecs holds the tokenizers loaded so far by encoding, since loading
+	// their vocabulary is expensive.
+	codecs = csync.NewMap[tokenizer.Encoding, tokenizer.Codec]()
+	// tokenCounts caches the tokens of the texts of the requests, which are
+	// mostly the same from one request to the next.
+	tokenCounts    = csync.NewMap[uint64, int]()
+	tokenCountSeed = maphash.MakeSeed()
+)
+
+// tokenizerEncodings maps the prefixes of the IDs of the OpenAI models to
+// the encoding of their tokenizer. Longer prefixes come first.
+var tokenizerEncodings = []struct {
+	prefix   string
+	encoding tokenizer.Encoding
+}{
+	{"gpt-5", tokenizer.O200kBase},
+	{"gpt-4.1", tokenizer.O200kBase},
+	{"gpt-4o", tokenizer.O200kBase},
+	{"chatgpt-4o", tokenizer.O200kBase},
+	{"gpt-oss", tokenizer.O200kBase},
+	{"o1", tokenizer.O200kBase},
+	{"o3", tokenizer.O200kBase},
+	{"o4", tokenizer.O200kBase},
+	{"gpt-4", tokenizer.Cl100kBase},
+	{"gpt-3.5", tokenizer.Cl100kBase},
+	{"gpt-35", tokenizer.Cl100kBase},
+}
+
+// tokenizerEncoding returns the encoding of the tokenizer of an OpenAI model,
+// named as OpenAI, Azure or OpenRouter do.
+func tokenizerEncoding(modelID string) (tokenizer.Encoding, bool) {
+	id := strings.ToLower(modelID)
+	if vendor, name, ok := strings.Cut(id, "/"); ok {
+		if vendor != "openai" {
+			return "", false
+		}
+		id = name
+	}
+	for _, e := range tokenizerEncodings {
+		if strings.HasPrefix(id, e.prefix) {
+			return e.encoding, true
+		}
+	}
+	return "", false
+}
+
+// tokenizer returns the tokenizer of the model, or nil when we don't have it
+// and the tokens are estimated from the characters.
+func (m Model) tokenizer() tokenizer.Codec {
+	if m.Model == nil {
+		return nil
+	}
+	encoding, ok := tokenizerEncoding(m.Model.Model())
+	if !ok {
+		return nil
+	}
+	return codecs.GetOrSet(encoding, func() tokenizer.Codec {
+		codec, err := tokenizer.Get(encoding)
+		if err != nil {
+			return nil
+		}
+		return codec
+	})
+}
+
+// countTokens counts the tokens of the text with the codec.
+func countTokens(codec tokenizer.Codec, text string) int {
+	if text == "" {
+		return 0
+	}
+	key := maphash.String(tokenCountSeed, codec.GetName()+"\x00"+text)
+	if count, ok := tokenCounts.Get(key); ok {
+		return count
+	}
+	count, err := codec.Count(text)
+	if err != nil {
+		// The text can still be sized up roughly.
+		return len(text) / 4
+	}
+	if tokenCounts.Len() >= maxCachedTokenCounts {
+		tokenCounts.Reset(make(map[uint64]int))
+	}
+	tokenCounts.Set(key, count)
+	return count
+}
@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+
+	"charm.land/fantasy"
+	"charm.land/fantasy/providers/anthropic"
+	"charm.land/fantasy/providers/google"
+	"charm.land/fantasy/providers/openai"
+	"github.com/mudaaaa/crushplus/internal/csync"
+	"github.com/mudaaaa/crushplus/internal/pubsub"
+)
+
+// mediaTokens is about what providers count for an image or a document page
+// of common size.
+const mediaTokens = 1_600
+
+// defaultCharsPerToken is the ratio of characters to tokens assumed for
+// providers we know nothing about.
+const defaultCharsPerToken = 3.8
+
+// charsPerToken is the ratio of characters to tokens of the tokenizers of
+// the providers, for a mix of code and English, before it's calibrated.
+var charsPerToken = map[string]float64{
+	anthropic.Name: 3.5,
+	google.Name:    4.0,
+	openai.Name:    4.0,
+}
+
+var (
+	// tokenCalibrations holds the ratio of characters to tokens seen in the
+	// usage reported for the requests to each model.
+	tokenCalibrations = csync.NewMap[string, float64]()
+	estimateBroker    = pubsub.NewBroker[TokenEstimate]()
+)
+
+// TokenEstimate is the estimated size of the next request of a session.
+type TokenEstimate struct {
+	SessionID string
+	Tokens    int64
+}
+
+// SubscribeTokenEstimates returns a channel for the token estimates of the
+// next requests of the sessions.
+func SubscribeTokenEstimates(ctx context.Context) <-chan pubsub.Event[TokenEstimate] {
+	return estimateBroker.Subscribe(ctx)
+}
+
+// requestSize is the size of what is sent to the model in a request. Its
+// text is counted in Tokens when we have the tokenizer of the model, and in
+// Chars otherwise.
+type requestSize struct {
+	Chars  int
+	Tokens int
+	Media  int
+}
+
+func (s requestSize) add(o requestSize) requestSize {
+	return requestSize{Chars: s.Chars + o.Chars, Tokens: s.Tokens + o.Tokens, Media: s.Media + o.Media}
+}
+
+// measureRequest measures the definitions of the tools and the messages of a
+// request, the system prompt included.
+func (m Model) measureRequest(tools []fantasy.AgentTool, msgs []fantasy.Message) requestSize {
+	var size requestSize
+	codec := m.tokenizer()
+	measure := func(text string) {
+		if codec != nil {
+			size.Tokens += countTokens(codec, text)
+		} else {
+			size.Chars += len(text)
+		}
+	}
+	for _, tool := range tools {
+		schema, _ := json.Marshal(tool.Info())
+		measure(string(schema))
+	}
+	for _, msg := range msgs {
+		if codec != nil {
+			size.Tokens += messageOverheadTokens
+		}
+		for _, part := range msg.Content {
+			switch part := part.(type) {
+			case fantasy.TextPart:
+				measure(part.Text)
+			case fantasy.ReasoningPart:
+				measure(part.Text)
+			case fantasy.ToolCallPart:
+				measure(part.ToolName + part.Input)
+			case fantasy.FilePart:
+				size.Media++
+			case fantasy.ToolResultPart:
+				switch output := part.Output.(type) {
+				case fantasy.ToolResultOutputContentText:
+					measure(output.Text)
+				case fantasy.ToolResultOutputContentError:
+					if output.Error != nil {
+						measure(output.Error.Error())
+					}
+				case fantasy.ToolResultOutputContentMedia:
+					size.Media++
+				}
+			}
+		}
+	}
+	return size
+}
+
+// calibrationKey identifies the tokenizer of a model.
+func (m Model) calibrationKey() string {
+	return m.Model.Provider() + "/" + m.Model.Model()
+}
+
+// charsPerToken returns the ratio of characters to tokens of the model,
+// calibrated on the usage of its past requests.
+func (m Model) charsPerToken() float64 {
+	if ratio, ok := tokenCalibrations.Get(m.calibrationKey()); ok {
+		return ratio
+	}
+	if ratio, ok := charsPerToken[m.Model.Provider()]; ok {
+		return ratio
+	}
+	return defaultCharsPerToken
+}
+
+// estimateTokens estimates how many tokens the model counts for a request of
+// the given size.
+func (m Model) estimateTokens(size requestSize) int64 {
+	return int64(size.Tokens) + int64(float64(size.Chars)/m.charsPerToken()) + int64(size.Media)*mediaTokens
+}
+
+// calibrate adjusts the ratio of characters to tokens of the model to the
+// input tokens the provider reported for a request of the given size. Models
+// whose tokenizer we have don't need it.
+func (m Model) calibrate(size requestSize, usage fantasy.Usage) {
+	input := usage.InputTokens + usage.CacheCreationTokens + usage.CacheReadTokens - int64(size.Media)*mediaTokens
+	// Small requests say little about the tokenizer, as the overhead of the
+	// request format dominates them.
+	if input < 1_000 || size.Chars == 0 || size.Tokens > 0 {
+		return
+	}
+	observed := min(max(float64(size.Chars)/float64(input), 1.5), 8)
+	// Move towards the observed ratio smoothly, as it varies with the
+	// content of each request.
+	ratio := m.charsPerToken()*0.7 + observed*0.3
+	tokenCalibrations.Set(m.calibrationKey(), ratio)
+}
+
+// summarizeThreshold returns how many tokens of the context window must stay
+// free for the session to go on without being summarized.
+func (a *sessionAgent) summarizeThreshold() int64 {
+	cw := int64(a.largeModel.CatwalkCfg.ContextWindow)
+	if cw > 200_000 {
+		return 20_000
+	}
+	return int64(float64(cw) * 0.2)
+}
+
+// needsSummary reports whether a request of the given tokens is too close
+// to the context window of the model.
+func (a *sessionAgent) needsSummary(tokens int64) bool {
+	if a.disableAutoSummarize {
+		return false
+	}
+	cw := int64(a.largeModel.CatwalkCfg.ContextWindow)
+	return cw > 0 && cw-tokens <= a.summarizeThreshold()
+}
+
+func (a *sessionAgent) publishEstimate(sessionID string, tokens int64) {
+	estimateBroker.Publish(pubsub.UpdatedEvent, TokenEstimate{
+		SessionID: sessionID,
+		Tokens:    tokens,
+	})
+}
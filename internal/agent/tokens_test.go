@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/stretchr/testify/require"
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// namedModel is a language model that only has a name.
+type namedModel struct {
+	fantasy.LanguageModel
+	provider, model string
+}
+
+func (m namedModel) Provider() string { return m.provider }
+func (m namedModel) Model() string    { return m.model }
+
+func TestMeasureRequest(t *testing.T) {
+	t.Parallel()
+
+	msgs := []fantasy.Message{
+		fantasy.NewSystemMessage("system"),
+		fantasy.NewUserMessage("prompt", fantasy.FilePart{Filename: "a.png", MediaType: "image/png"}),
+		{Role: fantasy.MessageRoleAssistant, Content: []fantasy.MessagePart{
+			fantasy.ReasoningPart{Text: "hmm"},
+			fantasy.ToolCallPart{ToolName: "view", Input: `{}`},
+		}},
+		{Role: fantasy.MessageRoleTool, Content: []fantasy.MessagePart{
+			fantasy.ToolResultPart{Output: fantasy.ToolResultOutputContentText{Text: "result"}},
+			fantasy.ToolResultPart{Output: fantasy.ToolResultOutputContentError{Error: errors.New("failed")}},
+			fantasy.ToolResultPart{Output: fantasy.ToolResultOutputContentMedia{Data: "aGk=", MediaType: "image/png"}},
+		}},
+	}
+	size := Model{Model: namedModel{provider: "test-measure", model: "m"}}.measureRequest(nil, msgs)
+	require.Equal(t, requestSize{
+		Chars: len("system") + len("prompt") + len("hmm") + len("view{}") + len("result") + len("failed"),
+		Media: 2,
+	}, size)
+}
+
+func TestModelEstimateTokens(t *testing.T) {
+	t.Parallel()
+
+	model := Model{Model: namedModel{provider: "test-estimate", model: "m"}}
+	size := requestSize{Chars: 38_000, Media: 1}
+	require.Equal(t, int64(10_000+mediaTokens), model.estimateTokens(size))
+
+	t.Run("calibrates on the reported usage", func(t *testing.T) {
+		t.Parallel()
+
+		model := Model{Model: namedModel{provider: "test-calibrate", model: "m"}}
+		size := requestSize{Chars: 40_000}
+		for range 20 {
+			model.calibrate(size, fantasy.Usage{InputTokens: 2_000, CacheReadTokens: 18_000})
+		}
+		require.InDelta(t, 20_000, model.estimateTokens(size), 200)
+	})
+
+	t.Run("ignores small requests", func(t *testing.T) {
+		t.Parallel()
+
+		model := Model{Model: namedModel{provider: "test-small", model: "m"}}
+		model.calibrate(requestSize{Chars: 100}, fantasy.Usage{InputTokens: 500})
+		require.Equal(t, defaultCharsPerToken, model.charsPerToken())
+	})
+}
+
+func TestEstimateRun(t *testing.T) {
+	t.Parallel()
+
+	a := &sessionAgent{
+		largeModel:   Model{Model: namedModel{provider: "test-run", model: "m"}},
+		systemPrompt: strings.Repeat("s", 3_800),
+	}
+	require.Equal(t, int64(1_000+1), a.estimateRun(a.systemPrompt, nil, nil, SessionAgentCall{Prompt: "abcd"}))
+}
+
+func TestTokenizer(t *testing.T) {
+	t.Parallel()
+
+	for id, encoding := range map[string]tokenizer.Encoding{
+		"gpt-5-codex":         tokenizer.O200kBase,
+		"openai/gpt-4.1-mini": tokenizer.O200kBase,
+		"o4-mini":             tokenizer.O200kBase,
+		"gpt-4-turbo":         tokenizer.Cl100kBase,
+	} {
+		got, ok := tokenizerEncoding(id)
+		require.True(t, ok, id)
+		require.Equal(t, encoding, got, id)
+	}
+	for _, id := range []string{"claude-sonnet-4-5", "anthropic/claude-opus-4", "gemini-2.5-pro", "qwen/gpt-4o-clone"} {
+		_, ok := tokenizerEncoding(id)
+		require.False(t, ok, id)
+	}
+
+	// Models with a tokenizer count the tokens of the text exactly.
+	model := Model{Model: namedModel{provider: "openai", model: "gpt-4o"}}
+	size := model.measureRequest(nil, []fantasy.Message{fantasy.NewUserMessage("hello world")})
+	require.Equal(t, requestSize{Tokens: 2 + messageOverheadTokens}, size)
+	require.EqualValues(t, 2+messageOverheadTokens, model.estimateTokens(size))
+
+	// And aren't calibrated.
+	model.calibrate(requestSize{Tokens: 10_000}, fantasy.Usage{InputTokens: 5_000})
+	_, calibrated := tokenCalibrations.Get(model.calibrationKey())
+	require.False(t, calibrated)
+}
@@ -7,6 +7,7 @@ import (
 	_ "embed"
 	"fmt"
 	"html/template"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -14,9 +15,11 @@ import (
 	"time"
 
 	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/ansiext"
 	"github.com/mudaaaa/crushplus/internal/config"
 	"github.com/mudaaaa/crushplus/internal/permission"
 	"github.com/mudaaaa/crushplus/internal/shell"
+	"github.com/mudaaaa/crushplus/internal/shellstate"
 )
 
 type BashParams struct {
@@ -24,6 +27,7 @@ type BashParams struct {
 	Command         string `json:"command" description:"The command to execute"`
 	WorkingDir      string `json:"working_dir,omitempty" description:"The working directory to execute the command in (defaults to current directory)"`
 	RunInBackground bool   `json:"run_in_background,omitempty" description:"Set to true (boolean) to run this command in the background. Use job_output to read the output later."`
+	PTY             bool   `json:"pty,omitempty" description:"Set to true (boolean) to run this command in a pseudo-terminal, for commands that need a TTY or prompt for input. Use job_input to answer prompts."`
 }
 
 type BashPermissionsParams struct {
@@ -31,6 +35,7 @@ type BashPermissionsParams struct {
 	Command         string `json:"command"`
 	WorkingDir      string `json:"working_dir"`
 	RunInBackground bool   `json:"run_in_background"`
+	PTY             bool   `json:"pty"`
 }
 
 type BashResponseMetadata struct {
@@ -47,7 +52,6 @@ const (
 	BashToolName = "bash"
 
 	AutoBackgroundThreshold = 1 * time.Minute // Commands taking longer automatically become background jobs
-	MaxOutputLength         = 30000
 	BashNoOutput            = "no output"
 )
 
@@ -60,10 +64,9 @@ var bashDescriptionTpl = template.Must(
 )
 
 type bashDescriptionData struct {
-	BannedCommands  string
-	MaxOutputLength int
-	Attribution     config.Attribution
-	ModelName       string
+	BannedCommands string
+	Attribution    config.Attribution
+	ModelName      string
 }
 
 var bannedCommands = []string{
@@ -143,10 +146,9 @@ func bashDescription(attribution *config.Attribution, modelName string) string {
 	bannedCommandsStr := strings.Join(bannedCommands, ", ")
 	var out bytes.Buffer
 	if err := bashDescriptionTpl.Execute(&out, bashDescriptionData{
-		BannedCommands:  bannedCommandsStr,
-		MaxOutputLength: MaxOutputLength,
-		Attribution:     *attribution,
-		ModelName:       modelName,
+		BannedCommands: bannedCommandsStr,
+		Attribution:    *attribution,
+		ModelName:      modelName,
 	}); err != nil {
 		// this should never happen.
 		panic("failed to execute bash description template: " + err.Error())
@@ -186,7 +188,7 @@ func blockFuncs() []shell.BlockFunc {
 	}
 }
 
-func NewBashTool(permissions permission.Service, workingDir string, attribution *config.Attribution, modelName string) fantasy.AgentTool {
+func NewBashTool(permissions permission.Service, shells shellstate.Service, workingDir string, attribution *config.Attribution, modelName string) fantasy.AgentTool {
 	return fantasy.NewAgentTool(
 		BashToolName,
 		string(bashDescription(attribution, modelName)),
@@ -195,9 +197,6 @@ func NewBashTool(permissions permission.Service, workingDir string, attribution
 				return fantasy.NewTextErrorResponse("missing command"), nil
 			}
 
-			// Determine working directory
-			execWorkingDir := cmp.Or(params.WorkingDir, workingDir)
-
 			isSafeReadOnly := false
 			cmdLower := strings.ToLower(params.Command)
 
@@ -214,6 +213,15 @@ func NewBashTool(permissions permission.Service, workingDir string, attribution
 			if sessionID == "" {
 				return fantasy.ToolResponse{}, fmt.Errorf("session ID is required for executing shell command")
 			}
+
+			// Commands run in a copy of the session's shell, which carries the
+			// working directory, exported variables and functions over.
+			sessionShell, err := shells.Shell(ctx, sessionID, workingDir)
+			if err != nil {
+				return fantasy.ToolResponse{}, fmt.Errorf("error loading shell: %w", err)
+			}
+			execWorkingDir := cmp.Or(params.WorkingDir, sessionShell.GetWorkingDir())
+
 			if !isSafeReadOnly {
 				p := permissions.Request(
 					permission.CreatePermissionRequest{
@@ -237,7 +245,7 @@ func NewBashTool(permissions permission.Service, workingDir string, attribution
 				bgManager := shell.GetBackgroundShellManager()
 				bgManager.Cleanup()
 				// Use background context so it continues after tool returns
-				bgShell, err := bgManager.Start(context.Background(), execWorkingDir, blockFuncs(), params.Command, params.Description)
+				bgShell, err := startBashJob(bgManager, sessionID, sessionShell, execWorkingDir, params)
 				if err != nil {
 					return fantasy.ToolResponse{}, fmt.Errorf("error starting background shell: %w", err)
 				}
@@ -256,6 +264,9 @@ func NewBashTool(permissions permission.Service, workingDir string, attribution
 						return fantasy.ToolResponse{}, fmt.Errorf("[Job %s] error executing command: %w", bgShell.ID, execErr)
 					}
 
+					if bgShell.PTY {
+						stdout = ansiext.Strip(stdout)
+					}
 					stdout = formatOutput(stdout, stderr, execErr)
 
 					metadata := BashResponseMetadata{
@@ -282,7 +293,10 @@ func NewBashTool(permissions permission.Service, workingDir string, attribution
 					Background:       true,
 					ShellID:          bgShell.ID,
 				}
-				response := fmt.Sprintf("Background shell started with ID: %s\n\nUse job_output tool to view output or job_kill to terminate.", bgShell.ID)
+				response := fmt.Sprintf("Background shell started with ID: %s\n\nUse job_output to view output, job_wait to wait for it to finish or print something, or job_kill to terminate.", bgShell.ID)
+				if bgShell.PTY {
+					response += " Use job_input to answer its prompts."
+				}
 				return fantasy.WithResponseMetadata(fantasy.NewTextResponse(response), metadata), nil
 			}
 
@@ -292,7 +306,7 @@ func NewBashTool(permissions permission.Service, workingDir string, attribution
 			// Start with detached context so it can survive if moved to background
 			bgManager := shell.GetBackgroundShellManager()
 			bgManager.Cleanup()
-			bgShell, err := bgManager.Start(context.Background(), execWorkingDir, blockFuncs(), params.Command, params.Description)
+			bgShell, err := startBashJob(bgManager, sessionID, sessionShell, execWorkingDir, params)
 			if err != nil {
 				return fantasy.ToolResponse{}, fmt.Errorf("error starting shell: %w", err)
 			}
@@ -331,12 +345,21 @@ func NewBashTool(permissions permission.Service, workingDir string, attribution
 				// Don't call Kill() as it cancels the context and corrupts the exit code
 				bgManager.Remove(bgShell.ID)
 
+				// Keep what the command changed, like the directory it moved to,
+				// for the next commands of the session.
+				if err := shells.Update(ctx, sessionID, commandState(bgShell.Shell, sessionShell, execWorkingDir)); err != nil {
+					slog.Error("Failed to save shell state", "session_id", sessionID, "error", err)
+				}
+
 				interrupted := shell.IsInterrupt(execErr)
 				exitCode := shell.ExitCode(execErr)
 				if exitCode == 0 && !interrupted && execErr != nil {
 					return fantasy.ToolResponse{}, fmt.Errorf("[Job %s] error executing command: %w", bgShell.ID, execErr)
 				}
 
+				if bgShell.PTY {
+					stdout = ansiext.Strip(stdout)
+				}
 				stdout = formatOutput(stdout, stderr, execErr)
 
 				metadata := BashResponseMetadata{
@@ -350,7 +373,7 @@ func NewBashTool(permissions permission.Service, workingDir string, attribution
 				if stdout == "" {
 					return fantasy.WithResponseMetadata(fantasy.NewTextResponse(BashNoOutput), metadata), nil
 				}
-				stdout += fmt.Sprintf("\n\n<cwd>%s</cwd>", normalizeWorkingDir(bgShell.WorkingDir))
+				stdout += fmt.Sprintf("\n\n<cwd>%s</cwd>", normalizeWorkingDir(bgShell.Shell.GetWorkingDir()))
 				return fantasy.WithResponseMetadata(fantasy.NewTextResponse(stdout), metadata), nil
 			}
 
@@ -363,19 +386,42 @@ func NewBashTool(permissions permission.Service, workingDir string, attribution
 				Background:       true,
 				ShellID:          bgShell.ID,
 			}
-			response := fmt.Sprintf("Command is taking longer than expected and has been moved to background.\n\nBackground shell ID: %s\n\nUse job_output tool to view output or job_kill to terminate.", bgShell.ID)
+			response := fmt.Sprintf("Command is taking longer than expected and has been moved to background.\n\nBackground shell ID: %s\n\nUse job_output to view output, job_wait to wait for it to finish or print something, or job_kill to terminate.", bgShell.ID)
+			if bgShell.PTY {
+				response += " Use job_input to answer its prompts."
+			}
 			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(response), metadata), nil
 		})
 }
 
+// startBashJob starts the command as a background job in a copy of the
+// session's shell, in a pseudo-terminal if asked. The job uses a detached
+// context so that it keeps running after the tool returns.
+func startBashJob(bgManager *shell.BackgroundShellManager, sessionID string, sessionShell *shell.Shell, workingDir string, params BashParams) (*shell.BackgroundShell, error) {
+	jobShell := sessionShell.Clone()
+	if err := jobShell.SetWorkingDir(workingDir); err != nil {
+		return nil, err
+	}
+	jobShell.SetBlockFuncs(blockFuncs())
+	return bgManager.StartShell(context.Background(), sessionID, jobShell, params.Command, params.Description, params.PTY)
+}
+
+// commandState returns the state a command left in the shell of its job, for
+// the next commands of the session. The working directory the command was
+// asked to run in only carries over when the command itself moved to it.
+func commandState(jobShell, sessionShell *shell.Shell, execWorkingDir string) shell.State {
+	state := jobShell.State()
+	if state.WorkingDir == execWorkingDir {
+		state.WorkingDir = sessionShell.GetWorkingDir()
+	}
+	return state
+}
+
 // formatOutput formats the output of a completed command with error handling
 func formatOutput(stdout, stderr string, execErr error) string {
 	interrupted := shell.IsInterrupt(execErr)
 	exitCode := shell.ExitCode(execErr)
 
-	stdout = truncateOutput(stdout)
-	stderr = truncateOutput(stderr)
-
 	errorMessage := stderr
 	if errorMessage == "" && execErr != nil {
 		errorMessage = execErr.Error()
@@ -406,26 +452,6 @@ func formatOutput(stdout, stderr string, execErr error) string {
 	return stdout
 }
 
-func truncateOutput(content string) string {
-	if len(content) <= MaxOutputLength {
-		return content
-	}
-
-	halfLength := MaxOutputLength / 2
-	start := content[:halfLength]
-	end := content[len(content)-halfLength:]
-
-	truncatedLinesCount := countLines(content[halfLength : len(content)-halfLength])
-	return fmt.Sprintf("%s\n\n... [%d lines truncated] ...\n\n%s", start, truncatedLinesCount, end)
-}
-
-func countLines(s string) int {
-	if s == "" {
-		return 0
-	}
-	return len(strings.Split(s, "\n"))
-}
-
 func normalizeWorkingDir(path string) string {
 	if runtime.GOOS == "windows" {
 		cwd, err := os.Getwd()
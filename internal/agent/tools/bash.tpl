@@ -11,22 +11,24 @@ Common shell builtins and core utils available on Windows.
 2. Security Check: Banned commands ({{ .BannedCommands }}) return error - explain to user. Safe read-only commands execute without prompts
 3. Command Execution: Execute with proper quoting, capture output
 4. Auto-Background: Commands exceeding 1 minute automatically move to background and return shell ID
-5. Output Processing: Truncate if exceeds {{ .MaxOutputLength }} characters
+5. Output Processing: Long output is saved to a file and replaced with its start and end, plus the path to read the rest from
 6. Return Result: Include errors, metadata with <cwd></cwd> tags
 </execution_steps>
 
 <usage_notes>
 - Command required, working_dir optional (defaults to current directory)
 - IMPORTANT: Use Grep/Glob/Agent tools instead of 'find'/'grep'. Use View/LS tools instead of 'cat'/'head'/'tail'/'ls'
+- Use the Test tool instead of running go test, jest, vitest or pytest: it returns the failures without the full output
 - Chain with ';' or '&&', avoid newlines except in quoted strings
-- Each command runs in independent shell (no state persistence between calls)
+- Each session has its own shell: working directory, exported variables and functions carry over between foreground commands (not from background jobs)
 - Prefer absolute paths over 'cd' (use 'cd' only if user explicitly requests)
 </usage_notes>
 
 <background_execution>
 - Set run_in_background=true to run commands in a separate background shell
 - Returns a shell ID for managing the background process
-- Use job_output tool to view current output from background shell
+- Use job_output tool to view current output from background shell; pass since_offset to read only new output
+- Use job_wait tool to wait for a background shell to exit or print a pattern (e.g. a dev server being ready), instead of polling or sleeping
 - Use job_kill tool to terminate a background shell
 - IMPORTANT: NEVER use `&` at the end of commands to run in background - use run_in_background parameter instead
 - Commands that should run in background:
@@ -42,15 +44,22 @@ Common shell builtins and core utils available on Windows.
   * Short-lived scripts
 </background_execution>
 
+<interactive_commands>
+- Set pty=true to run a command in a pseudo-terminal, for commands that need a TTY (colored output, isatty checks) or prompt for input (`npm init`, REPLs, interactive installers)
+- Terminal escape sequences are stripped from the output you see
+- For commands that prompt for input, also set run_in_background=true, then answer the prompts with the job_input tool and check the new output it returns
+- Prefer non-interactive flags (e.g. `npm init -y`, `--yes`, `--no-input`) when available; use pty only when there's no such option
+</interactive_commands>
+
 <git_commits>
 When user asks to create git commit:
 
 1. Single message with three tool_use blocks (IMPORTANT for speed):
-   - git status (untracked files)
-   - git diff (staged/unstaged changes)
+   - git_status tool (untracked files)
+   - git_diff tool (staged/unstaged changes)
    - git log (recent commit message style)
 
-2. Add relevant untracked files to staging. Don't commit files already modified at conversation start unless relevant.
+2. Pick the files to commit. Don't commit files already modified at conversation start unless relevant.
 
 3. Analyze staged changes in <commit_analysis> tags:
    - List changed/added files, summarize nature (feature/enhancement/bug fix/refactoring/test/docs)
@@ -60,7 +69,8 @@ When user asks to create git commit:
    - Use clear language, accurate reflection ("add"=new feature, "update"=enhancement, "fix"=bug fix)
    - Avoid generic messages, review draft
 
-4. Create commit{{ if or (eq .Attribution.TrailerStyle "assisted-by") (eq .Attribution.TrailerStyle "co-authored-by")}} with attribution{{ end }} using HEREDOC:
+4. Create the commit with the git_commit tool, passing the files to stage or all=true. It adds the attribution and refuses to commit secrets; don't work around it with bash.
+   Only if the git_commit tool isn't available, create commit{{ if or (eq .Attribution.TrailerStyle "assisted-by") (eq .Attribution.TrailerStyle "co-authored-by")}} with attribution{{ end }} using HEREDOC:
    git commit -m "$(cat <<'EOF'
    Commit message here.
 
@@ -80,9 +90,9 @@ When user asks to create git commit:
 
 5. If pre-commit hook fails, retry ONCE. If fails again, hook preventing commit. If succeeds but files modified, MUST amend.
 
-6. Run git status to verify.
+6. Run git_status to verify.
 
-Notes: Use "git commit -am" when possible, don't stage unrelated files, NEVER update config, don't push, no -i flags, no empty commits, return empty response.
+Notes: Don't stage unrelated files, NEVER update config, don't push, no -i flags, no empty commits, return empty response.
 </git_commits>
 
 <pull_requests>
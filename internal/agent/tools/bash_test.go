@@ -0,0 +1,32 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/mudaaaa/crushplus/internal/shell"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandState(t *testing.T) {
+	t.Parallel()
+
+	sessionDir, execDir, otherDir := t.TempDir(), t.TempDir(), t.TempDir()
+	sessionShell := shell.NewShell(&shell.Options{WorkingDir: sessionDir})
+
+	run := func(command string) shell.State {
+		jobShell := sessionShell.Clone()
+		require.NoError(t, jobShell.SetWorkingDir(execDir))
+		_, _, err := jobShell.Exec(t.Context(), command)
+		require.NoError(t, err)
+		return commandState(jobShell, sessionShell, execDir)
+	}
+
+	// Running in another directory doesn't move the session there.
+	state := run("export FOO=bar")
+	require.Equal(t, sessionDir, state.WorkingDir)
+	require.Contains(t, state.Env, "FOO=bar")
+
+	// Moving to a directory does.
+	state = run("cd " + otherDir)
+	require.Equal(t, otherDir, state.WorkingDir)
+}
@@ -0,0 +1,102 @@
+package tools
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/codeindex"
+)
+
+type CodeSearchParams struct {
+	Query string `json:"query" description:"The identifiers or words to look for"`
+	Path  string `json:"path,omitempty" description:"Only search the files under this directory or file"`
+	Limit int    `json:"limit,omitempty" description:"The number of results (default 10, max 50)"`
+}
+
+type CodeSearchResponseMetadata struct {
+	NumberOfResults int `json:"number_of_results"`
+	IndexedFiles    int `json:"indexed_files"`
+}
+
+const (
+	CodeSearchToolName = "code_search"
+
+	defaultCodeSearchLimit = 10
+	maxCodeSearchLimit     = 50
+	// maxCodeSearchSymbols is the number of definitions listed by result.
+	maxCodeSearchSymbols = 5
+)
+
+//go:embed code_search.md
+var codeSearchDescription []byte
+
+func NewCodeSearchTool(index *codeindex.Index, workingDir string) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		CodeSearchToolName,
+		string(codeSearchDescription),
+		func(ctx context.Context, params CodeSearchParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if strings.TrimSpace(params.Query) == "" {
+				return fantasy.NewTextErrorResponse("query is required"), nil
+			}
+			limit := params.Limit
+			if limit <= 0 {
+				limit = defaultCodeSearchLimit
+			}
+			limit = min(limit, maxCodeSearchLimit)
+
+			path := params.Path
+			if filepath.IsAbs(path) {
+				rel, err := filepath.Rel(workingDir, path)
+				if err != nil || strings.HasPrefix(rel, "..") {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("path is outside of the project: %s", params.Path)), nil
+				}
+				path = rel
+			}
+
+			results, err := index.Search(ctx, params.Query, path, limit)
+			if err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+			stats := index.Stats()
+			metadata := CodeSearchResponseMetadata{
+				NumberOfResults: len(results),
+				IndexedFiles:    stats.Files,
+			}
+			if len(results) == 0 {
+				return fantasy.WithResponseMetadata(
+					fantasy.NewTextResponse(fmt.Sprintf("No results for %q in %d indexed files. Try other words, or grep for exact text.", params.Query, stats.Files)),
+					metadata,
+				), nil
+			}
+			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(formatCodeSearchResults(params.Query, results, stats.Files)), metadata), nil
+		})
+}
+
+func formatCodeSearchResults(query string, results []codeindex.Result, files int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Found %d results for %q in %d indexed files, best first:\n", len(results), query, files)
+	for _, r := range results {
+		fmt.Fprintf(&sb, "\n%s:%d-%d", r.Path, r.StartLine, r.EndLine)
+		if len(r.Symbols) > 0 {
+			var names []string
+			for i, s := range r.Symbols {
+				if i == maxCodeSearchSymbols {
+					names = append(names, fmt.Sprintf("%d more", len(r.Symbols)-i))
+					break
+				}
+				names = append(names, fmt.Sprintf("%s %s", s.Kind, s.Name))
+			}
+			fmt.Fprintf(&sb, " (%s)", strings.Join(names, ", "))
+		}
+		sb.WriteString("\n")
+		if r.Snippet != "" {
+			sb.WriteString(r.Snippet)
+			sb.WriteString("\n")
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,41 @@
+package tools
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/codeindex"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodeSearchTool(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config/load.go": "package config\n\n// ParseConfigFile reads the configuration.\nfunc ParseConfigFile(path string) error {\n\treturn nil\n}\n",
+		"main.go":        "package main\n\nfunc main() {}\n",
+	})
+	tool := NewCodeSearchTool(codeindex.New(dir, t.TempDir()), dir)
+
+	resp, err := tool.Run(t.Context(), fantasy.ToolCall{ID: "call_1", Input: `{"query":"parseConfig"}`})
+	require.NoError(t, err)
+	require.False(t, resp.IsError, resp.Content)
+	require.Contains(t, resp.Content, "Found 1 results for \"parseConfig\" in 2 indexed files")
+	require.Contains(t, resp.Content, "config/load.go:1-6 (function ParseConfigFile)")
+	require.Contains(t, resp.Content, "     4|func ParseConfigFile(path string) error {")
+
+	var metadata CodeSearchResponseMetadata
+	require.NoError(t, json.Unmarshal([]byte(resp.Metadata), &metadata))
+	require.Equal(t, CodeSearchResponseMetadata{NumberOfResults: 1, IndexedFiles: 2}, metadata)
+
+	resp, err = tool.Run(t.Context(), fantasy.ToolCall{ID: "call_2", Input: `{"query":"parse config","path":"` + filepath.Join(dir, "main.go") + `"}`})
+	require.NoError(t, err)
+	require.Contains(t, resp.Content, "No results")
+
+	resp, err = tool.Run(t.Context(), fantasy.ToolCall{ID: "call_3", Input: `{"query":"config","path":"/elsewhere"}`})
+	require.NoError(t, err)
+	require.True(t, resp.IsError)
+}
@@ -48,10 +48,138 @@ func notifyLSPs(ctx context.Context, lsps *csync.Map[string, *lsp.Client], filep
 		}
 		_ = client.OpenFileOnDemand(ctx, filepath)
 		_ = client.NotifyChange(ctx, filepath)
-		client.WaitForDiagnostics(ctx, 5*time.Second)
+		client.WaitForDiagnosticsSettled(ctx, diagnosticsQuietPeriod, 5*time.Second)
 	}
 }
 
+// diagnosticsQuietPeriod is how long diagnostics must stay unchanged before
+// we consider the LSP server to have settled after a change.
+const diagnosticsQuietPeriod = 300 * time.Millisecond
+
+// diagnosticEntry is a single diagnostic along with where it came from.
+type diagnosticEntry struct {
+	path   string
+	source string
+	diag   protocol.Diagnostic
+}
+
+// key identifies a diagnostic independently of its position, so that edits
+// which only shift lines around don't make existing problems look new.
+func (e diagnosticEntry) key() string {
+	return fmt.Sprintf("%s|%d|%s|%v|%s", e.path, e.diag.Severity, e.diag.Source, e.diag.Code, e.diag.Message)
+}
+
+func (e diagnosticEntry) String() string {
+	return formatDiagnostic(e.path, e.diag, e.source)
+}
+
+// diagnosticsSnapshot holds all diagnostics known to the LSP clients at a
+// point in time.
+type diagnosticsSnapshot []diagnosticEntry
+
+// snapshotDiagnostics records the current diagnostics so they can later be
+// compared against the diagnostics produced after an edit. The file is opened
+// on demand first, so its baseline diagnostics are known.
+func snapshotDiagnostics(ctx context.Context, lsps *csync.Map[string, *lsp.Client], filepath string) diagnosticsSnapshot {
+	if filepath != "" {
+		for client := range lsps.Seq() {
+			if !client.HandlesFile(filepath) || client.IsFileOpen(filepath) {
+				continue
+			}
+			if err := client.OpenFile(ctx, filepath); err != nil {
+				continue
+			}
+			client.WaitForDiagnosticsSettled(ctx, diagnosticsQuietPeriod, 2*time.Second)
+		}
+	}
+	return collectDiagnostics(lsps)
+}
+
+func collectDiagnostics(lsps *csync.Map[string, *lsp.Client]) diagnosticsSnapshot {
+	var entries diagnosticsSnapshot
+	for lspName, client := range lsps.Seq2() {
+		for location, diags := range client.GetDiagnostics() {
+			path, err := location.Path()
+			if err != nil {
+				slog.Error("Failed to convert diagnostic location URI to path", "uri", location, "error", err)
+				continue
+			}
+			for _, diag := range diags {
+				entries = append(entries, diagnosticEntry{path: path, source: lspName, diag: diag})
+			}
+		}
+	}
+	return entries
+}
+
+// diagnosticsDelta is the difference between two diagnostic snapshots.
+type diagnosticsDelta struct {
+	added    []string
+	resolved []string
+	// unchanged holds the diagnostics present both before and after.
+	unchanged []string
+}
+
+func diffDiagnostics(before, after diagnosticsSnapshot) diagnosticsDelta {
+	var delta diagnosticsDelta
+
+	beforeCounts := make(map[string]int, len(before))
+	for _, e := range before {
+		beforeCounts[e.key()]++
+	}
+	afterCounts := make(map[string]int, len(after))
+	for _, e := range after {
+		afterCounts[e.key()]++
+	}
+
+	for _, e := range after {
+		k := e.key()
+		if beforeCounts[k] > 0 {
+			beforeCounts[k]--
+			delta.unchanged = append(delta.unchanged, e.String())
+			continue
+		}
+		delta.added = append(delta.added, e.String())
+	}
+	for _, e := range before {
+		k := e.key()
+		if afterCounts[k] > 0 {
+			afterCounts[k]--
+			continue
+		}
+		delta.resolved = append(delta.resolved, e.String())
+	}
+
+	sortDiagnostics(delta.added)
+	sortDiagnostics(delta.resolved)
+	return delta
+}
+
+// getDiagnosticsDelta reports only the diagnostics introduced or resolved
+// since the before snapshot was taken, plus a count of the pre-existing ones.
+func getDiagnosticsDelta(before diagnosticsSnapshot, lsps *csync.Map[string, *lsp.Client]) string {
+	after := collectDiagnostics(lsps)
+	if len(before) == 0 && len(after) == 0 {
+		return ""
+	}
+
+	delta := diffDiagnostics(before, after)
+
+	var output strings.Builder
+	writeDiagnostics(&output, "new_diagnostics", delta.added)
+	writeDiagnostics(&output, "resolved_diagnostics", delta.resolved)
+
+	output.WriteString("\n<diagnostic_summary>\n")
+	fmt.Fprintf(&output, "New: %d errors, %d warnings\n", countSeverity(delta.added, "Error"), countSeverity(delta.added, "Warn"))
+	fmt.Fprintf(&output, "Resolved: %d errors, %d warnings\n", countSeverity(delta.resolved, "Error"), countSeverity(delta.resolved, "Warn"))
+	fmt.Fprintf(&output, "Pre-existing (unchanged, not caused by this edit): %d errors, %d warnings\n", countSeverity(delta.unchanged, "Error"), countSeverity(delta.unchanged, "Warn"))
+	output.WriteString("</diagnostic_summary>\n")
+
+	out := output.String()
+	slog.Info("Diagnostics delta", "output", out)
+	return out
+}
+
 func getDiagnostics(filePath string, lsps *csync.Map[string, *lsp.Client]) string {
 	fileDiagnostics := []string{}
 	projectDiagnostics := []string{}
@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/x/powernap/pkg/lsp/protocol"
+	"github.com/stretchr/testify/require"
+)
+
+func newDiagnosticEntry(path string, line uint32, severity protocol.DiagnosticSeverity, message string) diagnosticEntry {
+	return diagnosticEntry{
+		path:   path,
+		source: "gopls",
+		diag: protocol.Diagnostic{
+			Range:    protocol.Range{Start: protocol.Position{Line: line}},
+			Severity: severity,
+			Message:  message,
+		},
+	}
+}
+
+func TestDiffDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	t.Run("reports new and resolved diagnostics", func(t *testing.T) {
+		t.Parallel()
+
+		before := diagnosticsSnapshot{
+			newDiagnosticEntry("/a.go", 1, protocol.SeverityWarning, "unused variable x"),
+			newDiagnosticEntry("/b.go", 4, protocol.SeverityError, "undefined: foo"),
+		}
+		after := diagnosticsSnapshot{
+			newDiagnosticEntry("/a.go", 1, protocol.SeverityWarning, "unused variable x"),
+			newDiagnosticEntry("/a.go", 9, protocol.SeverityError, "missing return"),
+		}
+
+		delta := diffDiagnostics(before, after)
+		require.Len(t, delta.added, 1)
+		require.Contains(t, delta.added[0], "missing return")
+		require.Len(t, delta.resolved, 1)
+		require.Contains(t, delta.resolved[0], "undefined: foo")
+		require.Len(t, delta.unchanged, 1)
+	})
+
+	t.Run("ignores line shifts", func(t *testing.T) {
+		t.Parallel()
+
+		before := diagnosticsSnapshot{
+			newDiagnosticEntry("/a.go", 10, protocol.SeverityWarning, "unused variable x"),
+		}
+		after := diagnosticsSnapshot{
+			newDiagnosticEntry("/a.go", 14, protocol.SeverityWarning, "unused variable x"),
+		}
+
+		delta := diffDiagnostics(before, after)
+		require.Empty(t, delta.added)
+		require.Empty(t, delta.resolved)
+		require.Len(t, delta.unchanged, 1)
+	})
+
+	t.Run("counts duplicate messages", func(t *testing.T) {
+		t.Parallel()
+
+		before := diagnosticsSnapshot{
+			newDiagnosticEntry("/a.go", 1, protocol.SeverityError, "undefined: foo"),
+		}
+		after := diagnosticsSnapshot{
+			newDiagnosticEntry("/a.go", 1, protocol.SeverityError, "undefined: foo"),
+			newDiagnosticEntry("/a.go", 7, protocol.SeverityError, "undefined: foo"),
+		}
+
+		delta := diffDiagnostics(before, after)
+		require.Len(t, delta.added, 1)
+		require.Empty(t, delta.resolved)
+		require.Len(t, delta.unchanged, 1)
+	})
+}
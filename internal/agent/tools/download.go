@@ -9,7 +9,6 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"charm.land/fantasy"
@@ -34,17 +33,8 @@ const DownloadToolName = "download"
 //go:embed download.md
 var downloadDescription []byte
 
-func NewDownloadTool(permissions permission.Service, workingDir string, client *http.Client) fantasy.AgentTool {
-	if client == nil {
-		client = &http.Client{
-			Timeout: 5 * time.Minute, // Default 5 minute timeout for downloads
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     90 * time.Second,
-			},
-		}
-	}
+func NewDownloadTool(permissions permission.Service, workingDir string, opts FetchOptions) fantasy.AgentTool {
+	client := opts.HTTPClient(5 * time.Minute) // Default 5 minute timeout for downloads
 	return fantasy.NewAgentTool(
 		DownloadToolName,
 		string(downloadDescription),
@@ -57,8 +47,8 @@ func NewDownloadTool(permissions permission.Service, workingDir string, client *
 				return fantasy.NewTextErrorResponse("file_path parameter is required"), nil
 			}
 
-			if !strings.HasPrefix(params.URL, "http://") && !strings.HasPrefix(params.URL, "https://") {
-				return fantasy.NewTextErrorResponse("URL must start with http:// or https://"), nil
+			if err := opts.CheckURL(ctx, client, params.URL); err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
 			}
 
 			filePath := filepathext.SmartJoin(workingDir, params.FilePath)
@@ -115,7 +105,7 @@ func NewDownloadTool(permissions permission.Service, workingDir string, client *
 			}
 
 			// Check content length if available
-			maxSize := int64(100 * 1024 * 1024) // 100MB
+			maxSize := opts.DownloadLimit()
 			if resp.ContentLength > maxSize {
 				return fantasy.NewTextErrorResponse(fmt.Sprintf("File too large: %d bytes (max %d bytes)", resp.ContentLength, maxSize)), nil
 			}
@@ -133,14 +123,14 @@ func NewDownloadTool(permissions permission.Service, workingDir string, client *
 			defer outFile.Close()
 
 			// Copy data with size limit
-			limitedReader := io.LimitReader(resp.Body, maxSize)
+			limitedReader := io.LimitReader(resp.Body, maxSize+1)
 			bytesWritten, err := io.Copy(outFile, limitedReader)
 			if err != nil {
 				return fantasy.ToolResponse{}, fmt.Errorf("failed to write file: %w", err)
 			}
 
-			// Check if we hit the size limit
-			if bytesWritten == maxSize {
+			// Check if we went over the size limit
+			if bytesWritten > maxSize {
 				// Clean up the file since it might be incomplete
 				os.Remove(filePath)
 				return fantasy.NewTextErrorResponse(fmt.Sprintf("File too large: exceeded %d bytes limit", maxSize)), nil
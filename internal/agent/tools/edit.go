@@ -67,6 +67,7 @@ func NewEditTool(lspClients *csync.Map[string, *lsp.Client], permissions permiss
 			var response fantasy.ToolResponse
 			var err error
 
+			diagnosticsBefore := snapshotDiagnostics(ctx, lspClients, params.FilePath)
 			editCtx := editContext{ctx, permissions, files, workingDir}
 
 			if params.OldString == "" {
@@ -96,7 +97,7 @@ func NewEditTool(lspClients *csync.Map[string, *lsp.Client], permissions permiss
 			notifyLSPs(ctx, lspClients, params.FilePath)
 
 			text := fmt.Sprintf("<result>\n%s\n</result>\n", response.Content)
-			text += getDiagnostics(params.FilePath, lspClients)
+			text += getDiagnosticsDelta(diagnosticsBefore, lspClients)
 			response.Content = text
 			return response, nil
 		})
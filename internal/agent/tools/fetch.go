@@ -4,7 +4,6 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -21,17 +20,8 @@ const FetchToolName = "fetch"
 //go:embed fetch.md
 var fetchDescription []byte
 
-func NewFetchTool(permissions permission.Service, workingDir string, client *http.Client) fantasy.AgentTool {
-	if client == nil {
-		client = &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     90 * time.Second,
-			},
-		}
-	}
+func NewFetchTool(permissions permission.Service, workingDir string, opts FetchOptions) fantasy.AgentTool {
+	client := opts.HTTPClient(30 * time.Second)
 
 	return fantasy.NewAgentTool(
 		FetchToolName,
@@ -46,8 +36,8 @@ func NewFetchTool(permissions permission.Service, workingDir string, client *htt
 				return fantasy.NewTextErrorResponse("Format must be one of: text, markdown, html"), nil
 			}
 
-			if !strings.HasPrefix(params.URL, "http://") && !strings.HasPrefix(params.URL, "https://") {
-				return fantasy.NewTextErrorResponse("URL must start with http:// or https://"), nil
+			if err := opts.CheckURL(ctx, client, params.URL); err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
 			}
 
 			sessionID := GetSessionFromContext(ctx)
@@ -100,8 +90,8 @@ func NewFetchTool(permissions permission.Service, workingDir string, client *htt
 				return fantasy.NewTextErrorResponse(fmt.Sprintf("Request failed with status code: %d", resp.StatusCode)), nil
 			}
 
-			maxSize := int64(5 * 1024 * 1024) // 5MB
-			body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize))
+			maxSize := opts.ResponseLimit()
+			body, truncated, err := readBody(resp.Body, maxSize)
 			if err != nil {
 				return fantasy.NewTextErrorResponse("Failed to read response body: " + err.Error()), nil
 			}
@@ -157,6 +147,8 @@ func NewFetchTool(permissions permission.Service, workingDir string, client *htt
 			if contentSize > MaxReadSize {
 				content = content[:MaxReadSize]
 				content += fmt.Sprintf("\n\n[Content truncated to %d bytes]", MaxReadSize)
+			} else if truncated {
+				content += truncationNotice(maxSize)
 			}
 
 			return fantasy.NewTextResponse(content), nil
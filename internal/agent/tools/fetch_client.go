@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mudaaaa/crushplus/internal/httpcache"
+	"github.com/mudaaaa/crushplus/internal/permission"
+)
+
+const (
+	defaultMaxResponseSize = 5 * 1024 * 1024   // 5MB
+	defaultMaxDownloadSize = 100 * 1024 * 1024 // 100MB
+)
+
+// FetchOptions configures the tools that fetch and download URLs.
+type FetchOptions struct {
+	// Client makes the requests. When nil, the tools make a client that
+	// caches the responses in CacheDir and enforces Domains on every
+	// request, redirects included.
+	Client *http.Client
+	// CacheDir is the directory of the cache of the responses. Nothing is
+	// cached when it's empty.
+	CacheDir string
+	// Domains restricts the hosts the tools can reach.
+	Domains permission.DomainPolicy
+	// MaxResponseSize is the size of the fetched pages over which they're
+	// truncated, 5MB by default.
+	MaxResponseSize int64
+	// MaxDownloadSize is the size of the largest downloads, 100MB by
+	// default.
+	MaxDownloadSize int64
+	// RespectRobotsTxt refuses the URLs the robots.txt of their site
+	// disallows.
+	RespectRobotsTxt bool
+}
+
+// HTTPClient returns the client of the tools, with the given timeout when
+// it's made.
+func (o FetchOptions) HTTPClient(timeout time.Duration) *http.Client {
+	if o.Client != nil {
+		return o.Client
+	}
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 10,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if o.CacheDir != "" {
+		transport = httpcache.New(o.CacheDir, transport, o.ResponseLimit())
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: o.Domains.Transport(transport),
+	}
+}
+
+// ResponseLimit returns the size over which fetched pages are truncated.
+func (o FetchOptions) ResponseLimit() int64 {
+	if o.MaxResponseSize > 0 {
+		return o.MaxResponseSize
+	}
+	return defaultMaxResponseSize
+}
+
+// DownloadLimit returns the size of the largest downloads.
+func (o FetchOptions) DownloadLimit() int64 {
+	if o.MaxDownloadSize > 0 {
+		return o.MaxDownloadSize
+	}
+	return defaultMaxDownloadSize
+}
+
+// CheckURL tells whether the URL can be fetched, before asking the user: it
+// must be HTTP, on a host the domain policy allows, and not disallowed by
+// robots.txt when it's respected.
+func (o FetchOptions) CheckURL(ctx context.Context, client *http.Client, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("URL must start with http:// or https://")
+	}
+	if err := o.Domains.Check(rawURL); err != nil {
+		return err
+	}
+	if o.RespectRobotsTxt && !robotsAllowed(ctx, client, u) {
+		return fmt.Errorf("the robots.txt of %s disallows fetching %s", u.Host, u.Path)
+	}
+	return nil
+}
+
+// readBody reads a response body of max bytes at most, and reports whether
+// it was truncated. A character cut by the truncation is dropped.
+func readBody(r io.Reader, max int64) ([]byte, bool, error) {
+	body, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) <= max {
+		return body, false, nil
+	}
+	body = body[:max]
+	for i := len(body) - 1; i >= 0 && i >= len(body)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(body[i]) {
+			if !utf8.FullRune(body[i:]) {
+				body = body[:i]
+			}
+			break
+		}
+	}
+	return body, true, nil
+}
+
+func truncationNotice(max int64) string {
+	return fmt.Sprintf("\n\n[Response truncated: it's larger than the limit of %d bytes. Only its beginning is shown.]", max)
+}
@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"unicode/utf8"
@@ -15,7 +14,8 @@ import (
 )
 
 // FetchURLAndConvert fetches a URL and converts HTML content to markdown.
-func FetchURLAndConvert(ctx context.Context, client *http.Client, url string) (string, error) {
+// Responses over maxSize bytes are truncated, with a notice.
+func FetchURLAndConvert(ctx context.Context, client *http.Client, url string, maxSize int64) (string, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
@@ -33,8 +33,7 @@ func FetchURLAndConvert(ctx context.Context, client *http.Client, url string) (s
 		return "", fmt.Errorf("request failed with status code: %d", resp.StatusCode)
 	}
 
-	maxSize := int64(5 * 1024 * 1024) // 5MB
-	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize))
+	body, truncated, err := readBody(resp.Body, maxSize)
 	if err != nil {
 		return "", fmt.Errorf("failed to read response body: %w", err)
 	}
@@ -63,6 +62,9 @@ func FetchURLAndConvert(ctx context.Context, client *http.Client, url string) (s
 		// If formatting fails, keep original content.
 	}
 
+	if truncated {
+		content += truncationNotice(maxSize)
+	}
 	return content, nil
 }
 
@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/permission"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchTool(t *testing.T) {
+	t.Parallel()
+
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Header().Set("Cache-Control", "max-age=60")
+			io.WriteString(w, "User-agent: *\nDisallow: /private\n")
+		case "/page":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Cache-Control", "max-age=60")
+			io.WriteString(w, "hello")
+		case "/large":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, strings.Repeat("é", 100))
+		case "/redirect":
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+		default:
+			io.WriteString(w, "other")
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.WithValue(t.Context(), SessionIDContextKey, "session")
+	run := func(tool fantasy.AgentTool, input string) fantasy.ToolResponse {
+		t.Helper()
+		resp, err := tool.Run(ctx, fantasy.ToolCall{ID: "call", Input: input})
+		require.NoError(t, err)
+		return resp
+	}
+	opts := FetchOptions{
+		CacheDir:         t.TempDir(),
+		Domains:          permission.NewDomainPolicy([]string{"127.0.0.1"}, nil),
+		MaxResponseSize:  51,
+		RespectRobotsTxt: true,
+	}
+
+	t.Run("caches responses", func(t *testing.T) {
+		tool := NewFetchTool(&mockPermissionService{}, t.TempDir(), opts)
+		resp := run(tool, `{"url":"`+server.URL+`/page","format":"text"}`)
+		require.False(t, resp.IsError, resp.Content)
+		require.Equal(t, "hello", resp.Content)
+		before := hits.Load()
+		require.Equal(t, "hello", run(tool, `{"url":"`+server.URL+`/page","format":"text"}`).Content)
+		require.Equal(t, before, hits.Load())
+	})
+
+	t.Run("truncates large responses", func(t *testing.T) {
+		resp := run(NewFetchTool(&mockPermissionService{}, t.TempDir(), opts), `{"url":"`+server.URL+`/large","format":"text"}`)
+		require.False(t, resp.IsError, resp.Content)
+		// The last character cut in half is dropped.
+		require.True(t, strings.HasPrefix(resp.Content, strings.Repeat("é", 25)+"\n\n[Response truncated"), resp.Content)
+		require.Contains(t, resp.Content, "limit of 51 bytes")
+	})
+
+	t.Run("checks domains before prompting", func(t *testing.T) {
+		denied := opts
+		denied.Domains = permission.NewDomainPolicy([]string{"example.com"}, nil)
+		resp := run(NewFetchTool(&denyPermissionService{}, t.TempDir(), denied), `{"url":"`+server.URL+`/page","format":"text"}`)
+		require.True(t, resp.IsError)
+		require.Contains(t, resp.Content, "isn't in the allowed domains")
+
+		resp = run(NewDownloadTool(&denyPermissionService{}, t.TempDir(), denied), `{"url":"`+server.URL+`/page","file_path":"page.txt"}`)
+		require.True(t, resp.IsError)
+		require.Contains(t, resp.Content, "isn't in the allowed domains")
+	})
+
+	t.Run("checks domains of redirects", func(t *testing.T) {
+		target := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/page"
+		resp := run(NewWebFetchTool(t.TempDir(), opts), `{"url":"`+server.URL+`/redirect?to=`+url.QueryEscape(target)+`"}`)
+		require.True(t, resp.IsError)
+		require.Contains(t, resp.Content, "localhost isn't in the allowed domains")
+	})
+
+	t.Run("respects robots.txt", func(t *testing.T) {
+		resp := run(NewFetchTool(&mockPermissionService{}, t.TempDir(), opts), `{"url":"`+server.URL+`/private/page","format":"text"}`)
+		require.True(t, resp.IsError)
+		require.Contains(t, resp.Content, "robots.txt")
+	})
+}
+
+func TestRobots(t *testing.T) {
+	t.Parallel()
+
+	robots := `# Comment
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+
+User-agent: other
+User-agent: Crush
+Disallow: /
+Allow: /docs
+`
+	rules := parseRobots(strings.NewReader(robots), "googlebot")
+	require.True(t, robotsMatch(rules, "/"))
+	require.False(t, robotsMatch(rules, "/private/page"))
+	require.True(t, robotsMatch(rules, "/private/public/page"))
+	require.False(t, robotsMatch(rules, "/files/doc.pdf"))
+	require.True(t, robotsMatch(rules, "/files/doc.pdf?x=1"))
+
+	rules = parseRobots(strings.NewReader(robots), robotsUserAgent)
+	require.False(t, robotsMatch(rules, "/private/public"))
+	require.True(t, robotsMatch(rules, "/docs/intro"))
+
+	require.True(t, robotsMatch(parseRobots(strings.NewReader("User-agent: *\nDisallow:\n"), robotsUserAgent), "/any"))
+}
@@ -0,0 +1,14 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validateGitArg refuses arguments that git would take for options.
+func validateGitArg(name, value string) error {
+	if strings.HasPrefix(value, "-") {
+		return fmt.Errorf("%s can't start with a dash: %s", name, value)
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package tools
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/config"
+	"github.com/mudaaaa/crushplus/internal/gitcmd"
+	"github.com/mudaaaa/crushplus/internal/permission"
+	"github.com/mudaaaa/crushplus/internal/redact"
+)
+
+type GitCommitParams struct {
+	Message string   `json:"message" description:"The commit message: a short summary line, then optionally a blank line and a body. Attribution is added automatically"`
+	Files   []string `json:"files,omitempty" description:"Files to stage before committing, new ones included (defaults to committing what's already staged)"`
+	All     bool     `json:"all,omitempty" description:"Stage the changes of all tracked files before committing, like git commit -a"`
+}
+
+type GitCommitPermissionsParams struct {
+	Message string   `json:"message"`
+	Files   []string `json:"files"`
+	Stat    string   `json:"stat"`
+	Diff    string   `json:"diff"`
+}
+
+type GitCommitResponseMetadata struct {
+	Hash    string   `json:"hash"`
+	Message string   `json:"message"`
+	Files   []string `json:"files"`
+	Stat    string   `json:"stat"`
+}
+
+const (
+	GitCommitToolName = "git_commit"
+
+	// maxCommitPreviewLines is the number of lines of the diff shown in the
+	// preview of the commit.
+	maxCommitPreviewLines = 2000
+)
+
+//go:embed git_commit.md
+var gitCommitDescription []byte
+
+var (
+	// crushAttribution matches the attribution lines the model may write
+	// itself, which are replaced with the configured ones.
+	crushAttribution = regexp.MustCompile(`(?im)^[ \t]*(?:(?:💘[ \t]*)?Generated with Crush|(?:Co-Authored-By|Assisted-by):.*\bCrush\b.*)[ \t]*$`)
+
+	// sensitiveFileName matches the names of files that usually hold
+	// secrets, like .env files and private keys.
+	sensitiveFileName = regexp.MustCompile(`(?i)(^|/)(\.env(\.[^/]+)?|id_(rsa|dsa|ecdsa|ed25519)|[^/]+\.(pem|key|p12|pfx|jks|keystore)|\.netrc|\.npmrc|\.pypirc|credentials(\.json)?)$`)
+	// sensitiveFileExample matches the examples of such files, which are
+	// meant to be committed.
+	sensitiveFileExample = regexp.MustCompile(`(?i)\.(example|sample|template|dist)$`)
+)
+
+func NewGitCommitTool(permissions permission.Service, workingDir string, attribution *config.Attribution, modelName string, redactor *redact.Redactor) fantasy.AgentTool {
+	// Secrets are never committed, even with redaction disabled.
+	if redactor == nil {
+		redactor = redact.New(nil, redact.DefaultPatterns)
+	}
+	return fantasy.NewAgentTool(
+		GitCommitToolName,
+		string(gitCommitDescription),
+		func(ctx context.Context, params GitCommitParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if strings.TrimSpace(params.Message) == "" {
+				return fantasy.NewTextErrorResponse("message is required"), nil
+			}
+			sessionID := GetSessionFromContext(ctx)
+			if sessionID == "" {
+				return fantasy.ToolResponse{}, fmt.Errorf("session ID is required for creating a commit")
+			}
+			if err := gitcmd.CheckRepository(ctx, workingDir); err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+
+			// The index is put back as it was unless the commit is made, so
+			// that a refused commit leaves nothing staged behind.
+			restoreIndex, err := snapshotGitIndex(ctx, workingDir)
+			if err != nil {
+				return fantasy.ToolResponse{}, fmt.Errorf("error reading the git index: %w", err)
+			}
+			committed := false
+			defer func() {
+				if !committed {
+					restoreIndex()
+				}
+			}()
+
+			if params.All {
+				if _, err := gitcmd.Run(ctx, workingDir, "", "add", "--update"); err != nil {
+					return fantasy.NewTextErrorResponse(err.Error()), nil
+				}
+			}
+			if len(params.Files) > 0 {
+				if _, err := gitcmd.Run(ctx, workingDir, "", append([]string{"add", "--"}, params.Files...)...); err != nil {
+					return fantasy.NewTextErrorResponse(err.Error()), nil
+				}
+			}
+
+			files, err := gitLines(ctx, workingDir, "diff", "--cached", "--name-only", "-z")
+			if err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+			if len(files) == 0 {
+				return fantasy.NewTextErrorResponse("nothing to commit: stage changes with files or all"), nil
+			}
+
+			if problems, err := findCommitSecrets(ctx, workingDir, redactor); err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			} else if len(problems) > 0 {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("Refusing to commit secrets, nothing was committed:\n%s\n\nRemove them from the commit, e.g. by loading them from the environment or ignoring the files. If they aren't secrets, ask the user to commit them.", strings.Join(problems, "\n"))), nil
+			}
+
+			stat, err := gitcmd.Run(ctx, workingDir, "", "diff", "--cached", "--no-color", "--stat")
+			if err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+			diff, err := gitcmd.Run(ctx, workingDir, "", "diff", "--cached", "--no-color", "--no-ext-diff")
+			if err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+			message := commitMessage(params.Message, attribution, modelName)
+
+			p := permissions.Request(
+				permission.CreatePermissionRequest{
+					SessionID:   sessionID,
+					Path:        workingDir,
+					ToolCallID:  call.ID,
+					ToolName:    GitCommitToolName,
+					Action:      "commit",
+					Description: fmt.Sprintf("Create commit: %s", commitSubject(message)),
+					Params: GitCommitPermissionsParams{
+						Message: message,
+						Files:   files,
+						Stat:    stat,
+						Diff:    truncateLines(diff, maxCommitPreviewLines),
+					},
+				},
+			)
+			if !p {
+				return fantasy.ToolResponse{}, permission.ErrorPermissionDenied
+			}
+
+			// Comments are kept, as lines starting with # are common in
+			// markdown.
+			if _, err := gitcmd.Run(ctx, workingDir, message, "commit", "--cleanup=whitespace", "--file=-"); err != nil {
+				// Hooks may have rejected the commit, leave the changes staged
+				// for the next try.
+				committed = true
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("The commit failed, the changes are still staged:\n%s", err)), nil
+			}
+			committed = true
+
+			hash, err := gitcmd.Run(ctx, workingDir, "", "rev-parse", "--short", "HEAD")
+			if err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+			metadata := GitCommitResponseMetadata{
+				Hash:    hash,
+				Message: message,
+				Files:   files,
+				Stat:    stat,
+			}
+			return fantasy.WithResponseMetadata(
+				fantasy.NewTextResponse(fmt.Sprintf("Committed %s: %s\n\n%s", hash, commitSubject(message), stat)),
+				metadata,
+			), nil
+		})
+}
+
+// commitMessage replaces the attribution the model wrote in the message with
+// the configured one.
+func commitMessage(message string, attribution *config.Attribution, modelName string) string {
+	message = crushAttribution.ReplaceAllString(message, "")
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	// Dropping attribution lines can leave runs of blank lines behind.
+	lines = slices.CompactFunc(lines, func(a, b string) bool {
+		return strings.TrimSpace(a) == "" && strings.TrimSpace(b) == ""
+	})
+	message = strings.Join(lines, "\n")
+
+	if attribution == nil {
+		return message + "\n"
+	}
+	if attribution.GeneratedWith {
+		message += "\n\n💘 Generated with Crush"
+	}
+	switch attribution.TrailerStyle {
+	case config.TrailerStyleAssistedBy:
+		if modelName != "" {
+			message += fmt.Sprintf("\n\nAssisted-by: %s via Crush <crush@charm.land>", modelName)
+		} else {
+			message += "\n\nAssisted-by: Crush <crush@charm.land>"
+		}
+	case config.TrailerStyleCoAuthoredBy:
+		message += "\n\nCo-Authored-By: Crush <crush@charm.land>"
+	}
+	return message + "\n"
+}
+
+func commitSubject(message string) string {
+	subject, _, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	return subject
+}
+
+// findCommitSecrets looks for files that usually hold secrets and for
+// secrets in the lines added by the staged changes.
+func findCommitSecrets(ctx context.Context, workingDir string, redactor *redact.Redactor) ([]string, error) {
+	var problems []string
+	files, err := gitLines(ctx, workingDir, "diff", "--cached", "--name-only", "-z", "--diff-filter=ACMR")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if sensitiveFileName.MatchString(file) && !sensitiveFileExample.MatchString(file) {
+			problems = append(problems, fmt.Sprintf("- %s: the file usually holds secrets", file))
+		}
+	}
+
+	diff, err := gitcmd.Run(ctx, workingDir, "", "diff", "--cached", "--no-color", "--no-ext-diff", "--unified=0", "--diff-filter=ACMR")
+	if err != nil {
+		return nil, err
+	}
+	var file string
+	var added []string
+	check := func() {
+		if len(added) == 0 {
+			return
+		}
+		if _, report := redactor.Redact(strings.Join(added, "\n")); len(report) > 0 {
+			problems = append(problems, fmt.Sprintf("- %s: %s", file, report))
+		}
+		added = nil
+	}
+	for line := range strings.SplitSeq(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			check()
+			file = strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+		case strings.HasPrefix(line, "+"):
+			added = append(added, line[1:])
+		}
+	}
+	check()
+	return problems, nil
+}
+
+// gitLines runs a git command printing NUL-separated paths.
+func gitLines(ctx context.Context, dir string, args ...string) ([]string, error) {
+	out, err := gitcmd.Run(ctx, dir, "", args...)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for line := range strings.SplitSeq(out, "\x00") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// snapshotGitIndex saves the git index of the repository, and returns a
+// function putting it back.
+func snapshotGitIndex(ctx context.Context, dir string) (func(), error) {
+	path, err := gitcmd.Run(ctx, dir, "", "rev-parse", "--git-path", "index")
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// There's no index before the first file is staged.
+		return func() { _ = os.Remove(path) }, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() { _ = os.WriteFile(path, data, 0o644) }, nil
+}
+
+func truncateLines(s string, n int) string {
+	lines := strings.Split(s, "\n")
+	if len(lines) <= n {
+		return s
+	}
+	return strings.Join(lines[:n], "\n") + fmt.Sprintf("\n... (%d more lines)", len(lines)-n)
+}
@@ -0,0 +1,74 @@
+package tools
+
+import (
+	"context"
+	_ "embed"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/gitcmd"
+)
+
+type GitDiffParams struct {
+	Paths  []string `json:"paths,omitempty" description:"Only show the changes of these files or directories"`
+	Staged bool     `json:"staged,omitempty" description:"Show the staged changes, which the next commit will have, instead of the unstaged ones"`
+	Ref    string   `json:"ref,omitempty" description:"Compare with this commit, branch or range instead, like HEAD~1, main or main...HEAD"`
+	Stat   bool     `json:"stat,omitempty" description:"Only show the files changed with their number of added and removed lines"`
+}
+
+type GitDiffResponseMetadata struct {
+	Paths  []string `json:"paths,omitempty"`
+	Staged bool     `json:"staged,omitempty"`
+	Ref    string   `json:"ref,omitempty"`
+	Stat   bool     `json:"stat,omitempty"`
+}
+
+const GitDiffToolName = "git_diff"
+
+//go:embed git_diff.md
+var gitDiffDescription []byte
+
+func NewGitDiffTool(workingDir string) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		GitDiffToolName,
+		string(gitDiffDescription),
+		func(ctx context.Context, params GitDiffParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if err := gitcmd.CheckRepository(ctx, workingDir); err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+			if err := validateGitArg("ref", params.Ref); err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+
+			args := []string{"diff", "--no-color", "--no-ext-diff"}
+			if params.Staged {
+				args = append(args, "--cached")
+			}
+			if params.Stat {
+				args = append(args, "--stat")
+			}
+			if params.Ref != "" {
+				args = append(args, params.Ref)
+			}
+			args = append(args, "--")
+			args = append(args, params.Paths...)
+
+			out, err := gitcmd.Run(ctx, workingDir, "", args...)
+			if err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+			if strings.TrimSpace(out) == "" {
+				out = "No changes"
+				if !params.Staged && params.Ref == "" {
+					out += " (the staged changes are shown with staged=true, untracked files aren't shown)"
+				}
+			}
+			metadata := GitDiffResponseMetadata{
+				Paths:  params.Paths,
+				Staged: params.Staged,
+				Ref:    params.Ref,
+				Stat:   params.Stat,
+			}
+			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(out), metadata), nil
+		})
+}
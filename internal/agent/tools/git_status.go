@@ -0,0 +1,195 @@
+package tools
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/gitcmd"
+)
+
+type GitStatusParams struct {
+	Path string `json:"path,omitempty" description:"Only show the status of the files under this path"`
+}
+
+type GitStatusResponseMetadata struct {
+	Branch    string          `json:"branch"`
+	Upstream  string          `json:"upstream,omitempty"`
+	Ahead     int             `json:"ahead,omitempty"`
+	Behind    int             `json:"behind,omitempty"`
+	Staged    []GitFileStatus `json:"staged,omitempty"`
+	Unstaged  []GitFileStatus `json:"unstaged,omitempty"`
+	Untracked []string        `json:"untracked,omitempty"`
+	Conflicts []string        `json:"conflicts,omitempty"`
+}
+
+// GitFileStatus is a changed file, staged or not.
+type GitFileStatus struct {
+	Status  string `json:"status"`
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"`
+}
+
+const (
+	GitStatusToolName = "git_status"
+
+	// maxGitStatusFiles is the number of files listed by kind of change.
+	maxGitStatusFiles = 200
+)
+
+//go:embed git_status.md
+var gitStatusDescription []byte
+
+var gitStatusNames = map[byte]string{
+	'M': "modified",
+	'A': "added",
+	'D': "deleted",
+	'R': "renamed",
+	'C': "copied",
+	'T': "type changed",
+}
+
+func NewGitStatusTool(workingDir string) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		GitStatusToolName,
+		string(gitStatusDescription),
+		func(ctx context.Context, params GitStatusParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if err := gitcmd.CheckRepository(ctx, workingDir); err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+			if err := validateGitArg("path", params.Path); err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+
+			args := []string{"status", "--porcelain=v1", "-z", "--branch"}
+			if params.Path != "" {
+				args = append(args, "--", params.Path)
+			}
+			out, err := gitcmd.Run(ctx, workingDir, "", args...)
+			if err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+			status := parseGitStatus(out)
+			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(formatGitStatus(status)), status), nil
+		})
+}
+
+// parseGitStatus reads the output of git status --porcelain=v1 -z --branch.
+func parseGitStatus(out string) GitStatusResponseMetadata {
+	var status GitStatusResponseMetadata
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if branch, ok := strings.CutPrefix(entry, "## "); ok {
+			parseGitBranch(&status, branch)
+			continue
+		}
+		if len(entry) < 4 {
+			continue
+		}
+		x, y, path := entry[0], entry[1], entry[3:]
+		var oldPath string
+		// Renames and copies are followed by the path they're from.
+		if (x == 'R' || x == 'C') && i+1 < len(entries) {
+			i++
+			oldPath = entries[i]
+		}
+		switch {
+		case x == '?' && y == '?':
+			status.Untracked = append(status.Untracked, path)
+		case x == '!':
+		case x == 'U' || y == 'U' || (x == 'A' && y == 'A') || (x == 'D' && y == 'D'):
+			status.Conflicts = append(status.Conflicts, path)
+		default:
+			if name, ok := gitStatusNames[x]; ok {
+				status.Staged = append(status.Staged, GitFileStatus{Status: name, Path: path, OldPath: oldPath})
+			}
+			if name, ok := gitStatusNames[y]; ok {
+				status.Unstaged = append(status.Unstaged, GitFileStatus{Status: name, Path: path})
+			}
+		}
+	}
+	return status
+}
+
+// parseGitBranch reads the branch line of git status, like
+// "main...origin/main [ahead 1, behind 2]".
+func parseGitBranch(status *GitStatusResponseMetadata, line string) {
+	line, tracking, _ := strings.Cut(line, " [")
+	for part := range strings.SplitSeq(strings.TrimSuffix(tracking, "]"), ", ") {
+		if n, ok := strings.CutPrefix(part, "ahead "); ok {
+			status.Ahead, _ = strconv.Atoi(n)
+		}
+		if n, ok := strings.CutPrefix(part, "behind "); ok {
+			status.Behind, _ = strconv.Atoi(n)
+		}
+	}
+	if branch, ok := strings.CutPrefix(line, "No commits yet on "); ok {
+		line = branch
+	}
+	status.Branch, status.Upstream, _ = strings.Cut(line, "...")
+}
+
+func formatGitStatus(status GitStatusResponseMetadata) string {
+	var b strings.Builder
+	if status.Branch == "HEAD (no branch)" {
+		b.WriteString("HEAD detached")
+	} else {
+		fmt.Fprintf(&b, "On branch %s", status.Branch)
+	}
+	if status.Upstream != "" {
+		switch {
+		case status.Ahead > 0 && status.Behind > 0:
+			fmt.Fprintf(&b, ", %d commits ahead of and %d behind %s", status.Ahead, status.Behind, status.Upstream)
+		case status.Ahead > 0:
+			fmt.Fprintf(&b, ", %d commits ahead of %s", status.Ahead, status.Upstream)
+		case status.Behind > 0:
+			fmt.Fprintf(&b, ", %d commits behind %s", status.Behind, status.Upstream)
+		default:
+			fmt.Fprintf(&b, ", up to date with %s", status.Upstream)
+		}
+	}
+
+	if len(status.Staged)+len(status.Unstaged)+len(status.Untracked)+len(status.Conflicts) == 0 {
+		b.WriteString("\n\nNothing to commit, working tree clean")
+		return b.String()
+	}
+
+	writeFiles := func(title string, files []GitFileStatus) {
+		if len(files) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n\n%s:", title)
+		for i, f := range files {
+			if i == maxGitStatusFiles {
+				fmt.Fprintf(&b, "\n  ... and %d more", len(files)-maxGitStatusFiles)
+				break
+			}
+			fmt.Fprintf(&b, "\n  %s: %s", f.Status, f.Path)
+			if f.OldPath != "" {
+				fmt.Fprintf(&b, " (from %s)", f.OldPath)
+			}
+		}
+	}
+	writePaths := func(title string, paths []string) {
+		if len(paths) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n\n%s:", title)
+		for i, path := range paths {
+			if i == maxGitStatusFiles {
+				fmt.Fprintf(&b, "\n  ... and %d more", len(paths)-maxGitStatusFiles)
+				break
+			}
+			fmt.Fprintf(&b, "\n  %s", path)
+		}
+	}
+	writePaths("Unmerged paths (conflicts)", status.Conflicts)
+	writeFiles("Staged changes", status.Staged)
+	writeFiles("Unstaged changes", status.Unstaged)
+	writePaths("Untracked files", status.Untracked)
+	return b.String()
+}
@@ -0,0 +1,200 @@
+package tools
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/permission"
+	"github.com/mudaaaa/crushplus/internal/shell"
+)
+
+const (
+	JobInputToolName = "job_input"
+
+	// jobInputQuiet is how long the output of the job must be quiet, after
+	// the input, for the job to be considered waiting again.
+	jobInputQuiet = 500 * time.Millisecond
+	// jobInputTimeout is the most job_input waits for the output to settle.
+	jobInputTimeout = 5 * time.Second
+)
+
+//go:embed job_input.md
+var jobInputDescription []byte
+
+type JobInputParams struct {
+	ShellID string   `json:"shell_id" description:"The ID of the background shell to send input to"`
+	Input   string   `json:"input,omitempty" description:"The text to type; newlines are sent as the enter key"`
+	Keys    []string `json:"keys,omitempty" description:"Special keys to press after the input, in order, e.g. [\"enter\"], [\"down\", \"enter\"] or [\"ctrl+c\"]"`
+}
+
+type JobInputResponseMetadata struct {
+	ShellID     string `json:"shell_id"`
+	Command     string `json:"command"`
+	Description string `json:"description"`
+	Done        bool   `json:"done"`
+	NextOffset  int64  `json:"next_offset"`
+}
+
+// jobInputKeys are the byte sequences terminals send for the special keys.
+var jobInputKeys = map[string]string{
+	"enter":     "\r",
+	"tab":       "\t",
+	"space":     " ",
+	"backspace": "\x7f",
+	"escape":    "\x1b",
+	"esc":       "\x1b",
+	"up":        "\x1b[A",
+	"down":      "\x1b[B",
+	"right":     "\x1b[C",
+	"left":      "\x1b[D",
+	"home":      "\x1b[H",
+	"end":       "\x1b[F",
+	"delete":    "\x1b[3~",
+	"pageup":    "\x1b[5~",
+	"pagedown":  "\x1b[6~",
+}
+
+func NewJobInputTool(permissions permission.Service) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		JobInputToolName,
+		string(jobInputDescription),
+		func(ctx context.Context, params JobInputParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if params.ShellID == "" {
+				return fantasy.NewTextErrorResponse("missing shell_id"), nil
+			}
+			if params.Input == "" && len(params.Keys) == 0 {
+				return fantasy.NewTextErrorResponse("missing input or keys"), nil
+			}
+			input, err := encodeJobInput(params.Input, params.Keys)
+			if err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+
+			bgShell, ok := getSessionJob(ctx, params.ShellID)
+			if !ok {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("background shell not found: %s", params.ShellID)), nil
+			}
+			if !bgShell.PTY {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("background shell %s doesn't run in a pseudo-terminal; run the command with pty set to true to send it input", params.ShellID)), nil
+			}
+
+			// The input can run anything the job reads it for, like a shell
+			// or a REPL, so it's approved like a command.
+			description := fmt.Sprintf("Send input to job %s (%s):\n\n%s", bgShell.ID, bgShell.Command, describeJobInput(params.Input, params.Keys))
+			p := permissions.Request(
+				permission.CreatePermissionRequest{
+					SessionID:   bgShell.SessionID,
+					Path:        bgShell.WorkingDir,
+					ToolCallID:  call.ID,
+					ToolName:    JobInputToolName,
+					Action:      "input",
+					Description: description,
+				},
+			)
+			if !p {
+				return fantasy.ToolResponse{}, permission.ErrorPermissionDenied
+			}
+
+			out := bgShell.Output()
+			since := out.Len()
+			if err := bgShell.WriteInput(input); err != nil {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("could not send input to background shell %s: %s", params.ShellID, err)), nil
+			}
+			if err := waitForQuiet(ctx, bgShell, jobInputQuiet, jobInputTimeout); err != nil {
+				return fantasy.ToolResponse{}, err
+			}
+
+			done := bgShell.IsDone()
+			output := readJobOutput(out, since, 0, nil, true)
+			metadata := JobInputResponseMetadata{
+				ShellID:     params.ShellID,
+				Command:     bgShell.Command,
+				Description: bgShell.Description,
+				Done:        done,
+				NextOffset:  output.next,
+			}
+			status := "running"
+			if done {
+				status = "completed"
+			}
+			result := formatJobOutput(status, bgShell, output)
+			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(result), metadata), nil
+		})
+}
+
+// encodeJobInput returns the bytes a terminal sends for the input followed
+// by the keys.
+func encodeJobInput(input string, keys []string) ([]byte, error) {
+	var sb strings.Builder
+	sb.WriteString(strings.ReplaceAll(input, "\n", "\r"))
+	for _, key := range keys {
+		seq, err := encodeJobInputKey(key)
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString(seq)
+	}
+	return []byte(sb.String()), nil
+}
+
+func encodeJobInputKey(key string) (string, error) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	if seq, ok := jobInputKeys[key]; ok {
+		return seq, nil
+	}
+	// Ctrl+A to ctrl+Z are the control characters 1 to 26, like ctrl+c to
+	// interrupt and ctrl+d to end the input.
+	if letter, ok := strings.CutPrefix(key, "ctrl+"); ok && len(letter) == 1 && letter[0] >= 'a' && letter[0] <= 'z' {
+		return string(rune(letter[0] - 'a' + 1)), nil
+	}
+	names := make([]string, 0, len(jobInputKeys))
+	for name := range jobInputKeys {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return "", fmt.Errorf("unknown key %q; use one of %s, or ctrl+a to ctrl+z", key, strings.Join(names, ", "))
+}
+
+// describeJobInput describes the input and keys for the user to approve.
+func describeJobInput(input string, keys []string) string {
+	var parts []string
+	if input != "" {
+		parts = append(parts, fmt.Sprintf("%q", input))
+	}
+	if len(keys) > 0 {
+		parts = append(parts, "keys: "+strings.Join(keys, ", "))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// waitForQuiet waits for the output of the job to be quiet for a while after
+// some input, so that what the input printed is returned with it, up to the
+// timeout or until the job completes.
+func waitForQuiet(ctx context.Context, bgShell *shell.BackgroundShell, quiet, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	idle := time.NewTimer(quiet)
+	defer idle.Stop()
+
+	out := bgShell.Output()
+	for {
+		changed := out.Changed()
+		select {
+		case <-changed:
+			idle.Reset(quiet)
+		case <-idle.C:
+			return nil
+		case <-bgShell.Done():
+			return nil
+		case <-deadline.C:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -1,24 +1,36 @@
 package tools
 
 import (
+	"bytes"
 	"context"
 	_ "embed"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/ansiext"
 	"github.com/mudaaaa/crushplus/internal/shell"
 )
 
 const (
 	JobOutputToolName = "job_output"
+
+	// maxJobOutputRead is the most output of a job read at once.
+	maxJobOutputRead = 256 * 1024
+	// maxJobOutputScan is the most output of a job searched for lines with
+	// grep or tail_lines.
+	maxJobOutputScan = 8 * 1024 * 1024
 )
 
 //go:embed job_output.md
 var jobOutputDescription []byte
 
 type JobOutputParams struct {
-	ShellID string `json:"shell_id" description:"The ID of the background shell to retrieve output from"`
+	ShellID     string `json:"shell_id" description:"The ID of the background shell to retrieve output from"`
+	SinceOffset int64  `json:"since_offset,omitempty" description:"Only return the output from this byte offset, as given by the previous call (defaults to 0, the start of the output)"`
+	TailLines   int    `json:"tail_lines,omitempty" description:"Only return the last lines of the output"`
+	Grep        string `json:"grep,omitempty" description:"Only return the lines of the output matching this regular expression"`
 }
 
 type JobOutputResponseMetadata struct {
@@ -27,6 +39,7 @@ type JobOutputResponseMetadata struct {
 	Description      string `json:"description"`
 	Done             bool   `json:"done"`
 	WorkingDirectory string `json:"working_directory"`
+	NextOffset       int64  `json:"next_offset"`
 }
 
 func NewJobOutputTool() fantasy.AgentTool {
@@ -37,35 +50,26 @@ func NewJobOutputTool() fantasy.AgentTool {
 			if params.ShellID == "" {
 				return fantasy.NewTextErrorResponse("missing shell_id"), nil
 			}
-
-			bgManager := shell.GetBackgroundShellManager()
-			bgShell, ok := bgManager.Get(params.ShellID)
-			if !ok {
-				return fantasy.NewTextErrorResponse(fmt.Sprintf("background shell not found: %s", params.ShellID)), nil
-			}
-
-			stdout, stderr, done, err := bgShell.GetOutput()
-
-			var outputParts []string
-			if stdout != "" {
-				outputParts = append(outputParts, stdout)
+			if params.SinceOffset < 0 || params.TailLines < 0 {
+				return fantasy.NewTextErrorResponse("since_offset and tail_lines must not be negative"), nil
 			}
-			if stderr != "" {
-				outputParts = append(outputParts, stderr)
+			var grep *regexp.Regexp
+			if params.Grep != "" {
+				var err error
+				if grep, err = regexp.Compile(params.Grep); err != nil {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("invalid grep pattern: %s", err)), nil
+				}
 			}
 
-			status := "running"
-			if done {
-				status = "completed"
-				if err != nil {
-					exitCode := shell.ExitCode(err)
-					if exitCode != 0 {
-						outputParts = append(outputParts, fmt.Sprintf("Exit code %d", exitCode))
-					}
-				}
+			bgShell, ok := getSessionJob(ctx, params.ShellID)
+			if !ok {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("background shell not found: %s", params.ShellID)), nil
 			}
 
-			output := strings.Join(outputParts, "\n")
+			// Check whether the job is done before reading, so that its
+			// output is complete when it is.
+			done := bgShell.IsDone()
+			output := readJobOutput(bgShell.Output(), params.SinceOffset, params.TailLines, grep, bgShell.PTY)
 
 			metadata := JobOutputResponseMetadata{
 				ShellID:          params.ShellID,
@@ -73,14 +77,119 @@ func NewJobOutputTool() fantasy.AgentTool {
 				Description:      bgShell.Description,
 				Done:             done,
 				WorkingDirectory: bgShell.WorkingDir,
+				NextOffset:       output.next,
 			}
-
-			if output == "" {
-				output = BashNoOutput
+			status := "running"
+			if done {
+				status = "completed"
 			}
-
-			result := fmt.Sprintf("Status: %s\n\n%s", status, output)
+			result := formatJobOutput(status, bgShell, output)
 			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(result), metadata), nil
 		})
 }
 
+// getSessionJob returns the background shell with the ID, when the session of
+// the call started it. The sessions don't see each other's jobs.
+func getSessionJob(ctx context.Context, id string) (*shell.BackgroundShell, bool) {
+	bgShell, ok := shell.GetBackgroundShellManager().Get(id)
+	if !ok || bgShell.SessionID != GetSessionFromContext(ctx) {
+		return nil, false
+	}
+	return bgShell, true
+}
+
+// jobOutput is the part of the output of a job read by a call.
+type jobOutput struct {
+	text string
+	// next is the offset to read the following output from.
+	next int64
+	// more is true when there's more output after next.
+	more bool
+	// skipped is how many bytes after the requested offset were left out,
+	// either no longer available or past what's searched.
+	skipped int64
+}
+
+// readJobOutput reads the output of a job from the offset. Without grep or
+// tail lines, the output is read forward by chunks. With them, the lines are
+// searched from the end of the output. With strip, the terminal escape
+// sequences of jobs running in a pseudo-terminal are removed first.
+func readJobOutput(out *shell.OutputBuffer, since int64, tailLines int, grep *regexp.Regexp, strip bool) jobOutput {
+	end := out.Len()
+	since = min(since, end)
+
+	if tailLines == 0 && grep == nil {
+		data, start := out.Read(since, maxJobOutputRead)
+		next := start + int64(len(data))
+		// Don't cut lines in two, unless they're longer than the chunk.
+		if next < end {
+			if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+				data = data[:i+1]
+				next = start + int64(i+1)
+			}
+		}
+		text := string(data)
+		if strip {
+			text = ansiext.Strip(text)
+		}
+		return jobOutput{text: text, next: next, more: next < end, skipped: start - since}
+	}
+
+	from := max(since, end-maxJobOutputScan)
+	data, start := out.Read(from, int(end-from))
+	text := string(data)
+	if strip {
+		text = ansiext.Strip(text)
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if grep != nil {
+		lines = filterLines(lines, grep)
+	}
+	if tailLines > 0 && len(lines) > tailLines {
+		lines = lines[len(lines)-tailLines:]
+	}
+	text = strings.Join(lines, "\n")
+	if len(text) > maxJobOutputRead {
+		text = text[len(text)-maxJobOutputRead:]
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		}
+	}
+	return jobOutput{text: text, next: start + int64(len(data)), skipped: start - since}
+}
+
+func filterLines(lines []string, re *regexp.Regexp) []string {
+	var matched []string
+	for _, line := range lines {
+		if re.MatchString(line) {
+			matched = append(matched, line)
+		}
+	}
+	return matched
+}
+
+// formatJobOutput formats the output of a job with its status and the offset
+// to read on from.
+func formatJobOutput(status string, bgShell *shell.BackgroundShell, output jobOutput) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Status: %s\n", status)
+	if err := bgShell.ExitErr(); err != nil {
+		if exitCode := shell.ExitCode(err); exitCode != 0 {
+			fmt.Fprintf(&sb, "Exit code: %d\n", exitCode)
+		}
+	}
+	fmt.Fprintf(&sb, "Next offset: %d\n", output.next)
+	if output.skipped > 0 {
+		fmt.Fprintf(&sb, "(%d bytes of output were skipped, either no longer kept or too far back to search)\n", output.skipped)
+	}
+	if output.more {
+		sb.WriteString("(There is more output. Call again with since_offset set to the next offset to read it.)\n")
+	}
+	text := strings.TrimRight(output.text, "\n")
+	if text == "" {
+		text = BashNoOutput
+	}
+	sb.WriteString("\n")
+	sb.WriteString(text)
+	return sb.String()
+}
@@ -2,9 +2,17 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/permission"
+	"github.com/mudaaaa/crushplus/internal/pubsub"
 	"github.com/mudaaaa/crushplus/internal/shell"
 	"github.com/stretchr/testify/require"
 )
@@ -17,7 +25,7 @@ func TestBackgroundShell_Integration(t *testing.T) {
 
 	// Start a background shell
 	bgManager := shell.GetBackgroundShellManager()
-	bgShell, err := bgManager.Start(ctx, workingDir, nil, "echo 'hello background' && echo 'done'", "")
+	bgShell, err := bgManager.Start(ctx, "", workingDir, nil, "echo 'hello background' && echo 'done'", "")
 	require.NoError(t, err)
 	require.NotEmpty(t, bgShell.ID)
 
@@ -44,7 +52,7 @@ func TestBackgroundShell_Kill(t *testing.T) {
 
 	// Start a long-running background shell
 	bgManager := shell.GetBackgroundShellManager()
-	bgShell, err := bgManager.Start(ctx, workingDir, nil, "sleep 100", "")
+	bgShell, err := bgManager.Start(ctx, "", workingDir, nil, "sleep 100", "")
 	require.NoError(t, err)
 
 	// Kill it
@@ -67,7 +75,7 @@ func TestBackgroundShell_MultipleOutputCalls(t *testing.T) {
 
 	// Start a background shell
 	bgManager := shell.GetBackgroundShellManager()
-	bgShell, err := bgManager.Start(ctx, workingDir, nil, "echo 'step 1' && echo 'step 2' && echo 'step 3'", "")
+	bgShell, err := bgManager.Start(ctx, "", workingDir, nil, "echo 'step 1' && echo 'step 2' && echo 'step 3'", "")
 	require.NoError(t, err)
 	defer bgManager.Kill(bgShell.ID)
 
@@ -103,7 +111,7 @@ func TestBackgroundShell_EmptyOutput(t *testing.T) {
 
 	// Start a background shell with no output
 	bgManager := shell.GetBackgroundShellManager()
-	bgShell, err := bgManager.Start(ctx, workingDir, nil, "sleep 0.1", "")
+	bgShell, err := bgManager.Start(ctx, "", workingDir, nil, "sleep 0.1", "")
 	require.NoError(t, err)
 	defer bgManager.Kill(bgShell.ID)
 
@@ -125,7 +133,7 @@ func TestBackgroundShell_ExitCode(t *testing.T) {
 
 	// Start a background shell that exits with non-zero code
 	bgManager := shell.GetBackgroundShellManager()
-	bgShell, err := bgManager.Start(ctx, workingDir, nil, "echo 'failing' && exit 42", "")
+	bgShell, err := bgManager.Start(ctx, "", workingDir, nil, "echo 'failing' && exit 42", "")
 	require.NoError(t, err)
 	defer bgManager.Kill(bgShell.ID)
 
@@ -153,7 +161,7 @@ func TestBackgroundShell_WithBlockFuncs(t *testing.T) {
 
 	// Start a background shell with a blocked command
 	bgManager := shell.GetBackgroundShellManager()
-	bgShell, err := bgManager.Start(ctx, workingDir, blockFuncs, "curl example.com", "")
+	bgShell, err := bgManager.Start(ctx, "", workingDir, blockFuncs, "curl example.com", "")
 	require.NoError(t, err)
 	defer bgManager.Kill(bgShell.ID)
 
@@ -182,7 +190,7 @@ func TestBackgroundShell_StdoutAndStderr(t *testing.T) {
 
 	// Start a background shell with both stdout and stderr
 	bgManager := shell.GetBackgroundShellManager()
-	bgShell, err := bgManager.Start(ctx, workingDir, nil, "echo 'stdout message' && echo 'stderr message' >&2", "")
+	bgShell, err := bgManager.Start(ctx, "", workingDir, nil, "echo 'stdout message' && echo 'stderr message' >&2", "")
 	require.NoError(t, err)
 	defer bgManager.Kill(bgShell.ID)
 
@@ -204,7 +212,7 @@ func TestBackgroundShell_ConcurrentAccess(t *testing.T) {
 
 	// Start a background shell
 	bgManager := shell.GetBackgroundShellManager()
-	bgShell, err := bgManager.Start(ctx, workingDir, nil, "for i in 1 2 3 4 5; do echo \"line $i\"; sleep 0.05; done", "")
+	bgShell, err := bgManager.Start(ctx, "", workingDir, nil, "for i in 1 2 3 4 5; do echo \"line $i\"; sleep 0.05; done", "")
 	require.NoError(t, err)
 	defer bgManager.Kill(bgShell.ID)
 
@@ -257,7 +265,7 @@ func TestBackgroundShell_List(t *testing.T) {
 	// Start multiple background shells
 	shells := make([]*shell.BackgroundShell, 3)
 	for i := range 3 {
-		bgShell, err := bgManager.Start(ctx, workingDir, nil, "sleep 1", "")
+		bgShell, err := bgManager.Start(ctx, "", workingDir, nil, "sleep 1", "")
 		require.NoError(t, err)
 		shells[i] = bgShell
 	}
@@ -286,7 +294,7 @@ func TestBackgroundShell_AutoBackground(t *testing.T) {
 	t.Run("quick command completes synchronously", func(t *testing.T) {
 		t.Parallel()
 		bgManager := shell.GetBackgroundShellManager()
-		bgShell, err := bgManager.Start(ctx, workingDir, nil, "echo 'quick'", "")
+		bgShell, err := bgManager.Start(ctx, "", workingDir, nil, "echo 'quick'", "")
 		require.NoError(t, err)
 
 		// Wait threshold time
@@ -307,7 +315,7 @@ func TestBackgroundShell_AutoBackground(t *testing.T) {
 	t.Run("long command stays in background", func(t *testing.T) {
 		t.Parallel()
 		bgManager := shell.GetBackgroundShellManager()
-		bgShell, err := bgManager.Start(ctx, workingDir, nil, "sleep 20 && echo '20 seconds completed'", "")
+		bgShell, err := bgManager.Start(ctx, "", workingDir, nil, "sleep 20 && echo '20 seconds completed'", "")
 		require.NoError(t, err)
 		defer bgManager.Kill(bgShell.ID)
 
@@ -328,3 +336,149 @@ func TestBackgroundShell_AutoBackground(t *testing.T) {
 	})
 }
 
+
+func TestReadJobOutput(t *testing.T) {
+	t.Parallel()
+
+	out := shell.NewOutputBuffer(shell.MaxOutputBufferSize, "")
+	_, err := out.Write([]byte("compiling\nerror: one\nok\nerror: two\npartial"))
+	require.NoError(t, err)
+
+	output := readJobOutput(out, 0, 0, nil, false)
+	require.Equal(t, "compiling\nerror: one\nok\nerror: two\npartial", output.text)
+	require.Equal(t, out.Len(), output.next)
+	require.False(t, output.more)
+
+	output = readJobOutput(out, 10, 0, nil, false)
+	require.Equal(t, "error: one\nok\nerror: two\npartial", output.text)
+
+	output = readJobOutput(out, 0, 0, regexp.MustCompile("^error"), false)
+	require.Equal(t, "error: one\nerror: two", output.text)
+
+	output = readJobOutput(out, 0, 1, regexp.MustCompile("^error"), false)
+	require.Equal(t, "error: two", output.text)
+
+	output = readJobOutput(out, 0, 2, nil, false)
+	require.Equal(t, "error: two\npartial", output.text)
+	require.Equal(t, out.Len(), output.next)
+
+	// The output of a pseudo-terminal is matched and returned as plain text.
+	tty := shell.NewOutputBuffer(shell.MaxOutputBufferSize, "")
+	_, err = tty.Write([]byte("\x1b[31merror: red\x1b[0m\r\nok\r\n"))
+	require.NoError(t, err)
+	output = readJobOutput(tty, 0, 0, regexp.MustCompile("^error"), true)
+	require.Equal(t, "error: red", output.text)
+}
+
+func TestJobWaitTool(t *testing.T) {
+	t.Parallel()
+
+	bgManager := shell.GetBackgroundShellManager()
+	bgShell, err := bgManager.Start(t.Context(), "", t.TempDir(), nil, "echo starting; sleep 0.2; echo 'listening on :8080'; sleep 10", "")
+	require.NoError(t, err)
+	defer bgManager.Kill(bgShell.ID)
+
+	tool := NewJobWaitTool()
+	run := func(input string) JobWaitResponseMetadata {
+		resp, err := tool.Run(t.Context(), fantasy.ToolCall{ID: "call_1", Input: input})
+		require.NoError(t, err)
+		require.False(t, resp.IsError, resp.Content)
+		var meta JobWaitResponseMetadata
+		require.NoError(t, json.Unmarshal([]byte(resp.Metadata), &meta))
+		return meta
+	}
+
+	meta := run(fmt.Sprintf(`{"shell_id":%q,"pattern":"listening on","timeout":5}`, bgShell.ID))
+	require.Equal(t, "matched", meta.Status)
+	require.Equal(t, "listening on :8080", meta.Match)
+
+	meta = run(fmt.Sprintf(`{"shell_id":%q,"pattern":"never","timeout":1,"since_offset":%d}`, bgShell.ID, meta.NextOffset))
+	require.Equal(t, "timeout", meta.Status)
+
+	quick, err := bgManager.Start(t.Context(), "", t.TempDir(), nil, "sleep 0.2; exit 3", "")
+	require.NoError(t, err)
+	defer bgManager.Kill(quick.ID)
+
+	resp, err := tool.Run(t.Context(), fantasy.ToolCall{ID: "call_2", Input: fmt.Sprintf(`{"shell_id":%q,"timeout":5}`, quick.ID)})
+	require.NoError(t, err)
+	require.Contains(t, resp.Content, "Status: completed\nExit code: 3")
+
+	// A prompt without a newline is matched once the output goes quiet.
+	prompt, err := bgManager.Start(t.Context(), "", t.TempDir(), nil, "printf 'Continue? [y/N] '; sleep 10", "")
+	require.NoError(t, err)
+	defer bgManager.Kill(prompt.ID)
+
+	meta = run(fmt.Sprintf(`{"shell_id":%q,"pattern":"\\[y/N\\]","timeout":5}`, prompt.ID))
+	require.Equal(t, "matched", meta.Status)
+	require.Equal(t, "Continue? [y/N] ", meta.Match)
+}
+
+func TestJobOutputOtherSession(t *testing.T) {
+	t.Parallel()
+
+	bgManager := shell.GetBackgroundShellManager()
+	bgShell, err := bgManager.Start(t.Context(), "session-a", t.TempDir(), nil, "echo secret", "")
+	require.NoError(t, err)
+	defer bgManager.Kill(bgShell.ID)
+
+	input := fmt.Sprintf(`{"shell_id":%q}`, bgShell.ID)
+	ctx := context.WithValue(t.Context(), SessionIDContextKey, "session-b")
+	resp, err := NewJobOutputTool().Run(ctx, fantasy.ToolCall{ID: "call_1", Input: input})
+	require.NoError(t, err)
+	require.True(t, resp.IsError)
+	require.Contains(t, resp.Content, "background shell not found")
+
+	ctx = context.WithValue(t.Context(), SessionIDContextKey, "session-a")
+	resp, err = NewJobOutputTool().Run(ctx, fantasy.ToolCall{ID: "call_2", Input: input})
+	require.NoError(t, err)
+	require.False(t, resp.IsError, resp.Content)
+}
+
+func TestJobInputTool(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("pseudo-terminals are not supported on Windows")
+	}
+
+	bgManager := shell.GetBackgroundShellManager()
+	bgShell, err := bgManager.StartPTY(t.Context(), "", t.TempDir(), nil, `printf 'Name: '; read name; printf '\033[32mHello, %s\033[0m\n' "$name"; sleep 10`, "")
+	require.NoError(t, err)
+	defer bgManager.Kill(bgShell.ID)
+
+	tool := NewJobInputTool(&mockPermissionService{Broker: pubsub.NewBroker[permission.PermissionRequest]()})
+	require.Eventually(t, func() bool {
+		return strings.Contains(bgShell.Output().String(), "Name:")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	resp, err := tool.Run(t.Context(), fantasy.ToolCall{ID: "call_1", Input: fmt.Sprintf(`{"shell_id":%q,"input":"crush\n"}`, bgShell.ID)})
+	require.NoError(t, err)
+	require.False(t, resp.IsError, resp.Content)
+	require.Contains(t, resp.Content, "Hello, crush")
+	require.NotContains(t, resp.Content, "\x1b[")
+
+	resp, err = tool.Run(t.Context(), fantasy.ToolCall{ID: "call_2", Input: fmt.Sprintf(`{"shell_id":%q,"keys":["f13"]}`, bgShell.ID)})
+	require.NoError(t, err)
+	require.True(t, resp.IsError)
+	require.Contains(t, resp.Content, "unknown key")
+
+	plain, err := bgManager.Start(t.Context(), "", t.TempDir(), nil, "sleep 10", "")
+	require.NoError(t, err)
+	defer bgManager.Kill(plain.ID)
+
+	resp, err = tool.Run(t.Context(), fantasy.ToolCall{ID: "call_3", Input: fmt.Sprintf(`{"shell_id":%q,"keys":["enter"]}`, plain.ID)})
+	require.NoError(t, err)
+	require.True(t, resp.IsError)
+	require.Contains(t, resp.Content, "pseudo-terminal")
+}
+
+func TestEncodeJobInput(t *testing.T) {
+	t.Parallel()
+
+	input, err := encodeJobInput("yes\n", []string{"down", "Enter", "ctrl+c"})
+	require.NoError(t, err)
+	require.Equal(t, "yes\r\x1b[B\r\x03", string(input))
+
+	_, err = encodeJobInput("", []string{"ctrl+1"})
+	require.Error(t, err)
+}
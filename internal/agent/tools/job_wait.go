@@ -0,0 +1,175 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"regexp"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/ansiext"
+	"github.com/mudaaaa/crushplus/internal/shell"
+)
+
+const (
+	JobWaitToolName = "job_wait"
+
+	defaultJobWaitTimeout = 60 * time.Second
+	maxJobWaitTimeout     = 10 * time.Minute
+	// jobWaitTailLines is how many lines of output job_wait returns.
+	jobWaitTailLines = 50
+	// jobWaitQuietDelay is how long the output has to be quiet for the
+	// partial line at its end, like a prompt waiting for input, to be
+	// matched too.
+	jobWaitQuietDelay = 500 * time.Millisecond
+)
+
+//go:embed job_wait.md
+var jobWaitDescription []byte
+
+type JobWaitParams struct {
+	ShellID     string `json:"shell_id" description:"The ID of the background shell to wait for"`
+	Pattern     string `json:"pattern,omitempty" description:"A regular expression to wait for in the output, matched line by line"`
+	Timeout     int    `json:"timeout,omitempty" description:"How long to wait, in seconds (defaults to 60, max 600)"`
+	SinceOffset int64  `json:"since_offset,omitempty" description:"Only look for the pattern in the output from this byte offset (defaults to 0)"`
+}
+
+type JobWaitResponseMetadata struct {
+	ShellID     string `json:"shell_id"`
+	Command     string `json:"command"`
+	Description string `json:"description"`
+	// Status is why the wait ended: "matched", "completed" or "timeout".
+	Status     string `json:"status"`
+	Match      string `json:"match,omitempty"`
+	NextOffset int64  `json:"next_offset"`
+}
+
+func NewJobWaitTool() fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		JobWaitToolName,
+		string(jobWaitDescription),
+		func(ctx context.Context, params JobWaitParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if params.ShellID == "" {
+				return fantasy.NewTextErrorResponse("missing shell_id"), nil
+			}
+			if params.SinceOffset < 0 || params.Timeout < 0 {
+				return fantasy.NewTextErrorResponse("since_offset and timeout must not be negative"), nil
+			}
+			var pattern *regexp.Regexp
+			if params.Pattern != "" {
+				var err error
+				if pattern, err = regexp.Compile(params.Pattern); err != nil {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("invalid pattern: %s", err)), nil
+				}
+			}
+			timeout := defaultJobWaitTimeout
+			if params.Timeout > 0 {
+				timeout = min(time.Duration(params.Timeout)*time.Second, maxJobWaitTimeout)
+			}
+
+			bgShell, ok := getSessionJob(ctx, params.ShellID)
+			if !ok {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("background shell not found: %s", params.ShellID)), nil
+			}
+
+			status, match, err := waitForJob(ctx, bgShell, pattern, params.SinceOffset, timeout)
+			if err != nil {
+				return fantasy.ToolResponse{}, err
+			}
+
+			output := readJobOutput(bgShell.Output(), params.SinceOffset, jobWaitTailLines, nil, bgShell.PTY)
+			metadata := JobWaitResponseMetadata{
+				ShellID:     params.ShellID,
+				Command:     bgShell.Command,
+				Description: bgShell.Description,
+				Status:      status,
+				Match:       match,
+				NextOffset:  output.next,
+			}
+			result := formatJobOutput(jobWaitStatus(status, match, timeout, bgShell.IsDone()), bgShell, output)
+			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(result), metadata), nil
+		})
+}
+
+// waitForJob waits for the pattern to match a line of the output of the job
+// from the offset, for the job to complete, or for the timeout to pass. The
+// line the output ends with, without a newline, is matched once the output
+// has been quiet for jobWaitQuietDelay.
+func waitForJob(ctx context.Context, bgShell *shell.BackgroundShell, pattern *regexp.Regexp, since int64, timeout time.Duration) (status, match string, err error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	out := bgShell.Output()
+	scanFrom := since
+	exited := false
+	quiet := false
+	var quietC <-chan time.Time
+	for {
+		// Take the channel before reading, so no write goes unnoticed.
+		changed := out.Changed()
+		if pattern != nil {
+			data, start := out.Read(scanFrom, maxJobOutputScan)
+			quietC = nil
+			for len(data) > 0 {
+				// Only match complete lines, unless the job is done or its
+				// output has gone quiet.
+				end := bytes.IndexByte(data, '\n')
+				if end < 0 && !exited && !quiet {
+					quietC = time.After(jobWaitQuietDelay)
+					break
+				}
+				line := data
+				if end >= 0 {
+					line = data[:end]
+				}
+				text := string(bytes.TrimRight(line, "\r"))
+				if bgShell.PTY {
+					text = ansiext.Strip(text)
+				}
+				if pattern.MatchString(text) {
+					return "matched", text, nil
+				}
+				if end < 0 {
+					break
+				}
+				data = data[end+1:]
+				start += int64(end + 1)
+			}
+			scanFrom = start
+		}
+		if exited {
+			return "completed", "", nil
+		}
+
+		quiet = false
+		select {
+		case <-bgShell.Done():
+			// Scan the output once more before returning.
+			exited = true
+		case <-quietC:
+			quiet = true
+		case <-changed:
+		case <-timer.C:
+			return "timeout", "", nil
+		case <-ctx.Done():
+			return "", "", ctx.Err()
+		}
+	}
+}
+
+func jobWaitStatus(status, match string, timeout time.Duration, done bool) string {
+	state := "running"
+	if done {
+		state = "completed"
+	}
+	switch status {
+	case "matched":
+		return fmt.Sprintf("%s, the pattern matched: %s", state, match)
+	case "timeout":
+		return fmt.Sprintf("%s, timed out after %s", state, timeout)
+	default:
+		return state
+	}
+}
@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"slices"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/agent/tools/mcp"
+	"github.com/mudaaaa/crushplus/internal/permission"
+)
+
+const (
+	MCPListResourcesToolName = "mcp_list_resources"
+	MCPReadResourceToolName  = "mcp_read_resource"
+)
+
+//go:embed mcp_list_resources.md
+var mcpListResourcesDescription []byte
+
+//go:embed mcp_read_resource.md
+var mcpReadResourceDescription []byte
+
+type MCPListResourcesParams struct {
+	MCPName string `json:"mcp_name,omitempty" description:"Only list resources of this MCP server (leave empty for all servers)"`
+}
+
+type MCPReadResourceParams struct {
+	MCPName string `json:"mcp_name" description:"The name of the MCP server that provides the resource"`
+	URI     string `json:"uri" description:"The URI of the resource to read"`
+}
+
+type MCPReadResourceResponseMetadata struct {
+	MCPName string `json:"mcp_name"`
+	URI     string `json:"uri"`
+}
+
+func NewMCPListResourcesTool() fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		MCPListResourcesToolName,
+		string(mcpListResourcesDescription),
+		func(ctx context.Context, params MCPListResourcesParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			var output strings.Builder
+			for _, name := range mcpResourceServers() {
+				if params.MCPName != "" && params.MCPName != name {
+					continue
+				}
+				writeMCPResources(&output, name)
+			}
+			if output.Len() == 0 {
+				if params.MCPName != "" {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("no resources available from mcp: %s", params.MCPName)), nil
+				}
+				return fantasy.NewTextResponse("No MCP resources available."), nil
+			}
+			return fantasy.NewTextResponse(output.String()), nil
+		})
+}
+
+func NewMCPReadResourceTool(permissions permission.Service, workingDir string) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		MCPReadResourceToolName,
+		string(mcpReadResourceDescription),
+		func(ctx context.Context, params MCPReadResourceParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if params.MCPName == "" {
+				return fantasy.NewTextErrorResponse("mcp_name is required"), nil
+			}
+			if params.URI == "" {
+				return fantasy.NewTextErrorResponse("uri is required"), nil
+			}
+
+			sessionID := GetSessionFromContext(ctx)
+			if sessionID == "" {
+				return fantasy.ToolResponse{}, fmt.Errorf("session ID is required for reading MCP resources")
+			}
+			p := permissions.Request(
+				permission.CreatePermissionRequest{
+					SessionID:   sessionID,
+					ToolCallID:  call.ID,
+					Path:        workingDir,
+					ToolName:    MCPReadResourceToolName,
+					Action:      "read",
+					Description: fmt.Sprintf("Read resource %s from MCP %s", params.URI, params.MCPName),
+					Params:      params,
+				},
+			)
+			if !p {
+				return fantasy.ToolResponse{}, permission.ErrorPermissionDenied
+			}
+
+			contents, err := mcp.ReadResource(mcp.WithSessionID(ctx, sessionID), params.MCPName, params.URI)
+			if err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+			return fantasy.WithResponseMetadata(
+				fantasy.NewTextResponse(FormatMCPResourceContents(contents)),
+				MCPReadResourceResponseMetadata{
+					MCPName: params.MCPName,
+					URI:     params.URI,
+				},
+			), nil
+		})
+}
+
+// FormatMCPResourceContents renders the contents of an MCP resource as text.
+// Binary contents are only described, as they can't be shown to the model
+// as-is.
+func FormatMCPResourceContents(contents []*mcp.ResourceContents) string {
+	var parts []string
+	for _, c := range contents {
+		if c.Blob != nil {
+			parts = append(parts, fmt.Sprintf("<resource uri=%q mime_type=%q>\n[binary content, %d bytes]\n</resource>", c.URI, c.MIMEType, len(c.Blob)))
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("<resource uri=%q mime_type=%q>\n%s\n</resource>", c.URI, c.MIMEType, c.Text))
+	}
+	if len(parts) == 0 {
+		return "Resource is empty."
+	}
+	return strings.Join(parts, "\n")
+}
+
+func mcpResourceServers() []string {
+	var names []string
+	for name := range mcp.Resources() {
+		names = append(names, name)
+	}
+	for name := range mcp.ResourceTemplates() {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func writeMCPResources(output *strings.Builder, name string) {
+	resources, templates := mcp.GetResources(name)
+	if len(resources) == 0 && len(templates) == 0 {
+		return
+	}
+
+	fmt.Fprintf(output, "<mcp name=%q>\n", name)
+	for _, r := range resources {
+		fmt.Fprintf(output, "- %s (%s)", r.URI, mcpResourceTitle(r.Title, r.Name))
+		if r.MIMEType != "" {
+			fmt.Fprintf(output, " [%s]", r.MIMEType)
+		}
+		if r.Description != "" {
+			fmt.Fprintf(output, ": %s", r.Description)
+		}
+		output.WriteString("\n")
+	}
+	for _, t := range templates {
+		fmt.Fprintf(output, "- template %s (%s)", t.URITemplate, mcpResourceTitle(t.Title, t.Name))
+		if t.MIMEType != "" {
+			fmt.Fprintf(output, " [%s]", t.MIMEType)
+		}
+		if t.Description != "" {
+			fmt.Fprintf(output, ": %s", t.Description)
+		}
+		output.WriteString("\n")
+	}
+	output.WriteString("</mcp>\n")
+}
+
+func mcpResourceTitle(title, name string) string {
+	if title != "" {
+		return title
+	}
+	return name
+}
@@ -0,0 +1,29 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/mudaaaa/crushplus/internal/agent/tools/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatMCPResourceContents(t *testing.T) {
+	t.Parallel()
+
+	t.Run("text and binary contents", func(t *testing.T) {
+		t.Parallel()
+
+		out := FormatMCPResourceContents([]*mcp.ResourceContents{
+			{URI: "docs://readme", MIMEType: "text/markdown", Text: "# Hello"},
+			{URI: "docs://logo", MIMEType: "image/png", Blob: []byte{1, 2, 3}},
+		})
+		require.Contains(t, out, "<resource uri=\"docs://readme\" mime_type=\"text/markdown\">\n# Hello\n</resource>")
+		require.Contains(t, out, "[binary content, 3 bytes]")
+	})
+
+	t.Run("empty contents", func(t *testing.T) {
+		t.Parallel()
+
+		require.Equal(t, "Resource is empty.", FormatMCPResourceContents(nil))
+	})
+}
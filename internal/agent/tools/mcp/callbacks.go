@@ -0,0 +1,114 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/mudaaaa/crushplus/internal/csync"
+)
+
+type (
+	CreateMessageParams = mcp.CreateMessageParams
+	CreateMessageResult = mcp.CreateMessageResult
+	ModelPreferences    = mcp.ModelPreferences
+	ElicitParams        = mcp.ElicitParams
+	ElicitResult        = mcp.ElicitResult
+	TextContent         = mcp.TextContent
+	ImageContent        = mcp.ImageContent
+)
+
+// SamplingHandler answers sampling requests, where an MCP server asks us
+// for an LLM completion.
+type SamplingHandler func(ctx context.Context, name, sessionID string, params *CreateMessageParams) (*CreateMessageResult, error)
+
+// ElicitationHandler answers elicitation requests, where an MCP server asks
+// the user for structured input.
+type ElicitationHandler func(ctx context.Context, name, sessionID string, params *ElicitParams) (*ElicitResult, error)
+
+var (
+	callbacksMu        sync.RWMutex
+	samplingHandler    SamplingHandler
+	elicitationHandler ElicitationHandler
+
+	// callerSessions holds the session that last called into each MCP, so
+	// requests the server sends back to us can be attributed to it.
+	callerSessions = csync.NewMap[string, string]()
+)
+
+type sessionIDContextKey struct{}
+
+// WithSessionID returns a context that attributes the MCP calls made with it
+// to the given session.
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDContextKey{}, sessionID)
+}
+
+func trackCaller(ctx context.Context, name string) {
+	if sessionID, ok := ctx.Value(sessionIDContextKey{}).(string); ok && sessionID != "" {
+		callerSessions.Set(name, sessionID)
+	}
+}
+
+// SetSamplingHandler sets the handler for sampling requests. It should be
+// set before MCP clients are initialized.
+func SetSamplingHandler(h SamplingHandler) {
+	callbacksMu.Lock()
+	defer callbacksMu.Unlock()
+	samplingHandler = h
+}
+
+// SetElicitationHandler sets the handler for elicitation requests. It should
+// be set before MCP clients are initialized.
+func SetElicitationHandler(h ElicitationHandler) {
+	callbacksMu.Lock()
+	defer callbacksMu.Unlock()
+	elicitationHandler = h
+}
+
+// clientCallbacks returns the sampling and elicitation handlers of the client
+// of the given MCP. They are nil when no handler is set, so that we don't
+// advertise capabilities we can't serve.
+func clientCallbacks(name string) (
+	func(context.Context, *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error),
+	func(context.Context, *mcp.ElicitRequest) (*mcp.ElicitResult, error),
+) {
+	callbacksMu.RLock()
+	sampling, elicitation := samplingHandler, elicitationHandler
+	callbacksMu.RUnlock()
+
+	var onSampling func(context.Context, *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error)
+	if sampling != nil {
+		onSampling = func(ctx context.Context, req *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+			sessionID, err := callerSession(name)
+			if err != nil {
+				return nil, err
+			}
+			return sampling(ctx, name, sessionID, req.Params)
+		}
+	}
+
+	var onElicitation func(context.Context, *mcp.ElicitRequest) (*mcp.ElicitResult, error)
+	if elicitation != nil {
+		onElicitation = func(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+			sessionID, err := callerSession(name)
+			if err != nil {
+				return nil, err
+			}
+			return elicitation(ctx, name, sessionID, req.Params)
+		}
+	}
+	return onSampling, onElicitation
+}
+
+func callerSession(name string) (string, error) {
+	sessionID, ok := callerSessions.Get(name)
+	if !ok {
+		return "", fmt.Errorf("mcp '%s': %w", name, errNoSession)
+	}
+	return sessionID, nil
+}
+
+var errNoSession = errors.New("request is not tied to an active session")
@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -40,6 +41,7 @@ const (
 	StateStarting
 	StateConnected
 	StateError
+	StateNeedsAuth
 )
 
 func (s State) String() string {
@@ -52,6 +54,8 @@ func (s State) String() string {
 		return "connected"
 	case StateError:
 		return "error"
+	case StateNeedsAuth:
+		return "needs auth"
 	default:
 		return "unknown"
 	}
@@ -64,6 +68,8 @@ const (
 	EventStateChanged EventType = iota
 	EventToolsListChanged
 	EventPromptsListChanged
+	EventResourcesListChanged
+	EventResourceUpdated
 )
 
 // Event represents an event in the MCP system
@@ -73,12 +79,15 @@ type Event struct {
 	State  State
 	Error  error
 	Counts Counts
+	// URI is set for [EventResourceUpdated].
+	URI string
 }
 
 // Counts number of available tools, prompts, etc.
 type Counts struct {
-	Tools   int
-	Prompts int
+	Tools     int
+	Prompts   int
+	Resources int
 }
 
 // ClientInfo holds information about an MCP client's state
@@ -123,9 +132,42 @@ func Close() error {
 
 // Initialize initializes MCP clients based on the provided configuration.
 func Initialize(ctx context.Context, permissions permission.Service, cfg *config.Config) {
+	startClients(ctx, cfg.MCPs(), cfg.Resolver())
+}
+
+// Reload applies a new MCP configuration: removed MCPs are closed and
+// forgotten, while added and changed ones are (re)started. Unchanged MCPs
+// keep their sessions.
+func Reload(ctx context.Context, cfg *config.Config, mcps config.MCPs) {
+	old := cfg.SetMCPs(mcps)
+
+	changed := make(config.MCPs)
+	for name := range old {
+		if _, ok := mcps[name]; !ok {
+			slog.Info("Removing mcp client", "name", name)
+			closeClient(name)
+			states.Del(name)
+			broker.Publish(pubsub.DeletedEvent, Event{
+				Type: EventStateChanged,
+				Name: name,
+			})
+		}
+	}
+	for name, m := range mcps {
+		if prev, ok := old[name]; ok && reflect.DeepEqual(prev, m) {
+			continue
+		}
+		slog.Info("Reloading mcp client", "name", name)
+		closeClient(name)
+		changed[name] = m
+	}
+	startClients(ctx, changed, cfg.Resolver())
+}
+
+func startClients(ctx context.Context, mcps config.MCPs, resolver config.VariableResolver) {
 	var wg sync.WaitGroup
 	// Initialize states for all configured MCPs
-	for name, m := range cfg.MCP {
+	for name, m := range mcps {
 		if m.Disabled {
 			updateState(name, StateDisabled, nil, nil, Counts{})
 			slog.Debug("skipping disabled mcp", "name", name)
@@ -154,41 +196,64 @@ func Initialize(ctx context.Context, permissions permission.Service, cfg *config
 				}
 			}()
 
-			// createSession handles its own timeout internally.
-			session, err := createSession(ctx, name, m, cfg.Resolver())
-			if err != nil {
-				return
-			}
-
-			tools, err := getTools(ctx, session)
-			if err != nil {
-				slog.Error("error listing tools", "error", err)
-				updateState(name, StateError, err, nil, Counts{})
-				session.Close()
-				return
-			}
-
-			prompts, err := getPrompts(ctx, session)
-			if err != nil {
-				slog.Error("error listing prompts", "error", err)
-				updateState(name, StateError, err, nil, Counts{})
-				session.Close()
-				return
-			}
-
-			updateTools(name, tools)
-			updatePrompts(name, prompts)
-			sessions.Set(name, session)
-
-			updateState(name, StateConnected, nil, session, Counts{
-				Tools:   len(tools),
-				Prompts: len(prompts),
-			})
+			_ = initClient(ctx, name, m, resolver)
 		}(name, m)
 	}
 	wg.Wait()
 }
 
+// closeClient closes the session of the given MCP and drops its tools,
+// prompts and resources.
+func closeClient(name string) {
+	if session, ok := sessions.Take(name); ok {
+		_ = session.Close()
+	}
+	updateTools(name, nil)
+	updatePrompts(name, nil)
+	updateResources(name, nil, nil)
+	invalidateResources(name)
+}
+
+// initClient connects to the given MCP and loads its tools, prompts and
+// resources.
+func initClient(ctx context.Context, name string, m config.MCPConfig, resolver config.VariableResolver) error {
+	// createSession handles its own timeout internally.
+	session, err := createSession(ctx, name, m, resolver)
+	if err != nil {
+		return err
+	}
+
+	tools, err := getTools(ctx, session)
+	if err != nil {
+		slog.Error("error listing tools", "error", err)
+		updateState(name, StateError, err, nil, Counts{})
+		session.Close()
+		return err
+	}
+
+	prompts, err := getPrompts(ctx, session)
+	if err != nil {
+		slog.Error("error listing prompts", "error", err)
+		updateState(name, StateError, err, nil, Counts{})
+		session.Close()
+		return err
+	}
+
+	resources, templates := getResources(ctx, name, session)
+
+	updateTools(name, tools)
+	updatePrompts(name, prompts)
+	updateResources(name, resources, templates)
+	sessions.Set(name, session)
+
+	updateState(name, StateConnected, nil, session, Counts{
+		Tools:     len(tools),
+		Prompts:   len(prompts),
+		Resources: len(resources) + len(templates),
+	})
+	return nil
+}
+
 func getOrRenewClient(ctx context.Context, name string) (*mcp.ClientSession, error) {
 	sess, ok := sessions.Get(name)
 	if !ok {
@@ -196,7 +261,7 @@ func getOrRenewClient(ctx context.Context, name string) (*mcp.ClientSession, err
 	}
 
 	cfg := config.Get()
-	m := cfg.MCP[name]
+	m := cfg.MCPs()[name]
 	state, _ := states.Get(name)
 
 	timeout := mcpTimeout(m)
@@ -230,8 +295,9 @@ func updateState(name string, state State, err error, client *mcp.ClientSession,
 	switch state {
 	case StateConnected:
 		info.ConnectedAt = time.Now()
-	case StateError:
+	case StateError, StateNeedsAuth:
 		sessions.Del(name)
+		invalidateResources(name)
 	}
 	states.Set(name, info)
 
@@ -250,7 +316,8 @@ func createSession(ctx context.Context, name string, m config.MCPConfig, resolve
 	mcpCtx, cancel := context.WithCancel(ctx)
 	cancelTimer := time.AfterFunc(timeout, cancel)
 
-	transport, err := createTransport(mcpCtx, m, resolver)
+	authChallenges.Del(name)
+	transport, err := createTransport(mcpCtx, name, m, resolver)
 	if err != nil {
 		updateState(name, StateError, err, nil, Counts{})
 		slog.Error("error creating mcp client", "error", err, "name", name)
@@ -259,6 +326,7 @@ func createSession(ctx context.Context, name string, m config.MCPConfig, resolve
 		return nil, err
 	}
 
+	onSampling, onElicitation := clientCallbacks(name)
 	client := mcp.NewClient(
 		&mcp.Implementation{
 			Name:    "crush",
@@ -278,6 +346,22 @@ func createSession(ctx context.Context, name string, m config.MCPConfig, resolve
 					Name: name,
 				})
 			},
+			ResourceListChangedHandler: func(context.Context, *mcp.ResourceListChangedRequest) {
+				broker.Publish(pubsub.UpdatedEvent, Event{
+					Type: EventResourcesListChanged,
+					Name: name,
+				})
+			},
+			ResourceUpdatedHandler: func(_ context.Context, req *mcp.ResourceUpdatedNotificationRequest) {
+				invalidateResource(name, req.Params.URI)
+				broker.Publish(pubsub.UpdatedEvent, Event{
+					Type: EventResourceUpdated,
+					Name: name,
+					URI:  req.Params.URI,
+				})
+			},
+			CreateMessageHandler: onSampling,
+			ElicitationHandler:   onElicitation,
 			LoggingMessageHandler: func(_ context.Context, req *mcp.LoggingMessageRequest) {
 				slog.Info("mcp log", "name", name, "data", req.Params.Data)
 			},
@@ -287,6 +371,14 @@ func createSession(ctx context.Context, name string, m config.MCPConfig, resolve
 
 	session, err := client.Connect(mcpCtx, transport, nil)
 	if err != nil {
+		if _, ok := authChallenges.Get(name); ok {
+			err = fmt.Errorf("mcp '%s': %w", name, ErrAuthRequired)
+			updateState(name, StateNeedsAuth, err, nil, Counts{})
+			slog.Warn("mcp client requires authorization", "name", name)
+			cancel()
+			cancelTimer.Stop()
+			return nil, err
+		}
 		err = maybeStdioErr(err, transport)
 		updateState(name, StateError, maybeTimeoutErr(err, timeout), nil, Counts{})
 		slog.Error("error starting mcp client", "error", err, "name", name)
@@ -328,7 +420,7 @@ func maybeTimeoutErr(err error, timeout time.Duration) error {
 	return err
 }
 
-func createTransport(ctx context.Context, m config.MCPConfig, resolver config.VariableResolver) (mcp.Transport, error) {
+func createTransport(ctx context.Context, name string, m config.MCPConfig, resolver config.VariableResolver) (mcp.Transport, error) {
 	switch m.Type {
 	case config.MCPStdio:
 		command, err := resolver.ResolveValue(m.Command)
@@ -348,9 +440,7 @@ func createTransport(ctx context.Context, m config.MCPConfig, resolver config.Va
 			return nil, fmt.Errorf("mcp http config requires a non-empty 'url' field")
 		}
 		client := &http.Client{
-			Transport: &headerRoundTripper{
-				headers: m.ResolvedHeaders(),
-			},
+			Transport: newAuthRoundTripper(name, m.ResolvedHeaders(), oauthStore{dir: config.Get().Options.DataDirectory}),
 		}
 		return &mcp.StreamableClientTransport{
 			Endpoint:   m.URL,
@@ -361,9 +451,7 @@ func createTransport(ctx context.Context, m config.MCPConfig, resolver config.Va
 			return nil, fmt.Errorf("mcp sse config requires a non-empty 'url' field")
 		}
 		client := &http.Client{
-			Transport: &headerRoundTripper{
-				headers: m.ResolvedHeaders(),
-			},
+			Transport: newAuthRoundTripper(name, m.ResolvedHeaders(), oauthStore{dir: config.Get().Options.DataDirectory}),
 		}
 		return &mcp.SSEClientTransport{
 			Endpoint:   m.URL,
@@ -374,17 +462,6 @@ func createTransport(ctx context.Context, m config.MCPConfig, resolver config.Va
 	}
 }
 
-type headerRoundTripper struct {
-	headers map[string]string
-}
-
-func (rt headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	for k, v := range rt.headers {
-		req.Header.Set(k, v)
-	}
-	return http.DefaultTransport.RoundTrip(req)
-}
-
 func mcpTimeout(m config.MCPConfig) time.Duration {
 	return time.Duration(cmp.Or(m.Timeout, 15)) * time.Second
 }
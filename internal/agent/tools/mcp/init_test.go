@@ -0,0 +1,63 @@
+package mcp
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/mudaaaa/crushplus/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{MCP: config.MCPs{
+		"reload-kept":    {Type: config.MCPStdio, Command: "kept", Disabled: true},
+		"reload-removed": {Type: config.MCPStdio, Command: "removed", Disabled: true},
+	}}
+	Initialize(t.Context(), nil, cfg)
+
+	Reload(t.Context(), cfg, config.MCPs{
+		"reload-kept":  {Type: config.MCPStdio, Command: "kept", Disabled: true},
+		"reload-added": {Type: config.MCPStdio, Command: "added", Disabled: true},
+	})
+
+	require.Len(t, cfg.MCPs(), 2)
+	_, ok := GetState("reload-removed")
+	require.False(t, ok)
+	state, ok := GetState("reload-added")
+	require.True(t, ok)
+	require.Equal(t, StateDisabled, state.State)
+	state, ok = GetState("reload-kept")
+	require.True(t, ok)
+	require.Equal(t, StateDisabled, state.State)
+}
+
+func TestReloadConcurrentReads(t *testing.T) {
+	t.Parallel()
+
+	cfg := &config.Config{MCP: config.MCPs{}}
+	Initialize(t.Context(), nil, cfg)
+
+	// Reloads replace the configurations the UI and the agents read, which
+	// the race detector checks.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 50 {
+			name := fmt.Sprintf("reload-concurrent-%d", i%3)
+			Reload(t.Context(), cfg, config.MCPs{
+				name: {Type: config.MCPStdio, Command: name, Disabled: true},
+			})
+		}
+	}()
+	for range 50 {
+		for _, m := range cfg.MCPs().Sorted() {
+			require.True(t, m.MCP.Disabled)
+		}
+	}
+	wg.Wait()
+	require.Len(t, cfg.MCPs(), 1)
+}
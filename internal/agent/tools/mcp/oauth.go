@@ -0,0 +1,527 @@
+package mcp
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mudaaaa/crushplus/internal/config"
+	"github.com/mudaaaa/crushplus/internal/csync"
+	"golang.org/x/oauth2"
+)
+
+// ErrAuthRequired is returned when an MCP server rejects our requests because
+// the user needs to authorize the client first.
+var ErrAuthRequired = errors.New("authorization required")
+
+const loginTimeout = 5 * time.Minute
+
+// authChallenges holds the MCPs that answered with 401 Unauthorized, along
+// with the protected resource metadata URL from their WWW-Authenticate
+// header, if any.
+var authChallenges = csync.NewMap[string, string]()
+
+// Login runs the OAuth authorization flow for the given MCP: it discovers
+// the authorization server, registers a client if needed, opens the browser
+// for the user to authorize us, and reconnects the MCP with the new token.
+func Login(ctx context.Context, name string) error {
+	cfg := config.Get()
+	m, ok := cfg.MCPs()[name]
+	if !ok {
+		return fmt.Errorf("mcp '%s' not configured", name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, loginTimeout)
+	defer cancel()
+
+	store := oauthStore{dir: cfg.Options.DataDirectory}
+	if err := login(ctx, name, m, store, http.DefaultClient, openBrowser); err != nil {
+		return err
+	}
+
+	if sess, ok := sessions.Get(name); ok {
+		_ = sess.Close()
+	}
+	updateState(name, StateStarting, nil, nil, Counts{})
+	return initClient(context.WithoutCancel(ctx), name, m, cfg.Resolver())
+}
+
+// Logout removes the stored OAuth credentials of the given MCP.
+func Logout(name string) error {
+	store := oauthStore{dir: config.Get().Options.DataDirectory}
+	return store.delete(name)
+}
+
+// oauthCredentials are the client registration and tokens of an MCP, stored
+// in the data directory.
+type oauthCredentials struct {
+	ClientID     string        `json:"client_id"`
+	ClientSecret string        `json:"client_secret,omitempty"`
+	AuthURL      string        `json:"auth_url"`
+	TokenURL     string        `json:"token_url"`
+	Scopes       []string      `json:"scopes,omitempty"`
+	Resource     string        `json:"resource,omitempty"`
+	Token        *oauth2.Token `json:"token,omitempty"`
+}
+
+func (c *oauthCredentials) config(redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.ClientID,
+		ClientSecret: c.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  c.AuthURL,
+			TokenURL: c.TokenURL,
+		},
+		RedirectURL: redirectURL,
+		Scopes:      c.Scopes,
+	}
+}
+
+type oauthStore struct {
+	dir string
+}
+
+func (s oauthStore) path(name string) string {
+	return filepath.Join(s.dir, "mcp-oauth", name+".json")
+}
+
+func (s oauthStore) load(name string) (*oauthCredentials, error) {
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read oauth credentials: %w", err)
+	}
+	var creds oauthCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("failed to parse oauth credentials: %w", err)
+	}
+	return &creds, nil
+}
+
+func (s oauthStore) save(name string, creds *oauthCredentials) error {
+	if err := os.MkdirAll(filepath.Dir(s.path(name)), 0o700); err != nil {
+		return fmt.Errorf("failed to create oauth directory: %w", err)
+	}
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal oauth credentials: %w", err)
+	}
+	if err := os.WriteFile(s.path(name), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write oauth credentials: %w", err)
+	}
+	return nil
+}
+
+func (s oauthStore) delete(name string) error {
+	if err := os.Remove(s.path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete oauth credentials: %w", err)
+	}
+	return nil
+}
+
+// authRoundTripper sets the configured headers and the OAuth bearer token, if
+// the user has authorized us, refreshing and persisting it as needed. It also
+// records 401 responses so we can tell the user to log in.
+type authRoundTripper struct {
+	name    string
+	headers map[string]string
+	store   oauthStore
+	base    http.RoundTripper
+
+	mu     sync.Mutex
+	creds  *oauthCredentials
+	source oauth2.TokenSource
+}
+
+func newAuthRoundTripper(name string, headers map[string]string, store oauthStore) *authRoundTripper {
+	return &authRoundTripper{
+		name:    name,
+		headers: headers,
+		store:   store,
+		base:    http.DefaultTransport,
+	}
+}
+
+func (rt *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range rt.headers {
+		req.Header.Set(k, v)
+	}
+	if req.Header.Get("Authorization") == "" {
+		token, err := rt.token()
+		if err != nil {
+			slog.Warn("error getting mcp oauth token", "name", rt.name, "error", err)
+		}
+		if token != nil {
+			token.SetAuthHeader(req)
+		}
+	}
+
+	resp, err := rt.base.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		authChallenges.Set(rt.name, resourceMetadataURL(resp.Header))
+	}
+	return resp, err
+}
+
+func (rt *authRoundTripper) token() (*oauth2.Token, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if rt.source == nil {
+		creds, err := rt.store.load(rt.name)
+		if err != nil || creds == nil || creds.Token == nil {
+			return nil, err
+		}
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: rt.base})
+		rt.creds = creds
+		rt.source = creds.config("").TokenSource(ctx, creds.Token)
+	}
+
+	token, err := rt.source.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken != rt.creds.Token.AccessToken {
+		rt.creds.Token = token
+		if err := rt.store.save(rt.name, rt.creds); err != nil {
+			slog.Warn("error saving refreshed mcp oauth token", "name", rt.name, "error", err)
+		}
+	}
+	return token, nil
+}
+
+var resourceMetadataRe = regexp.MustCompile(`resource_metadata="([^"]+)"`)
+
+func resourceMetadataURL(header http.Header) string {
+	for _, v := range header.Values("WWW-Authenticate") {
+		if m := resourceMetadataRe.FindStringSubmatch(v); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+type callbackResult struct {
+	code string
+	err  error
+}
+
+// login runs the authorization code flow with PKCE and stores the resulting
+// credentials.
+func login(ctx context.Context, name string, m config.MCPConfig, store oauthStore, client *http.Client, openURL func(string) error) error {
+	if m.Type != config.MCPHttp && m.Type != config.MCPSSE {
+		return fmt.Errorf("mcp '%s': oauth is only supported for http and sse servers", name)
+	}
+	oauthCfg := cmp.Or(m.OAuth, &config.MCPOAuthConfig{})
+
+	metadataURL, _ := authChallenges.Get(name)
+	issuer, resource, scopes, err := discoverProtectedResource(ctx, client, m.URL, metadataURL)
+	if err != nil {
+		return err
+	}
+	if len(oauthCfg.Scopes) > 0 {
+		scopes = oauthCfg.Scopes
+	}
+
+	meta := discoverAuthServer(ctx, client, issuer)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", oauthCfg.CallbackPort))
+	if err != nil {
+		return fmt.Errorf("failed to start oauth callback listener: %w", err)
+	}
+	defer listener.Close()
+	redirectURL := fmt.Sprintf("http://127.0.0.1:%d/callback", listener.Addr().(*net.TCPAddr).Port)
+
+	creds := &oauthCredentials{
+		ClientID:     oauthCfg.ClientID,
+		ClientSecret: oauthCfg.ClientSecret,
+		AuthURL:      meta.AuthorizationEndpoint,
+		TokenURL:     meta.TokenEndpoint,
+		Scopes:       scopes,
+		Resource:     resource,
+	}
+	if creds.ClientID == "" {
+		if meta.RegistrationEndpoint == "" {
+			return fmt.Errorf("mcp '%s': authorization server does not support dynamic client registration, set oauth.client_id", name)
+		}
+		reg, err := registerClient(ctx, client, meta.RegistrationEndpoint, clientRegistration{
+			RedirectURIs:            []string{redirectURL},
+			TokenEndpointAuthMethod: "none",
+			GrantTypes:              []string{"authorization_code", "refresh_token"},
+			ResponseTypes:           []string{"code"},
+			ClientName:              "CrushPlus",
+			Scope:                   strings.Join(scopes, " "),
+		})
+		if err != nil {
+			return fmt.Errorf("mcp '%s': failed to register client: %w", name, err)
+		}
+		creds.ClientID = reg.ClientID
+		creds.ClientSecret = reg.ClientSecret
+	}
+
+	conf := creds.config(redirectURL)
+	verifier := oauth2.GenerateVerifier()
+	state := oauth2.GenerateVerifier()
+	opts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(verifier)}
+	if resource != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("resource", resource))
+	}
+
+	results := make(chan callbackResult, 1)
+	srv := &http.Server{
+		Handler:           callbackHandler(state, results),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() { _ = srv.Serve(listener) }()
+	defer srv.Close()
+
+	authURL := conf.AuthCodeURL(state, opts...)
+	if err := openURL(authURL); err != nil {
+		slog.Warn("failed to open browser, open the url manually to authorize the mcp", "name", name, "url", authURL, "error", err)
+	}
+
+	var result callbackResult
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("mcp '%s': authorization not completed: %w", name, ctx.Err())
+	case result = <-results:
+	}
+	if result.err != nil {
+		return fmt.Errorf("mcp '%s': %w", name, result.err)
+	}
+
+	exchangeOpts := []oauth2.AuthCodeOption{oauth2.VerifierOption(verifier)}
+	if resource != "" {
+		exchangeOpts = append(exchangeOpts, oauth2.SetAuthURLParam("resource", resource))
+	}
+	token, err := conf.Exchange(context.WithValue(ctx, oauth2.HTTPClient, client), result.code, exchangeOpts...)
+	if err != nil {
+		return fmt.Errorf("mcp '%s': failed to exchange authorization code: %w", name, err)
+	}
+	creds.Token = token
+
+	if err := store.save(name, creds); err != nil {
+		return err
+	}
+	authChallenges.Del(name)
+	slog.Info("Authorized mcp client", "name", name)
+	return nil
+}
+
+func callbackHandler(state string, results chan<- callbackResult) http.Handler {
+	var once sync.Once
+	send := func(r callbackResult) {
+		once.Do(func() { results <- r })
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		if q.Get("state") != state {
+			http.Error(w, "invalid state", http.StatusBadRequest)
+			return
+		}
+		if e := q.Get("error"); e != "" {
+			send(callbackResult{err: fmt.Errorf("authorization failed: %s %s", e, q.Get("error_description"))})
+			http.Error(w, "Authorization failed, you can close this window.", http.StatusBadRequest)
+			return
+		}
+		send(callbackResult{code: q.Get("code")})
+		fmt.Fprintln(w, "Authorization complete, you can close this window and return to CrushPlus.")
+	})
+}
+
+type protectedResourceMetadata struct {
+	Resource             string   `json:"resource"`
+	AuthorizationServers []string `json:"authorization_servers,omitempty"`
+	ScopesSupported      []string `json:"scopes_supported,omitempty"`
+}
+
+type authServerMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	RegistrationEndpoint  string `json:"registration_endpoint,omitempty"`
+}
+
+type clientRegistration struct {
+	RedirectURIs            []string `json:"redirect_uris"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	ClientName              string   `json:"client_name,omitempty"`
+	Scope                   string   `json:"scope,omitempty"`
+}
+
+type clientRegistrationResponse struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// wellKnownURLs returns the well-known metadata URLs for the given resource
+// or issuer: first with the well-known path inserted before its path, then
+// at the root, as specified by RFC 8414 and RFC 9728.
+func wellKnownURLs(base string, suffixes ...string) []string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil
+	}
+	origin := u.Scheme + "://" + u.Host
+	path := strings.TrimSuffix(u.Path, "/")
+
+	var urls []string
+	for _, suffix := range suffixes {
+		if path != "" {
+			urls = append(urls, origin+"/.well-known/"+suffix+path)
+		}
+		urls = append(urls, origin+"/.well-known/"+suffix)
+	}
+	return urls
+}
+
+// registerClient performs dynamic client registration (RFC 7591).
+func registerClient(ctx context.Context, client *http.Client, endpoint string, reg clientRegistration) (*clientRegistrationResponse, error) {
+	body, err := json.Marshal(reg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, data)
+	}
+	var result clientRegistrationResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	if result.ClientID == "" {
+		return nil, errors.New("registration response is missing client_id")
+	}
+	return &result, nil
+}
+
+// discoverProtectedResource finds the authorization server of the MCP using
+// its protected resource metadata (RFC 9728). Servers that don't publish it
+// are assumed to be their own authorization server.
+func discoverProtectedResource(ctx context.Context, client *http.Client, serverURL, metadataURL string) (issuer, resource string, scopes []string, err error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("invalid mcp url: %w", err)
+	}
+	origin := u.Scheme + "://" + u.Host
+
+	var candidates []string
+	if metadataURL != "" {
+		candidates = append(candidates, metadataURL)
+	}
+	candidates = append(candidates, wellKnownURLs(serverURL, "oauth-protected-resource")...)
+
+	for _, candidate := range candidates {
+		prm, err := getJSON[protectedResourceMetadata](ctx, client, candidate)
+		if err != nil {
+			slog.Debug("no protected resource metadata", "url", candidate, "error", err)
+			continue
+		}
+		if len(prm.AuthorizationServers) == 0 {
+			continue
+		}
+		return prm.AuthorizationServers[0], cmp.Or(prm.Resource, serverURL), prm.ScopesSupported, nil
+	}
+	return origin, serverURL, nil, nil
+}
+
+// discoverAuthServer fetches the authorization server metadata (RFC 8414),
+// falling back to the default endpoints of the MCP authorization spec.
+func discoverAuthServer(ctx context.Context, client *http.Client, issuer string) *authServerMetadata {
+	for _, candidate := range wellKnownURLs(issuer, "oauth-authorization-server", "openid-configuration") {
+		meta, err := getJSON[authServerMetadata](ctx, client, candidate)
+		if err != nil {
+			slog.Debug("no authorization server metadata", "url", candidate, "error", err)
+			continue
+		}
+		if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" {
+			continue
+		}
+		return meta
+	}
+	slog.Debug("no authorization server metadata, using default endpoints", "issuer", issuer)
+	base := strings.TrimSuffix(issuer, "/")
+	return &authServerMetadata{
+		Issuer:                issuer,
+		AuthorizationEndpoint: base + "/authorize",
+		TokenEndpoint:         base + "/token",
+		RegistrationEndpoint:  base + "/register",
+	}
+}
+
+func getJSON[T any](ctx context.Context, client *http.Client, u string) (*T, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "application/json" {
+		return nil, fmt.Errorf("unexpected content type: %s", resp.Header.Get("Content-Type"))
+	}
+	var v T
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func openBrowser(u string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u)
+	default:
+		cmd = exec.Command("xdg-open", u)
+	}
+	return cmd.Start()
+}
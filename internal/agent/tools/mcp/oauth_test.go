@@ -0,0 +1,215 @@
+package mcp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mudaaaa/crushplus/internal/config"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAuthServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	challenge string
+	tokens    int
+	refreshes int
+}
+
+func newFakeAuthServer(t *testing.T, expiresIn int) *fakeAuthServer {
+	t.Helper()
+
+	s := &fakeAuthServer{}
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, status int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	mux.HandleFunc("/.well-known/oauth-protected-resource/mcp", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, protectedResourceMetadata{
+			Resource:             s.URL + "/mcp",
+			AuthorizationServers: []string{s.URL},
+			ScopesSupported:      []string{"read"},
+		})
+	})
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, authServerMetadata{
+			Issuer:                s.URL,
+			AuthorizationEndpoint: s.URL + "/authorize",
+			TokenEndpoint:         s.URL + "/token",
+			RegistrationEndpoint:  s.URL + "/register",
+		})
+	})
+	mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+		var reg clientRegistration
+		if err := json.NewDecoder(r.Body).Decode(&reg); err != nil || len(reg.RedirectURIs) == 0 {
+			http.Error(w, "bad registration", http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusCreated, clientRegistrationResponse{ClientID: "registered-client"})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("client_id") != "registered-client" || q.Get("code_challenge_method") != "S256" || q.Get("resource") != s.URL+"/mcp" {
+			http.Error(w, "bad authorization request", http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.challenge = q.Get("code_challenge")
+		s.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code=the-code&state="+q.Get("state"), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if r.PostForm.Get("code") != "the-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != s.challenge {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+				return
+			}
+		case "refresh_token":
+			if r.PostForm.Get("refresh_token") != "refresh" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+				return
+			}
+			s.refreshes++
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+			return
+		}
+		s.tokens++
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token":  "access-" + string(rune('0'+s.tokens)),
+			"refresh_token": "refresh",
+			"token_type":    "Bearer",
+			"expires_in":    expiresIn,
+		})
+	})
+	mux.HandleFunc("/mcp", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer resource_metadata="`+s.URL+`/.well-known/oauth-protected-resource/mcp"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// followURL plays the browser: it follows the authorization redirect to our
+// callback.
+func followURL(u string) error {
+	go func() {
+		resp, err := http.Get(u)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	return nil
+}
+
+func TestOAuthLogin(t *testing.T) {
+	t.Parallel()
+
+	t.Run("authorizes and sends the bearer token", func(t *testing.T) {
+		t.Parallel()
+
+		srv := newFakeAuthServer(t, 3600)
+		store := oauthStore{dir: t.TempDir()}
+		name := "oauth-login"
+		m := config.MCPConfig{Type: config.MCPHttp, URL: srv.URL + "/mcp"}
+
+		rt := newAuthRoundTripper(name, nil, store)
+		client := &http.Client{Transport: rt}
+
+		resp, err := client.Get(m.URL)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		challenge, ok := authChallenges.Get(name)
+		require.True(t, ok)
+		require.Equal(t, srv.URL+"/.well-known/oauth-protected-resource/mcp", challenge)
+
+		require.NoError(t, login(t.Context(), name, m, store, srv.Client(), followURL))
+		_, ok = authChallenges.Get(name)
+		require.False(t, ok)
+
+		creds, err := store.load(name)
+		require.NoError(t, err)
+		require.NotNil(t, creds)
+		require.Equal(t, "registered-client", creds.ClientID)
+		require.Equal(t, []string{"read"}, creds.Scopes)
+		require.Equal(t, "access-1", creds.Token.AccessToken)
+
+		rt = newAuthRoundTripper(name, nil, store)
+		client = &http.Client{Transport: rt}
+		resp, err = client.Get(m.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("refreshes and persists expired tokens", func(t *testing.T) {
+		t.Parallel()
+
+		srv := newFakeAuthServer(t, 3600)
+		store := oauthStore{dir: t.TempDir()}
+		name := "oauth-refresh"
+		m := config.MCPConfig{Type: config.MCPHttp, URL: srv.URL + "/mcp"}
+
+		require.NoError(t, login(t.Context(), name, m, store, srv.Client(), followURL))
+
+		creds, err := store.load(name)
+		require.NoError(t, err)
+		creds.Token.Expiry = time.Now().Add(-time.Hour)
+		require.NoError(t, store.save(name, creds))
+
+		client := &http.Client{Transport: newAuthRoundTripper(name, nil, store)}
+		resp, err := client.Get(m.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		creds, err = store.load(name)
+		require.NoError(t, err)
+		require.Equal(t, "access-2", creds.Token.AccessToken)
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		require.Equal(t, 1, srv.refreshes)
+	})
+
+	t.Run("rejects stdio servers", func(t *testing.T) {
+		t.Parallel()
+
+		err := login(t.Context(), "stdio", config.MCPConfig{Type: config.MCPStdio}, oauthStore{dir: t.TempDir()}, http.DefaultClient, followURL)
+		require.Error(t, err)
+	})
+}
+
+func TestWellKnownURLs(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, []string{
+		"https://example.com/.well-known/oauth-protected-resource/v1/mcp",
+		"https://example.com/.well-known/oauth-protected-resource",
+	}, wellKnownURLs("https://example.com/v1/mcp/", "oauth-protected-resource"))
+	require.Equal(t, []string{
+		"https://example.com/.well-known/oauth-authorization-server",
+		"https://example.com/.well-known/openid-configuration",
+	}, wellKnownURLs("https://example.com", "oauth-authorization-server", "openid-configuration"))
+}
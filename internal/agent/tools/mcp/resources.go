@@ -0,0 +1,163 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"log/slog"
+	"strings"
+
+	"github.com/mudaaaa/crushplus/internal/csync"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type (
+	Resource         = mcp.Resource
+	ResourceTemplate = mcp.ResourceTemplate
+	ResourceContents = mcp.ResourceContents
+)
+
+var (
+	allResources         = csync.NewMap[string, []*Resource]()
+	allResourceTemplates = csync.NewMap[string, []*ResourceTemplate]()
+
+	// resourceCache holds the contents of subscribed resources, keyed by MCP
+	// name and URI. Entries are dropped when the server notifies us that the
+	// resource changed.
+	resourceCache = csync.NewMap[string, []*ResourceContents]()
+)
+
+// Resources returns all available MCP resources.
+func Resources() iter.Seq2[string, []*Resource] {
+	return allResources.Seq2()
+}
+
+// ResourceTemplates returns all available MCP resource templates.
+func ResourceTemplates() iter.Seq2[string, []*ResourceTemplate] {
+	return allResourceTemplates.Seq2()
+}
+
+// GetResources returns the resources and resource templates of the given
+// MCP.
+func GetResources(name string) ([]*Resource, []*ResourceTemplate) {
+	resources, _ := allResources.Get(name)
+	templates, _ := allResourceTemplates.Get(name)
+	return resources, templates
+}
+
+// HasResources reports whether any MCP client exposes resources or resource
+// templates.
+func HasResources() bool {
+	return allResources.Len() > 0 || allResourceTemplates.Len() > 0
+}
+
+// ReadResource reads the contents of the resource with the given URI from the
+// given MCP. If the server supports subscriptions, the resource is subscribed
+// to and its contents are cached until the server reports an update.
+func ReadResource(ctx context.Context, name, uri string) ([]*ResourceContents, error) {
+	key := resourceCacheKey(name, uri)
+	if contents, ok := resourceCache.Get(key); ok {
+		return contents, nil
+	}
+
+	trackCaller(ctx, name)
+	c, err := getOrRenewClient(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri})
+	if err != nil {
+		return nil, err
+	}
+
+	if canSubscribe(c) {
+		if err := c.Subscribe(ctx, &mcp.SubscribeParams{URI: uri}); err != nil {
+			slog.Warn("error subscribing to mcp resource", "name", name, "uri", uri, "error", err)
+		} else {
+			resourceCache.Set(key, result.Contents)
+		}
+	}
+	return result.Contents, nil
+}
+
+// RefreshResources gets the updated list of resources and resource templates
+// from the MCP and updates the global state.
+func RefreshResources(ctx context.Context, name string) {
+	session, ok := sessions.Get(name)
+	if !ok {
+		slog.Warn("refresh resources: no session", "name", name)
+		return
+	}
+
+	resources, templates := getResources(ctx, name, session)
+	updateResources(name, resources, templates)
+
+	prev, _ := states.Get(name)
+	prev.Counts.Resources = len(resources) + len(templates)
+	updateState(name, StateConnected, nil, session, prev.Counts)
+}
+
+// getResources returns the resources and resource templates of the MCP.
+// Resources are optional, so a list that fails is logged and left empty
+// rather than failing the MCP along with its tools and prompts.
+func getResources(ctx context.Context, name string, c *mcp.ClientSession) ([]*Resource, []*ResourceTemplate) {
+	if c.InitializeResult().Capabilities.Resources == nil {
+		return nil, nil
+	}
+	var resources []*Resource
+	for r, err := range c.Resources(ctx, &mcp.ListResourcesParams{}) {
+		if err != nil {
+			slog.Warn("error listing mcp resources", "name", name, "error", err)
+			resources = nil
+			break
+		}
+		resources = append(resources, r)
+	}
+	var templates []*ResourceTemplate
+	for t, err := range c.ResourceTemplates(ctx, &mcp.ListResourceTemplatesParams{}) {
+		if err != nil {
+			slog.Warn("error listing mcp resource templates", "name", name, "error", err)
+			templates = nil
+			break
+		}
+		templates = append(templates, t)
+	}
+	return resources, templates
+}
+
+func updateResources(name string, resources []*Resource, templates []*ResourceTemplate) {
+	if len(resources) == 0 {
+		allResources.Del(name)
+	} else {
+		allResources.Set(name, resources)
+	}
+	if len(templates) == 0 {
+		allResourceTemplates.Del(name)
+	} else {
+		allResourceTemplates.Set(name, templates)
+	}
+}
+
+func canSubscribe(c *mcp.ClientSession) bool {
+	caps := c.InitializeResult().Capabilities.Resources
+	return caps != nil && caps.Subscribe
+}
+
+func invalidateResource(name, uri string) {
+	resourceCache.Del(resourceCacheKey(name, uri))
+}
+
+// invalidateResources drops all cached resources of the given MCP, e.g. when
+// its session is lost along with its subscriptions.
+func invalidateResources(name string) {
+	prefix := resourceCacheKey(name, "")
+	for key := range resourceCache.Seq2() {
+		if strings.HasPrefix(key, prefix) {
+			resourceCache.Del(key)
+		}
+	}
+}
+
+func resourceCacheKey(name, uri string) string {
+	return fmt.Sprintf("%s\x00%s", name, uri)
+}
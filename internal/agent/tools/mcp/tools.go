@@ -28,6 +28,7 @@ func RunTool(ctx context.Context, name, toolName string, input string) (string,
 		return "", fmt.Errorf("error parsing parameters: %s", err)
 	}
 
+	trackCaller(ctx, name)
 	c, err := getOrRenewClient(ctx, name)
 	if err != nil {
 		return "", err
@@ -0,0 +1,89 @@
+package tools
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/permission"
+	"github.com/mudaaaa/crushplus/internal/worktree"
+)
+
+const (
+	MergeAgentPatchToolName = "merge_agent_patch"
+)
+
+//go:embed merge_agent_patch.md
+var mergeAgentPatchDescription []byte
+
+var patchIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+type MergeAgentPatchParams struct {
+	PatchID string `json:"patch_id" description:"The ID of the patch returned by the parallel_agents tool"`
+	Discard bool   `json:"discard,omitempty" description:"Delete the patch instead of applying it"`
+}
+
+type MergeAgentPatchPermissionsParams struct {
+	PatchID string `json:"patch_id"`
+	Patch   string `json:"patch"`
+}
+
+func NewMergeAgentPatchTool(permissions permission.Service, workingDir, dataDir string) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		MergeAgentPatchToolName,
+		string(mergeAgentPatchDescription),
+		func(ctx context.Context, params MergeAgentPatchParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if !patchIDPattern.MatchString(params.PatchID) {
+				return fantasy.NewTextErrorResponse("invalid patch_id"), nil
+			}
+
+			patchPath := worktree.PatchPath(dataDir, params.PatchID)
+			patch, err := os.ReadFile(patchPath)
+			if os.IsNotExist(err) {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("patch not found: %s", params.PatchID)), nil
+			} else if err != nil {
+				return fantasy.ToolResponse{}, fmt.Errorf("error reading patch: %w", err)
+			}
+
+			if params.Discard {
+				if err := os.Remove(patchPath); err != nil {
+					return fantasy.ToolResponse{}, fmt.Errorf("error deleting patch: %w", err)
+				}
+				return fantasy.NewTextResponse(fmt.Sprintf("Patch %s discarded.", params.PatchID)), nil
+			}
+
+			sessionID := GetSessionFromContext(ctx)
+			if sessionID == "" {
+				return fantasy.ToolResponse{}, fmt.Errorf("session_id is required")
+			}
+
+			p := permissions.Request(
+				permission.CreatePermissionRequest{
+					SessionID:   sessionID,
+					Path:        workingDir,
+					ToolCallID:  call.ID,
+					ToolName:    MergeAgentPatchToolName,
+					Action:      "merge",
+					Description: fmt.Sprintf("Apply the patch %s of a sub-agent to the working tree", params.PatchID),
+					Params: MergeAgentPatchPermissionsParams{
+						PatchID: params.PatchID,
+						Patch:   string(patch),
+					},
+				},
+			)
+			if !p {
+				return fantasy.ToolResponse{}, permission.ErrorPermissionDenied
+			}
+
+			if err := worktree.Apply(ctx, workingDir, string(patch)); err != nil {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("The patch %s doesn't apply cleanly, nothing was changed:\n%s", params.PatchID, err)), nil
+			}
+			if err := os.Remove(patchPath); err != nil {
+				return fantasy.ToolResponse{}, fmt.Errorf("error deleting patch: %w", err)
+			}
+			return fantasy.NewTextResponse(fmt.Sprintf("Patch %s applied to the working tree.", params.PatchID)), nil
+		})
+}
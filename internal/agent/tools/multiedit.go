@@ -80,6 +80,7 @@ func NewMultiEditTool(lspClients *csync.Map[string, *lsp.Client], permissions pe
 			var response fantasy.ToolResponse
 			var err error
 
+			diagnosticsBefore := snapshotDiagnostics(ctx, lspClients, params.FilePath)
 			editCtx := editContext{ctx, permissions, files, workingDir}
 			// Handle file creation case (first edit has empty old_string)
 			if len(params.Edits) > 0 && params.Edits[0].OldString == "" {
@@ -99,9 +100,9 @@ func NewMultiEditTool(lspClients *csync.Map[string, *lsp.Client], permissions pe
 			// Notify LSP clients about the change
 			notifyLSPs(ctx, lspClients, params.FilePath)
 
-			// Wait for LSP diagnostics and add them to the response
+			// Wait for LSP diagnostics and report what the edit changed
 			text := fmt.Sprintf("<result>\n%s\n</result>\n", response.Content)
-			text += getDiagnostics(params.FilePath, lspClients)
+			text += getDiagnosticsDelta(diagnosticsBefore, lspClients)
 			response.Content = text
 			return response, nil
 		})
@@ -40,6 +40,17 @@ func (m *mockPermissionService) SubscribeNotifications(ctx context.Context) <-ch
 	return make(<-chan pubsub.Event[permission.PermissionNotification])
 }
 
+func (m *mockPermissionService) Elicit(ctx context.Context, opts permission.CreateElicitationRequest) permission.ElicitationResponse {
+	return permission.ElicitationResponse{Action: permission.ElicitationCancel}
+}
+
+func (m *mockPermissionService) RespondElicitation(request permission.ElicitationRequest, resp permission.ElicitationResponse) {
+}
+
+func (m *mockPermissionService) SubscribeElicitations(ctx context.Context) <-chan pubsub.Event[permission.ElicitationRequest] {
+	return make(<-chan pubsub.Event[permission.ElicitationRequest])
+}
+
 type mockHistoryService struct {
 	*pubsub.Broker[history.File]
 }
@@ -68,6 +79,10 @@ func (m *mockHistoryService) ListLatestSessionFiles(ctx context.Context, session
 	return nil, nil
 }
 
+func (m *mockHistoryService) ListRecentPaths(ctx context.Context, limit int) ([]string, error) {
+	return nil, nil
+}
+
 func (m *mockHistoryService) Delete(ctx context.Context, id string) error {
 	return nil
 }
@@ -0,0 +1,188 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/config"
+	"github.com/mudaaaa/crushplus/internal/redact"
+)
+
+// ToolOutputDir is the directory, inside the data directory, where tool
+// results that are over their output limit are saved.
+const ToolOutputDir = "tool-output"
+
+// maxToolOutputAge is how long the saved tool results are kept.
+const maxToolOutputAge = 7 * 24 * time.Hour
+
+// PruneToolOutput removes the tool results saved in dir more than a week
+// ago, for the directory to not grow forever.
+func PruneToolOutput(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err == nil && !e.IsDir() && time.Since(info.ModTime()) > maxToolOutputAge {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
+
+type outputLimitTool struct {
+	fantasy.AgentTool
+	limit int
+	dir   string
+}
+
+// WithOutputLimit wraps a tool so that text results longer than limit
+// characters are saved to a file in dir, and replaced with a preview of their
+// start and end, plus the path of the file for the model to page through with
+// the view tool. A limit of zero leaves the tool as is.
+func WithOutputLimit(tool fantasy.AgentTool, limit int, dir string) fantasy.AgentTool {
+	if limit <= 0 {
+		return tool
+	}
+	return &outputLimitTool{
+		AgentTool: tool,
+		limit:     limit,
+		dir:       dir,
+	}
+}
+
+// WithResultLimits wraps each of the tools with WithRedaction and
+// WithOutputLimit, saving the results over their limit in the tool output
+// directory of dataDir.
+func WithResultLimits(agentTools []fantasy.AgentTool, redactor *redact.Redactor, output config.ToolOutput, dataDir string) []fantasy.AgentTool {
+	dir := filepath.Join(dataDir, ToolOutputDir)
+	for i, tool := range agentTools {
+		// Secrets are redacted first, so that they're not in the files of
+		// the results over the limit either.
+		tool = WithRedaction(tool, redactor)
+		agentTools[i] = WithOutputLimit(tool, output.Limit(tool.Info().Name), dir)
+	}
+	return agentTools
+}
+
+func (t *outputLimitTool) Run(ctx context.Context, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+	resp, err := t.AgentTool.Run(ctx, call)
+	if err != nil || len(resp.Content) <= t.limit || (resp.Type != "" && resp.Type != "text") {
+		return resp, err
+	}
+
+	path, err := t.spill(call, resp.Content)
+	if err != nil {
+		// Without a file to page through, a preview is still better than
+		// blowing the context window.
+		resp.Content = previewOutput(resp.Content, t.limit, "")
+		return resp, nil
+	}
+	resp.Content = previewOutput(resp.Content, t.limit, path)
+	return resp, nil
+}
+
+// spill saves the output of a call to a file. Long lines are wrapped so that
+// the view tool, which truncates lines, can show all of it.
+func (t *outputLimitTool) spill(call fantasy.ToolCall, content string) (string, error) {
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s.txt", sanitizeFileName(t.Info().Name), sanitizeFileName(call.ID))
+	path := filepath.Join(t.dir, name)
+	if err := os.WriteFile(path, []byte(wrapLongLines(content, MaxLineLength)), 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// previewOutput keeps the start and end of content within limit characters,
+// cutting at line boundaries when possible.
+func previewOutput(content string, limit int, path string) string {
+	half := limit / 2
+	// Don't split multi-byte runes.
+	headEnd := half
+	for headEnd > 0 && !isRuneStart(content[headEnd]) {
+		headEnd--
+	}
+	head := content[:headEnd]
+	if i := strings.LastIndexByte(head, '\n'); i > half/2 {
+		head = head[:i]
+	}
+	tailStart := len(content) - half
+	for tailStart < len(content) && !isRuneStart(content[tailStart]) {
+		tailStart++
+	}
+	tail := content[tailStart:]
+	if i := strings.IndexByte(tail, '\n'); i >= 0 && i < half/2 {
+		tail = tail[i+1:]
+	}
+	omitted := content[len(head) : len(content)-len(tail)]
+
+	var b strings.Builder
+	b.WriteString(head)
+	fmt.Fprintf(&b, "\n\n... [%d lines, %d characters omitted] ...\n\n", countLines(strings.Trim(omitted, "\n")), len(omitted))
+	b.WriteString(tail)
+	if path == "" {
+		fmt.Fprintf(&b, "\n\n<system_info>Output was over %d characters and was truncated.</system_info>", limit)
+		return b.String()
+	}
+
+	lines := countLines(content)
+	pageLines := max(10, min(DefaultReadLimit, limit*lines/len(content)))
+	fmt.Fprintf(&b, "\n\n<system_info>Output was over %d characters, so only its start and end are shown. The full output (%d lines) was saved to %s; read it with the view tool using offset and a limit of about %d lines.</system_info>", limit, lines, path, pageLines)
+	return b.String()
+}
+
+func wrapLongLines(content string, width int) string {
+	lines := strings.Split(content, "\n")
+	var b strings.Builder
+	b.Grow(len(content))
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		for len(line) > width {
+			cut := width
+			// Don't split multi-byte runes.
+			for cut > 0 && !isRuneStart(line[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				cut = width
+			}
+			b.WriteString(line[:cut])
+			b.WriteByte('\n')
+			line = line[cut:]
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func countLines(s string) int {
+	if s == "" {
+		return 0
+	}
+	return strings.Count(s, "\n") + 1
+}
+
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
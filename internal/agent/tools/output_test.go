@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/config"
+	"github.com/mudaaaa/crushplus/internal/redact"
+	"github.com/stretchr/testify/require"
+)
+
+type echoParams struct {
+	Text string `json:"text"`
+}
+
+func newEchoTool() fantasy.AgentTool {
+	return fantasy.NewAgentTool("echo", "Echoes its input",
+		func(ctx context.Context, params echoParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			return fantasy.NewTextResponse(params.Text), nil
+		})
+}
+
+func TestWithOutputLimit(t *testing.T) {
+	t.Parallel()
+
+	t.Run("keeps short output", func(t *testing.T) {
+		t.Parallel()
+
+		tool := WithOutputLimit(newEchoTool(), 100, t.TempDir())
+		resp, err := tool.Run(t.Context(), fantasy.ToolCall{ID: "call_1", Input: `{"text":"hello"}`})
+		require.NoError(t, err)
+		require.Equal(t, "hello", resp.Content)
+	})
+
+	t.Run("spills long output to a file", func(t *testing.T) {
+		t.Parallel()
+
+		var lines []string
+		for i := range 1000 {
+			lines = append(lines, strings.Repeat("x", 10)+" line "+string(rune('a'+i%26)))
+		}
+		lines[0] = "first"
+		lines[len(lines)-1] = "last"
+		text := strings.Join(lines, "\n")
+
+		dir := t.TempDir()
+		tool := WithOutputLimit(newEchoTool(), 1000, dir)
+		resp, err := tool.Run(t.Context(), fantasy.ToolCall{ID: "call/1", Input: `{"text":"` + strings.ReplaceAll(text, "\n", `\n`) + `"}`})
+		require.NoError(t, err)
+
+		require.Less(t, len(resp.Content), 1500)
+		require.True(t, strings.HasPrefix(resp.Content, "first\n"))
+		require.Contains(t, resp.Content, "\nlast\n")
+		require.Contains(t, resp.Content, "characters omitted")
+		require.Contains(t, resp.Content, "echo-call_1.txt")
+
+		saved, err := os.ReadFile(dir + "/echo-call_1.txt")
+		require.NoError(t, err)
+		require.Equal(t, text, string(saved))
+	})
+
+	t.Run("disabled limit", func(t *testing.T) {
+		t.Parallel()
+
+		tool := newEchoTool()
+		require.Equal(t, tool, WithOutputLimit(tool, 0, t.TempDir()))
+	})
+}
+
+func TestWithResultLimits(t *testing.T) {
+	t.Parallel()
+
+	dataDir := t.TempDir()
+	redactor := redact.New([]redact.Secret{{Name: "TOKEN", Value: "s3cr3t-token"}}, nil)
+	output := config.ToolOutput{Tools: map[string]int{"echo": 100}}
+	agentTools := WithResultLimits([]fantasy.AgentTool{newEchoTool()}, redactor, output, dataDir)
+
+	text := "s3cr3t-token " + strings.Repeat("x", 200)
+	resp, err := agentTools[0].Run(t.Context(), fantasy.ToolCall{ID: "call_1", Input: `{"text":"` + text + `"}`})
+	require.NoError(t, err)
+	require.NotContains(t, resp.Content, "s3cr3t-token")
+	require.Contains(t, resp.Content, "characters omitted")
+
+	// The saved result is redacted too.
+	saved, err := os.ReadFile(filepath.Join(dataDir, ToolOutputDir, "echo-call_1.txt"))
+	require.NoError(t, err)
+	require.NotContains(t, string(saved), "s3cr3t-token")
+	require.Contains(t, string(saved), redact.Placeholder("TOKEN"))
+}
+
+func TestWrapLongLines(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "abc\ndef\ng\nhi", wrapLongLines("abcdefg\nhi", 3))
+	require.Equal(t, "ab\né\néc", wrapLongLines("abééc", 3))
+}
+
+func TestPreviewOutput(t *testing.T) {
+	t.Parallel()
+
+	// The cut points fall in the middle of the two-byte runes.
+	content := strings.Repeat("é", 100)
+	preview := previewOutput(content, 51, "")
+	require.True(t, utf8.ValidString(preview))
+	require.True(t, strings.HasPrefix(preview, strings.Repeat("é", 12)+"\n"))
+	require.Contains(t, preview, "\n"+strings.Repeat("é", 12)+"\n")
+}
+
+func TestPruneToolOutput(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	old, recent := filepath.Join(dir, "old.txt"), filepath.Join(dir, "recent.txt")
+	require.NoError(t, os.WriteFile(old, nil, 0o644))
+	require.NoError(t, os.WriteFile(recent, nil, 0o644))
+	past := time.Now().Add(-8 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(old, past, past))
+
+	PruneToolOutput(dir)
+	require.NoFileExists(t, old)
+	require.FileExists(t, recent)
+}
@@ -0,0 +1,55 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/redact"
+)
+
+type redactTool struct {
+	fantasy.AgentTool
+	redactor *redact.Redactor
+}
+
+// WithRedaction wraps a tool so that secrets are scrubbed from its text
+// results and metadata before they reach the model and are saved. What was
+// redacted is noted in the result for the model and logged. A nil redactor
+// leaves the tool as is.
+func WithRedaction(tool fantasy.AgentTool, redactor *redact.Redactor) fantasy.AgentTool {
+	if redactor == nil {
+		return tool
+	}
+	return &redactTool{
+		AgentTool: tool,
+		redactor:  redactor,
+	}
+}
+
+func (t *redactTool) Run(ctx context.Context, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+	resp, err := t.AgentTool.Run(ctx, call)
+	if err != nil {
+		return resp, err
+	}
+
+	report := make(redact.Report)
+	if resp.Type == "" || resp.Type == "text" {
+		var contentReport redact.Report
+		resp.Content, contentReport = t.redactor.Redact(resp.Content)
+		report.Add(contentReport)
+	}
+	var metadataReport redact.Report
+	resp.Metadata, metadataReport = t.redactor.RedactJSON(resp.Metadata)
+	report.Add(metadataReport)
+	if len(report) == 0 {
+		return resp, nil
+	}
+
+	slog.Info("Redacted secrets from tool result", "tool", t.Info().Name, "redacted", report.String())
+	if resp.Type == "" || resp.Type == "text" {
+		resp.Content += fmt.Sprintf("\n\n<system_info>Secrets were redacted from this output: %s. Don't try to reveal them.</system_info>", report)
+	}
+	return resp, nil
+}
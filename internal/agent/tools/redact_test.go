@@ -0,0 +1,45 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/csync"
+	"github.com/mudaaaa/crushplus/internal/lsp"
+	"github.com/mudaaaa/crushplus/internal/redact"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRedaction(t *testing.T) {
+	t.Parallel()
+
+	redactor := redact.New([]redact.Secret{{Name: "API_KEY", Value: "my-secret-value-123"}}, nil)
+	tool := WithRedaction(newEchoTool(), redactor)
+
+	resp, err := tool.Run(t.Context(), fantasy.ToolCall{ID: "call_1", Input: `{"text":"key: my-secret-value-123"}`})
+	require.NoError(t, err)
+	require.Contains(t, resp.Content, "key: [REDACTED:API_KEY]")
+	require.Contains(t, resp.Content, "Secrets were redacted from this output: API_KEY.")
+	require.NotContains(t, resp.Content, "my-secret-value-123")
+
+	resp, err = tool.Run(t.Context(), fantasy.ToolCall{ID: "call_2", Input: `{"text":"hello"}`})
+	require.NoError(t, err)
+	require.Equal(t, "hello", resp.Content)
+}
+
+func TestWithRedactionView(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(path, []byte("DEBUG=true\nexport DB_PASSWORD=hunter2hunter2\n"), 0o644))
+
+	// The secrets of .env files are redacted despite the line numbers.
+	tool := WithRedaction(NewViewTool(csync.NewMap[string, *lsp.Client](), nil, dir), redact.New(nil, redact.DefaultPatterns))
+	resp, err := tool.Run(t.Context(), fantasy.ToolCall{ID: "call_1", Input: `{"file_path":"` + path + `"}`})
+	require.NoError(t, err)
+	require.Contains(t, resp.Content, "     2|export DB_PASSWORD=[REDACTED:secret assignment]")
+	require.NotContains(t, resp.Content, "hunter2hunter2")
+}
@@ -0,0 +1,137 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// robotsUserAgent is the name the robots.txt rules are looked up for, before
+// falling back to the rules for all crawlers.
+const robotsUserAgent = "crush"
+
+// maxRobotsSize is the size of robots.txt files read, as crawlers commonly
+// do.
+const maxRobotsSize = 500 * 1024
+
+type robotsRule struct {
+	allow bool
+	path  string
+}
+
+// robotsAllowed reports whether the robots.txt of the site of the URL lets
+// crawlers fetch it. Sites without a readable robots.txt allow everything.
+func robotsAllowed(ctx context.Context, client *http.Client, u *url.URL) bool {
+	robotsURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return true
+	}
+	req.Header.Set("User-Agent", "crush/1.0")
+	resp, err := client.Do(req)
+	if err != nil {
+		return true
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return true
+	}
+	rules := parseRobots(io.LimitReader(resp.Body, maxRobotsSize), robotsUserAgent)
+	return robotsMatch(rules, u.EscapedPath()+queryOf(u))
+}
+
+func queryOf(u *url.URL) string {
+	if u.RawQuery == "" {
+		return ""
+	}
+	return "?" + u.RawQuery
+}
+
+// parseRobots returns the rules of the group of the user agent, or else of
+// the group for all agents.
+func parseRobots(r io.Reader, userAgent string) []robotsRule {
+	groups := map[string][]robotsRule{}
+	var agents []string
+	inRules := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			// A user agent after rules starts a new group.
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agent := strings.ToLower(value)
+			agents = append(agents, agent)
+			if _, ok := groups[agent]; !ok {
+				groups[agent] = nil
+			}
+		case "allow", "disallow":
+			inRules = true
+			// An empty disallow allows everything.
+			if value == "" {
+				continue
+			}
+			for _, agent := range agents {
+				groups[agent] = append(groups[agent], robotsRule{allow: key == "allow", path: value})
+			}
+		}
+	}
+	for agent, rules := range groups {
+		if agent != "*" && strings.Contains(strings.ToLower(userAgent), agent) {
+			return rules
+		}
+	}
+	return groups["*"]
+}
+
+// robotsMatch applies the most specific rule matching the path, allowing
+// on ties.
+func robotsMatch(rules []robotsRule, path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	allowed, longest := true, -1
+	for _, rule := range rules {
+		if !robotsPathMatch(rule.path, path) {
+			continue
+		}
+		if len(rule.path) > longest || (len(rule.path) == longest && rule.allow) {
+			allowed, longest = rule.allow, len(rule.path)
+		}
+	}
+	return allowed
+}
+
+// robotsPathMatch matches a path against a rule, where * matches any
+// characters and a final $ the end of the path.
+func robotsPathMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return strings.HasSuffix(rest, part)
+		}
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+	return !anchored || rest == ""
+}
@@ -0,0 +1,450 @@
+package tools
+
+import (
+	"cmp"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/permission"
+	"github.com/mudaaaa/crushplus/internal/shell"
+	"github.com/mudaaaa/crushplus/internal/shellstate"
+)
+
+type TestParams struct {
+	Path      string `json:"path,omitempty" description:"The package, directory or file to test, like ./internal/foo/... or src/foo.test.ts (defaults to the whole project)"`
+	Name      string `json:"name,omitempty" description:"Only run the tests whose name matches this pattern"`
+	Framework string `json:"framework,omitempty" description:"The test framework: go, jest, vitest or pytest (detected from the project by default)"`
+	Timeout   int    `json:"timeout,omitempty" description:"How long the tests can run, in seconds (defaults to 600, max 1800)"`
+}
+
+type TestPermissionsParams struct {
+	Framework  string `json:"framework"`
+	Command    string `json:"command"`
+	WorkingDir string `json:"working_dir"`
+}
+
+type TestResponseMetadata struct {
+	Framework  string        `json:"framework"`
+	Command    string        `json:"command"`
+	StartTime  int64         `json:"start_time"`
+	EndTime    int64         `json:"end_time"`
+	Passed     int           `json:"passed"`
+	Failed     int           `json:"failed"`
+	Skipped    int           `json:"skipped"`
+	Failures   []TestFailure `json:"failures,omitempty"`
+	Errors     []TestFailure `json:"errors,omitempty"`
+	TimedOut   bool          `json:"timed_out,omitempty"`
+	WorkingDir string        `json:"working_dir"`
+}
+
+// TestFailure is a failed test, or an error outside of tests, like a
+// package that doesn't build.
+type TestFailure struct {
+	// Suite is the package, file or class of the test.
+	Suite    string  `json:"suite,omitempty"`
+	Name     string  `json:"name,omitempty"`
+	File     string  `json:"file,omitempty"`
+	Line     int     `json:"line,omitempty"`
+	Message  string  `json:"message,omitempty"`
+	Duration float64 `json:"duration,omitempty"`
+}
+
+const (
+	TestToolName = "test"
+
+	TestFrameworkGo     = "go"
+	TestFrameworkJest   = "jest"
+	TestFrameworkVitest = "vitest"
+	TestFrameworkPytest = "pytest"
+
+	defaultTestTimeout = 600
+	maxTestTimeout     = 1800
+	// maxTestFailures is the number of failures detailed in the result.
+	maxTestFailures = 20
+	// maxTestMessageLines is the number of lines kept of a failure message.
+	maxTestMessageLines = 30
+	// testOutputTailLines is the number of lines of output shown when no
+	// results could be read from it.
+	testOutputTailLines = 50
+)
+
+var testFrameworks = []string{TestFrameworkGo, TestFrameworkJest, TestFrameworkVitest, TestFrameworkPytest}
+
+//go:embed test.md
+var testDescription []byte
+
+// testReport holds the results of a test run.
+type testReport struct {
+	passed, failed, skipped int
+	failures                []TestFailure
+	errors                  []TestFailure
+}
+
+func NewTestTool(permissions permission.Service, shells shellstate.Service, workingDir string) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		TestToolName,
+		string(testDescription),
+		func(ctx context.Context, params TestParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			sessionID := GetSessionFromContext(ctx)
+			if sessionID == "" {
+				return fantasy.ToolResponse{}, fmt.Errorf("session ID is required for running tests")
+			}
+
+			sessionShell, err := shells.Shell(ctx, sessionID, workingDir)
+			if err != nil {
+				return fantasy.ToolResponse{}, fmt.Errorf("error loading shell: %w", err)
+			}
+			execWorkingDir := sessionShell.GetWorkingDir()
+
+			framework := params.Framework
+			if framework == "" {
+				framework = detectTestFramework(execWorkingDir, params.Path)
+				if framework == "" {
+					return fantasy.NewTextErrorResponse("could not detect the test framework of the project, set framework to one of: " + strings.Join(testFrameworks, ", ")), nil
+				}
+			} else if !slices.Contains(testFrameworks, framework) {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("unsupported test framework %q, use one of: %s", framework, strings.Join(testFrameworks, ", "))), nil
+			}
+
+			reportDir, err := os.MkdirTemp("", "crush-test-*")
+			if err != nil {
+				return fantasy.ToolResponse{}, fmt.Errorf("error creating report directory: %w", err)
+			}
+			defer os.RemoveAll(reportDir)
+			reportFile := filepath.Join(reportDir, "report")
+			command := testCommand(framework, params, reportFile)
+
+			p := permissions.Request(
+				permission.CreatePermissionRequest{
+					SessionID:   sessionID,
+					Path:        execWorkingDir,
+					ToolCallID:  call.ID,
+					ToolName:    TestToolName,
+					Action:      "execute",
+					Description: fmt.Sprintf("Run tests: %s", command),
+					Params: TestPermissionsParams{
+						Framework:  framework,
+						Command:    command,
+						WorkingDir: execWorkingDir,
+					},
+				},
+			)
+			if !p {
+				return fantasy.ToolResponse{}, permission.ErrorPermissionDenied
+			}
+
+			timeout := defaultTestTimeout
+			if params.Timeout > 0 {
+				timeout = min(params.Timeout, maxTestTimeout)
+			}
+			runCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+			defer cancel()
+
+			// Tests run in a copy of the session's shell, so they see its
+			// variables, but don't change it.
+			testShell := sessionShell.Clone()
+			testShell.SetBlockFuncs(blockFuncs())
+			startTime := time.Now()
+			stdout, stderr, execErr := testShell.Exec(runCtx, command)
+			if ctx.Err() != nil {
+				return fantasy.ToolResponse{}, ctx.Err()
+			}
+			timedOut := errors.Is(runCtx.Err(), context.DeadlineExceeded)
+			if execErr != nil && !timedOut && shell.ExitCode(execErr) == 0 && !shell.IsInterrupt(execErr) {
+				return fantasy.ToolResponse{}, fmt.Errorf("error running tests: %w", execErr)
+			}
+
+			var report testReport
+			var readErr error
+			switch framework {
+			case TestFrameworkGo:
+				report = parseGoTestOutput(stdout, execWorkingDir)
+			case TestFrameworkJest, TestFrameworkVitest:
+				report, readErr = parseJestReport(reportFile, execWorkingDir)
+			case TestFrameworkPytest:
+				report, readErr = parseJUnitReport(reportFile, execWorkingDir)
+			}
+
+			metadata := TestResponseMetadata{
+				Framework:  framework,
+				Command:    command,
+				StartTime:  startTime.UnixMilli(),
+				EndTime:    time.Now().UnixMilli(),
+				Passed:     report.passed,
+				Failed:     report.failed,
+				Skipped:    report.skipped,
+				Failures:   report.failures,
+				Errors:     report.errors,
+				TimedOut:   timedOut,
+				WorkingDir: execWorkingDir,
+			}
+
+			var b strings.Builder
+			if timedOut {
+				fmt.Fprintf(&b, "Tests timed out after %d seconds, the results are partial.\n\n", timeout)
+			}
+			b.WriteString(formatTestReport(framework, report, time.Since(startTime)))
+			exitCode := shell.ExitCode(execErr)
+			total := report.passed + report.failed + report.skipped
+			if len(report.failures) == 0 && len(report.errors) == 0 && (exitCode != 0 || total == 0) {
+				// Without failures to explain the outcome, the output is all
+				// there is to go by, like when the test runner isn't installed.
+				if readErr != nil {
+					fmt.Fprintf(&b, "\n\nCould not read the test report: %v", readErr)
+				}
+				output := stderr
+				if framework != TestFrameworkGo {
+					// The output of go test is JSON, its report.
+					output = stdout + "\n" + stderr
+				}
+				if output = tailLines(strings.TrimSpace(output), testOutputTailLines); output != "" {
+					fmt.Fprintf(&b, "\n\nOutput of %s:\n%s", command, output)
+				}
+				if exitCode != 0 {
+					fmt.Fprintf(&b, "\n\nExit code %d", exitCode)
+				}
+			}
+			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(b.String()), metadata), nil
+		})
+}
+
+// detectTestFramework guesses the test framework from the file to test, or
+// from the files of the project found in dir or its parents.
+func detectTestFramework(dir, path string) string {
+	switch filepath.Ext(path) {
+	case ".go":
+		return TestFrameworkGo
+	case ".py":
+		return TestFrameworkPytest
+	case ".js", ".jsx", ".ts", ".tsx", ".mjs", ".cjs", ".mts", ".cts":
+		if framework := detectJSTestFramework(dir); framework != "" {
+			return framework
+		}
+		return TestFrameworkJest
+	}
+
+	for {
+		if fileExists(filepath.Join(dir, "go.mod")) {
+			return TestFrameworkGo
+		}
+		if framework := detectJSTestFramework(dir); framework != "" {
+			return framework
+		}
+		if isPytestProject(dir) {
+			return TestFrameworkPytest
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+func detectJSTestFramework(dir string) string {
+	data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return ""
+	}
+	var pkg struct {
+		Scripts         map[string]string `json:"scripts"`
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return ""
+	}
+	has := func(name string) bool {
+		_, dep := pkg.Dependencies[name]
+		_, devDep := pkg.DevDependencies[name]
+		return dep || devDep || strings.Contains(pkg.Scripts["test"], name)
+	}
+	switch {
+	case has(TestFrameworkVitest):
+		return TestFrameworkVitest
+	case has(TestFrameworkJest):
+		return TestFrameworkJest
+	}
+	return ""
+}
+
+func isPytestProject(dir string) bool {
+	if fileExists(filepath.Join(dir, "pytest.ini")) || fileExists(filepath.Join(dir, "conftest.py")) {
+		return true
+	}
+	for _, name := range []string{"pyproject.toml", "setup.cfg", "tox.ini"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil && strings.Contains(string(data), "pytest") {
+			return true
+		}
+	}
+	return false
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// testCommand returns the command running the tests with a machine-readable
+// report, printed for go and written to reportFile for the others.
+func testCommand(framework string, params TestParams, reportFile string) string {
+	var args []string
+	switch framework {
+	case TestFrameworkGo:
+		args = []string{"go", "test", "-json"}
+		if params.Name != "" {
+			args = append(args, "-run", shellQuote(params.Name))
+		}
+		args = append(args, shellQuote(goTestPackage(params.Path)))
+	case TestFrameworkJest:
+		args = []string{"CI=true", "npx", "jest", "--json", "--testLocationInResults", "--outputFile=" + shellQuote(reportFile)}
+		if params.Name != "" {
+			args = append(args, "-t", shellQuote(params.Name))
+		}
+		if params.Path != "" {
+			args = append(args, shellQuote(params.Path))
+		}
+	case TestFrameworkVitest:
+		args = []string{"CI=true", "npx", "vitest", "run", "--reporter=json", "--outputFile=" + shellQuote(reportFile)}
+		if params.Name != "" {
+			args = append(args, "-t", shellQuote(params.Name))
+		}
+		if params.Path != "" {
+			args = append(args, shellQuote(params.Path))
+		}
+	case TestFrameworkPytest:
+		args = []string{"pytest", "-q", "--junitxml=" + shellQuote(reportFile)}
+		if params.Name != "" {
+			args = append(args, "-k", shellQuote(params.Name))
+		}
+		if params.Path != "" {
+			args = append(args, shellQuote(params.Path))
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// goTestPackage turns the path to test into a package pattern of go test,
+// which takes directories rather than files.
+func goTestPackage(path string) string {
+	if path == "" {
+		return "./..."
+	}
+	if strings.HasSuffix(path, ".go") {
+		path = filepath.Dir(path)
+	}
+	if filepath.IsAbs(path) || strings.HasPrefix(path, ".") {
+		return path
+	}
+	return "./" + path
+}
+
+// shellQuote quotes s for the shell, unless it's made of safe characters
+// only.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:@+,", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// formatTestReport summarizes the results of a test run for the model.
+func formatTestReport(framework string, report testReport, elapsed time.Duration) string {
+	var b strings.Builder
+	var counts []string
+	if report.failed > 0 {
+		counts = append(counts, fmt.Sprintf("%d failed", report.failed))
+	}
+	counts = append(counts, fmt.Sprintf("%d passed", report.passed))
+	if report.skipped > 0 {
+		counts = append(counts, fmt.Sprintf("%d skipped", report.skipped))
+	}
+	if len(report.errors) > 0 {
+		counts = append(counts, fmt.Sprintf("%d errors", len(report.errors)))
+	}
+	fmt.Fprintf(&b, "%s tests: %s in %s", framework, strings.Join(counts, ", "), elapsed.Round(10*time.Millisecond))
+
+	for _, e := range report.errors {
+		b.WriteString("\n\nERROR ")
+		writeTestFailure(&b, e)
+	}
+	for i, f := range report.failures {
+		if i == maxTestFailures {
+			fmt.Fprintf(&b, "\n\n... and %d more failures, run fewer tests to see them.", len(report.failures)-maxTestFailures)
+			break
+		}
+		b.WriteString("\n\nFAIL ")
+		writeTestFailure(&b, f)
+	}
+	return b.String()
+}
+
+func writeTestFailure(b *strings.Builder, f TestFailure) {
+	b.WriteString(strings.TrimSpace(f.Suite + " " + f.Name))
+	var details []string
+	if f.File != "" {
+		location := f.File
+		if f.Line > 0 {
+			location += fmt.Sprintf(":%d", f.Line)
+		}
+		details = append(details, location)
+	}
+	if f.Duration > 0 {
+		details = append(details, fmt.Sprintf("%.2fs", f.Duration))
+	}
+	if len(details) > 0 {
+		fmt.Fprintf(b, " (%s)", strings.Join(details, ", "))
+	}
+	if f.Message != "" {
+		b.WriteString("\n    ")
+		b.WriteString(strings.ReplaceAll(f.Message, "\n", "\n    "))
+	}
+}
+
+// truncateTestMessage keeps the first lines of a failure message.
+func truncateTestMessage(message string) string {
+	message = strings.TrimSpace(message)
+	lines := strings.Split(message, "\n")
+	if len(lines) <= maxTestMessageLines {
+		return message
+	}
+	return strings.Join(lines[:maxTestMessageLines], "\n") + fmt.Sprintf("\n... (%d more lines)", len(lines)-maxTestMessageLines)
+}
+
+func tailLines(s string, n int) string {
+	lines := strings.Split(s, "\n")
+	if len(lines) <= n {
+		return s
+	}
+	return strings.Join(lines[len(lines)-n:], "\n")
+}
+
+// relativeTestPath makes the paths of reports relative to the working
+// directory, which is shorter for the model.
+func relativeTestPath(path, workingDir string) string {
+	if !filepath.IsAbs(path) {
+		return path
+	}
+	if rel, err := filepath.Rel(workingDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+func sortTestFailures(failures []TestFailure) {
+	slices.SortStableFunc(failures, func(a, b TestFailure) int {
+		return cmp.Or(cmp.Compare(a.Suite, b.Suite), cmp.Compare(a.Name, b.Name))
+	})
+}
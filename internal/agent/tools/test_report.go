@@ -0,0 +1,431 @@
+package tools
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mudaaaa/crushplus/internal/ansiext"
+)
+
+// goTestEvent is an event of the output of go test -json.
+type goTestEvent struct {
+	Action      string  `json:"Action"`
+	Package     string  `json:"Package"`
+	Test        string  `json:"Test"`
+	Elapsed     float64 `json:"Elapsed"`
+	Output      string  `json:"Output"`
+	ImportPath  string  `json:"ImportPath"`
+	FailedBuild string  `json:"FailedBuild"`
+}
+
+var (
+	// goTestLocation matches the file and line of a go test failure, from
+	// t.Error, a testify error trace or a panic stack trace.
+	goTestLocation = regexp.MustCompile(`^\s*(?:Error Trace:\s*)?([^\s:]+\.go):(\d+)`)
+	// goTestNoise matches the lines go test prints around the output of
+	// tests.
+	goTestNoise = regexp.MustCompile(`^(\s*(=== (RUN|PAUSE|CONT|NAME)|--- (FAIL|PASS|SKIP):)|(FAIL|PASS|ok)(\s|$))`)
+)
+
+// parseGoTestOutput reads the results of go test -json.
+func parseGoTestOutput(output, workingDir string) testReport {
+	var report testReport
+	testOutput := make(map[string]*strings.Builder)
+	packageOutput := make(map[string]*strings.Builder)
+	buildOutput := make(map[string]*strings.Builder)
+	appendOutput := func(outputs map[string]*strings.Builder, key, text string) {
+		b, ok := outputs[key]
+		if !ok {
+			b = &strings.Builder{}
+			outputs[key] = b
+		}
+		b.WriteString(text)
+	}
+
+	var failures []TestFailure
+	var failedPackages []goTestEvent
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event goTestEvent
+		line := scanner.Bytes()
+		if len(line) == 0 || line[0] != '{' || json.Unmarshal(line, &event) != nil {
+			continue
+		}
+		testKey := event.Package + " " + event.Test
+		switch event.Action {
+		case "build-output":
+			appendOutput(buildOutput, event.ImportPath, event.Output)
+		case "output":
+			if event.Test != "" {
+				appendOutput(testOutput, testKey, event.Output)
+			} else {
+				appendOutput(packageOutput, event.Package, event.Output)
+			}
+		case "pass":
+			if event.Test != "" {
+				report.passed++
+			}
+		case "skip":
+			if event.Test != "" {
+				report.skipped++
+			}
+		case "fail":
+			if event.Test == "" {
+				failedPackages = append(failedPackages, event)
+				continue
+			}
+			var text string
+			if b, ok := testOutput[testKey]; ok {
+				text = b.String()
+			}
+			failures = append(failures, goTestFailure(event, text, workingDir))
+		}
+	}
+
+	// Tests fail along with their subtests, which tell more.
+	for _, f := range failures {
+		if slices.ContainsFunc(failures, func(other TestFailure) bool {
+			return other.Suite == f.Suite && strings.HasPrefix(other.Name, f.Name+"/")
+		}) {
+			continue
+		}
+		report.failures = append(report.failures, f)
+	}
+	report.failed = len(report.failures)
+
+	// Packages can fail without failing tests, when they don't build or
+	// exit early.
+	for _, event := range failedPackages {
+		if slices.ContainsFunc(report.failures, func(f TestFailure) bool { return f.Suite == event.Package }) {
+			continue
+		}
+		var text string
+		if b, ok := buildOutput[event.FailedBuild]; ok && event.FailedBuild != "" {
+			text = b.String()
+		} else if b, ok := packageOutput[event.Package]; ok {
+			text = b.String()
+		}
+		message := cleanGoTestOutput(text)
+		if message == "" {
+			message = "package failed"
+			if event.FailedBuild != "" {
+				message = "build failed"
+			}
+		}
+		report.errors = append(report.errors, TestFailure{
+			Suite:   event.Package,
+			Message: truncateTestMessage(message),
+		})
+	}
+	sortTestFailures(report.failures)
+	sortTestFailures(report.errors)
+	return report
+}
+
+func goTestFailure(event goTestEvent, output, workingDir string) TestFailure {
+	f := TestFailure{
+		Suite:    event.Package,
+		Name:     event.Test,
+		Duration: event.Elapsed,
+		Message:  truncateTestMessage(cleanGoTestOutput(output)),
+	}
+
+	// Prefer the location in the test itself over those deeper in the
+	// stack.
+	var file, line string
+	for l := range strings.SplitSeq(output, "\n") {
+		m := goTestLocation.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		if file == "" || strings.Contains(l, "Error Trace:") || (strings.HasSuffix(m[1], "_test.go") && !strings.HasSuffix(file, "_test.go")) {
+			file, line = m[1], m[2]
+		}
+		if strings.Contains(l, "Error Trace:") {
+			break
+		}
+	}
+	if file != "" {
+		// t.Error only prints the name of the file, which is in the
+		// directory of the package.
+		if !strings.ContainsRune(file, '/') {
+			if dir := goPackageDir(event.Package, workingDir); dir != "" {
+				file = filepath.Join(dir, file)
+			}
+		}
+		f.File = relativeTestPath(file, workingDir)
+		f.Line, _ = strconv.Atoi(line)
+	}
+	return f
+}
+
+// cleanGoTestOutput drops the lines go test prints around the output of
+// tests and dedents the rest.
+func cleanGoTestOutput(output string) string {
+	var lines []string
+	for line := range strings.SplitSeq(output, "\n") {
+		if strings.TrimSpace(line) == "" || goTestNoise.MatchString(line) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(dedentLines(lines), "\n")
+}
+
+// dedentLines removes the indentation common to all lines.
+func dedentLines(lines []string) []string {
+	indent := -1
+	for _, line := range lines {
+		if n := len(line) - len(strings.TrimLeft(line, " \t")); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	for i, line := range lines {
+		lines[i] = line[max(indent, 0):]
+	}
+	return lines
+}
+
+// goPackageDir returns the directory of a package of the module in
+// workingDir, or its parents.
+func goPackageDir(pkg, workingDir string) string {
+	dir := workingDir
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			for line := range strings.SplitSeq(string(data), "\n") {
+				module, ok := strings.CutPrefix(strings.TrimSpace(line), "module ")
+				if !ok {
+					continue
+				}
+				module = strings.Trim(strings.TrimSpace(module), `"`)
+				if pkg == module {
+					return dir
+				}
+				if rest, ok := strings.CutPrefix(pkg, module+"/"); ok {
+					return filepath.Join(dir, filepath.FromSlash(rest))
+				}
+				return ""
+			}
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// jestReport is the JSON report of jest, which vitest also writes.
+type jestReport struct {
+	TestResults []struct {
+		Name             string `json:"name"`
+		Status           string `json:"status"`
+		Message          string `json:"message"`
+		AssertionResults []struct {
+			FullName        string   `json:"fullName"`
+			Status          string   `json:"status"`
+			Duration        *float64 `json:"duration"`
+			FailureMessages []string `json:"failureMessages"`
+			Location        *struct {
+				Line int `json:"line"`
+			} `json:"location"`
+		} `json:"assertionResults"`
+	} `json:"testResults"`
+}
+
+// jestStackFrame matches the frames of the stack traces of jest and vitest
+// failures.
+var jestStackFrame = regexp.MustCompile(`^\s*at\s`)
+
+// parseJestReport reads the JSON report of jest or vitest.
+func parseJestReport(path, workingDir string) (testReport, error) {
+	var report testReport
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+	var jest jestReport
+	if err := json.Unmarshal(data, &jest); err != nil {
+		return report, err
+	}
+
+	for _, suite := range jest.TestResults {
+		file := relativeTestPath(suite.Name, workingDir)
+		suiteFailed := false
+		for _, test := range suite.AssertionResults {
+			switch test.Status {
+			case "passed":
+				report.passed++
+				continue
+			case "failed":
+				report.failed++
+				suiteFailed = true
+			default:
+				report.skipped++
+				continue
+			}
+
+			message := ansiext.Strip(strings.Join(test.FailureMessages, "\n"))
+			f := TestFailure{
+				Suite: file,
+				Name:  test.FullName,
+				File:  file,
+			}
+			if test.Duration != nil {
+				f.Duration = *test.Duration / 1000
+			}
+			if test.Location != nil {
+				f.Line = test.Location.Line
+			} else {
+				f.Line = jestFailureLine(message, suite.Name)
+			}
+			var lines []string
+			for line := range strings.SplitSeq(message, "\n") {
+				if !jestStackFrame.MatchString(line) {
+					lines = append(lines, line)
+				}
+			}
+			f.Message = truncateTestMessage(strings.Join(lines, "\n"))
+			report.failures = append(report.failures, f)
+		}
+
+		// Suites fail without failed tests when they don't load, e.g. on
+		// syntax errors.
+		if suite.Status == "failed" && !suiteFailed {
+			message := strings.TrimSpace(ansiext.Strip(suite.Message))
+			if message == "" {
+				message = "test suite failed"
+			}
+			report.errors = append(report.errors, TestFailure{
+				Suite:   file,
+				File:    file,
+				Message: truncateTestMessage(message),
+			})
+		}
+	}
+	return report, nil
+}
+
+// jestFailureLine finds the line of a test file in the stack trace of a
+// failure.
+func jestFailureLine(message, file string) int {
+	re, err := regexp.Compile(regexp.QuoteMeta(file) + `:(\d+)`)
+	if err != nil {
+		return 0
+	}
+	if m := re.FindStringSubmatch(message); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return line
+	}
+	return 0
+}
+
+// junitSuite is a suite of a JUnit XML report, like pytest writes. Reports
+// have either a testsuites or a testsuite root.
+type junitSuite struct {
+	Suites    []junitSuite    `xml:"testsuite"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string       `xml:"classname,attr"`
+	Name      string       `xml:"name,attr"`
+	File      string       `xml:"file,attr"`
+	Line      int          `xml:"line,attr"`
+	Time      float64      `xml:"time,attr"`
+	Failure   *junitResult `xml:"failure"`
+	Error     *junitResult `xml:"error"`
+	Skipped   *junitResult `xml:"skipped"`
+}
+
+type junitResult struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// pytestLocation matches the file and line of a pytest failure, e.g.
+// "tests/test_foo.py:12: AssertionError".
+var pytestLocation = regexp.MustCompile(`(?m)^([^\s:]+\.py):(\d+):`)
+
+// parseJUnitReport reads a JUnit XML report.
+func parseJUnitReport(path, workingDir string) (testReport, error) {
+	var report testReport
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+	var root junitSuite
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return report, err
+	}
+	addJUnitSuite(&report, root, workingDir)
+	return report, nil
+}
+
+func addJUnitSuite(report *testReport, suite junitSuite, workingDir string) {
+	for _, s := range suite.Suites {
+		addJUnitSuite(report, s, workingDir)
+	}
+	for _, test := range suite.TestCases {
+		result := cmp.Or(test.Failure, test.Error)
+		switch {
+		case result != nil:
+		case test.Skipped != nil:
+			report.skipped++
+			continue
+		default:
+			report.passed++
+			continue
+		}
+
+		f := TestFailure{
+			Suite:    test.ClassName,
+			Name:     test.Name,
+			File:     test.File,
+			Line:     test.Line,
+			Duration: test.Time,
+			Message:  truncateTestMessage(junitMessage(result)),
+		}
+		if f.File == "" {
+			// The last location of a pytest traceback is where it failed.
+			if m := pytestLocation.FindAllStringSubmatch(result.Text, -1); m != nil {
+				f.File = m[len(m)-1][1]
+				f.Line, _ = strconv.Atoi(m[len(m)-1][2])
+			}
+		}
+		f.File = relativeTestPath(f.File, workingDir)
+
+		if test.Failure != nil {
+			report.failed++
+			report.failures = append(report.failures, f)
+		} else {
+			report.errors = append(report.errors, f)
+		}
+	}
+}
+
+// junitMessage keeps the explanation lines of pytest tracebacks, which
+// start with "E", or else the message of the failure.
+func junitMessage(result *junitResult) string {
+	var lines []string
+	for line := range strings.SplitSeq(result.Text, "\n") {
+		if rest, ok := strings.CutPrefix(line, "E "); ok {
+			lines = append(lines, rest)
+		}
+	}
+	if len(lines) > 0 {
+		return strings.Join(dedentLines(lines), "\n")
+	}
+	return strings.TrimSpace(cmp.Or(result.Message, result.Text))
+}
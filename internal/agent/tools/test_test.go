@@ -0,0 +1,263 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/shell"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeShells struct{}
+
+func (fakeShells) Shell(ctx context.Context, sessionID, workingDir string) (*shell.Shell, error) {
+	return shell.NewShell(&shell.Options{WorkingDir: workingDir}), nil
+}
+
+func (fakeShells) Update(ctx context.Context, sessionID string, state shell.State) error {
+	return nil
+}
+
+func TestTestTool(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"go.mod":  "module example.com/calc\n\ngo 1.24\n",
+		"calc.go": "package calc\n\nfunc Add(a, b int) int { return a - b }\n",
+		"calc_test.go": `package calc
+
+import "testing"
+
+func TestAdd(t *testing.T) {
+	if got := Add(1, 2); got != 3 {
+		t.Errorf("Add(1, 2) = %d, want 3", got)
+	}
+}
+
+func TestZero(t *testing.T) {
+	if Add(0, 0) != 0 {
+		t.Fatal("not zero")
+	}
+}
+
+func TestSkipped(t *testing.T) {
+	t.Skip("later")
+}
+`,
+	})
+
+	tool := NewTestTool(&mockPermissionService{}, fakeShells{}, dir)
+	ctx := context.WithValue(t.Context(), SessionIDContextKey, "session")
+	resp, err := tool.Run(ctx, fantasy.ToolCall{ID: "call_1", Input: `{}`})
+	require.NoError(t, err)
+	require.Contains(t, resp.Content, "go tests: 1 failed, 1 passed, 1 skipped")
+	require.Contains(t, resp.Content, "FAIL example.com/calc TestAdd (calc_test.go:7")
+	require.Contains(t, resp.Content, "\n    calc_test.go:7: Add(1, 2) = -1, want 3")
+
+	var metadata TestResponseMetadata
+	require.NoError(t, json.Unmarshal([]byte(resp.Metadata), &metadata))
+	require.Equal(t, TestFrameworkGo, metadata.Framework)
+	require.Equal(t, "go test -json ./...", metadata.Command)
+	require.Len(t, metadata.Failures, 1)
+	require.Equal(t, "calc_test.go", metadata.Failures[0].File)
+	require.Equal(t, 7, metadata.Failures[0].Line)
+
+	resp, err = tool.Run(ctx, fantasy.ToolCall{ID: "call_2", Input: `{"name":"^TestZero$"}`})
+	require.NoError(t, err)
+	require.Contains(t, resp.Content, "go tests: 1 passed in")
+}
+
+func TestParseGoTestOutput(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"go.mod": "module example.com/app\n"})
+	events := []goTestEvent{
+		{Action: "run", Package: "example.com/app/foo", Test: "TestFoo"},
+		{Action: "output", Package: "example.com/app/foo", Test: "TestFoo", Output: "=== RUN   TestFoo\n"},
+		{Action: "run", Package: "example.com/app/foo", Test: "TestFoo/sub"},
+		{Action: "output", Package: "example.com/app/foo", Test: "TestFoo/sub", Output: "    foo_test.go:12: \n"},
+		{Action: "output", Package: "example.com/app/foo", Test: "TestFoo/sub", Output: "        \tError Trace:\t" + filepath.Join(dir, "foo", "foo_test.go") + ":12\n"},
+		{Action: "output", Package: "example.com/app/foo", Test: "TestFoo/sub", Output: "        \tError:      \tNot equal\n"},
+		{Action: "output", Package: "example.com/app/foo", Test: "TestFoo/sub", Output: "    --- FAIL: TestFoo/sub (0.00s)\n"},
+		{Action: "fail", Package: "example.com/app/foo", Test: "TestFoo/sub", Elapsed: 0.01},
+		{Action: "fail", Package: "example.com/app/foo", Test: "TestFoo", Elapsed: 0.02},
+		{Action: "pass", Package: "example.com/app/foo", Test: "TestBar"},
+		{Action: "fail", Package: "example.com/app/foo"},
+		{Action: "build-output", ImportPath: "example.com/app/bar [example.com/app/bar.test]", Output: "# example.com/app/bar\n"},
+		{Action: "build-output", ImportPath: "example.com/app/bar [example.com/app/bar.test]", Output: "bar/bar.go:3:2: undefined: x\n"},
+		{Action: "fail", Package: "example.com/app/bar", FailedBuild: "example.com/app/bar [example.com/app/bar.test]"},
+	}
+	var output strings.Builder
+	for _, event := range events {
+		b, err := json.Marshal(event)
+		require.NoError(t, err)
+		output.Write(b)
+		output.WriteString("\n")
+	}
+	output.WriteString("not json\n")
+
+	report := parseGoTestOutput(output.String(), dir)
+	require.Equal(t, 1, report.passed)
+	require.Equal(t, 1, report.failed)
+	require.Equal(t, []TestFailure{{
+		Suite:    "example.com/app/foo",
+		Name:     "TestFoo/sub",
+		File:     filepath.Join("foo", "foo_test.go"),
+		Line:     12,
+		Message:  "foo_test.go:12: \n    \tError Trace:\t" + filepath.Join(dir, "foo", "foo_test.go") + ":12\n    \tError:      \tNot equal",
+		Duration: 0.01,
+	}}, report.failures)
+	require.Equal(t, []TestFailure{{
+		Suite:   "example.com/app/bar",
+		Message: "# example.com/app/bar\nbar/bar.go:3:2: undefined: x",
+	}}, report.errors)
+}
+
+func TestParseJestReport(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "src", "sum.test.ts")
+	report := map[string]any{
+		"testResults": []map[string]any{
+			{
+				"name":   file,
+				"status": "failed",
+				"assertionResults": []map[string]any{
+					{"fullName": "sum adds", "status": "passed", "duration": 3},
+					{
+						"fullName":        "sum subtracts",
+						"status":          "failed",
+						"duration":        12,
+						"failureMessages": []string{"\x1b[31mError: expect(received).toBe(expected)\x1b[39m\n\nExpected: 1\nReceived: 3\n    at Object.<anonymous> (" + file + ":9:17)"},
+					},
+					{"fullName": "sum later", "status": "pending"},
+				},
+			},
+			{
+				"name":             filepath.Join(dir, "src", "broken.test.ts"),
+				"status":           "failed",
+				"message":          "SyntaxError: Unexpected token",
+				"assertionResults": []map[string]any{},
+			},
+		},
+	}
+	data, err := json.Marshal(report)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "report.json")
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+
+	parsed, err := parseJestReport(path, dir)
+	require.NoError(t, err)
+	require.Equal(t, 1, parsed.passed)
+	require.Equal(t, 1, parsed.failed)
+	require.Equal(t, 1, parsed.skipped)
+	require.Equal(t, []TestFailure{{
+		Suite:    filepath.Join("src", "sum.test.ts"),
+		Name:     "sum subtracts",
+		File:     filepath.Join("src", "sum.test.ts"),
+		Line:     9,
+		Message:  "Error: expect(received).toBe(expected)\n\nExpected: 1\nReceived: 3",
+		Duration: 0.012,
+	}}, parsed.failures)
+	require.Len(t, parsed.errors, 1)
+	require.Equal(t, "SyntaxError: Unexpected token", parsed.errors[0].Message)
+
+	_, err = parseJestReport(filepath.Join(dir, "missing.json"), dir)
+	require.Error(t, err)
+}
+
+func TestParseJUnitReport(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.xml")
+	require.NoError(t, os.WriteFile(path, []byte(`<?xml version="1.0" encoding="utf-8"?>
+<testsuites>
+  <testsuite name="pytest" tests="4">
+    <testcase classname="tests.test_calc" name="test_add" time="0.001"/>
+    <testcase classname="tests.test_calc" name="test_sub" time="0.002">
+      <failure message="assert 3 == 1">def test_sub():
+&gt;       assert sub(2, 1) == 3
+E       assert 1 == 3
+E        +  where 1 = sub(2, 1)
+
+tests/test_calc.py:8: AssertionError</failure>
+    </testcase>
+    <testcase classname="tests.test_calc" name="test_skip" time="0">
+      <skipped message="later"/>
+    </testcase>
+    <testcase classname="tests.test_calc" name="test_fixture" time="0">
+      <error message="failed on setup with &quot;fixture 'db' not found&quot;">fixture 'db' not found</error>
+    </testcase>
+  </testsuite>
+</testsuites>`), 0o644))
+
+	report, err := parseJUnitReport(path, dir)
+	require.NoError(t, err)
+	require.Equal(t, 1, report.passed)
+	require.Equal(t, 1, report.failed)
+	require.Equal(t, 1, report.skipped)
+	require.Equal(t, []TestFailure{{
+		Suite:    "tests.test_calc",
+		Name:     "test_sub",
+		File:     "tests/test_calc.py",
+		Line:     8,
+		Message:  "assert 1 == 3\n +  where 1 = sub(2, 1)",
+		Duration: 0.002,
+	}}, report.failures)
+	require.Len(t, report.errors, 1)
+	require.Equal(t, "test_fixture", report.errors[0].Name)
+	require.Equal(t, `failed on setup with "fixture 'db' not found"`, report.errors[0].Message)
+}
+
+func TestDetectTestFramework(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		files     map[string]string
+		path      string
+		framework string
+	}{
+		{name: "go module", files: map[string]string{"go.mod": "module x\n"}, framework: TestFrameworkGo},
+		{name: "vitest", files: map[string]string{"package.json": `{"devDependencies":{"vitest":"^1.0.0"}}`}, framework: TestFrameworkVitest},
+		{name: "jest script", files: map[string]string{"package.json": `{"scripts":{"test":"jest --coverage"}}`}, framework: TestFrameworkJest},
+		{name: "pytest", files: map[string]string{"pyproject.toml": "[tool.pytest.ini_options]\n"}, framework: TestFrameworkPytest},
+		{name: "python file in go module", files: map[string]string{"go.mod": "module x\n"}, path: "scripts/test_x.py", framework: TestFrameworkPytest},
+		{name: "nothing", files: map[string]string{"README.md": "hi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+			require.Equal(t, tt.framework, detectTestFramework(dir, tt.path))
+		})
+	}
+}
+
+func TestTestCommand(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, "go test -json -run '^TestFoo$' ./internal/foo", testCommand(TestFrameworkGo, TestParams{Path: "internal/foo/foo_test.go", Name: "^TestFoo$"}, "report"))
+	require.Equal(t, "CI=true npx jest --json --testLocationInResults --outputFile=/tmp/report -t 'adds numbers' src/sum.test.ts", testCommand(TestFrameworkJest, TestParams{Path: "src/sum.test.ts", Name: "adds numbers"}, "/tmp/report"))
+	require.Equal(t, "pytest -q --junitxml=/tmp/report -k 'it'\\''s'", testCommand(TestFrameworkPytest, TestParams{Name: "it's"}, "/tmp/report"))
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
@@ -0,0 +1,70 @@
+package tools
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/todo"
+)
+
+const (
+	TodosToolName = "todos"
+)
+
+//go:embed todos.md
+var todosDescription []byte
+
+type TodoItem struct {
+	Content string `json:"content" description:"What to do, in a short sentence"`
+	Status  string `json:"status" description:"The status of the todo: pending, in_progress or done"`
+}
+
+type TodosParams struct {
+	Todos []TodoItem `json:"todos" description:"The whole checklist, in order. It replaces the previous one"`
+}
+
+type TodosResponseMetadata struct {
+	Done  int `json:"done"`
+	Total int `json:"total"`
+}
+
+func NewTodosTool(todos todo.Service) fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		TodosToolName,
+		string(todosDescription),
+		func(ctx context.Context, params TodosParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			sessionID := GetSessionFromContext(ctx)
+			if sessionID == "" {
+				return fantasy.ToolResponse{}, fmt.Errorf("session_id is required")
+			}
+
+			items := make([]todo.Todo, 0, len(params.Todos))
+			for i, item := range params.Todos {
+				content := strings.TrimSpace(item.Content)
+				if content == "" {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("todo %d has no content", i+1)), nil
+				}
+				status := todo.Status(item.Status)
+				if !status.Valid() {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("todo %d has an invalid status %q, use pending, in_progress or done", i+1, item.Status)), nil
+				}
+				items = append(items, todo.Todo{Content: content, Status: status})
+			}
+
+			list, err := todos.Set(ctx, sessionID, items)
+			if err != nil {
+				return fantasy.ToolResponse{}, fmt.Errorf("error saving todos: %w", err)
+			}
+
+			done, total := list.Progress()
+			result := "Todo list cleared."
+			if total > 0 {
+				result = fmt.Sprintf("Todo list updated (%d/%d done):\n\n%s", done, total, list)
+			}
+			metadata := TodosResponseMetadata{Done: done, Total: total}
+			return fantasy.WithResponseMetadata(fantasy.NewTextResponse(result), metadata), nil
+		})
+}
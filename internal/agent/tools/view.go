@@ -5,6 +5,7 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -17,6 +18,7 @@ import (
 	"github.com/mudaaaa/crushplus/internal/csync"
 	"github.com/mudaaaa/crushplus/internal/filepathext"
 	"github.com/mudaaaa/crushplus/internal/lsp"
+	"github.com/mudaaaa/crushplus/internal/pdf"
 	"github.com/mudaaaa/crushplus/internal/permission"
 )
 
@@ -49,6 +51,7 @@ type ViewResponseMetadata struct {
 const (
 	ViewToolName     = "view"
 	MaxReadSize      = 250 * 1024
+	MaxPDFReadSize   = 32 * 1024 * 1024
 	DefaultReadLimit = 2000
 	MaxLineLength    = 2000
 )
@@ -168,6 +171,16 @@ func NewViewTool(lspClients *csync.Map[string, *lsp.Client], permissions permiss
 				params.Limit = DefaultReadLimit
 			}
 
+			// PDF documents are read as their text, which needs them in
+			// memory whole.
+			if strings.EqualFold(filepath.Ext(filePath), ".pdf") {
+				if fileInfo.Size() > MaxPDFReadSize {
+					return fantasy.NewTextErrorResponse(fmt.Sprintf("PDF document is too large (%d bytes). The maximum size of PDF documents is %d bytes.",
+						fileInfo.Size(), MaxPDFReadSize)), nil
+				}
+				return viewPDF(filePath, params.Offset, params.Limit)
+			}
+
 			// Check file size
 			if fileInfo.Size() > MaxReadSize {
 				if params.Limit > 150 {
@@ -216,6 +229,43 @@ func NewViewTool(lspClients *csync.Map[string, *lsp.Client], permissions permiss
 		})
 }
 
+// viewPDF returns the lines of the text extracted from the PDF document.
+func viewPDF(filePath string, offset, limit int) (fantasy.ToolResponse, error) {
+	text, err := pdf.ExtractFile(filePath)
+	if errors.Is(err, pdf.ErrNotPDF) || errors.Is(err, pdf.ErrEncrypted) || errors.Is(err, pdf.ErrNoText) {
+		return fantasy.NewTextErrorResponse(fmt.Sprintf("Cannot read %s: %s", filePath, err)), nil
+	} else if err != nil {
+		return fantasy.ToolResponse{}, fmt.Errorf("error reading file: %w", err)
+	}
+
+	lines := strings.Split(text, "\n")
+	if offset >= len(lines) {
+		return fantasy.NewTextErrorResponse(fmt.Sprintf("The text of the PDF document has %d lines, offset %d is past its end", len(lines), offset)), nil
+	}
+	end := min(offset+limit, len(lines))
+	shown := lines[offset:end]
+	for i, line := range shown {
+		if len(line) > MaxLineLength {
+			shown[i] = line[:MaxLineLength] + "..."
+		}
+	}
+	content := strings.Join(shown, "\n")
+
+	output := "<file>\n" + addLineNumbers(content, offset+1)
+	if end < len(lines) {
+		output += fmt.Sprintf("\n\n(Document has more lines. Use 'offset' parameter to read beyond line %d)", end)
+	}
+	output += "\n</file>\n"
+	recordFileRead(filePath)
+	return fantasy.WithResponseMetadata(
+		fantasy.NewTextResponse(output),
+		ViewResponseMetadata{
+			FilePath: filePath,
+			Content:  content,
+		},
+	), nil
+}
+
 func addLineNumbers(content string, startLine int) string {
 	if content == "" {
 		return ""
@@ -4,7 +4,6 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
-	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -16,17 +15,8 @@ import (
 var webFetchToolDescription []byte
 
 // NewWebFetchTool creates a simple web fetch tool for sub-agents (no permissions needed).
-func NewWebFetchTool(workingDir string, client *http.Client) fantasy.AgentTool {
-	if client == nil {
-		client = &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     90 * time.Second,
-			},
-		}
-	}
+func NewWebFetchTool(workingDir string, opts FetchOptions) fantasy.AgentTool {
+	client := opts.HTTPClient(30 * time.Second)
 
 	return fantasy.NewAgentTool(
 		WebFetchToolName,
@@ -36,7 +26,11 @@ func NewWebFetchTool(workingDir string, client *http.Client) fantasy.AgentTool {
 				return fantasy.NewTextErrorResponse("url is required"), nil
 			}
 
-			content, err := FetchURLAndConvert(ctx, client, params.URL)
+			if err := opts.CheckURL(ctx, client, params.URL); err != nil {
+				return fantasy.NewTextErrorResponse(err.Error()), nil
+			}
+
+			content, err := FetchURLAndConvert(ctx, client, params.URL, opts.ResponseLimit())
 			if err != nil {
 				return fantasy.NewTextErrorResponse(fmt.Sprintf("Failed to fetch URL: %s", err)), nil
 			}
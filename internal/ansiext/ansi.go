@@ -23,3 +23,25 @@ func Escape(content string) string {
 	}
 	return sb.String()
 }
+
+// Strip turns the output of a terminal into plain text: it removes the ANSI
+// escape sequences, and keeps only what's left visible of the lines redrawn
+// with carriage returns, like progress bars.
+func Strip(content string) string {
+	content = strings.ReplaceAll(ansi.Strip(content), "\r\n", "\n")
+	if !strings.Contains(content, "\r") {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		segments := strings.Split(line, "\r")
+		lines[i] = ""
+		for j := len(segments) - 1; j >= 0; j-- {
+			if segments[j] != "" {
+				lines[i] = segments[j]
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
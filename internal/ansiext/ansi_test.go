@@ -0,0 +1,28 @@
+package ansiext
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"plain", "hello\nworld", "hello\nworld"},
+		{"colors", "\x1b[32mok\x1b[0m\r\n\x1b[1mdone\x1b[0m\r\n", "ok\ndone\n"},
+		{"progress", "downloading 10%\rdownloading 50%\rdownloading 100%\ndone", "downloading 100%\ndone"},
+		{"trailing carriage return", "line\r\r\nnext", "line\nnext"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tt.want, Strip(tt.content))
+		})
+	}
+}
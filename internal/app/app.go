@@ -10,6 +10,8 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
@@ -17,10 +19,13 @@ import (
 	"charm.land/fantasy"
 	"charm.land/lipgloss/v2"
 	"github.com/mudaaaa/crushplus/internal/agent"
+	"github.com/mudaaaa/crushplus/internal/agent/tools"
 	"github.com/mudaaaa/crushplus/internal/agent/tools/mcp"
+	"github.com/mudaaaa/crushplus/internal/codeindex"
 	"github.com/mudaaaa/crushplus/internal/config"
 	"github.com/mudaaaa/crushplus/internal/csync"
 	"github.com/mudaaaa/crushplus/internal/db"
+	"github.com/mudaaaa/crushplus/internal/env"
 	"github.com/mudaaaa/crushplus/internal/format"
 	"github.com/mudaaaa/crushplus/internal/history"
 	"github.com/mudaaaa/crushplus/internal/log"
@@ -28,9 +33,12 @@ import (
 	"github.com/mudaaaa/crushplus/internal/message"
 	"github.com/mudaaaa/crushplus/internal/permission"
 	"github.com/mudaaaa/crushplus/internal/pubsub"
+	"github.com/mudaaaa/crushplus/internal/redact"
 	"github.com/mudaaaa/crushplus/internal/session"
 	"github.com/mudaaaa/crushplus/internal/shell"
+	"github.com/mudaaaa/crushplus/internal/shellstate"
 	"github.com/mudaaaa/crushplus/internal/term"
+	"github.com/mudaaaa/crushplus/internal/todo"
 	"github.com/mudaaaa/crushplus/internal/tui/components/anim"
 	"github.com/mudaaaa/crushplus/internal/tui/styles"
 	"github.com/mudaaaa/crushplus/internal/update"
@@ -43,8 +51,16 @@ type App struct {
 	Sessions    session.Service
 	Messages    message.Service
 	History     history.Service
+	Todos       todo.Service
+	Shells      shellstate.Service
 	Permissions permission.Service
 
+	// Redactor scrubs secrets from tool results and logs.
+	Redactor *redact.Redactor
+
+	// CodeIndex is the search index of the code of the project.
+	CodeIndex *codeindex.Index
+
 	AgentCoordinator agent.Coordinator
 
 	LSPClients *csync.Map[string, *lsp.Client]
@@ -77,8 +93,12 @@ func New(ctx context.Context, conn *sql.DB, cfg *config.Config) (*App, error) {
 		Sessions:    sessions,
 		Messages:    messages,
 		History:     files,
+		Todos:       todo.NewService(q, conn),
+		Shells:      shellstate.NewService(q),
 		Permissions: permission.NewPermissionService(cfg.WorkingDir(), skipPermissionsRequests, allowedTools),
 		LSPClients:  csync.NewMap[string, *lsp.Client](),
+		Redactor:    cfg.Redactor(env.New()),
+		CodeIndex:   codeindex.New(cfg.WorkingDir(), cfg.Options.DataDirectory),
 
 		globalCtx: ctx,
 
@@ -89,6 +109,8 @@ func New(ctx context.Context, conn *sql.DB, cfg *config.Config) (*App, error) {
 		tuiWG:           &sync.WaitGroup{},
 	}
 
+	redact.SetDefault(app.Redactor)
+
 	app.setupEvents()
 
 	// Initialize LSP clients in the background.
@@ -97,13 +119,29 @@ func New(ctx context.Context, conn *sql.DB, cfg *config.Config) (*App, error) {
 	// Check for updates in the background.
 	go app.checkForUpdates(ctx)
 
+	// Remove the tool results saved long ago, and the output of the jobs of
+	// previous runs.
+	go tools.PruneToolOutput(filepath.Join(cfg.Options.DataDirectory, tools.ToolOutputDir))
+	jobOutputDir := filepath.Join(cfg.Options.DataDirectory, shell.JobOutputDir)
+	shell.GetBackgroundShellManager().SetOutputDir(jobOutputDir)
+	go shell.PruneJobOutput(jobOutputDir)
+
+	// Build or refresh the code index in the background, so that searches
+	// don't wait for it.
+	if !slices.Contains(cfg.Options.DisabledTools, tools.CodeSearchToolName) {
+		go app.refreshCodeIndex(ctx)
+	}
+
+	mcp.SetSamplingHandler(app.handleMCPSampling)
+	mcp.SetElicitationHandler(app.handleMCPElicitation)
 	go func() {
 		slog.Info("Initializing MCP clients")
 		mcp.Initialize(ctx, app.Permissions, cfg)
+		app.watchMCPConfig(ctx)
 	}()
 
 	// cleanup database upon app shutdown
-	app.cleanupFuncs = append(app.cleanupFuncs, conn.Close, mcp.Close)
+	app.cleanupFuncs = append(app.cleanupFuncs, conn.Close, mcp.Close, app.CodeIndex.Save)
 
 	// TODO: remove the concept of agent config, most likely.
 	if !cfg.IsConfigured() {
@@ -122,8 +160,9 @@ func (app *App) Config() *config.Config {
 }
 
 // RunNonInteractive runs the application in non-interactive mode with the
-// given prompt, printing to stdout.
-func (app *App) RunNonInteractive(ctx context.Context, output io.Writer, prompt string, quiet bool) error {
+// given prompt and attachments, printing to stdout. In plan mode, the agent
+// only plans the changes and prints the plan.
+func (app *App) RunNonInteractive(ctx context.Context, output io.Writer, prompt string, attachments []message.Attachment, quiet, plan bool) error {
 	slog.Info("Running in non-interactive mode")
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -190,7 +229,11 @@ func (app *App) RunNonInteractive(ctx context.Context, output io.Writer, prompt
 	done := make(chan response, 1)
 
 	go func(ctx context.Context, sessionID, prompt string) {
-		result, err := app.AgentCoordinator.Run(ctx, sess.ID, prompt)
+		run := app.AgentCoordinator.Run
+		if plan {
+			run = app.AgentCoordinator.Plan
+		}
+		result, err := run(ctx, sess.ID, prompt, attachments...)
 		if err != nil {
 			done <- response{
 				err: fmt.Errorf("failed to start agent processing stream: %w", err),
@@ -270,9 +313,15 @@ func (app *App) setupEvents() {
 	setupSubscriber(ctx, app.serviceEventsWG, "messages", app.Messages.Subscribe, app.events)
 	setupSubscriber(ctx, app.serviceEventsWG, "permissions", app.Permissions.Subscribe, app.events)
 	setupSubscriber(ctx, app.serviceEventsWG, "permissions-notifications", app.Permissions.SubscribeNotifications, app.events)
+	setupSubscriber(ctx, app.serviceEventsWG, "elicitations", app.Permissions.SubscribeElicitations, app.events)
 	setupSubscriber(ctx, app.serviceEventsWG, "history", app.History.Subscribe, app.events)
+	setupSubscriber(ctx, app.serviceEventsWG, "todos", app.Todos.Subscribe, app.events)
 	setupSubscriber(ctx, app.serviceEventsWG, "mcp", mcp.SubscribeEvents, app.events)
 	setupSubscriber(ctx, app.serviceEventsWG, "lsp", SubscribeLSPEvents, app.events)
+	setupSubscriber(ctx, app.serviceEventsWG, "token-estimates", agent.SubscribeTokenEstimates, app.events)
+	setupSubscriber(ctx, app.serviceEventsWG, "jobs", shell.SubscribeJobs, app.events)
+	app.serviceEventsWG.Go(func() { app.killDeletedSessionJobs(ctx) })
+	app.serviceEventsWG.Go(func() { app.updateCodeIndex(ctx) })
 	cleanupFunc := func() error {
 		cancel()
 		app.serviceEventsWG.Wait()
@@ -281,6 +330,31 @@ func (app *App) setupEvents() {
 	app.cleanupFuncs = append(app.cleanupFuncs, cleanupFunc)
 }
 
+// killDeletedSessionJobs terminates the background jobs of the sessions as
+// they're deleted.
+func (app *App) killDeletedSessionJobs(ctx context.Context) {
+	for event := range app.Sessions.Subscribe(ctx) {
+		if event.Type == pubsub.DeletedEvent {
+			shell.GetBackgroundShellManager().KillSession(event.Payload.ID)
+		}
+	}
+}
+
+// refreshCodeIndex indexes the files of the project changed since the last
+// run.
+func (app *App) refreshCodeIndex(ctx context.Context) {
+	if err := app.CodeIndex.Refresh(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		slog.Warn("Failed to refresh code index", "error", err)
+	}
+}
+
+// updateCodeIndex reindexes the files as the edit tools change them.
+func (app *App) updateCodeIndex(ctx context.Context) {
+	for event := range app.History.Subscribe(ctx) {
+		app.CodeIndex.Update(event.Payload.Path)
+	}
+}
+
 func setupSubscriber[T any](
 	ctx context.Context,
 	wg *sync.WaitGroup,
@@ -327,6 +401,10 @@ func (app *App) InitCoderAgent(ctx context.Context) error {
 		app.Messages,
 		app.Permissions,
 		app.History,
+		app.Todos,
+		app.Shells,
+		app.Redactor,
+		app.CodeIndex,
 		app.LSPClients,
 	)
 	if err != nil {
@@ -0,0 +1,241 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"strings"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/mudaaaa/crushplus/internal/agent"
+	"github.com/mudaaaa/crushplus/internal/agent/tools/mcp"
+	"github.com/mudaaaa/crushplus/internal/config"
+	"github.com/mudaaaa/crushplus/internal/message"
+	"github.com/mudaaaa/crushplus/internal/permission"
+)
+
+const mcpConfigPollInterval = 2 * time.Second
+
+// watchMCPConfig polls the config files and reloads the MCP clients when
+// they change, so MCPs can be added, removed, enabled or disabled without
+// restarting.
+func (app *App) watchMCPConfig(ctx context.Context) {
+	last := modTimes(config.ConfigPaths(app.config.WorkingDir()))
+
+	ticker := time.NewTicker(mcpConfigPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Look the files up again, so new project configs are picked up too.
+		current := modTimes(config.ConfigPaths(app.config.WorkingDir()))
+		if maps.Equal(current, last) {
+			continue
+		}
+		last = current
+
+		mcps, err := config.LoadMCPs(app.config.WorkingDir())
+		if err != nil {
+			slog.Warn("Failed to reload MCP configuration", "error", err)
+			continue
+		}
+		mcp.Reload(ctx, app.config, mcps)
+	}
+}
+
+func modTimes(paths []string) map[string]time.Time {
+	times := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			times[path] = info.ModTime()
+		}
+	}
+	return times
+}
+
+// handleMCPSampling answers sampling requests from MCP servers with one of
+// our models, once the user approves them.
+func (app *App) handleMCPSampling(ctx context.Context, name, sessionID string, params *mcp.CreateMessageParams) (*mcp.CreateMessageResult, error) {
+	if app.AgentCoordinator == nil {
+		return nil, errors.New("no model configured")
+	}
+
+	messages, transcript, err := samplingMessages(params)
+	if err != nil {
+		return nil, err
+	}
+
+	useSmallModel := preferSmallModel(app.config, params.ModelPreferences)
+	modelType := config.SelectedModelTypeLarge
+	if useSmallModel {
+		modelType = config.SelectedModelTypeSmall
+	}
+	granted := app.Permissions.Request(permission.CreatePermissionRequest{
+		SessionID:   sessionID,
+		ToolName:    fmt.Sprintf("mcp_%s_sampling", name),
+		Action:      "sample",
+		Path:        app.config.WorkingDir(),
+		Description: fmt.Sprintf("MCP server %q wants to generate a completion with the %s model:", name, modelType),
+		Params:      transcript,
+	})
+	if !granted {
+		app.logMCPRequest(ctx, sessionID, fmt.Sprintf("Denied a sampling request from MCP server %q.", name))
+		return nil, permission.ErrorPermissionDenied
+	}
+
+	var temperature *float64
+	if params.Temperature != 0 {
+		temperature = &params.Temperature
+	}
+	result, err := app.AgentCoordinator.Sample(ctx, agent.SampleCall{
+		SessionID:       sessionID,
+		SystemPrompt:    params.SystemPrompt,
+		Messages:        messages,
+		MaxOutputTokens: params.MaxTokens,
+		Temperature:     temperature,
+		UseSmallModel:   useSmallModel,
+	})
+	if err != nil {
+		app.logMCPRequest(ctx, sessionID, fmt.Sprintf("Sampling request from MCP server %q failed: %v", name, err))
+		return nil, err
+	}
+	app.logMCPRequest(ctx, sessionID, fmt.Sprintf("Answered a sampling request from MCP server %q with %s:\n\n%s", name, result.Model, result.Text))
+
+	stopReason := string(result.FinishReason)
+	switch result.FinishReason {
+	case fantasy.FinishReasonStop:
+		stopReason = "endTurn"
+	case fantasy.FinishReasonLength:
+		stopReason = "maxTokens"
+	}
+	return &mcp.CreateMessageResult{
+		Content:    &mcp.TextContent{Text: result.Text},
+		Model:      result.Model,
+		Role:       "assistant",
+		StopReason: stopReason,
+	}, nil
+}
+
+// samplingMessages converts the messages of a sampling request, and renders
+// them as a transcript for the user to review.
+func samplingMessages(params *mcp.CreateMessageParams) ([]fantasy.Message, string, error) {
+	var transcript strings.Builder
+	if params.SystemPrompt != "" {
+		fmt.Fprintf(&transcript, "system: %s\n\n", params.SystemPrompt)
+	}
+
+	messages := make([]fantasy.Message, 0, len(params.Messages))
+	for _, msg := range params.Messages {
+		role := fantasy.MessageRoleUser
+		if msg.Role == "assistant" {
+			role = fantasy.MessageRoleAssistant
+		}
+
+		var part fantasy.MessagePart
+		switch content := msg.Content.(type) {
+		case *mcp.TextContent:
+			part = fantasy.TextPart{Text: content.Text}
+			fmt.Fprintf(&transcript, "%s: %s\n\n", msg.Role, content.Text)
+		case *mcp.ImageContent:
+			part = fantasy.FilePart{Data: content.Data, MediaType: content.MIMEType}
+			fmt.Fprintf(&transcript, "%s: [%s image]\n\n", msg.Role, content.MIMEType)
+		default:
+			return nil, "", fmt.Errorf("unsupported sampling content: %T", msg.Content)
+		}
+		messages = append(messages, fantasy.Message{
+			Role:    role,
+			Content: []fantasy.MessagePart{part},
+		})
+	}
+	return messages, strings.TrimSpace(transcript.String()), nil
+}
+
+// preferSmallModel picks the small model when the server's hints name it, or
+// when it cares more about cost or speed than intelligence.
+func preferSmallModel(cfg *config.Config, prefs *mcp.ModelPreferences) bool {
+	if prefs == nil {
+		return false
+	}
+	large, small := cfg.Models[config.SelectedModelTypeLarge], cfg.Models[config.SelectedModelTypeSmall]
+	for _, hint := range prefs.Hints {
+		if hint == nil || hint.Name == "" {
+			continue
+		}
+		switch {
+		case strings.Contains(large.Model, hint.Name):
+			return false
+		case strings.Contains(small.Model, hint.Name):
+			return true
+		}
+	}
+	return max(prefs.CostPriority, prefs.SpeedPriority) > prefs.IntelligencePriority
+}
+
+// handleMCPElicitation asks the user for the input MCP servers request
+// through elicitation.
+func (app *App) handleMCPElicitation(ctx context.Context, name, sessionID string, params *mcp.ElicitParams) (*mcp.ElicitResult, error) {
+	schema, err := schemaMap(params.RequestedSchema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid requested schema: %w", err)
+	}
+
+	resp := app.Permissions.Elicit(ctx, permission.CreateElicitationRequest{
+		SessionID: sessionID,
+		Source:    name,
+		Message:   params.Message,
+		Schema:    schema,
+	})
+
+	var outcome string
+	switch resp.Action {
+	case permission.ElicitationAccept:
+		outcome = "answered"
+	case permission.ElicitationDecline:
+		outcome = "declined"
+	default:
+		outcome = "dismissed"
+	}
+	app.logMCPRequest(ctx, sessionID, fmt.Sprintf("MCP server %q asked for input, which was %s:\n\n%s", name, outcome, params.Message))
+
+	return &mcp.ElicitResult{
+		Action:  string(resp.Action),
+		Content: resp.Content,
+	}, nil
+}
+
+func schemaMap(schema any) (map[string]any, error) {
+	if m, ok := schema.(map[string]any); ok {
+		return m, nil
+	}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// logMCPRequest records a request an MCP server made to us in the session.
+// These are system messages, which are shown to the user but never sent to
+// the model.
+func (app *App) logMCPRequest(ctx context.Context, sessionID, text string) {
+	_, err := app.Messages.Create(ctx, sessionID, message.CreateMessageParams{
+		Role:  message.System,
+		Parts: []message.ContentPart{message.TextContent{Text: text}},
+	})
+	if err != nil {
+		slog.Error("Failed to log MCP request", "session_id", sessionID, "error", err)
+	}
+}
@@ -0,0 +1,334 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"charm.land/lipgloss/v2"
+	"charm.land/lipgloss/v2/table"
+	"github.com/charmbracelet/x/term"
+	"github.com/mudaaaa/crushplus/internal/agent/tools/mcp"
+	"github.com/mudaaaa/crushplus/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var mcpCmd = &cobra.Command{
+	Use:   "mcp",
+	Short: "Manage MCP servers",
+	Long: `Add, remove, enable, disable and inspect the MCP servers configured for CrushPlus.
+Changes are written to the project config file by default, or to the global
+one with --global. A running CrushPlus picks them up without a restart.`,
+	Example: `
+# List the configured MCP servers and their state
+crushplus mcp list
+
+# Add a stdio server to the project config
+crushplus mcp add filesystem npx -- -y @modelcontextprotocol/server-filesystem /tmp
+
+# Add an HTTP server to the global config
+crushplus mcp add --global github https://api.githubcopilot.com/mcp/ --header "Authorization=Bearer $GH_PAT"
+
+# Check that a server works and list its tools
+crushplus mcp test github
+crushplus mcp tools github
+  `,
+}
+
+var mcpListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List MCP servers and their state",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := initMCPs(cmd, "")
+		if err != nil {
+			return err
+		}
+		defer mcp.Close()
+
+		mcps := cfg.MCPs().Sorted()
+		if len(mcps) == 0 {
+			cmd.Println("No MCP servers configured.")
+			return nil
+		}
+
+		states := mcp.GetStates()
+		rows := make([][]string, 0, len(mcps))
+		for _, m := range mcps {
+			state := states[m.Name]
+			tools := "-"
+			if state.State == mcp.StateConnected {
+				tools = fmt.Sprint(state.Counts.Tools)
+			}
+			errMsg := ""
+			if state.Error != nil {
+				errMsg = state.Error.Error()
+			}
+			rows = append(rows, []string{m.Name, string(m.MCP.Type), state.State.String(), tools, errMsg})
+		}
+
+		if term.IsTerminal(os.Stdout.Fd()) {
+			t := table.New().
+				Border(lipgloss.RoundedBorder()).
+				StyleFunc(func(row, col int) lipgloss.Style {
+					return lipgloss.NewStyle().Padding(0, 1)
+				}).
+				Headers("Name", "Type", "State", "Tools", "Error").
+				Rows(rows...)
+			lipgloss.Println(t)
+			return nil
+		}
+		for _, row := range rows {
+			fmt.Fprintln(cmd.OutOrStdout(), strings.Join(row, "\t"))
+		}
+		return nil
+	},
+}
+
+var mcpAddCmd = &cobra.Command{
+	Use:   "add <name> <command-or-url> [args...]",
+	Short: "Add an MCP server",
+	Long: `Add an MCP server, or replace an existing one with the same name.
+URLs are added as HTTP servers, unless --type sse is given; anything else is
+run as a stdio server with the given arguments.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, target := args[0], args[1]
+		typ, _ := cmd.Flags().GetString("type")
+		envs, _ := cmd.Flags().GetStringArray("env")
+		headers, _ := cmd.Flags().GetStringArray("header")
+		timeout, _ := cmd.Flags().GetInt("timeout")
+
+		m := config.MCPConfig{Timeout: timeout}
+		isURL := strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://")
+		switch {
+		case typ == "" && isURL:
+			m.Type = config.MCPHttp
+		case typ == "":
+			m.Type = config.MCPStdio
+		default:
+			m.Type = config.MCPType(typ)
+		}
+
+		switch m.Type {
+		case config.MCPStdio:
+			m.Command = target
+			m.Args = args[2:]
+		case config.MCPHttp, config.MCPSSE:
+			if !isURL {
+				return fmt.Errorf("%s servers require an http(s) url, got %q", m.Type, target)
+			}
+			if len(args) > 2 {
+				return fmt.Errorf("%s servers take no arguments", m.Type)
+			}
+			m.URL = target
+		default:
+			return fmt.Errorf("unsupported mcp type: %s", m.Type)
+		}
+
+		var err error
+		if m.Env, err = parseKeyValues(envs); err != nil {
+			return fmt.Errorf("invalid --env: %w", err)
+		}
+		if m.Headers, err = parseKeyValues(headers); err != nil {
+			return fmt.Errorf("invalid --header: %w", err)
+		}
+
+		path, err := mcpConfigPath(cmd)
+		if err != nil {
+			return err
+		}
+		if err := config.SetMCP(path, name, m); err != nil {
+			return err
+		}
+		cmd.Printf("Added MCP server %q to %s.\n", name, path)
+		return nil
+	},
+}
+
+var mcpRemoveCmd = &cobra.Command{
+	Use:     "remove <name>",
+	Aliases: []string{"rm"},
+	Short:   "Remove an MCP server",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := mcpConfigPath(cmd)
+		if err != nil {
+			return err
+		}
+		if err := config.RemoveMCP(path, args[0]); err != nil {
+			return err
+		}
+		cmd.Printf("Removed MCP server %q from %s.\n", args[0], path)
+		return nil
+	},
+}
+
+var mcpEnableCmd = &cobra.Command{
+	Use:   "enable <name>",
+	Short: "Enable an MCP server",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setMCPDisabled(cmd, args[0], false)
+	},
+}
+
+var mcpDisableCmd = &cobra.Command{
+	Use:   "disable <name>",
+	Short: "Disable an MCP server",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return setMCPDisabled(cmd, args[0], true)
+	},
+}
+
+var mcpTestCmd = &cobra.Command{
+	Use:   "test <name>",
+	Short: "Connect to an MCP server and report its state",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if _, err := initMCPs(cmd, name); err != nil {
+			return err
+		}
+		defer mcp.Close()
+
+		state, err := connectedState(name)
+		if err != nil {
+			return err
+		}
+		cmd.Printf("MCP server %q is connected: %d tools, %d prompts, %d resources.\n",
+			name, state.Counts.Tools, state.Counts.Prompts, state.Counts.Resources)
+		return nil
+	},
+}
+
+var mcpToolsCmd = &cobra.Command{
+	Use:   "tools <name>",
+	Short: "List the tools of an MCP server",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		if _, err := initMCPs(cmd, name); err != nil {
+			return err
+		}
+		defer mcp.Close()
+
+		if _, err := connectedState(name); err != nil {
+			return err
+		}
+		for mcpName, tools := range mcp.Tools() {
+			if mcpName != name {
+				continue
+			}
+			for _, tool := range tools {
+				description, _, _ := strings.Cut(strings.TrimSpace(tool.Description), "\n")
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\n", tool.Name, description)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	for _, c := range []*cobra.Command{mcpAddCmd, mcpRemoveCmd, mcpEnableCmd, mcpDisableCmd} {
+		c.Flags().BoolP("global", "g", false, "Write to the global config instead of the project config")
+	}
+	mcpAddCmd.Flags().StringP("type", "t", "", "Type of MCP server: stdio, http or sse (detected by default)")
+	mcpAddCmd.Flags().StringArrayP("env", "e", nil, "Environment variable for stdio servers, as KEY=VALUE")
+	mcpAddCmd.Flags().StringArray("header", nil, "HTTP header for http and sse servers, as KEY=VALUE")
+	mcpAddCmd.Flags().Int("timeout", 0, "Connection timeout in seconds")
+
+	mcpCmd.AddCommand(
+		mcpListCmd,
+		mcpAddCmd,
+		mcpRemoveCmd,
+		mcpEnableCmd,
+		mcpDisableCmd,
+		mcpTestCmd,
+		mcpToolsCmd,
+	)
+}
+
+// initMCPs loads the configuration and connects to the configured MCPs, or
+// only to the given one. Callers must call [mcp.Close] when done.
+func initMCPs(cmd *cobra.Command, only string) (*config.Config, error) {
+	debug, _ := cmd.Flags().GetBool("debug")
+	dataDir, _ := cmd.Flags().GetString("data-dir")
+	cwd, err := ResolveCwd(cmd)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.Init(cwd, dataDir, debug)
+	if err != nil {
+		return nil, err
+	}
+
+	if only != "" {
+		m, ok := cfg.MCPs()[only]
+		if !ok {
+			return nil, fmt.Errorf("mcp '%s' not configured", only)
+		}
+		cfg.SetMCPs(config.MCPs{only: m})
+	}
+	mcp.Initialize(cmd.Context(), nil, cfg)
+	return cfg, nil
+}
+
+func connectedState(name string) (mcp.ClientInfo, error) {
+	state, _ := mcp.GetState(name)
+	switch {
+	case state.State == mcp.StateConnected:
+		return state, nil
+	case state.Error != nil:
+		return state, fmt.Errorf("mcp '%s' is %s: %w", name, state.State, state.Error)
+	default:
+		return state, fmt.Errorf("mcp '%s' is %s", name, state.State)
+	}
+}
+
+func mcpConfigPath(cmd *cobra.Command) (string, error) {
+	if global, _ := cmd.Flags().GetBool("global"); global {
+		return config.GlobalConfig(), nil
+	}
+	cwd, err := ResolveCwd(cmd)
+	if err != nil {
+		return "", err
+	}
+	return config.ProjectConfig(cwd), nil
+}
+
+func setMCPDisabled(cmd *cobra.Command, name string, disabled bool) error {
+	cwd, err := ResolveCwd(cmd)
+	if err != nil {
+		return err
+	}
+	path, err := mcpConfigPath(cmd)
+	if err != nil {
+		return err
+	}
+	if err := config.SetMCPDisabled(cwd, path, name, disabled); err != nil {
+		return err
+	}
+	verb := "Enabled"
+	if disabled {
+		verb = "Disabled"
+	}
+	cmd.Printf("%s MCP server %q in %s.\n", verb, name, path)
+	return nil
+}
+
+func parseKeyValues(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]string, len(values))
+	for _, v := range values {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected KEY=VALUE, got %q", v)
+		}
+		result[key] = value
+	}
+	return result, nil
+}
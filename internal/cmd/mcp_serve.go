@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"github.com/mudaaaa/crushplus/internal/mcpserver"
+	"github.com/spf13/cobra"
+)
+
+var mcpServeCmd = &cobra.Command{
+	Use:   "mcp-serve",
+	Short: "Serve the built-in tools over MCP",
+	Long: `Serve the built-in tools of CrushPlus (view, grep, glob, edit, multiedit and the
+LSP tools) to other agents and editors over the Model Context Protocol, on stdio
+by default or over HTTP with --http. With --agent, the coder agent is exposed as
+a tool as well.
+
+Edits are versioned in a session of their own for each client. Permission
+requests are forwarded to the client through elicitation, and denied when the
+client doesn't support it, unless --yolo is set.`,
+	Example: `
+# Serve the tools on stdio
+crushplus mcp-serve
+
+# Serve the tools and the agent over HTTP
+crushplus mcp-serve --agent --http localhost:8765
+  `,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		addr, _ := cmd.Flags().GetString("http")
+		withAgent, _ := cmd.Flags().GetBool("agent")
+
+		app, err := setupApp(cmd)
+		if err != nil {
+			return err
+		}
+		defer app.Shutdown()
+
+		server := mcpserver.New(app, mcpserver.Options{Agent: withAgent})
+		if addr != "" {
+			return server.ServeHTTP(cmd.Context(), addr)
+		}
+		return server.ServeStdio(cmd.Context())
+	},
+}
+
+func init() {
+	mcpServeCmd.Flags().String("http", "", "Serve over HTTP on the given address instead of stdio")
+	mcpServeCmd.Flags().Bool("agent", false, "Expose the coder agent as a tool")
+	mcpServeCmd.Flags().BoolP("yolo", "y", false, "Automatically accept all permissions (dangerous mode)")
+}
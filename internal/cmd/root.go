@@ -43,6 +43,8 @@ func init() {
 		updateProvidersCmd,
 		logsCmd,
 		schemaCmd,
+		mcpCmd,
+		mcpServeCmd,
 	)
 }
 
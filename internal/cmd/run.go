@@ -3,9 +3,12 @@ package cmd
 import (
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/mudaaaa/crushplus/internal/message"
 	"github.com/spf13/cobra"
 )
 
@@ -26,9 +29,22 @@ crush run "What is this code doing?" <<< prrr.go
 
 # Run in quiet mode (hide the spinner)
 crush run --quiet "Generate a README for this project"
+
+# Plan the changes with read-only tools, without making them
+crush run --plan "Add pagination to the users endpoint"
+
+# Attach images and PDF documents
+crush run --attach mockup.png --attach spec.pdf "Implement this screen"
   `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		quiet, _ := cmd.Flags().GetBool("quiet")
+		plan, _ := cmd.Flags().GetBool("plan")
+		attachPaths, _ := cmd.Flags().GetStringArray("attach")
+
+		attachments, err := readAttachments(attachPaths)
+		if err != nil {
+			return err
+		}
 
 		app, err := setupApp(cmd)
 		if err != nil {
@@ -58,10 +74,36 @@ crush run --quiet "Generate a README for this project"
 		//     echo "Do something fancy" | crush run > output.txt
 		//
 		// TODO: We currently need to press ^c twice to cancel. Fix that.
-		return app.RunNonInteractive(cmd.Context(), os.Stdout, prompt, quiet)
+		return app.RunNonInteractive(cmd.Context(), os.Stdout, prompt, attachments, quiet, plan)
 	},
 }
 
 func init() {
 	runCmd.Flags().BoolP("quiet", "q", false, "Hide spinner")
+	runCmd.Flags().Bool("plan", false, "Only plan the changes, with read-only tools, and print the plan")
+	runCmd.Flags().StringArrayP("attach", "a", nil, "Attach an image, PDF document or text file to the prompt (repeatable)")
+}
+
+// readAttachments reads the files to attach to the prompt, detecting their
+// type from their content.
+func readAttachments(paths []string) ([]message.Attachment, error) {
+	var attachments []message.Attachment
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attachment: %w", err)
+		}
+		mimeType := http.DetectContentType(content[:min(512, len(content))])
+		attachments = append(attachments, message.Attachment{
+			FilePath: path,
+			FileName: filepath.Base(path),
+			MimeType: mimeType,
+			Content:  content,
+		})
+	}
+	return attachments, nil
 }
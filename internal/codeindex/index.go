@@ -0,0 +1,644 @@
+// Package codeindex keeps a local search index of the code of a repository:
+// the symbols defined in each file, and the terms of chunks of lines ranked
+// with BM25. The index is saved in the data directory and kept up to date
+// incrementally, so it works offline and on repositories where grep finds
+// too much.
+package codeindex
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charlievieth/fastwalk"
+	"github.com/mudaaaa/crushplus/internal/fsext"
+)
+
+const (
+	// version is bumped when the format of the saved index changes, to
+	// rebuild it.
+	version = 1
+
+	// chunkLines is the number of lines of the chunks the files are split
+	// into. Chunks end early at definitions, when they're close to full.
+	chunkLines = 40
+	// chunkSlack is how early a chunk can end at a definition.
+	chunkSlack = 15
+	// snippetLines is the number of lines of the results.
+	snippetLines = 12
+
+	// maxFileSize is the size of the largest files indexed: larger ones are
+	// mostly generated or data.
+	maxFileSize = 1 << 20
+	// maxFiles is the number of files indexed, in the order they're found.
+	maxFiles = 200_000
+	// maxResultsPerFile keeps a file from taking all the results.
+	maxResultsPerFile = 3
+
+	// refreshInterval is how often searches look for files changed outside
+	// of the edit tools, like by a git checkout.
+	refreshInterval = time.Minute
+
+	// BM25 parameters.
+	k1 = 1.2
+	b  = 0.75
+
+	// symbolBoost weighs the query terms in the names of the definitions of
+	// a chunk, and exactSymbolBoost a definition named like the query.
+	symbolBoost      = 2.0
+	exactSymbolBoost = 8.0
+	// pathBoost weighs the query terms in the path of the file.
+	pathBoost = 0.5
+)
+
+var textExts = []string{
+	".go", ".vue", ".svelte", ".html", ".css", ".scss", ".less", ".sql",
+	".graphql", ".gql", ".tf", ".hcl", ".nix", ".zig", ".dart", ".hs", ".ml",
+	".clj", ".erl", ".el", ".vim", ".r", ".jl", ".m", ".mm", ".groovy",
+	".gradle", ".yaml", ".yml", ".toml", ".tpl", ".tmpl", ".rst", ".txt",
+}
+
+// Result is a chunk of a file matching a search.
+type Result struct {
+	Path      string   `json:"path"`
+	StartLine int      `json:"start_line"`
+	EndLine   int      `json:"end_line"`
+	Score     float64  `json:"score"`
+	Symbols   []Symbol `json:"symbols,omitempty"`
+	Snippet   string   `json:"-"`
+}
+
+// FileSymbols is an indexed file with its definitions.
+type FileSymbols struct {
+	Path    string
+	Symbols []Symbol
+}
+
+// Stats describes the content of the index.
+type Stats struct {
+	Files   int
+	Chunks  int
+	Symbols int
+}
+
+type chunk struct {
+	Start  int
+	End    int
+	Length int
+	Terms  map[string]int
+}
+
+type file struct {
+	ModTime int64
+	Size    int64
+	Symbols []Symbol
+	Chunks  []chunk
+}
+
+// saved is the index as saved in the data directory.
+type saved struct {
+	Version int
+	Root    string
+	Files   map[string]*file
+}
+
+// Index is the search index of the files under a directory.
+type Index struct {
+	root string
+	path string
+
+	// refreshMu keeps refreshes from running at the same time.
+	refreshMu sync.Mutex
+
+	mu        sync.RWMutex
+	loaded    bool
+	files     map[string]*file
+	df        map[string]int
+	chunks    int
+	length    int
+	refreshed time.Time
+	dirty     bool
+	// generation is bumped by every change of the files.
+	generation uint64
+}
+
+// New returns the index of the files under root, saved in dataDir. It's
+// loaded or built on the first refresh or search.
+func New(root, dataDir string) *Index {
+	return &Index{
+		root:  root,
+		path:  filepath.Join(dataDir, "code_index.gob"),
+		files: make(map[string]*file),
+		df:    make(map[string]int),
+	}
+}
+
+// Refresh loads the index if needed, and indexes the files added or changed
+// since, dropping the deleted ones.
+func (idx *Index) Refresh(ctx context.Context) error {
+	idx.refreshMu.Lock()
+	defer idx.refreshMu.Unlock()
+
+	idx.load()
+	start := time.Now()
+
+	type found struct {
+		rel  string
+		info fs.FileInfo
+	}
+	var mu sync.Mutex
+	var paths []found
+	walker := fsext.NewFastGlobWalker(idx.root)
+	conf := fastwalk.Config{Follow: false}
+	err := fastwalk.Walk(&conf, idx.root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Hidden files are mostly tooling, like the data directory.
+		if path != idx.root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if path != idx.root && walker.ShouldSkip(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !indexable(path) || walker.ShouldSkip(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > maxFileSize {
+			return nil
+		}
+		rel, err := filepath.Rel(idx.root, path)
+		if err != nil {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if len(paths) >= maxFiles {
+			return filepath.SkipAll
+		}
+		paths = append(paths, found{rel: filepath.ToSlash(rel), info: info})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	idx.mu.RLock()
+	seen := make(map[string]bool, len(paths))
+	var changed []found
+	for _, p := range paths {
+		seen[p.rel] = true
+		if f, ok := idx.files[p.rel]; !ok || f.ModTime != p.info.ModTime().UnixNano() || f.Size != p.info.Size() {
+			changed = append(changed, p)
+		}
+	}
+	var deleted []string
+	for rel := range idx.files {
+		if !seen[rel] {
+			deleted = append(deleted, rel)
+		}
+	}
+	idx.mu.RUnlock()
+
+	// Files are read and split in parallel, and added to the index one by
+	// one.
+	work := make(chan found)
+	var wg sync.WaitGroup
+	for range runtime.GOMAXPROCS(0) {
+		wg.Go(func() {
+			for p := range work {
+				f, err := indexFile(filepath.Join(idx.root, filepath.FromSlash(p.rel)), p.info)
+				if err != nil {
+					continue
+				}
+				idx.mu.Lock()
+				idx.put(p.rel, f)
+				idx.mu.Unlock()
+			}
+		})
+	}
+	for _, p := range changed {
+		if ctx.Err() != nil {
+			break
+		}
+		work <- p
+	}
+	close(work)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	idx.mu.Lock()
+	for _, rel := range deleted {
+		idx.put(rel, nil)
+	}
+	idx.refreshed = time.Now()
+	idx.mu.Unlock()
+
+	if len(changed) > 0 || len(deleted) > 0 {
+		slog.Info("Refreshed code index", "files", len(paths), "changed", len(changed), "deleted", len(deleted), "took", time.Since(start))
+	}
+	return idx.Save()
+}
+
+// Update reindexes a file changed by the edit tools. Files outside of the
+// root, or that aren't indexed, are ignored.
+func (idx *Index) Update(path string) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(idx.root, path)
+	}
+	rel, err := filepath.Rel(idx.root, path)
+	if err != nil || !indexable(path) || slices.ContainsFunc(strings.Split(filepath.ToSlash(rel), "/"), func(name string) bool {
+		return strings.HasPrefix(name, ".")
+	}) {
+		return
+	}
+	rel = filepath.ToSlash(rel)
+
+	idx.mu.RLock()
+	loaded := idx.loaded
+	idx.mu.RUnlock()
+	// The next refresh picks up the changes made before the index is
+	// loaded.
+	if !loaded {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxFileSize || fsext.NewFastGlobWalker(idx.root).ShouldSkip(path) {
+		idx.mu.Lock()
+		idx.put(rel, nil)
+		idx.mu.Unlock()
+		return
+	}
+	f, err := indexFile(path, info)
+	if err != nil {
+		return
+	}
+	idx.mu.Lock()
+	idx.put(rel, f)
+	idx.mu.Unlock()
+}
+
+// Search returns the chunks of files best matching the query, under the
+// directory or file dir when it isn't empty. The index is refreshed first
+// when it's older than a minute.
+func (idx *Index) Search(ctx context.Context, query, dir string, limit int) ([]Result, error) {
+	idx.mu.RLock()
+	stale := time.Since(idx.refreshed) > refreshInterval
+	idx.mu.RUnlock()
+	if stale {
+		if err := idx.Refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	terms := slices.Compact(slices.Sorted(slices.Values(tokenize(query))))
+	if len(terms) == 0 {
+		return nil, errors.New("the query has no words to look for")
+	}
+	exact := strings.ToLower(strings.Join(strings.Fields(query), ""))
+	prefix := ""
+	if dir != "" && dir != "." {
+		prefix = strings.TrimSuffix(filepath.ToSlash(dir), "/")
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if idx.chunks == 0 {
+		return nil, nil
+	}
+	avgLength := float64(idx.length) / float64(idx.chunks)
+	idf := make(map[string]float64, len(terms))
+	for _, term := range terms {
+		df := float64(idx.df[term])
+		idf[term] = math.Log(1 + (float64(idx.chunks)-df+0.5)/(df+0.5))
+	}
+
+	var results []Result
+	for rel, f := range idx.files {
+		if prefix != "" && rel != prefix && !strings.HasPrefix(rel, prefix+"/") {
+			continue
+		}
+		pathTerms := tokenize(rel)
+		var pathScore float64
+		for _, term := range terms {
+			if slices.Contains(pathTerms, term) {
+				pathScore += pathBoost * idf[term]
+			}
+		}
+		var fileResults []Result
+		for _, c := range f.Chunks {
+			var score float64
+			for _, term := range terms {
+				if tf := float64(c.Terms[term]); tf > 0 {
+					score += idf[term] * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(c.Length)/avgLength))
+				}
+			}
+			if score == 0 {
+				continue
+			}
+			symbols := chunkSymbols(f.Symbols, c)
+			for _, s := range symbols {
+				name := strings.ToLower(s.Name)
+				if name == exact || strings.HasSuffix(name, "."+exact) {
+					score += exactSymbolBoost * maxIDF(idf)
+				}
+				for _, term := range tokenize(s.Name) {
+					if _, ok := idf[term]; ok {
+						score += symbolBoost * idf[term]
+					}
+				}
+			}
+			fileResults = append(fileResults, Result{
+				Path:      rel,
+				StartLine: c.Start,
+				EndLine:   c.End,
+				Score:     score + pathScore,
+				Symbols:   symbols,
+			})
+		}
+		sortResults(fileResults)
+		results = append(results, fileResults[:min(len(fileResults), maxResultsPerFile)]...)
+	}
+	sortResults(results)
+	results = results[:min(len(results), limit)]
+
+	for i := range results {
+		results[i].Snippet = snippet(filepath.Join(idx.root, filepath.FromSlash(results[i].Path)), results[i], terms)
+	}
+	return results, nil
+}
+
+// Outline returns the indexed files with their definitions, sorted by path.
+// It's empty until the first refresh ends, to not wait for it.
+func (idx *Index) Outline() []FileSymbols {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if idx.refreshed.IsZero() {
+		return nil
+	}
+	outline := make([]FileSymbols, 0, len(idx.files))
+	for rel, f := range idx.files {
+		outline = append(outline, FileSymbols{Path: rel, Symbols: slices.Clone(f.Symbols)})
+	}
+	slices.SortFunc(outline, func(a, b FileSymbols) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return outline
+}
+
+// Generation returns a number that changes whenever files are indexed or
+// dropped, and is 0 until the first refresh ends. It tells whether what's
+// derived from the index is out of date.
+func (idx *Index) Generation() uint64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if idx.refreshed.IsZero() {
+		return 0
+	}
+	return idx.generation
+}
+
+// Root returns the directory of the indexed files.
+func (idx *Index) Root() string {
+	return idx.root
+}
+
+// Stats returns the numbers of files, chunks and symbols in the index.
+func (idx *Index) Stats() Stats {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	stats := Stats{Files: len(idx.files), Chunks: idx.chunks}
+	for _, f := range idx.files {
+		stats.Symbols += len(f.Symbols)
+	}
+	return stats
+}
+
+// Save writes the index to the data directory, if it changed.
+func (idx *Index) Save() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if !idx.dirty {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(saved{Version: version, Root: idx.root, Files: idx.files}); err != nil {
+		return fmt.Errorf("failed to encode code index: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create code index directory: %w", err)
+	}
+	tmp := idx.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write code index: %w", err)
+	}
+	if err := os.Rename(tmp, idx.path); err != nil {
+		return fmt.Errorf("failed to write code index: %w", err)
+	}
+	idx.dirty = false
+	return nil
+}
+
+// load reads the saved index the first time it's called. An index that
+// can't be read is rebuilt.
+func (idx *Index) load() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.loaded {
+		return
+	}
+	idx.loaded = true
+
+	data, err := os.ReadFile(idx.path)
+	if err != nil {
+		return
+	}
+	var s saved
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s); err != nil || s.Version != version || s.Root != idx.root {
+		slog.Info("Rebuilding code index", "path", idx.path)
+		return
+	}
+	for rel, f := range s.Files {
+		idx.put(rel, f)
+	}
+	idx.dirty = false
+}
+
+// put replaces the entry of a file, or removes it when f is nil, keeping the
+// statistics of the terms up to date. The lock must be held.
+func (idx *Index) put(rel string, f *file) {
+	if old, ok := idx.files[rel]; ok {
+		for _, c := range old.Chunks {
+			idx.chunks--
+			idx.length -= c.Length
+			for term := range c.Terms {
+				if idx.df[term]--; idx.df[term] <= 0 {
+					delete(idx.df, term)
+				}
+			}
+		}
+		delete(idx.files, rel)
+		idx.dirty = true
+		idx.generation++
+	}
+	if f == nil {
+		return
+	}
+	idx.dirty = true
+	idx.generation++
+	for _, c := range f.Chunks {
+		idx.chunks++
+		idx.length += c.Length
+		for term := range c.Terms {
+			idx.df[term]++
+		}
+	}
+	idx.files[rel] = f
+}
+
+func indexable(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	_, ok := symbolsByExt[ext]
+	return ok || slices.Contains(textExts, ext)
+}
+
+// indexFile reads a file and splits it into chunks, ending them at
+// definitions when possible.
+func indexFile(path string, info fs.FileInfo) (*file, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &file{ModTime: info.ModTime().UnixNano(), Size: info.Size()}
+	// Binary files, like some minified bundles, are left out.
+	if bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0 {
+		return f, nil
+	}
+	f.Symbols = extractSymbols(path, content)
+
+	starts := make(map[int]bool, len(f.Symbols))
+	for _, s := range f.Symbols {
+		starts[s.Line] = true
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	current := chunk{Start: 1, Terms: make(map[string]int)}
+	flush := func(end int) {
+		current.End = end
+		if current.Length > 0 {
+			f.Chunks = append(f.Chunks, current)
+		}
+		current = chunk{Start: end + 1, Terms: make(map[string]int)}
+	}
+	for i, line := range lines {
+		n := i + 1
+		size := n - current.Start
+		if size >= chunkLines || (size >= chunkLines-chunkSlack && starts[n]) {
+			flush(n - 1)
+		}
+		for _, term := range tokenize(line) {
+			current.Terms[term]++
+			current.Length++
+		}
+	}
+	flush(len(lines))
+	return f, nil
+}
+
+func chunkSymbols(symbols []Symbol, c chunk) []Symbol {
+	var in []Symbol
+	for _, s := range symbols {
+		if s.Line >= c.Start && s.Line <= c.End {
+			in = append(in, s)
+		}
+	}
+	return in
+}
+
+func maxIDF(idf map[string]float64) float64 {
+	var m float64
+	for _, v := range idf {
+		m = max(m, v)
+	}
+	return m
+}
+
+func sortResults(results []Result) {
+	slices.SortFunc(results, func(a, b Result) int {
+		return cmp.Or(
+			cmp.Compare(b.Score, a.Score),
+			cmp.Compare(a.Path, b.Path),
+			cmp.Compare(a.StartLine, b.StartLine),
+		)
+	})
+}
+
+// snippet returns the lines of the result around its best line: the first
+// definition matching the query, or else the line with the most terms of
+// the query.
+func snippet(path string, r Result, terms []string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(string(content), "\n")
+	end := min(r.EndLine, len(lines))
+	if r.StartLine > end {
+		return ""
+	}
+
+	best, bestHits := r.StartLine, 0
+	for _, s := range r.Symbols {
+		if slices.ContainsFunc(tokenize(s.Name), func(t string) bool { return slices.Contains(terms, t) }) {
+			best, bestHits = s.Line, math.MaxInt
+			break
+		}
+	}
+	if bestHits == 0 {
+		for n := r.StartLine; n <= end; n++ {
+			hits := 0
+			for _, term := range tokenize(lines[n-1]) {
+				if slices.Contains(terms, term) {
+					hits++
+				}
+			}
+			if hits > bestHits {
+				best, bestHits = n, hits
+			}
+		}
+	}
+
+	from := max(r.StartLine, best-2)
+	to := min(end, from+snippetLines-1)
+	from = max(r.StartLine, min(from, to-snippetLines+1))
+	var sb strings.Builder
+	for n := from; n <= to; n++ {
+		fmt.Fprintf(&sb, "%6d|%s\n", n, strings.TrimRight(lines[n-1], "\r"))
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
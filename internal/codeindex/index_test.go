@@ -0,0 +1,169 @@
+package codeindex
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, []string{"parsegotestoutput", "parse", "go", "test", "output"}, tokenize("parseGoTestOutput"))
+	require.Equal(t, []string{"httpserver", "http", "server", "max_retries", "max", "retry"}, tokenize("HTTPServer(max_retries)"))
+	require.Equal(t, []string{"tools", "tool", "status"}, tokenize("tools a status"))
+	require.Equal(t, []string{"HTTP", "Server", "error"}, splitIdentifier("HTTPServer_error"))
+	require.Equal(t, []string{"v", "2", "Client"}, splitIdentifier("v2Client"))
+}
+
+func TestExtractSymbols(t *testing.T) {
+	t.Parallel()
+
+	goSource := `package calc
+
+const Pi = 3.14
+
+type Calculator[T any] struct{}
+
+func (c *Calculator[T]) Add(a, b int) int { return a + b }
+
+func New() *Calculator[int] { return nil }
+`
+	require.Equal(t, []Symbol{
+		{Name: "Pi", Kind: "const", Line: 3},
+		{Name: "Calculator", Kind: "type", Line: 5},
+		{Name: "Calculator.Add", Kind: "method", Line: 7},
+		{Name: "New", Kind: "function", Line: 9},
+	}, extractSymbols("calc.go", []byte(goSource)))
+
+	tsSource := `export interface Options {}
+export default class Parser {
+  async parse(input: string): Promise<Node> {
+    if (input) {
+    }
+  }
+}
+export const render = (node: Node) => node;
+function helper() {}
+`
+	require.Equal(t, []Symbol{
+		{Name: "Options", Kind: "type", Line: 1},
+		{Name: "Parser", Kind: "class", Line: 2},
+		{Name: "parse", Kind: "method", Line: 3},
+		{Name: "render", Kind: "function", Line: 8},
+		{Name: "helper", Kind: "function", Line: 9},
+	}, extractSymbols("parser.ts", []byte(tsSource)))
+
+	pySource := "class Parser:\n    async def parse(self):\n        pass\n"
+	require.Equal(t, []Symbol{
+		{Name: "Parser", Kind: "class", Line: 1},
+		{Name: "parse", Kind: "function", Line: 2},
+	}, extractSymbols("parser.py", []byte(pySource)))
+
+	require.Nil(t, extractSymbols("data.csv", []byte("a,b\n")))
+}
+
+func TestIndexSearch(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	dataDir := t.TempDir()
+	filler := strings.Repeat("// Some unrelated comment about nothing.\n", 50)
+	writeFiles(t, root, map[string]string{
+		"internal/tools/registry.go": "package tools\n\n" + filler + "// buildTools returns the tools of the agent.\nfunc buildTools() []string {\n\treturn []string{\"bash\", \"edit\"}\n}\n",
+		"internal/tools/bash.go":     "package tools\n\n// The tools run commands.\nfunc runBash() {}\n",
+		"web/app.ts":                 "export function renderTools() {}\n",
+		"vendor.bin":                 "tools\x00",
+		".hidden/tools.go":           "package hidden\n\nfunc buildTools() {}\n",
+		"ignored/tools.go":           "package ignored\n\nfunc buildTools() {}\n",
+		".gitignore":                 "ignored/\n",
+	})
+
+	idx := New(root, dataDir)
+	results, err := idx.Search(t.Context(), "buildTools", "", 10)
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	require.Equal(t, "internal/tools/registry.go", results[0].Path)
+	require.Equal(t, []Symbol{{Name: "buildTools", Kind: "function", Line: 54}}, results[0].Symbols)
+	require.Contains(t, results[0].Snippet, "    54|func buildTools() []string {")
+	require.Greater(t, results[0].StartLine, 1, "the chunk should start near the definition")
+	for _, r := range results {
+		require.NotContains(t, r.Path, "hidden")
+		require.NotContains(t, r.Path, "ignored")
+	}
+
+	results, err = idx.Search(t.Context(), "tools", "web", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "web/app.ts", results[0].Path)
+
+	_, err = idx.Search(t.Context(), "!!", "", 10)
+	require.Error(t, err)
+
+	// Edits are picked up right away.
+	writeFiles(t, root, map[string]string{"internal/tools/bash.go": "package tools\n\nfunc runShellCommand() {}\n"})
+	idx.Update(filepath.Join(root, "internal/tools/bash.go"))
+	results, err = idx.Search(t.Context(), "shell command", "", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "internal/tools/bash.go", results[0].Path)
+
+	require.NoError(t, os.Remove(filepath.Join(root, "web/app.ts")))
+	idx.Update(filepath.Join(root, "web/app.ts"))
+	stats := idx.Stats()
+	require.Equal(t, 2, stats.Files)
+	require.NoError(t, idx.Save())
+
+	// The saved index is loaded, and only the changed files are read again.
+	loaded := New(root, dataDir)
+	require.NoError(t, loaded.Refresh(t.Context()))
+	require.Equal(t, stats, loaded.Stats())
+
+	later := time.Now().Add(time.Second)
+	writeFiles(t, root, map[string]string{"internal/tools/new.go": "package tools\n\nfunc newTool() {}\n"})
+	require.NoError(t, os.Chtimes(filepath.Join(root, "internal/tools/new.go"), later, later))
+	require.NoError(t, loaded.Refresh(t.Context()))
+	require.Equal(t, 3, loaded.Stats().Files)
+}
+
+func TestIndexChunks(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	var sb strings.Builder
+	sb.WriteString("package big\n")
+	for i := range 10 {
+		sb.WriteString("\nfunc f" + string(rune('a'+i)) + "() {\n")
+		sb.WriteString(strings.Repeat("\tx := 1\n", 8))
+		sb.WriteString("}\n")
+	}
+	writeFiles(t, dir, map[string]string{"big.go": sb.String()})
+	info, err := os.Stat(filepath.Join(dir, "big.go"))
+	require.NoError(t, err)
+
+	f, err := indexFile(filepath.Join(dir, "big.go"), info)
+	require.NoError(t, err)
+	require.Len(t, f.Symbols, 10)
+	require.Greater(t, len(f.Chunks), 2)
+	for i, c := range f.Chunks {
+		require.LessOrEqual(t, c.End-c.Start+1, chunkLines)
+		if i > 0 {
+			require.Equal(t, f.Chunks[i-1].End+1, c.Start)
+			// Chunks start at definitions.
+			require.Equal(t, c.Start, chunkSymbols(f.Symbols, c)[0].Line)
+		}
+	}
+}
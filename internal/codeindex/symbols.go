@@ -0,0 +1,204 @@
+package codeindex
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Symbol is a definition found in a file.
+type Symbol struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	Line int    `json:"line"`
+}
+
+type symbolPattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+func symbolPatterns(kinds ...string) []symbolPattern {
+	patterns := make([]symbolPattern, 0, len(kinds)/2)
+	for i := 0; i+1 < len(kinds); i += 2 {
+		patterns = append(patterns, symbolPattern{kind: kinds[i], re: regexp.MustCompile(kinds[i+1])})
+	}
+	return patterns
+}
+
+var (
+	jsPatterns = symbolPatterns(
+		"function", `^\s*(?:export\s+)?(?:default\s+)?(?:async\s+)?function\*?\s+([\w$]+)`,
+		"class", `^\s*(?:export\s+)?(?:default\s+)?(?:abstract\s+)?class\s+([\w$]+)`,
+		"type", `^\s*(?:export\s+)?(?:declare\s+)?(?:interface|type|enum)\s+([\w$]+)`,
+		"function", `^\s*(?:export\s+)?(?:const|let|var)\s+([\w$]+)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:function\b|\([^)]*\)\s*(?::[^=]+)?=>|[\w$]+\s*=>)`,
+		"method", `^\s+(?:(?:public|private|protected|static|async|readonly|override|get|set)\s+)*([\w$]+)\s*\([^)]*\)\s*(?::[^{]+)?\{\s*$`,
+	)
+	symbolsByExt = map[string][]symbolPattern{
+		".js":  jsPatterns,
+		".jsx": jsPatterns,
+		".mjs": jsPatterns,
+		".cjs": jsPatterns,
+		".ts":  jsPatterns,
+		".tsx": jsPatterns,
+		".py": symbolPatterns(
+			"function", `^\s*(?:async\s+)?def\s+(\w+)`,
+			"class", `^\s*class\s+(\w+)`,
+		),
+		".rb": symbolPatterns(
+			"function", `^\s*def\s+(?:self\.)?([\w?!=]+)`,
+			"class", `^\s*(?:class|module)\s+([\w:]+)`,
+		),
+		".rs": symbolPatterns(
+			"function", `^\s*(?:pub(?:\([^)]*\))?\s+)?(?:const\s+)?(?:async\s+)?(?:unsafe\s+)?(?:extern\s+"[^"]*"\s+)?fn\s+(\w+)`,
+			"type", `^\s*(?:pub(?:\([^)]*\))?\s+)?(?:struct|enum|trait|type|union)\s+(\w+)`,
+			"module", `^\s*(?:pub(?:\([^)]*\))?\s+)?mod\s+(\w+)`,
+			"type", `^\s*impl(?:<[^>]*>)?\s+(?:[\w:<>, ]+\s+for\s+)?(\w+)`,
+		),
+		".java":  classLikePatterns("method", `^\s*(?:(?:public|private|protected|static|final|abstract|synchronized|native|default)\s+)+[\w<>\[\],.? ]+\s+(\w+)\s*\(`),
+		".cs":    classLikePatterns("method", `^\s*(?:(?:public|private|protected|internal|static|virtual|override|abstract|sealed|async|extern)\s+)+[\w<>\[\],.? ]+\s+(\w+)\s*\(`),
+		".kt":    classLikePatterns("function", `\bfun\s+(?:<[^>]*>\s*)?(?:[\w.]+\.)?(\w+)\s*\(`),
+		".kts":   classLikePatterns("function", `\bfun\s+(?:<[^>]*>\s*)?(?:[\w.]+\.)?(\w+)\s*\(`),
+		".scala": classLikePatterns("function", `\bdef\s+(\w+)`),
+		".swift": classLikePatterns("function", `\bfunc\s+(\w+)`),
+		".php":   classLikePatterns("function", `\bfunction\s+&?(\w+)\s*\(`),
+		".c":     cPatterns,
+		".h":     cPatterns,
+		".cc":    cPatterns,
+		".cpp":   cPatterns,
+		".cxx":   cPatterns,
+		".hpp":   cPatterns,
+		".hh":    cPatterns,
+		".lua": symbolPatterns(
+			"function", `^\s*(?:local\s+)?function\s+([\w.:]+)`,
+		),
+		".sh":   shellPatterns,
+		".bash": shellPatterns,
+		".zsh":  shellPatterns,
+		".ex": symbolPatterns(
+			"function", `^\s*defp?\s+(\w+[?!]?)`,
+			"module", `^\s*defmodule\s+([\w.]+)`,
+		),
+		".exs": symbolPatterns(
+			"function", `^\s*defp?\s+(\w+[?!]?)`,
+			"module", `^\s*defmodule\s+([\w.]+)`,
+		),
+		".proto": symbolPatterns(
+			"type", `^\s*(?:message|enum|service)\s+(\w+)`,
+			"method", `^\s*rpc\s+(\w+)`,
+		),
+		".md": symbolPatterns(
+			"heading", `^#{1,6}\s+(.+?)\s*#*$`,
+		),
+	}
+	cPatterns = symbolPatterns(
+		"type", `^\s*(?:typedef\s+)?(?:struct|class|enum|union)\s+(\w+)\s*(?:[:{]|$)`,
+		"macro", `^\s*#\s*define\s+(\w+)`,
+		"function", `^[A-Za-z_][\w\s\*&:<>,]*?\b([A-Za-z_]\w*)\s*\([^;]*$`,
+	)
+	shellPatterns = symbolPatterns(
+		"function", `^\s*(?:function\s+)?([\w-]+)\s*\(\)\s*\{?`,
+		"function", `^\s*function\s+([\w-]+)`,
+	)
+	// cKeywords are taken for function names by the loose pattern of C.
+	cKeywords = map[string]bool{"if": true, "for": true, "while": true, "switch": true, "return": true, "sizeof": true}
+)
+
+func classLikePatterns(functionKind, function string) []symbolPattern {
+	return append(symbolPatterns(
+		"class", `\b(?:class|interface|enum|record|struct|object|trait|protocol|extension)\s+(\w+)`,
+	), symbolPattern{kind: functionKind, re: regexp.MustCompile(function)})
+}
+
+// extractSymbols returns the definitions of a file: read from the syntax tree
+// for Go, and matched line by line for the other languages.
+//
+// The language servers aren't asked for the symbols of the files: the LSP
+// client has no request for them, and the index is built and refreshed
+// without waiting for the servers, which may not be configured at all.
+func extractSymbols(path string, content []byte) []Symbol {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".go" {
+		return goSymbols(path, content)
+	}
+	patterns, ok := symbolsByExt[ext]
+	if !ok {
+		return nil
+	}
+	var symbols []Symbol
+	for i, line := range strings.Split(string(content), "\n") {
+		for _, p := range patterns {
+			m := p.re.FindStringSubmatch(line)
+			if m == nil || cKeywords[m[1]] {
+				continue
+			}
+			symbols = append(symbols, Symbol{Name: m[1], Kind: p.kind, Line: i + 1})
+			break
+		}
+	}
+	return symbols
+}
+
+func goSymbols(path string, content []byte) []Symbol {
+	fset := token.NewFileSet()
+	// A file that doesn't parse still gives the declarations before the
+	// error.
+	f, _ := parser.ParseFile(fset, path, content, parser.SkipObjectResolution)
+	if f == nil {
+		return nil
+	}
+	var symbols []Symbol
+	add := func(name *ast.Ident, kind string) {
+		if name == nil || name.Name == "_" {
+			return
+		}
+		symbols = append(symbols, Symbol{Name: name.Name, Kind: kind, Line: fset.Position(name.Pos()).Line})
+	}
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Recv == nil || len(decl.Recv.List) == 0 {
+				add(decl.Name, "function")
+				continue
+			}
+			name := *decl.Name
+			if recv := receiverName(decl.Recv.List[0].Type); recv != "" {
+				name.Name = recv + "." + name.Name
+			}
+			add(&name, "method")
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					add(spec.Name, "type")
+				case *ast.ValueSpec:
+					kind := "var"
+					if decl.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, name := range spec.Names {
+						add(name, kind)
+					}
+				}
+			}
+		}
+	}
+	return symbols
+}
+
+func receiverName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverName(expr.X)
+	case *ast.IndexExpr:
+		return receiverName(expr.X)
+	case *ast.IndexListExpr:
+		return receiverName(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package codeindex
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenize returns the terms of text: each identifier in lower case, and the
+// words it's made of, so that "parseGoTestOutput" is found by "parse",
+// "test" and "output" as well as by the whole name.
+func tokenize(text string) []string {
+	var terms []string
+	start := -1
+	for i := 0; i <= len(text); {
+		r, size := utf8.RuneError, 1
+		if i < len(text) {
+			r, size = utf8.DecodeRuneInString(text[i:])
+		}
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+			if start < 0 {
+				start = i
+			}
+		case unicode.IsDigit(r) && start >= 0:
+		default:
+			if start >= 0 {
+				terms = append(terms, identifierTerms(text[start:i])...)
+				start = -1
+			}
+		}
+		i += size
+	}
+	return terms
+}
+
+func identifierTerms(id string) []string {
+	whole := strings.ToLower(id)
+	// Most words are a single part.
+	if whole == id && !strings.Contains(id, "_") {
+		if len(id) < 2 {
+			return nil
+		}
+		if s := stem(id); s != id && len(s) > 1 {
+			return []string{id, s}
+		}
+		return []string{id}
+	}
+	parts := splitIdentifier(id)
+	terms := make([]string, 0, len(parts)+1)
+	if len(whole) > 1 {
+		terms = append(terms, whole)
+	}
+	for _, part := range parts {
+		part = stem(strings.ToLower(part))
+		if len(part) > 1 && part != whole {
+			terms = append(terms, part)
+		}
+	}
+	return terms
+}
+
+// splitIdentifier splits an identifier into its words, on underscores and
+// changes of case: "HTTPServer_error" gives "HTTP", "Server" and "error".
+func splitIdentifier(id string) []string {
+	var parts []string
+	runes := []rune(id)
+	start := 0
+	for i := 1; i <= len(runes); i++ {
+		if i < len(runes) && !isBoundary(runes, i) {
+			continue
+		}
+		part := strings.Trim(string(runes[start:i]), "_")
+		if part != "" {
+			parts = append(parts, part)
+		}
+		start = i
+	}
+	return parts
+}
+
+func isBoundary(runes []rune, i int) bool {
+	prev, cur := runes[i-1], runes[i]
+	switch {
+	case cur == '_' || prev == '_':
+		return true
+	case unicode.IsLower(prev) && unicode.IsUpper(cur):
+		return true
+	case unicode.IsDigit(prev) != unicode.IsDigit(cur):
+		return true
+	case unicode.IsUpper(prev) && unicode.IsUpper(cur):
+		// The last capital of an acronym starts the next word: HTTPServer.
+		return i+1 < len(runes) && unicode.IsLower(runes[i+1])
+	}
+	return false
+}
+
+// stem drops the plural of words, so that "tool" finds "tools".
+func stem(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		return word[:len(word)-1]
+	}
+	return word
+}
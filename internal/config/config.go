@@ -131,6 +131,18 @@ type MCPConfig struct {
 
 	// TODO: maybe make it possible to get the value from the env
 	Headers map[string]string `json:"headers,omitempty" jsonschema:"description=HTTP headers for HTTP/SSE MCP servers"`
+
+	OAuth *MCPOAuthConfig `json:"oauth,omitempty" jsonschema:"description=OAuth settings for HTTP/SSE MCP servers that require authorization"`
+}
+
+// MCPOAuthConfig configures the OAuth authorization flow of HTTP/SSE MCP
+// servers. Every field is optional: when no client ID is given, the client is
+// registered dynamically with the authorization server.
+type MCPOAuthConfig struct {
+	ClientID     string   `json:"client_id,omitempty" jsonschema:"description=OAuth client ID to use instead of dynamic client registration"`
+	ClientSecret string   `json:"client_secret,omitempty" jsonschema:"description=OAuth client secret for confidential clients"`
+	Scopes       []string `json:"scopes,omitempty" jsonschema:"description=OAuth scopes to request (defaults to the scopes advertised by the server)"`
+	CallbackPort int      `json:"callback_port,omitempty" jsonschema:"description=Local port for the OAuth callback listener (random by default),example=8765"`
 }
 
 type LSPConfig struct {
@@ -164,8 +176,10 @@ func (c Completions) Limits() (depth, items int) {
 }
 
 type Permissions struct {
-	AllowedTools []string `json:"allowed_tools,omitempty" jsonschema:"description=List of tools that don't require permission prompts,example=bash,example=view"` // Tools that don't require permission prompts
-	SkipRequests bool     `json:"-"`                                                                                                                              // Automatically accept all permissions (YOLO mode)
+	AllowedTools   []string `json:"allowed_tools,omitempty" jsonschema:"description=List of tools that don't require permission prompts,example=bash,example=view"` // Tools that don't require permission prompts
+	AllowedDomains []string `json:"allowed_domains,omitempty" jsonschema:"description=Domains the fetch and download tools can reach (all when empty); a domain matches its subdomains and *. matches only the subdomains,example=go.dev,example=*.github.com"`
+	DeniedDomains  []string `json:"denied_domains,omitempty" jsonschema:"description=Domains the fetch and download tools can't reach; they win over the allowed domains,example=internal.example.com"`
+	SkipRequests   bool     `json:"-"` // Automatically accept all permissions (YOLO mode)
 }
 
 type TrailerStyle string
@@ -192,17 +206,76 @@ func (Attribution) JSONSchemaExtend(schema *jsonschema.Schema) {
 }
 
 type Options struct {
-	ContextPaths              []string     `json:"context_paths,omitempty" jsonschema:"description=Paths to files containing context information for the AI,example=.cursorrules,example=CRUSH.md"`
-	TUI                       *TUIOptions  `json:"tui,omitempty" jsonschema:"description=Terminal user interface options"`
-	Debug                     bool         `json:"debug,omitempty" jsonschema:"description=Enable debug logging,default=false"`
-	DebugLSP                  bool         `json:"debug_lsp,omitempty" jsonschema:"description=Enable debug logging for LSP servers,default=false"`
-	DisableAutoSummarize      bool         `json:"disable_auto_summarize,omitempty" jsonschema:"description=Disable automatic conversation summarization,default=false"`
-	DataDirectory             string       `json:"data_directory,omitempty" jsonschema:"description=Directory for storing application data (relative to working directory),default=.crush,example=.crush"` // Relative to the cwd
-	DisabledTools             []string     `json:"disabled_tools" jsonschema:"description=Tools to disable"`
-	DisableProviderAutoUpdate bool         `json:"disable_provider_auto_update,omitempty" jsonschema:"description=Disable providers auto-update,default=false"`
-	Attribution               *Attribution `json:"attribution,omitempty" jsonschema:"description=Attribution settings for generated content"`
-	DisableMetrics            bool         `json:"disable_metrics,omitempty" jsonschema:"description=Disable sending metrics,default=false"`
-	InitializeAs              string       `json:"initialize_as,omitempty" jsonschema:"description=Name of the context file to create/update during project initialization,default=AGENTS.md,example=AGENTS.md,example=CRUSH.md,example=CLAUDE.md,example=docs/LLMs.md"`
+	ContextPaths              []string        `json:"context_paths,omitempty" jsonschema:"description=Paths to files containing context information for the AI,example=.cursorrules,example=CRUSH.md"`
+	TUI                       *TUIOptions     `json:"tui,omitempty" jsonschema:"description=Terminal user interface options"`
+	Debug                     bool            `json:"debug,omitempty" jsonschema:"description=Enable debug logging,default=false"`
+	DebugLSP                  bool            `json:"debug_lsp,omitempty" jsonschema:"description=Enable debug logging for LSP servers,default=false"`
+	DisableAutoSummarize      bool            `json:"disable_auto_summarize,omitempty" jsonschema:"description=Disable automatic conversation summarization,default=false"`
+	DataDirectory             string          `json:"data_directory,omitempty" jsonschema:"description=Directory for storing application data (relative to working directory),default=.crush,example=.crush"` // Relative to the cwd
+	DisabledTools             []string        `json:"disabled_tools" jsonschema:"description=Tools to disable"`
+	DisableProviderAutoUpdate bool            `json:"disable_provider_auto_update,omitempty" jsonschema:"description=Disable providers auto-update,default=false"`
+	Attribution               *Attribution    `json:"attribution,omitempty" jsonschema:"description=Attribution settings for generated content"`
+	DisableMetrics            bool            `json:"disable_metrics,omitempty" jsonschema:"description=Disable sending metrics,default=false"`
+	InitializeAs              string          `json:"initialize_as,omitempty" jsonschema:"description=Name of the context file to create/update during project initialization,default=AGENTS.md,example=AGENTS.md,example=CRUSH.md,example=CLAUDE.md,example=docs/LLMs.md"`
+	HistoryPruning            *HistoryPruning `json:"history_pruning,omitempty" jsonschema:"description=Settings for pruning old tool results from the conversation history"`
+	TaskAgent                 *TaskAgent      `json:"task_agent,omitempty" jsonschema:"description=Settings for the task sub-agent the agent tool runs"`
+	Redaction                 *Redaction      `json:"redaction,omitempty" jsonschema:"description=Settings for the redaction of secrets from tool results and logs"`
+	RepoMap                   *RepoMap        `json:"repo_map,omitempty" jsonschema:"description=Settings for the map of the repository in the system prompt"`
+	Fetch                     *Fetch          `json:"fetch,omitempty" jsonschema:"description=Settings for the tools that fetch and download URLs"`
+}
+
+// Fetch configures the fetch, agentic_fetch and download tools. Their
+// responses are cached in the data directory, honoring Cache-Control and
+// ETag. The domains they can reach are set in the permissions.
+type Fetch struct {
+	MaxResponseSize  int64 `json:"max_response_size,omitempty" jsonschema:"description=Maximum size in bytes of the fetched pages; larger ones are truncated,default=5242880,example=1048576"`
+	MaxDownloadSize  int64 `json:"max_download_size,omitempty" jsonschema:"description=Maximum size in bytes of the downloaded files,default=104857600,example=524288000"`
+	DisableCache     bool  `json:"disable_cache,omitempty" jsonschema:"description=Disable the cache of the fetched pages,default=false"`
+	RespectRobotsTxt bool  `json:"respect_robots_txt,omitempty" jsonschema:"description=Refuse to fetch the pages the robots.txt of their site disallows,default=false"`
+}
+
+// RepoMap configures the map of the repository added to the system prompt:
+// its directory tree and the top-level definitions of its files, ranked by
+// the files edited recently. It's built from the code index, so it needs the
+// code_search tool.
+type RepoMap struct {
+	Enabled   bool `json:"enabled,omitempty" jsonschema:"description=Add a map of the repository to the system prompt,default=false"`
+	MaxTokens *int `json:"max_tokens,omitempty" jsonschema:"description=Maximum number of tokens of the map,default=2000,example=4000"`
+}
+
+func (r RepoMap) TokenBudget() int {
+	return ptrValOr(r.MaxTokens, 2000)
+}
+
+// Redaction configures the scrubbing of secrets from tool results, before
+// they reach the model and are saved, and from the HTTP debug logs. The
+// values of provider API keys, MCP headers and environment variables named
+// like secrets are redacted, plus common kinds of tokens.
+type Redaction struct {
+	Disabled bool              `json:"disabled,omitempty" jsonschema:"description=Disable the redaction of secrets,default=false"`
+	EnvVars  []string          `json:"env_vars,omitempty" jsonschema:"description=Names of more environment variables whose values are secrets,example=DATABASE_URL"`
+	Patterns map[string]string `json:"patterns,omitempty" jsonschema:"description=More regular expressions of secrets keyed by name; when an expression has a group only the text of its first group is redacted,example={\"internal_token\":\"itk_[a-z0-9]{32}\"}"`
+}
+
+// TaskAgent configures the sub-agent the agent tool runs to search for
+// context. It's read-only, whatever its settings.
+type TaskAgent struct {
+	Model      SelectedModelType   `json:"model,omitempty" jsonschema:"description=The model type the task agent uses,enum=large,enum=small,default=large"`
+	LSP        bool                `json:"lsp,omitempty" jsonschema:"description=Give the task agent the LSP diagnostics and references tools,default=false"`
+	AllowedMCP map[string][]string `json:"allowed_mcp,omitempty" jsonschema:"description=MCP servers the task agent can use mapped to the tools it can use from each (all of them when empty). No MCPs by default"`
+}
+
+// HistoryPruning controls the elision of old tool results from the prompt,
+// which frees context without summarizing the conversation.
+type HistoryPruning struct {
+	Disabled  bool     `json:"disabled,omitempty" jsonschema:"description=Disable pruning of old tool results,default=false"`
+	KeepTurns *int     `json:"keep_turns,omitempty" jsonschema:"description=Number of recent turns whose tool results are always kept,default=3,example=5"`
+	MinChars  *int     `json:"min_chars,omitempty" jsonschema:"description=Tool results shorter than this number of characters are always kept,default=2000,example=5000"`
+	Threshold *float64 `json:"threshold,omitempty" jsonschema:"description=Share of the context window in use above which old tool results are pruned (0 prunes them regardless),default=0.5,example=0.3"`
+}
+
+func (h HistoryPruning) Limits() (keepTurns, minChars int, threshold float64) {
+	return ptrValOr(h.KeepTurns, 3), ptrValOr(h.MinChars, 2000), ptrValOr(h.Threshold, 0.5)
 }
 
 type MCPs map[string]MCPConfig
@@ -292,7 +365,8 @@ type Agent struct {
 }
 
 type Tools struct {
-	Ls ToolLs `json:"ls,omitzero"`
+	Ls     ToolLs     `json:"ls,omitzero"`
+	Output ToolOutput `json:"output,omitzero"`
 }
 
 type ToolLs struct {
@@ -304,6 +378,23 @@ func (t ToolLs) Limits() (depth, items int) {
 	return ptrValOr(t.MaxDepth, 0), ptrValOr(t.MaxItems, 0)
 }
 
+// DefaultToolOutputMaxChars is the default size limit of tool results.
+const DefaultToolOutputMaxChars = 30000
+
+type ToolOutput struct {
+	MaxChars *int           `json:"max_chars,omitempty" jsonschema:"description=Maximum number of characters of a tool result; longer results are saved to a file and replaced with a preview (0 disables the limit),default=30000,example=50000"`
+	Tools    map[string]int `json:"tools,omitempty" jsonschema:"description=Per-tool overrides of max_chars keyed by tool name,example={\"bash\":60000}"`
+}
+
+// Limit returns the output limit of the given tool, or zero when its output
+// isn't limited.
+func (t ToolOutput) Limit(tool string) int {
+	if limit, ok := t.Tools[tool]; ok {
+		return max(limit, 0)
+	}
+	return max(ptrValOr(t.MaxChars, DefaultToolOutputMaxChars), 0)
+}
+
 // Config holds the configuration for crush.
 type Config struct {
 	Schema string `json:"$schema,omitempty"`
@@ -537,20 +628,32 @@ func (c *Config) recordRecentModel(modelType SelectedModelType, model SelectedMo
 func allToolNames() []string {
 	return []string{
 		"agent",
+		"parallel_agents",
 		"bash",
 		"job_output",
 		"job_kill",
+		"job_wait",
+		"job_input",
+		"code_search",
 		"download",
 		"edit",
 		"multiedit",
 		"lsp_diagnostics",
 		"lsp_references",
+		"mcp_list_resources",
+		"mcp_read_resource",
 		"fetch",
 		"agentic_fetch",
+		"git_status",
+		"git_diff",
+		"git_commit",
 		"glob",
 		"grep",
 		"ls",
+		"merge_agent_patch",
 		"sourcegraph",
+		"test",
+		"todos",
 		"view",
 		"write",
 	}
@@ -565,11 +668,18 @@ func resolveAllowedTools(allTools []string, disabledTools []string) []string {
 }
 
 func resolveReadOnlyTools(tools []string) []string {
-	readOnlyTools := []string{"glob", "grep", "ls", "sourcegraph", "view"}
+	readOnlyTools := []string{"code_search", "git_status", "git_diff", "glob", "grep", "ls", "sourcegraph", "view"}
 	// filter to only include tools that are in allowedtools (include mode)
 	return filterSlice(tools, readOnlyTools, true)
 }
 
+// PlanTools returns the tools, out of the given ones, that the agent can use
+// in plan mode: the read-only tools and the LSP tools.
+func PlanTools(tools []string) []string {
+	lspTools := filterSlice(tools, []string{"lsp_diagnostics", "lsp_references"}, true)
+	return append(resolveReadOnlyTools(tools), lspTools...)
+}
+
 func filterSlice(data []string, mask []string, include bool) []string {
 	filtered := []string{}
 	for _, s := range data {
@@ -595,20 +705,40 @@ func (c *Config) SetupAgents() {
 			AllowedTools: allowedTools,
 		},
 
-		AgentTask: {
-			ID:           AgentCoder,
-			Name:         "Task",
-			Description:  "An agent that helps with searching for context and finding implementation details.",
-			Model:        SelectedModelTypeLarge,
-			ContextPaths: c.Options.ContextPaths,
-			AllowedTools: resolveReadOnlyTools(allowedTools),
-			// NO MCPs or LSPs by default
-			AllowedMCP: map[string][]string{},
-		},
+		AgentTask: c.taskAgent(allowedTools),
 	}
 	c.Agents = agents
 }
 
+// taskAgent returns the task agent with the allowed tools, set up by the task
+// agent options.
+func (c *Config) taskAgent(allowedTools []string) Agent {
+	agent := Agent{
+		ID:           AgentCoder,
+		Name:         "Task",
+		Description:  "An agent that helps with searching for context and finding implementation details.",
+		Model:        SelectedModelTypeLarge,
+		ContextPaths: c.Options.ContextPaths,
+		AllowedTools: resolveReadOnlyTools(allowedTools),
+		// NO MCPs or LSPs by default
+		AllowedMCP: map[string][]string{},
+	}
+	opts := c.Options.TaskAgent
+	if opts == nil {
+		return agent
+	}
+	if opts.Model == SelectedModelTypeSmall {
+		agent.Model = SelectedModelTypeSmall
+	}
+	if opts.LSP {
+		agent.AllowedTools = PlanTools(allowedTools)
+	}
+	if len(opts.AllowedMCP) > 0 {
+		agent.AllowedMCP = opts.AllowedMCP
+	}
+	return agent
+}
+
 func (c *Config) Resolver() VariableResolver {
 	return c.resolver
 }
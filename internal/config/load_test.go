@@ -469,7 +469,7 @@ func TestConfig_setupAgentsWithNoDisabledTools(t *testing.T) {
 
 	taskAgent, ok := cfg.Agents[AgentTask]
 	require.True(t, ok)
-	assert.Equal(t, []string{"glob", "grep", "ls", "sourcegraph", "view"}, taskAgent.AllowedTools)
+	assert.Equal(t, []string{"code_search", "git_status", "git_diff", "glob", "grep", "ls", "sourcegraph", "view"}, taskAgent.AllowedTools)
 }
 
 func TestConfig_setupAgentsWithDisabledTools(t *testing.T) {
@@ -487,17 +487,20 @@ func TestConfig_setupAgentsWithDisabledTools(t *testing.T) {
 	coderAgent, ok := cfg.Agents[AgentCoder]
 	require.True(t, ok)
 
-	assert.Equal(t, []string{"agent", "bash", "job_output", "job_kill", "multiedit", "lsp_diagnostics", "lsp_references", "fetch", "agentic_fetch", "glob", "ls", "sourcegraph", "view", "write"}, coderAgent.AllowedTools)
+	assert.Equal(t, []string{"agent", "parallel_agents", "bash", "job_output", "job_kill", "job_wait", "job_input", "code_search", "multiedit", "lsp_diagnostics", "lsp_references", "mcp_list_resources", "mcp_read_resource", "fetch", "agentic_fetch", "git_status", "git_diff", "git_commit", "glob", "ls", "merge_agent_patch", "sourcegraph", "test", "todos", "view", "write"}, coderAgent.AllowedTools)
 
 	taskAgent, ok := cfg.Agents[AgentTask]
 	require.True(t, ok)
-	assert.Equal(t, []string{"glob", "ls", "sourcegraph", "view"}, taskAgent.AllowedTools)
+	assert.Equal(t, []string{"code_search", "git_status", "git_diff", "glob", "ls", "sourcegraph", "view"}, taskAgent.AllowedTools)
 }
 
 func TestConfig_setupAgentsWithEveryReadOnlyToolDisabled(t *testing.T) {
 	cfg := &Config{
 		Options: &Options{
 			DisabledTools: []string{
+				"code_search",
+				"git_status",
+				"git_diff",
 				"glob",
 				"grep",
 				"ls",
@@ -510,13 +513,43 @@ func TestConfig_setupAgentsWithEveryReadOnlyToolDisabled(t *testing.T) {
 	cfg.SetupAgents()
 	coderAgent, ok := cfg.Agents[AgentCoder]
 	require.True(t, ok)
-	assert.Equal(t, []string{"agent", "bash", "job_output", "job_kill", "download", "edit", "multiedit", "lsp_diagnostics", "lsp_references", "fetch", "agentic_fetch", "write"}, coderAgent.AllowedTools)
+	assert.Equal(t, []string{"agent", "parallel_agents", "bash", "job_output", "job_kill", "job_wait", "job_input", "download", "edit", "multiedit", "lsp_diagnostics", "lsp_references", "mcp_list_resources", "mcp_read_resource", "fetch", "agentic_fetch", "git_commit", "merge_agent_patch", "test", "todos", "write"}, coderAgent.AllowedTools)
 
 	taskAgent, ok := cfg.Agents[AgentTask]
 	require.True(t, ok)
 	assert.Equal(t, []string{}, taskAgent.AllowedTools)
 }
 
+func TestConfig_setupAgentsWithTaskAgentOptions(t *testing.T) {
+	cfg := &Config{
+		Options: &Options{
+			TaskAgent: &TaskAgent{
+				Model:      SelectedModelTypeSmall,
+				LSP:        true,
+				AllowedMCP: map[string][]string{"docs": {"search"}},
+			},
+		},
+	}
+
+	cfg.SetupAgents()
+	taskAgent, ok := cfg.Agents[AgentTask]
+	require.True(t, ok)
+	assert.Equal(t, SelectedModelTypeSmall, taskAgent.Model)
+	assert.Equal(t, []string{"code_search", "git_status", "git_diff", "glob", "grep", "ls", "sourcegraph", "view", "lsp_diagnostics", "lsp_references"}, taskAgent.AllowedTools)
+	assert.Equal(t, map[string][]string{"docs": {"search"}}, taskAgent.AllowedMCP)
+
+	coderAgent, ok := cfg.Agents[AgentCoder]
+	require.True(t, ok)
+	assert.Equal(t, SelectedModelTypeLarge, coderAgent.Model)
+}
+
+func TestPlanTools(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"code_search", "git_status", "git_diff", "glob", "grep", "ls", "sourcegraph", "view", "lsp_diagnostics", "lsp_references"}, PlanTools(allToolNames()))
+	assert.Equal(t, []string{"view", "lsp_references"}, PlanTools([]string{"bash", "edit", "view", "lsp_references"}))
+}
+
 func TestConfig_configureProvidersWithDisabledProvider(t *testing.T) {
 	knownProviders := []catwalk.Provider{
 		{
@@ -1249,3 +1282,17 @@ func TestConfig_configureSelectedModels(t *testing.T) {
 	})
 }
 
+func TestToolOutput_Limit(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, DefaultToolOutputMaxChars, ToolOutput{}.Limit("bash"))
+
+	maxChars := 10000
+	output := ToolOutput{
+		MaxChars: &maxChars,
+		Tools:    map[string]int{"bash": 50000, "view": 0},
+	}
+	require.Equal(t, 50000, output.Limit("bash"))
+	require.Equal(t, 0, output.Limit("view"))
+	require.Equal(t, 10000, output.Limit("grep"))
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// ProjectConfig returns the path of the project configuration file in the
+// given directory: the existing crushplus.json or .crushplus.json, or
+// crushplus.json if there is none yet.
+func ProjectConfig(workingDir string) string {
+	for _, name := range []string{appName + ".json", "." + appName + ".json"} {
+		path := filepath.Join(workingDir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(workingDir, appName+".json")
+}
+
+// mcpMu guards the MCP field of the configuration, which is replaced when
+// the config files change while the app runs.
+var mcpMu sync.RWMutex
+
+// MCPs returns the MCP configurations. Read them with it rather than through
+// the MCP field once the app runs, since reloads replace them concurrently.
+// The returned map must not be modified.
+func (c *Config) MCPs() MCPs {
+	mcpMu.RLock()
+	defer mcpMu.RUnlock()
+	return c.MCP
+}
+
+// SetMCPs replaces the MCP configurations and returns the previous ones.
+func (c *Config) SetMCPs(mcps MCPs) MCPs {
+	mcpMu.Lock()
+	defer mcpMu.Unlock()
+	old := c.MCP
+	c.MCP = mcps
+	return old
+}
+
+// LoadMCPs reads the MCP configurations from the config files that apply to
+// the given directory, without loading the rest of the configuration.
+func LoadMCPs(workingDir string) (MCPs, error) {
+	cfg, err := loadFromConfigPaths(lookupConfigs(workingDir))
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MCP == nil {
+		cfg.MCP = make(MCPs)
+	}
+	return cfg.MCP, nil
+}
+
+// ConfigPaths returns the config files that apply to the given directory, in
+// load order. Not all of them need to exist.
+func ConfigPaths(workingDir string) []string {
+	return lookupConfigs(workingDir)
+}
+
+// SetMCP adds or replaces the MCP with the given name in the config file at
+// path.
+func SetMCP(path, name string, m MCPConfig) error {
+	return updateConfigFile(path, func(data string) (string, error) {
+		return sjson.Set(data, mcpKey(name), m)
+	})
+}
+
+// RemoveMCP removes the MCP with the given name from the config file at path.
+func RemoveMCP(path, name string) error {
+	return updateConfigFile(path, func(data string) (string, error) {
+		if !gjson.Get(data, mcpKey(name)).Exists() {
+			return "", fmt.Errorf("mcp '%s' not found in %s", name, path)
+		}
+		return sjson.Delete(data, mcpKey(name))
+	})
+}
+
+// SetMCPDisabled enables or disables the MCP with the given name in the
+// config file at path. The MCP may be defined in another of the config files
+// of workingDir, in which case only the override is written, but it has to
+// be defined in one of them.
+func SetMCPDisabled(workingDir, path, name string, disabled bool) error {
+	mcps, err := LoadMCPs(workingDir)
+	if err != nil {
+		return err
+	}
+	if _, ok := mcps[name]; !ok {
+		return fmt.Errorf("mcp '%s' not found", name)
+	}
+	return updateConfigFile(path, func(data string) (string, error) {
+		return sjson.Set(data, mcpKey(name)+".disabled", disabled)
+	})
+}
+
+func updateConfigFile(path string, fn func(data string) (string, error)) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		data = []byte("{}")
+	} else if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	newValue, err := fn(string(data))
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(newValue), 0o600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// mcpKey returns the sjson path of the given MCP, escaping the characters
+// sjson would otherwise interpret in its name.
+func mcpKey(name string) string {
+	r := strings.NewReplacer(".", `\.`, "*", `\*`, "?", `\?`, "|", `\|`, "#", `\#`, "@", `\@`)
+	return "mcp." + r.Replace(name)
+}
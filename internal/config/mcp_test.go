@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMCPConfigFile(t *testing.T) {
+	t.Parallel()
+
+	t.Run("adds, disables and removes mcps", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "crushplus.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"options":{"debug":true}}`), 0o644))
+
+		require.NoError(t, SetMCP(path, "fs", MCPConfig{Type: MCPStdio, Command: "npx", Args: []string{"-y", "fs"}}))
+		require.NoError(t, SetMCPDisabled(dir, path, "fs", true))
+		require.Error(t, SetMCPDisabled(dir, path, "typo", true))
+
+		cfg := loadConfigFile(t, path)
+		require.True(t, cfg.Options.Debug)
+		require.Equal(t, MCPConfig{Type: MCPStdio, Command: "npx", Args: []string{"-y", "fs"}, Disabled: true}, cfg.MCP["fs"])
+		require.NotContains(t, cfg.MCP, "typo")
+
+		require.NoError(t, RemoveMCP(path, "fs"))
+		require.Empty(t, loadConfigFile(t, path).MCP)
+		require.Error(t, RemoveMCP(path, "fs"))
+	})
+
+	t.Run("escapes names", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "crushplus.json")
+		require.NoError(t, SetMCP(path, "my.server", MCPConfig{Type: MCPHttp, URL: "https://example.com/mcp"}))
+
+		cfg := loadConfigFile(t, path)
+		require.Equal(t, "https://example.com/mcp", cfg.MCP["my.server"].URL)
+	})
+
+	t.Run("finds the project config", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		require.Equal(t, filepath.Join(dir, "crushplus.json"), ProjectConfig(dir))
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".crushplus.json"), []byte("{}"), 0o644))
+		require.Equal(t, filepath.Join(dir, ".crushplus.json"), ProjectConfig(dir))
+	})
+}
+
+func loadConfigFile(t *testing.T, path string) *Config {
+	t.Helper()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	cfg, err := LoadReader(f)
+	require.NoError(t, err)
+	return cfg
+}
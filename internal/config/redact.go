@@ -0,0 +1,85 @@
+package config
+
+import (
+	"log/slog"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mudaaaa/crushplus/internal/env"
+	"github.com/mudaaaa/crushplus/internal/redact"
+)
+
+// secretEnvName matches the names of environment variables that usually
+// hold secrets.
+var secretEnvName = regexp.MustCompile(`(?i)(api_?key|access_?key|private_?key|_key$|token|secret|password|passwd|credential)`)
+
+// secretHeaderName matches the names of HTTP headers that hold credentials.
+var secretHeaderName = regexp.MustCompile(`(?i)(authorization|key|token|secret|cookie)`)
+
+// Redactor returns the redactor of the secrets of this configuration and of
+// the environment, or nil when redaction is disabled.
+func (c *Config) Redactor(e env.Env) *redact.Redactor {
+	var opts Redaction
+	if c.Options != nil && c.Options.Redaction != nil {
+		opts = *c.Options.Redaction
+	}
+	if opts.Disabled {
+		return nil
+	}
+
+	var secrets []redact.Secret
+	for _, kv := range e.Env() {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || (!secretEnvName.MatchString(name) && !slices.Contains(opts.EnvVars, name)) {
+			continue
+		}
+		secrets = append(secrets, redact.Secret{Name: name, Value: value})
+	}
+
+	resolver := c.resolver
+	if resolver == nil {
+		resolver = NewShellVariableResolver(e)
+	}
+	if c.Providers != nil {
+		for provider := range c.Providers.Seq() {
+			if provider.APIKey == "" {
+				continue
+			}
+			apiKey, err := resolver.ResolveValue(provider.APIKey)
+			if err != nil {
+				continue
+			}
+			secrets = append(secrets, redact.Secret{Name: provider.ID + " API key", Value: apiKey})
+		}
+	}
+	for name, mcp := range c.MCPs() {
+		for header, value := range mcp.Headers {
+			if !secretHeaderName.MatchString(header) {
+				continue
+			}
+			resolved, err := resolver.ResolveValue(value)
+			if err != nil {
+				continue
+			}
+			// Only the credentials of "Bearer <token>" and the like.
+			if _, credentials, ok := strings.Cut(resolved, " "); ok {
+				resolved = credentials
+			}
+			secrets = append(secrets, redact.Secret{Name: name + " " + header, Value: resolved})
+		}
+	}
+
+	patterns := slices.Clone(redact.DefaultPatterns)
+	for _, name := range slices.Sorted(maps.Keys(opts.Patterns)) {
+		expr := opts.Patterns[name]
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			slog.Warn("Invalid redaction pattern", "name", name, "pattern", expr, "error", err)
+			continue
+		}
+		patterns = append(patterns, redact.Pattern{Name: name, Regexp: re})
+	}
+	return redact.New(secrets, patterns)
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/mudaaaa/crushplus/internal/csync"
+	"github.com/mudaaaa/crushplus/internal/env"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_Redactor(t *testing.T) {
+	t.Parallel()
+
+	e := env.NewFromMap(map[string]string{
+		"OPENAI_API_KEY": "sk-openai-0123456789",
+		"GITHUB_TOKEN":   "github-token-value",
+		"DATABASE_URL":   "postgres://user:pass@db/app",
+		"HOME":           "/home/crushplus",
+	})
+	cfg := &Config{
+		Options: &Options{
+			Redaction: &Redaction{
+				EnvVars:  []string{"DATABASE_URL"},
+				Patterns: map[string]string{"internal token": `itk_[a-z0-9]{8}`, "invalid": `(`},
+			},
+		},
+		Providers: csync.NewMapFrom(map[string]ProviderConfig{
+			"custom": {ID: "custom", APIKey: "custom-provider-key"},
+			"openai": {ID: "openai", APIKey: "$OPENAI_API_KEY"},
+		}),
+		MCP: MCPs{
+			"remote": {Headers: map[string]string{
+				"Authorization": "Bearer remote-mcp-token",
+				"Content-Type":  "application/json",
+			}},
+		},
+	}
+	cfg.resolver = NewShellVariableResolver(e)
+
+	r := cfg.Redactor(e)
+	output, _ := r.Redact("sk-openai-0123456789 github-token-value postgres://user:pass@db/app custom-provider-key remote-mcp-token application/json /home/crushplus itk_abcd1234")
+	require.Equal(t, "[REDACTED:OPENAI_API_KEY] [REDACTED:GITHUB_TOKEN] [REDACTED:DATABASE_URL] [REDACTED:custom API key] [REDACTED:remote Authorization] application/json /home/crushplus [REDACTED:internal token]", output)
+
+	cfg.Options.Redaction.Disabled = true
+	require.Nil(t, cfg.Redactor(e))
+}
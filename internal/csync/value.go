@@ -0,0 +1,28 @@
+package csync
+
+import "sync"
+
+// Value is a thread-safe value that can be replaced while it's being read.
+type Value[T any] struct {
+	inner T
+	mu    sync.RWMutex
+}
+
+// NewValue creates a new thread-safe value holding v.
+func NewValue[T any](v T) *Value[T] {
+	return &Value[T]{inner: v}
+}
+
+// Get returns the value.
+func (v *Value[T]) Get() T {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return v.inner
+}
+
+// Set replaces the value.
+func (v *Value[T]) Set(value T) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.inner = value
+}
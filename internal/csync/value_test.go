@@ -0,0 +1,25 @@
+package csync
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValue(t *testing.T) {
+	t.Parallel()
+
+	v := NewValue("a")
+	require.Equal(t, "a", v.Get())
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			v.Set("b")
+			require.Equal(t, "b", v.Get())
+		})
+	}
+	wg.Wait()
+	require.Equal(t, "b", v.Get())
+}
@@ -278,3 +278,34 @@ func (q *Queries) ListNewFiles(ctx context.Context) ([]File, error) {
 	}
 	return items, nil
 }
+
+const listRecentFilePaths = `-- name: ListRecentFilePaths :many
+SELECT path
+FROM files
+GROUP BY path
+ORDER BY MAX(created_at) DESC, MAX(version) DESC
+LIMIT ?
+`
+
+func (q *Queries) ListRecentFilePaths(ctx context.Context, limit int64) ([]string, error) {
+	rows, err := q.query(ctx, q.listRecentFilePathsStmt, listRecentFilePaths, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		items = append(items, path)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE sessions ADD COLUMN task_tokens INTEGER DEFAULT 0 NOT NULL;
+
+-- +goose Down
+ALTER TABLE sessions DROP COLUMN task_tokens;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS shell_states (
+    session_id TEXT PRIMARY KEY,
+    working_dir TEXT NOT NULL,
+    env TEXT NOT NULL DEFAULT '{}',  -- JSON object of the variables changed from the environment, null when unset
+    funcs TEXT NOT NULL DEFAULT '',  -- Shell source of the function definitions
+    updated_at INTEGER NOT NULL,  -- Unix timestamp in milliseconds
+    FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS shell_states;
+-- +goose StatementEnd
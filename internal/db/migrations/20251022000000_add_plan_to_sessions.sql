@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE sessions ADD COLUMN plan TEXT DEFAULT '' NOT NULL;
+
+-- +goose Down
+ALTER TABLE sessions DROP COLUMN plan;
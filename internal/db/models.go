@@ -42,4 +42,24 @@ type Session struct {
 	UpdatedAt        int64          `json:"updated_at"`
 	CreatedAt        int64          `json:"created_at"`
 	SummaryMessageID sql.NullString `json:"summary_message_id"`
+	TaskTokens       int64          `json:"task_tokens"`
+	Plan             string         `json:"plan"`
+}
+
+type ShellState struct {
+	SessionID  string `json:"session_id"`
+	WorkingDir string `json:"working_dir"`
+	Env        string `json:"env"`
+	Funcs      string `json:"funcs"`
+	UpdatedAt  int64  `json:"updated_at"`
+}
+
+type Todo struct {
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	Position  int64  `json:"position"`
+	Content   string `json:"content"`
+	Status    string `json:"status"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
 }
@@ -33,7 +33,7 @@ INSERT INTO sessions (
     null,
     strftime('%s', 'now'),
     strftime('%s', 'now')
-) RETURNING id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id
+) RETURNING id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id, task_tokens, plan
 `
 
 type CreateSessionParams struct {
@@ -68,6 +68,8 @@ func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (S
 		&i.UpdatedAt,
 		&i.CreatedAt,
 		&i.SummaryMessageID,
+		&i.TaskTokens,
+		&i.Plan,
 	)
 	return i, err
 }
@@ -83,7 +85,7 @@ func (q *Queries) DeleteSession(ctx context.Context, id string) error {
 }
 
 const getSessionByID = `-- name: GetSessionByID :one
-SELECT id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id
+SELECT id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id, task_tokens, plan
 FROM sessions
 WHERE id = ? LIMIT 1
 `
@@ -102,12 +104,14 @@ func (q *Queries) GetSessionByID(ctx context.Context, id string) (Session, error
 		&i.UpdatedAt,
 		&i.CreatedAt,
 		&i.SummaryMessageID,
+		&i.TaskTokens,
+		&i.Plan,
 	)
 	return i, err
 }
 
 const listSessions = `-- name: ListSessions :many
-SELECT id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id
+SELECT id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id, task_tokens, plan
 FROM sessions
 WHERE parent_session_id is NULL
 ORDER BY created_at DESC
@@ -133,6 +137,8 @@ func (q *Queries) ListSessions(ctx context.Context) ([]Session, error) {
 			&i.UpdatedAt,
 			&i.CreatedAt,
 			&i.SummaryMessageID,
+			&i.TaskTokens,
+			&i.Plan,
 		); err != nil {
 			return nil, err
 		}
@@ -154,9 +160,10 @@ SET
     prompt_tokens = ?,
     completion_tokens = ?,
     summary_message_id = ?,
-    cost = ?
+    cost = ?,
+    task_tokens = ?
 WHERE id = ?
-RETURNING id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id
+RETURNING id, parent_session_id, title, message_count, prompt_tokens, completion_tokens, cost, updated_at, created_at, summary_message_id, task_tokens, plan
 `
 
 type UpdateSessionParams struct {
@@ -165,6 +172,7 @@ type UpdateSessionParams struct {
 	CompletionTokens int64          `json:"completion_tokens"`
 	SummaryMessageID sql.NullString `json:"summary_message_id"`
 	Cost             float64        `json:"cost"`
+	TaskTokens       int64          `json:"task_tokens"`
 	ID               string         `json:"id"`
 }
 
@@ -175,6 +183,7 @@ func (q *Queries) UpdateSession(ctx context.Context, arg UpdateSessionParams) (S
 		arg.CompletionTokens,
 		arg.SummaryMessageID,
 		arg.Cost,
+		arg.TaskTokens,
 		arg.ID,
 	)
 	var i Session
@@ -189,6 +198,24 @@ func (q *Queries) UpdateSession(ctx context.Context, arg UpdateSessionParams) (S
 		&i.UpdatedAt,
 		&i.CreatedAt,
 		&i.SummaryMessageID,
+		&i.TaskTokens,
+		&i.Plan,
 	)
 	return i, err
 }
+
+const updateSessionPlan = `-- name: UpdateSessionPlan :exec
+UPDATE sessions
+SET plan = ?
+WHERE id = ?
+`
+
+type UpdateSessionPlanParams struct {
+	Plan string `json:"plan"`
+	ID   string `json:"id"`
+}
+
+func (q *Queries) UpdateSessionPlan(ctx context.Context, arg UpdateSessionPlanParams) error {
+	_, err := q.exec(ctx, q.updateSessionPlanStmt, updateSessionPlan, arg.Plan, arg.ID)
+	return err
+}
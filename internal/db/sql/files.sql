@@ -60,3 +60,10 @@ SELECT *
 FROM files
 WHERE is_new = 1
 ORDER BY version DESC, created_at DESC;
+
+-- name: ListRecentFilePaths :many
+SELECT path
+FROM files
+GROUP BY path
+ORDER BY MAX(created_at) DESC, MAX(version) DESC
+LIMIT ?;
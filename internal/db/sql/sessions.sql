@@ -41,10 +41,16 @@ SET
     prompt_tokens = ?,
     completion_tokens = ?,
     summary_message_id = ?,
-    cost = ?
+    cost = ?,
+    task_tokens = ?
 WHERE id = ?
 RETURNING *;
 
+-- name: UpdateSessionPlan :exec
+UPDATE sessions
+SET plan = ?
+WHERE id = ?;
+
 
 -- name: DeleteSession :exec
 DELETE FROM sessions
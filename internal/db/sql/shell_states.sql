@@ -0,0 +1,20 @@
+-- name: GetShellState :one
+SELECT *
+FROM shell_states
+WHERE session_id = ? LIMIT 1;
+
+-- name: UpsertShellState :exec
+INSERT INTO shell_states (
+    session_id,
+    working_dir,
+    env,
+    funcs,
+    updated_at
+) VALUES (
+    ?, ?, ?, ?, strftime('%s', 'now')
+)
+ON CONFLICT (session_id) DO UPDATE SET
+    working_dir = excluded.working_dir,
+    env = excluded.env,
+    funcs = excluded.funcs,
+    updated_at = excluded.updated_at;
@@ -0,0 +1,47 @@
+// Package gitcmd runs git commands for the tools and the worktrees of the
+// agents.
+package gitcmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrNotRepository is returned when the directory isn't in a git repository.
+var ErrNotRepository = errors.New("not inside a git repository")
+
+// Run runs git in dir, with stdin as its input when it isn't empty, and
+// returns its output without the trailing newline. Errors carry what git
+// printed.
+func Run(ctx context.Context, dir, stdin string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	if err := cmd.Run(); err != nil {
+		// Hooks may print their errors to either output.
+		msg := strings.TrimSpace(strings.TrimSpace(stderr.String()) + "\n" + strings.TrimSpace(stdout.String()))
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
+
+// CheckRepository returns ErrNotRepository when dir isn't inside the working
+// tree of a git repository.
+func CheckRepository(ctx context.Context, dir string) error {
+	if out, err := Run(ctx, dir, "", "rev-parse", "--is-inside-work-tree"); err != nil || out != "true" {
+		return ErrNotRepository
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package gitcmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.ErrorIs(t, CheckRepository(t.Context(), dir), ErrNotRepository)
+
+	_, err := Run(t.Context(), dir, "", "init", "--quiet")
+	require.NoError(t, err)
+	require.NoError(t, CheckRepository(t.Context(), dir))
+
+	out, err := Run(t.Context(), dir, "hello\n", "hash-object", "--stdin")
+	require.NoError(t, err)
+	require.Equal(t, "ce013625030ba8dba906f756967f9e9ca394464a", out)
+
+	_, err = Run(t.Context(), dir, "", "rev-parse", "--verify", "missing")
+	require.ErrorContains(t, err, "git rev-parse: fatal:")
+}
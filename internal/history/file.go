@@ -33,6 +33,9 @@ type Service interface {
 	GetByPathAndSession(ctx context.Context, path, sessionID string) (File, error)
 	ListBySession(ctx context.Context, sessionID string) ([]File, error)
 	ListLatestSessionFiles(ctx context.Context, sessionID string) ([]File, error)
+	// ListRecentPaths returns the paths of the files changed most recently,
+	// in any session, the latest first.
+	ListRecentPaths(ctx context.Context, limit int) ([]string, error)
 	Delete(ctx context.Context, id string) error
 	DeleteSessionFiles(ctx context.Context, sessionID string) error
 }
@@ -170,6 +173,10 @@ func (s *service) ListLatestSessionFiles(ctx context.Context, sessionID string)
 	return files, nil
 }
 
+func (s *service) ListRecentPaths(ctx context.Context, limit int) ([]string, error) {
+	return s.q.ListRecentFilePaths(ctx, int64(limit))
+}
+
 func (s *service) Delete(ctx context.Context, id string) error {
 	file, err := s.Get(ctx, id)
 	if err != nil {
@@ -0,0 +1,355 @@
+// Package httpcache caches HTTP responses on disk for the tools that fetch
+// web pages, so that fetching the same documentation again doesn't hit the
+// network. It honors Cache-Control, Expires and Age, and revalidates stale
+// responses with their ETag or Last-Modified.
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Header is set on the responses to tell whether they came from the
+	// cache.
+	Header = "X-Crush-Cache"
+	// Hit is the value of Header for a fresh response from the cache.
+	Hit = "hit"
+	// Revalidated is the value of Header for a stale response from the cache
+	// the server confirmed is still current.
+	Revalidated = "revalidated"
+
+	// version is bumped when the format of the entries changes, to ignore
+	// the old ones.
+	version = 1
+	// maxEntryAge is how long entries are kept after they were last stored.
+	maxEntryAge = 7 * 24 * time.Hour
+)
+
+type entry struct {
+	Version    int
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Stored is when the response was received or last revalidated.
+	Stored time.Time
+	// Vary holds the values of the request headers the response varies on.
+	Vary map[string]string
+}
+
+// Transport is an http.RoundTripper that caches the successful responses to
+// GET requests in a directory.
+type Transport struct {
+	dir     string
+	next    http.RoundTripper
+	maxSize int64
+	now     func() time.Time
+
+	pruneOnce sync.Once
+}
+
+// New returns a transport caching in dir the responses of next whose bodies
+// are maxSize bytes at most.
+func New(dir string, next http.RoundTripper, maxSize int64) *Transport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &Transport{dir: dir, next: next, maxSize: maxSize, now: time.Now}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !cacheableRequest(req) {
+		return t.next.RoundTrip(req)
+	}
+	t.pruneOnce.Do(func() { go t.prune() })
+
+	key := cacheKey(req.URL.String())
+	cached := t.load(key)
+	if cached != nil && !cached.matches(req) {
+		cached = nil
+	}
+	if cached != nil && !hasDirective(req.Header, "no-cache") && cached.fresh(t.now()) {
+		return cached.response(req, Hit), nil
+	}
+
+	outReq := req
+	if cached != nil {
+		etag, lastModified := cached.Header.Get("ETag"), cached.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			outReq = req.Clone(req.Context())
+			if etag != "" {
+				outReq.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				outReq.Header.Set("If-Modified-Since", lastModified)
+			}
+		}
+	}
+	resp, err := t.next.RoundTrip(outReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		for name, values := range resp.Header {
+			cached.Header[name] = values
+		}
+		cached.Stored = t.now()
+		t.save(key, cached)
+		return cached.response(req, Revalidated), nil
+	}
+	if !t.storable(resp) {
+		if cached != nil {
+			t.remove(key)
+		}
+		return resp, nil
+	}
+
+	e := &entry{
+		Version:    version,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Stored:     t.now(),
+		Vary:       make(map[string]string),
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		e.Vary[name] = req.Header.Get(name)
+	}
+	resp.Body = &cachingBody{ReadCloser: resp.Body, max: t.maxSize, done: func(body []byte) {
+		e.Body = body
+		t.save(key, e)
+	}}
+	return resp, nil
+}
+
+func cacheableRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+	for _, name := range []string{"Range", "Authorization", "If-None-Match", "If-Modified-Since"} {
+		if req.Header.Get(name) != "" {
+			return false
+		}
+	}
+	return !hasDirective(req.Header, "no-store")
+}
+
+// storable reports whether the response can be cached and reused: it's
+// successful, small enough, allowed to be stored, and can be either fresh
+// for a while or revalidated.
+func (t *Transport) storable(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK || hasDirective(resp.Header, "no-store") {
+		return false
+	}
+	if resp.ContentLength > t.maxSize {
+		return false
+	}
+	for _, name := range varyHeaders(resp.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+	if resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "" {
+		return true
+	}
+	return lifetime(resp.Header) > 0
+}
+
+func (e *entry) matches(req *http.Request) bool {
+	for name, value := range e.Vary {
+		if req.Header.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// fresh reports whether the entry can be used without asking the server.
+func (e *entry) fresh(now time.Time) bool {
+	if hasDirective(e.Header, "no-cache") {
+		return false
+	}
+	age := now.Sub(e.Stored)
+	if seconds, err := strconv.Atoi(e.Header.Get("Age")); err == nil && seconds > 0 {
+		age += time.Duration(seconds) * time.Second
+	}
+	return age < lifetime(e.Header)
+}
+
+func (e *entry) response(req *http.Request, status string) *http.Response {
+	header := e.Header.Clone()
+	header.Set(Header, status)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// lifetime is how long a response stays fresh after it was received: its
+// max-age, or else the time between its Date and its Expires.
+func lifetime(header http.Header) time.Duration {
+	if value, ok := directive(header, "max-age"); ok {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		return 0
+	}
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return 0
+	}
+	return expires.Sub(date)
+}
+
+// directive returns the value of a directive of the Cache-Control header.
+func directive(header http.Header, name string) (string, bool) {
+	for _, value := range header.Values("Cache-Control") {
+		for part := range strings.SplitSeq(value, ",") {
+			key, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if strings.EqualFold(key, name) {
+				return strings.Trim(val, `"`), true
+			}
+		}
+	}
+	return "", false
+}
+
+func hasDirective(header http.Header, name string) bool {
+	_, ok := directive(header, name)
+	return ok || (name == "no-cache" && strings.EqualFold(header.Get("Pragma"), "no-cache"))
+}
+
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for name := range strings.SplitSeq(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+func cacheKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *Transport) path(key string) string {
+	return filepath.Join(t.dir, key+".gob")
+}
+
+func (t *Transport) load(key string) *entry {
+	data, err := os.ReadFile(t.path(key))
+	if err != nil {
+		return nil
+	}
+	var e entry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&e); err != nil || e.Version != version {
+		return nil
+	}
+	return &e
+}
+
+func (t *Transport) save(key string, e *entry) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		slog.Warn("Failed to encode cached response", "url", e.URL, "error", err)
+		return
+	}
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		slog.Warn("Failed to create HTTP cache directory", "error", err)
+		return
+	}
+	tmp, err := os.CreateTemp(t.dir, key+".*.tmp")
+	if err != nil {
+		slog.Warn("Failed to cache response", "url", e.URL, "error", err)
+		return
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), t.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		slog.Warn("Failed to cache response", "url", e.URL, "error", err)
+	}
+}
+
+func (t *Transport) remove(key string) {
+	os.Remove(t.path(key))
+}
+
+// prune removes the entries that weren't stored for a week, for the cache to
+// not grow forever.
+func (t *Transport) prune() {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err == nil && time.Since(info.ModTime()) > maxEntryAge {
+			os.Remove(filepath.Join(t.dir, e.Name()))
+		}
+	}
+}
+
+// cachingBody passes the body of a response through, and stores it when
+// it's read to the end without going over the maximum size.
+type cachingBody struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	max      int64
+	overflow bool
+	done     func([]byte)
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.overflow {
+		if int64(b.buf.Len()+n) > b.max {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !b.overflow && b.done != nil {
+		b.done(b.buf.Bytes())
+		b.done = nil
+	}
+	return n, err
+}
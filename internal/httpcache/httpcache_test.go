@@ -0,0 +1,142 @@
+package httpcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, client *http.Client, url string, header ...string) (string, string) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, url, nil)
+	require.NoError(t, err)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body), resp.Header.Get(Header)
+}
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "max-age=60")
+			io.WriteString(w, "fresh")
+		case "/etag":
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Cache-Control", "no-cache")
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			io.WriteString(w, "tagged")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store, max-age=60")
+			io.WriteString(w, "secret")
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept")
+			io.WriteString(w, "vary "+r.Header.Get("Accept"))
+		case "/large":
+			w.Header().Set("Cache-Control", "max-age=60")
+			io.WriteString(w, strings.Repeat("x", 100))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	transport := New(t.TempDir(), nil, 50)
+	now := time.Now()
+	transport.now = func() time.Time { return now }
+	client := &http.Client{Transport: transport}
+
+	t.Run("fresh responses are served from the cache", func(t *testing.T) {
+		hits.Store(0)
+		body, status := get(t, client, server.URL+"/fresh")
+		require.Equal(t, "fresh", body)
+		require.Empty(t, status)
+		body, status = get(t, client, server.URL+"/fresh")
+		require.Equal(t, "fresh", body)
+		require.Equal(t, Hit, status)
+		require.EqualValues(t, 1, hits.Load())
+
+		// Requests asking for no cache go to the server.
+		_, status = get(t, client, server.URL+"/fresh", "Cache-Control", "no-cache")
+		require.Empty(t, status)
+		require.EqualValues(t, 2, hits.Load())
+	})
+
+	t.Run("stale responses are revalidated", func(t *testing.T) {
+		hits.Store(0)
+		body, _ := get(t, client, server.URL+"/etag")
+		require.Equal(t, "tagged", body)
+		body, status := get(t, client, server.URL+"/etag")
+		require.Equal(t, "tagged", body)
+		require.Equal(t, Revalidated, status)
+		require.EqualValues(t, 2, hits.Load())
+	})
+
+	t.Run("no-store and large responses aren't cached", func(t *testing.T) {
+		hits.Store(0)
+		get(t, client, server.URL+"/no-store")
+		body, status := get(t, client, server.URL+"/no-store")
+		require.Equal(t, "secret", body)
+		require.Empty(t, status)
+
+		get(t, client, server.URL+"/large")
+		body, status = get(t, client, server.URL+"/large")
+		require.Len(t, body, 100)
+		require.Empty(t, status)
+		require.EqualValues(t, 4, hits.Load())
+	})
+
+	t.Run("responses vary on the request headers", func(t *testing.T) {
+		body, _ := get(t, client, server.URL+"/vary", "Accept", "text/html")
+		require.Equal(t, "vary text/html", body)
+		body, status := get(t, client, server.URL+"/vary", "Accept", "application/json")
+		require.Equal(t, "vary application/json", body)
+		require.Empty(t, status)
+	})
+
+	t.Run("responses expire", func(t *testing.T) {
+		hits.Store(0)
+		get(t, client, server.URL+"/fresh", "Cache-Control", "no-cache")
+		now = now.Add(2 * time.Minute)
+		_, status := get(t, client, server.URL+"/fresh")
+		require.Empty(t, status)
+		require.EqualValues(t, 2, hits.Load())
+	})
+}
+
+func TestLifetime(t *testing.T) {
+	t.Parallel()
+
+	header := http.Header{}
+	require.Zero(t, lifetime(header))
+
+	header.Set("Date", "Mon, 02 Jan 2006 15:04:05 GMT")
+	header.Set("Expires", "Mon, 02 Jan 2006 16:04:05 GMT")
+	require.Equal(t, time.Hour, lifetime(header))
+
+	header.Set("Cache-Control", `public, max-age="30"`)
+	require.Equal(t, 30*time.Second, lifetime(header))
+
+	header.Set("Cache-Control", "max-age=invalid")
+	require.Zero(t, lifetime(header))
+}
@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/mudaaaa/crushplus/internal/redact"
 )
 
 // NewHTTPClient creates an HTTP client with debug logging enabled when debug mode is on.
@@ -33,7 +35,7 @@ func (h *HTTPRoundTripLogger) RoundTrip(req *http.Request) (*http.Response, erro
 		slog.Error(
 			"HTTP request failed",
 			"method", req.Method,
-			"url", req.URL,
+			"url", redact.String(req.URL.String()),
 			"error", err,
 		)
 		return nil, err
@@ -43,8 +45,8 @@ func (h *HTTPRoundTripLogger) RoundTrip(req *http.Request) (*http.Response, erro
 		slog.Debug(
 			"HTTP Request",
 			"method", req.Method,
-			"url", req.URL,
-			"body", bodyToString(save),
+			"url", redact.String(req.URL.String()),
+			"body", redact.String(bodyToString(save)),
 		)
 	}
 
@@ -55,7 +57,7 @@ func (h *HTTPRoundTripLogger) RoundTrip(req *http.Request) (*http.Response, erro
 		slog.Error(
 			"HTTP request failed",
 			"method", req.Method,
-			"url", req.URL,
+			"url", redact.String(req.URL.String()),
 			"duration_ms", duration.Milliseconds(),
 			"error", err,
 		)
@@ -69,7 +71,7 @@ func (h *HTTPRoundTripLogger) RoundTrip(req *http.Request) (*http.Response, erro
 			"status_code", resp.StatusCode,
 			"status", resp.Status,
 			"headers", formatHeaders(resp.Header),
-			"body", bodyToString(save),
+			"body", redact.String(bodyToString(save)),
 			"content_length", resp.ContentLength,
 			"duration_ms", duration.Milliseconds(),
 			"error", err,
@@ -445,6 +445,35 @@ func (c *Client) WaitForDiagnostics(ctx context.Context, d time.Duration) {
 	}
 }
 
+// WaitForDiagnosticsSettled waits until diagnostics change and then stay
+// unchanged for the quiet period, or until the timeout is reached. Servers
+// often publish diagnostics in several batches after a change, so this gives
+// a more stable picture than [Client.WaitForDiagnostics].
+func (c *Client) WaitForDiagnosticsSettled(ctx context.Context, quiet, d time.Duration) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(d)
+	pv := c.diagnostics.Version()
+	var lastChange time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout:
+			return
+		case now := <-ticker.C:
+			if v := c.diagnostics.Version(); v != pv {
+				pv = v
+				lastChange = now
+				continue
+			}
+			if !lastChange.IsZero() && now.Sub(lastChange) >= quiet {
+				return
+			}
+		}
+	}
+}
+
 // FindReferences finds all references to the symbol at the given position.
 func (c *Client) FindReferences(ctx context.Context, filepath string, line, character int, includeDeclaration bool) ([]protocol.Location, error) {
 	if err := c.OpenFileOnDemand(ctx, filepath); err != nil {
@@ -0,0 +1,328 @@
+// Package mcpserver exposes crushplus's built-in tools, and optionally its
+// coder agent, to other agents and editors over the Model Context Protocol.
+package mcpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"charm.land/fantasy"
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/mudaaaa/crushplus/internal/agent"
+	"github.com/mudaaaa/crushplus/internal/agent/tools"
+	"github.com/mudaaaa/crushplus/internal/app"
+	"github.com/mudaaaa/crushplus/internal/csync"
+	"github.com/mudaaaa/crushplus/internal/permission"
+	"github.com/mudaaaa/crushplus/internal/session"
+	"github.com/mudaaaa/crushplus/internal/version"
+)
+
+// AgentToolName is the name of the tool that runs a task with the coder
+// agent.
+const AgentToolName = "agent"
+
+type Options struct {
+	// Agent exposes the coder agent as a tool.
+	Agent bool
+}
+
+// Server serves the built-in tools of an app over MCP. Each MCP client gets
+// its own session, so file edits are versioned in the history like the ones
+// made from the TUI, and permission requests are forwarded to the client
+// through elicitation.
+type Server struct {
+	sessions    session.Service
+	permissions permission.Service
+	coordinator agent.Coordinator
+	server      *mcp.Server
+
+	clientSessionsMu sync.Mutex
+	// clientSessions maps MCP clients to the session of their calls.
+	clientSessions map[*mcp.ServerSession]string
+	// clients maps sessions, including the task sessions of the agent tool,
+	// back to their MCP client.
+	clients *csync.Map[string, *mcp.ServerSession]
+}
+
+func New(app *app.App, opts Options) *Server {
+	s := newServer(app.Sessions, app.Permissions, app.AgentCoordinator)
+	s.addTools(s.tools(app, opts)...)
+	return s
+}
+
+func newServer(sessions session.Service, permissions permission.Service, coordinator agent.Coordinator) *Server {
+	return &Server{
+		sessions:    sessions,
+		permissions: permissions,
+		coordinator: coordinator,
+		server: mcp.NewServer(&mcp.Implementation{
+			Name:    "crushplus",
+			Version: version.Version,
+		}, nil),
+		clientSessions: make(map[*mcp.ServerSession]string),
+		clients:        csync.NewMap[string, *mcp.ServerSession](),
+	}
+}
+
+func (s *Server) addTools(agentTools ...fantasy.AgentTool) {
+	for _, tool := range agentTools {
+		info := tool.Info()
+		// Strict JSON Schema validators reject a null list of required
+		// properties.
+		required := info.Required
+		if required == nil {
+			required = []string{}
+		}
+		s.server.AddTool(&mcp.Tool{
+			Name:        info.Name,
+			Description: info.Description,
+			InputSchema: map[string]any{
+				"type":       "object",
+				"properties": info.Parameters,
+				"required":   required,
+			},
+		}, s.handler(tool))
+	}
+}
+
+func (s *Server) tools(app *app.App, opts Options) []fantasy.AgentTool {
+	cfg := app.Config()
+	cwd := cfg.WorkingDir()
+
+	allTools := []fantasy.AgentTool{
+		tools.NewViewTool(app.LSPClients, app.Permissions, cwd),
+		tools.NewGrepTool(cwd),
+		tools.NewGlobTool(cwd),
+		tools.NewCodeSearchTool(app.CodeIndex, cwd),
+		tools.NewEditTool(app.LSPClients, app.Permissions, app.History, cwd),
+		tools.NewMultiEditTool(app.LSPClients, app.Permissions, app.History, cwd),
+	}
+	if len(cfg.LSP) > 0 {
+		allTools = append(allTools, tools.NewDiagnosticsTool(app.LSPClients), tools.NewReferencesTool(app.LSPClients))
+	}
+	if opts.Agent && cfg.IsConfigured() {
+		allTools = append(allTools, s.agentTool())
+	}
+
+	return tools.WithResultLimits(allTools, app.Redactor, cfg.Tools.Output, cfg.Options.DataDirectory)
+}
+
+// ServeStdio serves a single client over stdin and stdout.
+func (s *Server) ServeStdio(ctx context.Context) error {
+	s.forwardPermissions(ctx)
+	return s.server.Run(ctx, &mcp.StdioTransport{})
+}
+
+// ServeHTTP serves clients over the streamable HTTP transport on addr.
+func (s *Server) ServeHTTP(ctx context.Context, addr string) error {
+	s.forwardPermissions(ctx)
+
+	srv := &http.Server{
+		Addr: addr,
+		Handler: mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server {
+			return s.server
+		}, nil),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("Serving MCP over HTTP", "addr", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (s *Server) handler(tool fantasy.AgentTool) mcp.ToolHandler {
+	return func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		sessionID, err := s.session(ctx, req.Session)
+		if err != nil {
+			return nil, err
+		}
+		ctx = context.WithValue(ctx, tools.SessionIDContextKey, sessionID)
+
+		input := string(req.Params.Arguments)
+		if input == "" {
+			input = "{}"
+		}
+		resp, err := tool.Run(ctx, fantasy.ToolCall{
+			ID:    uuid.NewString(),
+			Name:  req.Params.Name,
+			Input: input,
+		})
+		if err != nil {
+			if errors.Is(err, permission.ErrorPermissionDenied) {
+				resp = fantasy.NewTextErrorResponse("permission denied")
+			} else {
+				resp = fantasy.NewTextErrorResponse(err.Error())
+			}
+		}
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{&mcp.TextContent{Text: resp.Content}},
+			IsError: resp.IsError,
+		}, nil
+	}
+}
+
+// session returns the session of the calls of the given client, creating it
+// on its first call.
+func (s *Server) session(ctx context.Context, ss *mcp.ServerSession) (string, error) {
+	s.clientSessionsMu.Lock()
+	defer s.clientSessionsMu.Unlock()
+
+	if id, ok := s.clientSessions[ss]; ok {
+		return id, nil
+	}
+
+	title := "MCP client"
+	if params := ss.InitializeParams(); params != nil && params.ClientInfo != nil && params.ClientInfo.Name != "" {
+		title = "MCP: " + params.ClientInfo.Name
+	}
+	sess, err := s.sessions.Create(ctx, title)
+	if err != nil {
+		return "", fmt.Errorf("failed to create session: %w", err)
+	}
+	slog.Info("Created session for MCP client", "session_id", sess.ID, "title", title)
+
+	s.clientSessions[ss] = sess.ID
+	s.clients.Set(sess.ID, ss)
+	go func() {
+		_ = ss.Wait()
+		s.clientSessionsMu.Lock()
+		delete(s.clientSessions, ss)
+		s.clientSessionsMu.Unlock()
+		for id, client := range s.clients.Seq2() {
+			if client == ss {
+				s.clients.Del(id)
+			}
+		}
+	}()
+	return sess.ID, nil
+}
+
+type agentParams struct {
+	Prompt string `json:"prompt" description:"The task for the agent to perform"`
+}
+
+const agentDescription = `Runs a task with the crushplus coding agent, which can read, search and edit files in the project, run commands and use the language servers.
+The agent works autonomously and returns a single message with its result, so describe the task and the answer you expect in detail.`
+
+func (s *Server) agentTool() fantasy.AgentTool {
+	return fantasy.NewAgentTool(
+		AgentToolName,
+		agentDescription,
+		func(ctx context.Context, params agentParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			if params.Prompt == "" {
+				return fantasy.NewTextErrorResponse("prompt is required"), nil
+			}
+
+			sessionID := tools.GetSessionFromContext(ctx)
+			task, err := s.sessions.CreateTaskSession(ctx, call.ID, sessionID, "New Agent Session")
+			if err != nil {
+				return fantasy.ToolResponse{}, fmt.Errorf("error creating session: %s", err)
+			}
+			if client, ok := s.clients.Get(sessionID); ok {
+				s.clients.Set(task.ID, client)
+				defer s.clients.Del(task.ID)
+			}
+
+			// The usage of the task is rolled up to the client's session
+			// step by step, along with the tokens, as for the task tool.
+			result, err := s.coordinator.Run(agent.WithSessionUsage(ctx, s.sessions, sessionID), task.ID, params.Prompt)
+			if err != nil {
+				return fantasy.NewTextErrorResponse(fmt.Sprintf("error running agent: %s", err)), nil
+			}
+			return fantasy.NewTextResponse(result.Response.Content.Text()), nil
+		})
+}
+
+// Permission decisions offered to MCP clients.
+const (
+	decisionAllow        = "allow"
+	decisionAllowSession = "allow_session"
+	decisionDeny         = "deny"
+)
+
+// forwardPermissions answers the permission requests of tool calls by asking
+// the MCP client that made them. Requests are denied when the client can't
+// ask its user. It subscribes before returning, so no request is missed.
+func (s *Server) forwardPermissions(ctx context.Context) {
+	events := s.permissions.Subscribe(ctx)
+	go func() {
+		for event := range events {
+			go s.askPermission(ctx, event.Payload)
+		}
+	}()
+}
+
+func (s *Server) askPermission(ctx context.Context, req permission.PermissionRequest) {
+	client, ok := s.clients.Get(req.SessionID)
+	if !ok || !canElicit(client) {
+		slog.Warn("Denied permission request, MCP client can't elicit", "tool", req.ToolName, "path", req.Path)
+		s.permissions.Deny(req)
+		return
+	}
+
+	result, err := client.Elicit(ctx, &mcp.ElicitParams{
+		Message: permissionMessage(req),
+		RequestedSchema: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"decision": map[string]any{
+					"type":      "string",
+					"title":     "Decision",
+					"enum":      []string{decisionAllow, decisionAllowSession, decisionDeny},
+					"enumNames": []string{"Allow", "Allow for session", "Deny"},
+				},
+			},
+			"required": []string{"decision"},
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to ask MCP client for permission", "error", err)
+		s.permissions.Deny(req)
+		return
+	}
+
+	decision, _ := result.Content["decision"].(string)
+	switch {
+	case result.Action != "accept":
+		s.permissions.Deny(req)
+	case decision == decisionAllow:
+		s.permissions.Grant(req)
+	case decision == decisionAllowSession:
+		s.permissions.GrantPersistent(req)
+	default:
+		s.permissions.Deny(req)
+	}
+}
+
+func canElicit(client *mcp.ServerSession) bool {
+	params := client.InitializeParams()
+	return params != nil && params.Capabilities != nil && params.Capabilities.Elicitation != nil
+}
+
+func permissionMessage(req permission.PermissionRequest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "crushplus wants to use the %s tool", req.ToolName)
+	if req.Path != "" {
+		fmt.Fprintf(&b, " on %s", req.Path)
+	}
+	b.WriteString(".")
+	if req.Description != "" {
+		fmt.Fprintf(&b, "\n\n%s", req.Description)
+	}
+	return b.String()
+}
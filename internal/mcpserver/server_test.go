@@ -0,0 +1,137 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"charm.land/fantasy"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/mudaaaa/crushplus/internal/agent/tools"
+	"github.com/mudaaaa/crushplus/internal/csync"
+	"github.com/mudaaaa/crushplus/internal/db"
+	"github.com/mudaaaa/crushplus/internal/history"
+	"github.com/mudaaaa/crushplus/internal/lsp"
+	"github.com/mudaaaa/crushplus/internal/permission"
+	"github.com/mudaaaa/crushplus/internal/session"
+	"github.com/stretchr/testify/require"
+)
+
+type pingParams struct {
+	Message string `json:"message,omitempty" description:"The message to echo"`
+}
+
+func newTestServer(t *testing.T, dir string) *Server {
+	t.Helper()
+	conn, err := db.Connect(t.Context(), t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	q := db.New(conn)
+
+	permissions := permission.NewPermissionService(dir, false, nil)
+	lspClients := csync.NewMap[string, *lsp.Client]()
+	s := newServer(session.NewService(q), permissions, nil)
+	s.addTools(
+		tools.NewViewTool(lspClients, permissions, dir),
+		tools.NewWriteTool(lspClients, permissions, history.NewService(q, conn), dir),
+		fantasy.NewAgentTool("ping", "Echoes a message.", func(ctx context.Context, params pingParams, call fantasy.ToolCall) (fantasy.ToolResponse, error) {
+			return fantasy.NewTextResponse("pong " + params.Message), nil
+		}),
+	)
+	s.forwardPermissions(t.Context())
+	return s
+}
+
+// connect connects a client to the server in memory. The client answers the
+// permission requests with decision, or can't elicit when it's empty.
+func connect(t *testing.T, s *Server, decision string) *mcp.ClientSession {
+	t.Helper()
+	var opts *mcp.ClientOptions
+	if decision != "" {
+		opts = &mcp.ClientOptions{
+			ElicitationHandler: func(ctx context.Context, req *mcp.ElicitRequest) (*mcp.ElicitResult, error) {
+				return &mcp.ElicitResult{Action: "accept", Content: map[string]any{"decision": decision}}, nil
+			},
+		}
+	}
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	_, err := s.server.Connect(t.Context(), serverTransport, nil)
+	require.NoError(t, err)
+	client, err := mcp.NewClient(&mcp.Implementation{Name: "test"}, opts).Connect(t.Context(), clientTransport, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func callTool(t *testing.T, client *mcp.ClientSession, name string, args map[string]any) (string, bool) {
+	t.Helper()
+	result, err := client.CallTool(t.Context(), &mcp.CallToolParams{Name: name, Arguments: args})
+	require.NoError(t, err)
+	require.Len(t, result.Content, 1)
+	return result.Content[0].(*mcp.TextContent).Text, result.IsError
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644))
+	s := newTestServer(t, dir)
+
+	t.Run("lists tools", func(t *testing.T) {
+		t.Parallel()
+		result, err := connect(t, s, "").ListTools(t.Context(), nil)
+		require.NoError(t, err)
+		schemas := make(map[string]map[string]any)
+		for _, tool := range result.Tools {
+			data, err := json.Marshal(tool.InputSchema)
+			require.NoError(t, err)
+			var schema map[string]any
+			require.NoError(t, json.Unmarshal(data, &schema))
+			schemas[tool.Name] = schema
+		}
+		require.Len(t, schemas, 3)
+		require.Equal(t, []any{"file_path", "content"}, schemas[tools.WriteToolName]["required"])
+		require.Equal(t, []any{}, schemas["ping"]["required"])
+		require.Contains(t, schemas["ping"]["properties"], "message")
+	})
+
+	t.Run("calls tools", func(t *testing.T) {
+		t.Parallel()
+		client := connect(t, s, "")
+		text, isError := callTool(t, client, "ping", map[string]any{"message": "hi"})
+		require.False(t, isError)
+		require.Equal(t, "pong hi", text)
+
+		text, isError = callTool(t, client, tools.ViewToolName, map[string]any{"file_path": filepath.Join(dir, "main.go")})
+		require.False(t, isError, text)
+		require.Contains(t, text, "package main")
+	})
+
+	t.Run("asks the client for permissions", func(t *testing.T) {
+		t.Parallel()
+		for _, tt := range []struct {
+			decision string
+			granted  bool
+		}{
+			{decision: decisionAllow, granted: true},
+			{decision: decisionDeny},
+			// Clients that can't ask their user are denied.
+			{decision: ""},
+		} {
+			path := filepath.Join(dir, "file-"+tt.decision+".txt")
+			text, isError := callTool(t, connect(t, s, tt.decision), tools.WriteToolName, map[string]any{"file_path": path, "content": "hello"})
+			_, statErr := os.Stat(path)
+			if tt.granted {
+				require.False(t, isError, text)
+				require.NoError(t, statErr)
+			} else {
+				require.True(t, isError)
+				require.Equal(t, "permission denied", text)
+				require.ErrorIs(t, statErr, os.ErrNotExist)
+			}
+		}
+	})
+}
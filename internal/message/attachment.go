@@ -1,8 +1,53 @@
 package message
 
+import (
+	"mime"
+	"slices"
+	"strings"
+)
+
 type Attachment struct {
 	FilePath string
 	FileName string
 	MimeType string
 	Content  []byte
 }
+
+// IsText reports whether the attachment holds text, e.g. an MCP resource,
+// rather than binary data such as an image.
+func (a Attachment) IsText() bool {
+	return IsTextMIMEType(a.MimeType)
+}
+
+// textMIMETypes are the types outside of text/ that hold text, which
+// providers reject as file parts.
+var textMIMETypes = []string{
+	"application/json",
+	"application/xml",
+	"application/yaml",
+	"application/x-yaml",
+	"application/toml",
+	"application/javascript",
+	"application/x-javascript",
+	"application/ecmascript",
+	"application/x-sh",
+	"application/sql",
+	"application/graphql",
+}
+
+// IsTextMIMEType reports whether the MIME type is the one of text content,
+// such as text/plain, application/json or application/schema+json, so it's
+// sent to the model inline rather than as a file.
+func IsTextMIMEType(mimeType string) bool {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(mimeType))
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"), strings.HasSuffix(mediaType, "+yaml"):
+		return true
+	}
+	return slices.Contains(textMIMETypes, mediaType)
+}
@@ -3,6 +3,7 @@ package message
 import (
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"slices"
 	"strings"
 	"time"
@@ -93,6 +94,13 @@ func (bc BinaryContent) String(p catwalk.InferenceProvider) string {
 
 func (BinaryContent) isPart() {}
 
+// TextAttachment renders text attached to a user message (e.g. an MCP
+// resource) so it can be sent inline, as providers only accept images as
+// file parts.
+func TextAttachment(path string, data []byte) string {
+	return fmt.Sprintf("<attachment path=%q>\n%s\n</attachment>", path, data)
+}
+
 type ToolCall struct {
 	ID               string `json:"id"`
 	Name             string `json:"name"`
@@ -436,6 +444,10 @@ func (m *Message) ToAIMessage() []fantasy.Message {
 			parts = append(parts, fantasy.TextPart{Text: text})
 		}
 		for _, content := range m.BinaryContent() {
+			if IsTextMIMEType(content.MIMEType) {
+				parts = append(parts, fantasy.TextPart{Text: TextAttachment(content.Path, content.Data)})
+				continue
+			}
 			parts = append(parts, fantasy.FilePart{
 				Filename:  content.Path,
 				Data:      content.Data,
@@ -0,0 +1,982 @@
+// Package pdf extracts the text of PDF documents, for the models that can't
+// read them natively.
+//
+// The extraction is deliberately minimal: it walks the pages of the document
+// and reads the text shown by their content streams, uncompressed or
+// Flate-compressed, and by the forms they draw. Fonts with a ToUnicode CMap
+// are mapped back to text through it, and the others are read as Latin-1.
+// Scanned documents, encrypted documents and documents whose composite fonts
+// lack a ToUnicode CMap yield no text.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	// ErrNotPDF is returned when the data isn't a PDF document.
+	ErrNotPDF = errors.New("not a PDF document")
+	// ErrEncrypted is returned for encrypted PDF documents.
+	ErrEncrypted = errors.New("the PDF document is encrypted")
+	// ErrNoText is returned when no text could be extracted from the document.
+	ErrNoText = errors.New("no text could be extracted from the PDF document; it may be scanned or use embedded font encodings")
+)
+
+// MIMEType is the media type of PDF documents.
+const MIMEType = "application/pdf"
+
+// objHeader matches the start of an indirect object.
+var objHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+const (
+	// maxStreamSize caps the size of a decompressed stream.
+	maxStreamSize = 64 * 1024 * 1024
+	// maxFormDepth caps the nesting of the forms drawn by a page.
+	maxFormDepth = 8
+	// maxRangeSize caps the codes of a range of a CMap.
+	maxRangeSize = 0x10000
+)
+
+// IsPDF reports whether the data looks like a PDF document.
+func IsPDF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("%PDF-"))
+}
+
+// ExtractFile extracts the text of the PDF document at the path.
+func ExtractFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return ExtractText(data)
+}
+
+// ExtractText extracts the text of the PDF document.
+func ExtractText(data []byte) (string, error) {
+	if !IsPDF(data) {
+		return "", ErrNotPDF
+	}
+	doc := parseDocument(data)
+	if doc.encrypted() {
+		return "", ErrEncrypted
+	}
+
+	w := &textWriter{}
+	for _, page := range doc.pages() {
+		doc.showText(w, doc.contents(page["Contents"]), doc.dict(page["Resources"]), 0)
+		w.newLine()
+	}
+	text := tidy(w.sb.String())
+	if text == "" {
+		return "", ErrNoText
+	}
+	return text, nil
+}
+
+type (
+	// name is a name object, without its slash.
+	name string
+	// ref is a reference to an indirect object, by its number.
+	ref int
+	// dict is a dictionary object, by the names of its keys.
+	dict map[string]any
+)
+
+// object is an indirect object of the document, with the undecoded data of
+// its stream, if any.
+type object struct {
+	value  any
+	stream []byte
+}
+
+type document struct {
+	objects  map[int]object
+	trailers []dict
+	fonts    map[int]*font
+}
+
+// parseDocument reads the objects and the trailers of the document. It scans
+// the data rather than following the cross-reference table, which damaged
+// documents often get wrong; of the objects defined twice, the last one,
+// written by the latest update, wins.
+func parseDocument(data []byte) *document {
+	doc := &document{
+		objects: make(map[int]object),
+		fonts:   make(map[int]*font),
+	}
+	type trailer struct {
+		pos  int
+		dict dict
+	}
+	var trailers []trailer
+
+	end := 0
+	for _, m := range objHeader.FindAllSubmatchIndex(data, -1) {
+		// Skip what looks like an object in the data of a stream.
+		if m[0] < end || (m[0] > 0 && isDigit(data[m[0]-1])) {
+			continue
+		}
+		num, err := strconv.Atoi(string(data[m[2]:m[3]]))
+		if err != nil {
+			continue
+		}
+		p := &parser{scanner: scanner{data: data, pos: m[1]}}
+		obj := object{value: p.object()}
+		end = p.pos
+		if tok, ok := p.scan(); ok && tok.kind == tokenOperator && tok.text == "stream" {
+			obj.stream, end = streamData(data, p.pos, obj.value)
+		}
+		doc.objects[num] = obj
+		if d, ok := obj.value.(dict); ok && d["Type"] == name("XRef") {
+			trailers = append(trailers, trailer{m[0], d})
+		}
+	}
+	for i := 0; ; {
+		j := bytes.Index(data[i:], []byte("trailer"))
+		if j < 0 {
+			break
+		}
+		i += j + len("trailer")
+		p := &parser{scanner: scanner{data: data, pos: i}}
+		if d, ok := p.object().(dict); ok {
+			trailers = append(trailers, trailer{i, d})
+		}
+	}
+	slices.SortStableFunc(trailers, func(a, b trailer) int { return a.pos - b.pos })
+	for _, t := range trailers {
+		doc.trailers = append(doc.trailers, t.dict)
+	}
+
+	// The objects of object streams are only used when no newer definition
+	// exists outside of them.
+	for _, obj := range doc.objects {
+		if d, ok := obj.value.(dict); ok && d["Type"] == name("ObjStm") {
+			doc.readObjectStream(d, obj.stream)
+		}
+	}
+	return doc
+}
+
+// streamData returns the data of the stream starting at the position, after
+// its keyword, and the position of its end.
+func streamData(data []byte, pos int, value any) ([]byte, int) {
+	if bytes.HasPrefix(data[pos:], []byte("\r\n")) {
+		pos += 2
+	} else if pos < len(data) && (data[pos] == '\n' || data[pos] == '\r') {
+		pos++
+	}
+	// Trust the length of the stream when the keyword ending it follows. It's
+	// checked as a float, as huge lengths would overflow an int.
+	if d, ok := value.(dict); ok {
+		if length, ok := d["Length"].(float64); ok && length >= 0 && length <= float64(len(data)-pos) {
+			end := pos + int(length)
+			after := bytes.TrimLeft(data[end:min(end+8+len("endstream"), len(data))], "\r\n\t ")
+			if bytes.HasPrefix(after, []byte("endstream")) {
+				return data[pos:end], end
+			}
+		}
+	}
+	end := bytes.Index(data[pos:], []byte("endstream"))
+	if end < 0 {
+		return data[pos:], len(data)
+	}
+	return data[pos : pos+end], pos + end + len("endstream")
+}
+
+func (d *document) readObjectStream(streamDict dict, raw []byte) {
+	data, ok := decodeStream(streamDict, raw)
+	if !ok {
+		return
+	}
+	n, _ := streamDict["N"].(float64)
+	first, _ := streamDict["First"].(float64)
+	if n <= 0 || first < 0 || first > float64(len(data)) {
+		return
+	}
+	header := &parser{scanner: scanner{data: data[:int(first)]}}
+	for range int(n) {
+		num, ok1 := header.object().(float64)
+		offset, ok2 := header.object().(float64)
+		if !ok1 || !ok2 {
+			return
+		}
+		if _, ok := d.objects[int(num)]; ok {
+			continue
+		}
+		if offset < 0 || offset > float64(len(data))-first {
+			continue
+		}
+		p := &parser{scanner: scanner{data: data, pos: int(first) + int(offset)}}
+		d.objects[int(num)] = object{value: p.object()}
+	}
+}
+
+// encrypted reports whether a trailer of the document declares it encrypted.
+func (d *document) encrypted() bool {
+	for _, t := range d.trailers {
+		if _, ok := t["Encrypt"]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the object a reference points to.
+func (d *document) resolve(v any) any {
+	if r, ok := v.(ref); ok {
+		return d.objects[int(r)].value
+	}
+	return v
+}
+
+func (d *document) dict(v any) dict {
+	dct, _ := d.resolve(v).(dict)
+	return dct
+}
+
+// pages returns the dictionaries of the pages of the document, in order, with
+// the resources they inherit from the page tree.
+func (d *document) pages() []dict {
+	var pages []dict
+	visited := make(map[int]bool)
+	var walk func(v any, resources any)
+	walk = func(v any, resources any) {
+		if r, ok := v.(ref); ok {
+			if visited[int(r)] {
+				return
+			}
+			visited[int(r)] = true
+		}
+		node := d.dict(v)
+		if node == nil {
+			return
+		}
+		if res, ok := node["Resources"]; ok {
+			resources = res
+		}
+		if kids, ok := d.resolve(node["Kids"]).([]any); ok {
+			for _, kid := range kids {
+				walk(kid, resources)
+			}
+			return
+		}
+		page := dict{"Contents": node["Contents"], "Resources": resources}
+		pages = append(pages, page)
+	}
+	for _, t := range slices.Backward(d.trailers) {
+		if root := d.dict(t["Root"]); root != nil {
+			walk(root["Pages"], nil)
+			break
+		}
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+
+	// Without a usable page tree, read the pages in the order of their
+	// objects, or else the streams that may be content streams: those
+	// without a type, nor the lengths of font programs.
+	var pageNums, streamNums []int
+	for num, obj := range d.objects {
+		dct, ok := obj.value.(dict)
+		if !ok {
+			continue
+		}
+		if dct["Type"] == name("Page") {
+			pageNums = append(pageNums, num)
+		} else if obj.stream != nil && !slices.ContainsFunc([]string{"Type", "Subtype", "Length1", "Length2", "Length3"}, func(key string) bool {
+			_, ok := dct[key]
+			return ok
+		}) {
+			streamNums = append(streamNums, num)
+		}
+	}
+	slices.Sort(pageNums)
+	for _, num := range pageNums {
+		page := d.objects[num].value.(dict)
+		pages = append(pages, dict{"Contents": page["Contents"], "Resources": page["Resources"]})
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+	slices.Sort(streamNums)
+	for _, num := range streamNums {
+		pages = append(pages, dict{"Contents": ref(num)})
+	}
+	return pages
+}
+
+// contents returns the decoded content streams of a page, joined.
+func (d *document) contents(v any) []byte {
+	streams, ok := d.resolve(v).([]any)
+	if !ok {
+		streams = []any{v}
+	}
+	var content []byte
+	for _, s := range streams {
+		r, ok := s.(ref)
+		if !ok {
+			continue
+		}
+		obj := d.objects[int(r)]
+		if data, ok := decodeStream(d.dict(obj.value), obj.stream); ok {
+			content = append(content, data...)
+			content = append(content, '\n')
+		}
+	}
+	return content
+}
+
+// font returns the font of the resources by its name.
+func (d *document) font(resources dict, fontName name) *font {
+	v := d.dict(resources["Font"])[string(fontName)]
+	r, isRef := v.(ref)
+	if isRef {
+		if f, ok := d.fonts[int(r)]; ok {
+			return f
+		}
+	}
+	fd := d.dict(v)
+	if fd == nil {
+		return nil
+	}
+	f := &font{composite: fd["Subtype"] == name("Type0")}
+	if r, ok := fd["ToUnicode"].(ref); ok {
+		obj := d.objects[int(r)]
+		if data, ok := decodeStream(d.dict(obj.value), obj.stream); ok {
+			f.cmap = parseCMap(data)
+		}
+	}
+	if isRef {
+		d.fonts[int(r)] = f
+	}
+	return f
+}
+
+// form returns the content stream and the resources of the form of the
+// resources by its name.
+func (d *document) form(resources dict, formName name) ([]byte, dict, bool) {
+	r, ok := d.dict(resources["XObject"])[string(formName)].(ref)
+	if !ok {
+		return nil, nil, false
+	}
+	obj := d.objects[int(r)]
+	fd, _ := obj.value.(dict)
+	if fd == nil || fd["Subtype"] != name("Form") {
+		return nil, nil, false
+	}
+	content, ok := decodeStream(fd, obj.stream)
+	if !ok {
+		return nil, nil, false
+	}
+	if res := d.dict(fd["Resources"]); res != nil {
+		resources = res
+	}
+	return content, resources, true
+}
+
+// decodeStream decodes the data of a stream, uncompressed or
+// Flate-compressed.
+func decodeStream(streamDict dict, raw []byte) ([]byte, bool) {
+	var filters []any
+	switch filter := streamDict["Filter"].(type) {
+	case nil:
+		return raw, true
+	case name:
+		filters = []any{filter}
+	case []any:
+		filters = filter
+	}
+	// Only Flate, alone, is supported.
+	if len(filters) != 1 || filters[0] != name("FlateDecode") {
+		return nil, false
+	}
+	r, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, false
+	}
+	defer r.Close()
+	// Keep what was decompressed of truncated streams.
+	stream, _ := io.ReadAll(io.LimitReader(r, maxStreamSize))
+	return stream, len(stream) > 0
+}
+
+// textWriter writes the text of the pages, with line breaks where the text
+// moves to a new line.
+type textWriter struct {
+	sb strings.Builder
+}
+
+func (w *textWriter) newLine() {
+	if w.sb.Len() > 0 && !strings.HasSuffix(w.sb.String(), "\n") {
+		w.sb.WriteString("\n")
+	}
+}
+
+func (w *textWriter) space() {
+	if s := w.sb.String(); !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+		w.sb.WriteString(" ")
+	}
+}
+
+// showText writes the text shown by the text operators of the content
+// stream, and of the forms it draws.
+func (d *document) showText(w *textWriter, content []byte, resources dict, depth int) {
+	var operands []any
+	var current *font
+	inText := false
+	show := func(operand any) {
+		if s, ok := operand.([]byte); ok {
+			w.sb.WriteString(current.decode(s))
+		}
+	}
+
+	p := &parser{scanner: scanner{data: content}}
+	for {
+		value, op, ok := p.next()
+		if !ok {
+			return
+		}
+		if op == "" {
+			operands = append(operands, value)
+			continue
+		}
+
+		switch op {
+		case "BT":
+			inText = true
+		case "ET":
+			inText = false
+			w.newLine()
+		case "Tf":
+			if len(operands) == 2 {
+				if fontName, ok := operands[0].(name); ok {
+					current = d.font(resources, fontName)
+				}
+			}
+		case "Do":
+			if len(operands) == 1 && depth < maxFormDepth {
+				if formName, ok := operands[0].(name); ok {
+					if form, formResources, ok := d.form(resources, formName); ok {
+						d.showText(w, form, formResources, depth+1)
+					}
+				}
+			}
+		}
+		if inText {
+			switch op {
+			case "Tj":
+				for _, operand := range operands {
+					show(operand)
+				}
+			case "'", `"`:
+				w.newLine()
+				for _, operand := range operands {
+					show(operand)
+				}
+			case "TJ":
+				for _, operand := range operands {
+					array, _ := operand.([]any)
+					for _, item := range array {
+						// Large negative adjustments move the text right,
+						// typically between words.
+						if adjustment, ok := item.(float64); ok && adjustment < -200 {
+							w.space()
+						}
+						show(item)
+					}
+				}
+			case "Td", "TD":
+				if len(operands) == 2 {
+					if ty, ok := operands[1].(float64); ok && ty != 0 {
+						w.newLine()
+					} else {
+						w.space()
+					}
+				}
+			case "T*", "Tm":
+				w.newLine()
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// font maps the codes a font shows to text.
+type font struct {
+	cmap *cmap
+	// composite fonts show glyph identifiers, which mean nothing without a
+	// CMap.
+	composite bool
+}
+
+func (f *font) decode(b []byte) string {
+	switch {
+	case f == nil:
+		return decodeText(b)
+	case f.cmap != nil:
+		return f.cmap.decode(b)
+	case f.composite:
+		return ""
+	default:
+		return decodeText(b)
+	}
+}
+
+// cmap is a ToUnicode CMap, mapping the codes of a font to text.
+type cmap struct {
+	// lengths are the byte lengths of the codes, ascending.
+	lengths []int
+	text    map[string]string
+}
+
+// parseCMap reads the code space and the mappings of a ToUnicode CMap.
+func parseCMap(data []byte) *cmap {
+	c := &cmap{text: make(map[string]string)}
+	addLength := func(n int) {
+		if n > 0 && !slices.Contains(c.lengths, n) {
+			c.lengths = append(c.lengths, n)
+		}
+	}
+
+	var operands []any
+	p := &parser{scanner: scanner{data: data}}
+	for {
+		value, op, ok := p.next()
+		if !ok {
+			break
+		}
+		if op == "" {
+			operands = append(operands, value)
+			continue
+		}
+		switch op {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if lo, ok := operands[i].([]byte); ok {
+					addLength(len(lo))
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].([]byte)
+				dst, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 {
+					c.text[string(src)] = decodeUTF16(dst)
+					addLength(len(src))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].([]byte)
+				hi, ok2 := operands[i+1].([]byte)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) > 4 {
+					continue
+				}
+				addLength(len(lo))
+				start, end := codeValue(lo), codeValue(hi)
+				for code := start; code <= end && code-start < maxRangeSize; code++ {
+					n := code - start
+					switch dst := operands[i+2].(type) {
+					case []byte:
+						c.text[string(codeBytes(code, len(lo)))] = offsetUTF16(dst, n)
+					case []any:
+						if int(n) < len(dst) {
+							if s, ok := dst[n].([]byte); ok {
+								c.text[string(codeBytes(code, len(lo)))] = decodeUTF16(s)
+							}
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	if len(c.lengths) == 0 {
+		c.lengths = []int{1}
+	}
+	slices.Sort(c.lengths)
+	return c
+}
+
+// decode maps the codes of the string to text, skipping those the CMap
+// doesn't map.
+func (c *cmap) decode(b []byte) string {
+	var sb strings.Builder
+	for len(b) > 0 {
+		n := c.lengths[0]
+		for _, length := range c.lengths {
+			if length > len(b) {
+				break
+			}
+			if text, ok := c.text[string(b[:length])]; ok {
+				sb.WriteString(text)
+				n = length
+				break
+			}
+		}
+		b = b[min(n, len(b)):]
+	}
+	return sb.String()
+}
+
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func codeBytes(v uint32, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+	return b
+}
+
+// offsetUTF16 decodes the UTF-16 text, its last code unit moved by the
+// offset, as the ranges of CMaps do.
+func offsetUTF16(b []byte, offset uint32) string {
+	units := utf16Units(b)
+	if len(units) > 0 {
+		units[len(units)-1] += uint16(offset)
+	}
+	return string(utf16.Decode(units))
+}
+
+func decodeUTF16(b []byte) string {
+	return string(utf16.Decode(utf16Units(b)))
+}
+
+func utf16Units(b []byte) []uint16 {
+	units := make([]uint16, 0, (len(b)+1)/2)
+	for i := 0; i < len(b); i += 2 {
+		unit := uint16(b[i]) << 8
+		if i+1 < len(b) {
+			unit |= uint16(b[i+1])
+		}
+		units = append(units, unit)
+	}
+	return units
+}
+
+// tidy trims the lines of the text and collapses blank lines.
+func tidy(text string) string {
+	var lines []string
+	blank := false
+	for line := range strings.SplitSeq(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parser reads the objects of a PDF document or of a content stream.
+type parser struct {
+	scanner
+}
+
+// next reads the next object, or the operator following the operands read
+// before it.
+func (p *parser) next() (value any, op string, ok bool) {
+	tok, ok := p.scan()
+	if !ok {
+		return nil, "", false
+	}
+	value, op = p.value(tok)
+	return value, op, true
+}
+
+// object reads the next object, skipping operators.
+func (p *parser) object() any {
+	for {
+		value, op, ok := p.next()
+		if !ok || op == "" {
+			return value
+		}
+	}
+}
+
+func (p *parser) value(tok token) (any, string) {
+	switch tok.kind {
+	case tokenString:
+		return tok.raw, ""
+	case tokenNumber:
+		return tok.number, ""
+	case tokenName:
+		return name(tok.text), ""
+	case tokenArrayStart:
+		return p.items(tokenArrayEnd), ""
+	case tokenDictStart:
+		items := p.items(tokenDictEnd)
+		d := make(dict, len(items)/2)
+		for i := 0; i+1 < len(items); {
+			key, ok := items[i].(name)
+			if !ok {
+				i++
+				continue
+			}
+			d[string(key)] = items[i+1]
+			i += 2
+		}
+		return d, ""
+	}
+	switch tok.text {
+	case "true":
+		return true, ""
+	case "false":
+		return false, ""
+	case "null":
+		return nil, ""
+	}
+	return nil, tok.text
+}
+
+// items reads the objects of an array or a dictionary, up to its end.
+func (p *parser) items(end tokenKind) []any {
+	var items []any
+	for {
+		tok, ok := p.scan()
+		if !ok || tok.kind == end {
+			return items
+		}
+		value, op := p.value(tok)
+		if op == "R" && len(items) >= 2 {
+			num, ok1 := items[len(items)-2].(float64)
+			_, ok2 := items[len(items)-1].(float64)
+			if ok1 && ok2 {
+				items = append(items[:len(items)-2], ref(num))
+			}
+			continue
+		}
+		if op != "" {
+			continue
+		}
+		items = append(items, value)
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenOperator tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenName
+	tokenArrayStart
+	tokenArrayEnd
+	tokenDictStart
+	tokenDictEnd
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	raw    []byte
+	number float64
+}
+
+// scanner splits PDF data into tokens.
+type scanner struct {
+	data []byte
+	pos  int
+}
+
+func (s *scanner) scan() (token, bool) {
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		switch {
+		case isSpace(c):
+			s.pos++
+		case c == '%':
+			for s.pos < len(s.data) && s.data[s.pos] != '\n' && s.data[s.pos] != '\r' {
+				s.pos++
+			}
+		case c == '(':
+			s.pos++
+			return token{kind: tokenString, raw: s.literal()}, true
+		case c == '<' && s.peek(1) == '<':
+			s.pos += 2
+			return token{kind: tokenDictStart, text: "<<"}, true
+		case c == '>' && s.peek(1) == '>':
+			s.pos += 2
+			return token{kind: tokenDictEnd, text: ">>"}, true
+		case c == '<':
+			s.pos++
+			return token{kind: tokenString, raw: s.hex()}, true
+		case c == '[':
+			s.pos++
+			return token{kind: tokenArrayStart, text: "["}, true
+		case c == ']':
+			s.pos++
+			return token{kind: tokenArrayEnd, text: "]"}, true
+		case c == '/':
+			s.pos++
+			return token{kind: tokenName, text: s.word()}, true
+		case isDelimiter(c):
+			s.pos++
+		default:
+			word := s.word()
+			if number, err := strconv.ParseFloat(word, 64); err == nil {
+				return token{kind: tokenNumber, number: number}, true
+			}
+			// Inline images carry binary data up to their end.
+			if word == "ID" {
+				if end := bytes.Index(s.data[s.pos:], []byte("EI")); end >= 0 {
+					s.pos += end + 2
+				} else {
+					s.pos = len(s.data)
+				}
+				return token{kind: tokenOperator, text: "EI"}, true
+			}
+			return token{kind: tokenOperator, text: word}, true
+		}
+	}
+	return token{}, false
+}
+
+func (s *scanner) peek(n int) byte {
+	if s.pos+n < len(s.data) {
+		return s.data[s.pos+n]
+	}
+	return 0
+}
+
+func (s *scanner) word() string {
+	start := s.pos
+	for s.pos < len(s.data) && !isSpace(s.data[s.pos]) && !isDelimiter(s.data[s.pos]) {
+		s.pos++
+	}
+	return string(s.data[start:s.pos])
+}
+
+// literal reads a literal string, after its opening parenthesis.
+func (s *scanner) literal() []byte {
+	var out []byte
+	depth := 1
+	for s.pos < len(s.data) {
+		c := s.data[s.pos]
+		s.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if s.pos >= len(s.data) {
+				return out
+			}
+			e := s.data[s.pos]
+			s.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// A backslash at the end of the line continues the string.
+				if s.pos < len(s.data) && s.data[s.pos] == '\n' {
+					s.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					n := int(e - '0')
+					for i := 0; i < 2 && s.pos < len(s.data) && s.data[s.pos] >= '0' && s.data[s.pos] <= '7'; i++ {
+						n = n*8 + int(s.data[s.pos]-'0')
+						s.pos++
+					}
+					c = byte(n)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// hex reads a hexadecimal string, after its opening angle bracket.
+func (s *scanner) hex() []byte {
+	var digits []byte
+	for s.pos < len(s.data) && s.data[s.pos] != '>' {
+		if c := s.data[s.pos]; isHex(c) {
+			digits = append(digits, c)
+		}
+		s.pos++
+	}
+	s.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		n, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		out[i] = byte(n)
+	}
+	return out
+}
+
+// decodeText decodes a string, either UTF-16 with its byte order mark or
+// single-byte, read as Latin-1.
+func decodeText(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+		return decodeUTF16(b[2:])
+	}
+	runes := make([]rune, 0, len(b))
+	for _, c := range b {
+		if c < 0x20 && c != '\t' && c != '\n' {
+			continue
+		}
+		runes = append(runes, rune(c))
+	}
+	return string(runes)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
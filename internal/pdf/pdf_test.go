@@ -0,0 +1,156 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildDocument returns a PDF document of the objects, numbered from 1, the
+// first being its catalog.
+func buildDocument(objects ...string) []byte {
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	pdf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return pdf.Bytes()
+}
+
+// streamObject returns a stream object of the data, with the entries of its
+// dictionary.
+func streamObject(t *testing.T, entries, data string, compress bool) string {
+	t.Helper()
+	stream := []byte(data)
+	if compress {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		_, err := w.Write(stream)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		stream = buf.Bytes()
+		entries += " /Filter /FlateDecode"
+	}
+	return fmt.Sprintf("<< /Length %d%s >>\nstream\n%s\nendstream", len(stream), entries, stream)
+}
+
+// buildPDF returns a one-page PDF document showing the content stream.
+func buildPDF(t *testing.T, content string, compress bool) []byte {
+	t.Helper()
+	return buildDocument(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		streamObject(t, "", content, compress),
+	)
+}
+
+func TestExtractText(t *testing.T) {
+	t.Parallel()
+
+	content := `BT /F1 12 Tf 72 720 Td (Hello, \(PDF\) world!) Tj 0 -14 Td [(Spec) -300 (v2)] TJ T* <FEFF00E9> Tj ET`
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			t.Parallel()
+			text, err := ExtractText(buildPDF(t, content, compress))
+			require.NoError(t, err)
+			require.Equal(t, "Hello, (PDF) world!\nSpec v2\né", text)
+		})
+	}
+}
+
+func TestExtractTextToUnicode(t *testing.T) {
+	t.Parallel()
+
+	cmap := `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def
+/CMapName /Adobe-Identity-UCS def
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0001> <0048>
+<0002> <00E9>
+endbfchar
+2 beginbfrange
+<0003> <0006> <006C>
+<0007> <0008> [<0021> <D83DDE00>]
+endbfrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`
+	doc := buildDocument(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /Resources << /Font << /F1 5 0 R /F2 7 0 R >> /XObject << /X1 8 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [4 0 R] >>",
+		streamObject(t, "", "BT /F1 12 Tf <00010002000300030006000700080009> Tj ET BT /F2 12 Tf <00010002> Tj ET /X1 Do", true),
+		"<< /Type /Font /Subtype /Type0 /BaseFont /Sans /Encoding /Identity-H /ToUnicode 6 0 R >>",
+		streamObject(t, "", cmap, true),
+		"<< /Type /Font /Subtype /Type0 /BaseFont /Symbols /Encoding /Identity-H >>",
+		streamObject(t, " /Type /XObject /Subtype /Form", "BT /F1 12 Tf <0001> Tj ET", false),
+	)
+	text, err := ExtractText(doc)
+	require.NoError(t, err)
+	// The glyphs of the font without a ToUnicode CMap are dropped.
+	require.Equal(t, "Héllo!😀\nH", text)
+}
+
+func TestExtractTextErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := ExtractText([]byte("hello"))
+	require.ErrorIs(t, err, ErrNotPDF)
+
+	_, err = ExtractText(buildPDF(t, "0 0 m 100 100 l S", true))
+	require.ErrorIs(t, err, ErrNoText)
+
+	_, err = ExtractText(append(buildPDF(t, "BT (x) Tj ET", false), []byte("trailer\n<< /Encrypt 5 0 R >>\n")...))
+	require.ErrorIs(t, err, ErrEncrypted)
+
+	// Documents without pages, like damaged ones, are read from their
+	// content streams.
+	text, err := ExtractText([]byte("%PDF-1.4\n1 0 obj\n<< /Length 17 >>\nstream\nBT (Spec) Tj ET\nendstream\nendobj\n"))
+	require.NoError(t, err)
+	require.Equal(t, "Spec", text)
+
+	// Only the trailer says whether the document is encrypted.
+	text, err = ExtractText(buildPDF(t, "BT (See /Encrypt) Tj ET", false))
+	require.NoError(t, err)
+	require.Equal(t, "See /Encrypt", text)
+}
+
+func TestExtractTextOversizedNumbers(t *testing.T) {
+	t.Parallel()
+
+	// Lengths and offsets past the range of ints are ignored instead of
+	// wrapping around.
+	text, err := ExtractText(buildDocument(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		"<< /Length 99999999999999999999 >>\nstream\nBT (Long) Tj ET\nendstream",
+	))
+	require.NoError(t, err)
+	require.Equal(t, "Long", text)
+
+	for _, entries := range []string{
+		"/N 1 /First 99999999999999999999",
+		"/N 1 /First 0",
+	} {
+		stream := streamObject(t, " /Type /ObjStm "+entries, "5 99999999999999999999 << /Type /Font >>", false)
+		_, err = ExtractText(buildDocument(
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+			stream,
+		))
+		require.ErrorIs(t, err, ErrNoText)
+	}
+}
@@ -0,0 +1,101 @@
+package permission
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrDomainNotAllowed is returned for the URLs whose host the domain policy
+// doesn't let the tools reach.
+var ErrDomainNotAllowed = errors.New("domain not allowed")
+
+// DomainPolicy restricts the hosts the tools that fetch URLs can reach. A
+// domain matches its subdomains too, and "*.example.com" only matches the
+// subdomains of example.com. Denied domains win over allowed ones, and when
+// domains are allowed, all others are denied.
+type DomainPolicy struct {
+	allowed []string
+	denied  []string
+}
+
+// NewDomainPolicy returns the policy of the allowed and denied domains.
+func NewDomainPolicy(allowed, denied []string) DomainPolicy {
+	return DomainPolicy{allowed: normalizeDomains(allowed), denied: normalizeDomains(denied)}
+}
+
+// Check returns an error wrapping ErrDomainNotAllowed when the URL can't be
+// fetched.
+func (p DomainPolicy) Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return fmt.Errorf("invalid URL: %q has no host", rawURL)
+	}
+	for _, domain := range p.denied {
+		if matchDomain(domain, host) {
+			return fmt.Errorf("%w: %s is denied by the permissions config", ErrDomainNotAllowed, host)
+		}
+	}
+	if len(p.allowed) == 0 {
+		return nil
+	}
+	for _, domain := range p.allowed {
+		if matchDomain(domain, host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s isn't in the allowed domains of the permissions config", ErrDomainNotAllowed, host)
+}
+
+// Transport returns a transport that checks the URL of every request,
+// redirects included, before passing it to next.
+func (p DomainPolicy) Transport(next http.RoundTripper) http.RoundTripper {
+	if len(p.allowed) == 0 && len(p.denied) == 0 {
+		return next
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &domainTransport{policy: p, next: next}
+}
+
+type domainTransport struct {
+	policy DomainPolicy
+	next   http.RoundTripper
+}
+
+func (t *domainTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.policy.Check(req.URL.String()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+func normalizeDomains(domains []string) []string {
+	normalized := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain != "" {
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized
+}
+
+func matchDomain(domain, host string) bool {
+	if sub, ok := strings.CutPrefix(domain, "*."); ok {
+		return strings.HasSuffix(host, "."+sub)
+	}
+	// IP addresses only match themselves.
+	if net.ParseIP(host) != nil {
+		return host == domain
+	}
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
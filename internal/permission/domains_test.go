@@ -0,0 +1,44 @@
+package permission
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDomainPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		allowed []string
+		denied  []string
+		url     string
+		ok      bool
+	}{
+		{name: "no lists", url: "https://example.com/page", ok: true},
+		{name: "allowed domain", allowed: []string{"go.dev"}, url: "https://go.dev/doc", ok: true},
+		{name: "allowed subdomain", allowed: []string{"go.dev"}, url: "https://pkg.go.dev/fmt", ok: true},
+		{name: "not allowed", allowed: []string{"go.dev"}, url: "https://example.com", ok: false},
+		{name: "suffix isn't a subdomain", allowed: []string{"go.dev"}, url: "https://notgo.dev", ok: false},
+		{name: "wildcard skips the domain", allowed: []string{"*.github.com"}, url: "https://github.com", ok: false},
+		{name: "wildcard matches subdomains", allowed: []string{"*.github.com"}, url: "https://api.github.com/repos", ok: true},
+		{name: "case and trailing dot", allowed: []string{"Go.Dev."}, url: "https://GO.dev./doc", ok: true},
+		{name: "denied wins", allowed: []string{"example.com"}, denied: []string{"internal.example.com"}, url: "http://internal.example.com:8080", ok: false},
+		{name: "denied only", denied: []string{"169.254.169.254"}, url: "http://169.254.169.254/latest", ok: false},
+		{name: "IP addresses match exactly", allowed: []string{"1.1"}, url: "http://10.1.1.1", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := NewDomainPolicy(tt.allowed, tt.denied).Check(tt.url)
+			if tt.ok {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, ErrDomainNotAllowed)
+			}
+		})
+	}
+
+	require.Error(t, NewDomainPolicy(nil, nil).Check("file:///etc/passwd"))
+}
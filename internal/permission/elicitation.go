@@ -0,0 +1,90 @@
+package permission
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/mudaaaa/crushplus/internal/pubsub"
+)
+
+// ElicitationAction is the user's answer to an elicitation request.
+type ElicitationAction string
+
+const (
+	// ElicitationAccept means the user submitted the requested data.
+	ElicitationAccept ElicitationAction = "accept"
+	// ElicitationDecline means the user explicitly refused to answer.
+	ElicitationDecline ElicitationAction = "decline"
+	// ElicitationCancel means the user dismissed the request without
+	// answering.
+	ElicitationCancel ElicitationAction = "cancel"
+)
+
+type CreateElicitationRequest struct {
+	SessionID string         `json:"session_id"`
+	Source    string         `json:"source"`
+	Message   string         `json:"message"`
+	Schema    map[string]any `json:"schema"`
+}
+
+// ElicitationRequest asks the user for structured input, described by a flat
+// JSON schema, on behalf of Source (e.g. an MCP server).
+type ElicitationRequest struct {
+	ID        string         `json:"id"`
+	SessionID string         `json:"session_id"`
+	Source    string         `json:"source"`
+	Message   string         `json:"message"`
+	Schema    map[string]any `json:"schema"`
+}
+
+type ElicitationResponse struct {
+	Action  ElicitationAction `json:"action"`
+	Content map[string]any    `json:"content,omitempty"`
+}
+
+// Elicit publishes an elicitation request and waits for the user to answer
+// it. Sessions that are auto-approved have no one to answer, so their
+// requests are canceled right away.
+func (s *permissionService) Elicit(ctx context.Context, opts CreateElicitationRequest) ElicitationResponse {
+	s.autoApproveSessionsMu.RLock()
+	unattended := s.autoApproveSessions[opts.SessionID]
+	s.autoApproveSessionsMu.RUnlock()
+	if unattended {
+		return ElicitationResponse{Action: ElicitationCancel}
+	}
+
+	// The TUI shows one elicitation at a time.
+	s.elicitationMu.Lock()
+	defer s.elicitationMu.Unlock()
+
+	request := ElicitationRequest{
+		ID:        uuid.New().String(),
+		SessionID: opts.SessionID,
+		Source:    opts.Source,
+		Message:   opts.Message,
+		Schema:    opts.Schema,
+	}
+
+	respCh := make(chan ElicitationResponse, 1)
+	s.pendingElicitations.Set(request.ID, respCh)
+	defer s.pendingElicitations.Del(request.ID)
+
+	s.elicitationBroker.Publish(pubsub.CreatedEvent, request)
+
+	select {
+	case <-ctx.Done():
+		return ElicitationResponse{Action: ElicitationCancel}
+	case resp := <-respCh:
+		return resp
+	}
+}
+
+func (s *permissionService) RespondElicitation(request ElicitationRequest, resp ElicitationResponse) {
+	if respCh, ok := s.pendingElicitations.Get(request.ID); ok {
+		respCh <- resp
+	}
+}
+
+func (s *permissionService) SubscribeElicitations(ctx context.Context) <-chan pubsub.Event[ElicitationRequest] {
+	return s.elicitationBroker.Subscribe(ctx)
+}
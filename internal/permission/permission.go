@@ -52,6 +52,9 @@ type Service interface {
 	SetSkipRequests(skip bool)
 	SkipRequests() bool
 	SubscribeNotifications(ctx context.Context) <-chan pubsub.Event[PermissionNotification]
+	Elicit(ctx context.Context, opts CreateElicitationRequest) ElicitationResponse
+	RespondElicitation(request ElicitationRequest, resp ElicitationResponse)
+	SubscribeElicitations(ctx context.Context) <-chan pubsub.Event[ElicitationRequest]
 }
 
 type permissionService struct {
@@ -67,6 +70,10 @@ type permissionService struct {
 	skip                  bool
 	allowedTools          []string
 
+	elicitationBroker   *pubsub.Broker[ElicitationRequest]
+	pendingElicitations *csync.Map[string, chan ElicitationResponse]
+	elicitationMu       sync.Mutex
+
 	// used to make sure we only process one request at a time
 	requestMu     sync.Mutex
 	activeRequest *PermissionRequest
@@ -230,6 +237,8 @@ func NewPermissionService(workingDir string, skip bool, allowedTools []string) S
 		skip:                skip,
 		allowedTools:        allowedTools,
 		pendingRequests:     csync.NewMap[string, chan bool](),
+		elicitationBroker:   pubsub.NewBroker[ElicitationRequest](),
+		pendingElicitations: csync.NewMap[string, chan ElicitationResponse](),
 	}
 }
 
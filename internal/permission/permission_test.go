@@ -1,6 +1,7 @@
 package permission
 
 import (
+	"context"
 	"sync"
 	"testing"
 
@@ -245,3 +246,49 @@ func TestPermissionService_SequentialProperties(t *testing.T) {
 		assert.True(t, result, "Repeated request should be auto-approved due to persistent permission")
 	})
 }
+
+func TestPermissionService_Elicit(t *testing.T) {
+	t.Run("Returns the user's answer", func(t *testing.T) {
+		service := NewPermissionService("/tmp", false, []string{})
+		events := service.SubscribeElicitations(t.Context())
+
+		var resp ElicitationResponse
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp = service.Elicit(t.Context(), CreateElicitationRequest{
+				SessionID: "session1",
+				Source:    "github",
+				Message:   "Which repository?",
+				Schema:    map[string]any{"type": "object"},
+			})
+		}()
+
+		event := <-events
+		assert.Equal(t, "github", event.Payload.Source)
+		service.RespondElicitation(event.Payload, ElicitationResponse{
+			Action:  ElicitationAccept,
+			Content: map[string]any{"repo": "crushplus"},
+		})
+
+		wg.Wait()
+		assert.Equal(t, ElicitationAccept, resp.Action)
+		assert.Equal(t, "crushplus", resp.Content["repo"])
+	})
+	t.Run("Cancels requests of auto-approved sessions", func(t *testing.T) {
+		service := NewPermissionService("/tmp", false, []string{})
+		service.AutoApproveSession("session1")
+
+		resp := service.Elicit(t.Context(), CreateElicitationRequest{SessionID: "session1"})
+		assert.Equal(t, ElicitationCancel, resp.Action)
+	})
+	t.Run("Cancels requests when the context is done", func(t *testing.T) {
+		service := NewPermissionService("/tmp", false, []string{})
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		resp := service.Elicit(ctx, CreateElicitationRequest{SessionID: "session1"})
+		assert.Equal(t, ElicitationCancel, resp.Action)
+	})
+}
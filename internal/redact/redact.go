@@ -0,0 +1,208 @@
+// Package redact scrubs secrets, like API keys and tokens, from text before
+// it's shown to a model, saved or logged.
+package redact
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// MinSecretLength is the length under which secret values aren't redacted,
+// as short values would match all over unrelated text.
+const MinSecretLength = 8
+
+// Secret is a known secret value, like an API key read from the environment.
+type Secret struct {
+	Name  string
+	Value string
+}
+
+// Pattern matches secrets by their shape. When the expression has a
+// capturing group, only the text of the first group is redacted.
+type Pattern struct {
+	Name   string
+	Regexp *regexp.Regexp
+}
+
+// DefaultPatterns match common kinds of tokens and keys.
+var DefaultPatterns = []Pattern{
+	{Name: "private key", Regexp: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{Name: "AWS access key", Regexp: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: "GitHub token", Regexp: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{Name: "GitLab token", Regexp: regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`)},
+	{Name: "Slack token", Regexp: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{Name: "Google API key", Regexp: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{Name: "Stripe key", Regexp: regexp.MustCompile(`\b[rs]k_(?:live|test)_[0-9A-Za-z]{16,}\b`)},
+	{Name: "API key", Regexp: regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`)},
+	{Name: "JWT", Regexp: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{Name: "bearer token", Regexp: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]{20,}=*)`)},
+	// Assignments in .env files and the like, e.g. API_KEY=value, on lines
+	// numbered like the view tool shows them or not.
+	{Name: "secret assignment", Regexp: regexp.MustCompile(`(?m)^\s*(?:\d+\|\s*)?(?:export\s+)?[A-Z0-9_]*(?:KEY|TOKEN|SECRET|PASSWORD|PASSWD)[A-Z0-9_]*\s*[=:]\s*["']?([A-Za-z0-9_\-./+=:@~]{8,})["']?\s*$`)},
+}
+
+// Report counts the secrets redacted from a text by name.
+type Report map[string]int
+
+// Add adds the counts of another report to this one.
+func (r Report) Add(other Report) {
+	for name, n := range other {
+		r[name] += n
+	}
+}
+
+// String lists the names of the redacted secrets, with their count when
+// there's more than one.
+func (r Report) String() string {
+	names := make([]string, 0, len(r))
+	for name, n := range r {
+		if n > 1 {
+			name = fmt.Sprintf("%s (%d)", name, n)
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return strings.Join(names, ", ")
+}
+
+// Redactor replaces secrets in text with placeholders naming them. A nil
+// Redactor leaves text as is.
+type Redactor struct {
+	secrets  []Secret
+	patterns []Pattern
+}
+
+// New returns a Redactor of the given secrets and patterns. Secrets shorter
+// than MinSecretLength are ignored.
+func New(secrets []Secret, patterns []Pattern) *Redactor {
+	r := &Redactor{patterns: patterns}
+	seen := make(map[string]bool)
+	for _, secret := range secrets {
+		if len(secret.Value) < MinSecretLength || seen[secret.Value] {
+			continue
+		}
+		seen[secret.Value] = true
+		r.secrets = append(r.secrets, secret)
+	}
+	// Longer values go first, so that a secret containing another one is
+	// redacted whole.
+	slices.SortStableFunc(r.secrets, func(a, b Secret) int {
+		return cmp.Compare(len(b.Value), len(a.Value))
+	})
+	return r
+}
+
+// Placeholder is what a secret of the given name is replaced with.
+func Placeholder(name string) string {
+	return "[REDACTED:" + name + "]"
+}
+
+// Redact replaces the secrets in s and reports what was redacted.
+func (r *Redactor) Redact(s string) (string, Report) {
+	report := make(Report)
+	if r == nil || s == "" {
+		return s, report
+	}
+
+	for _, secret := range r.secrets {
+		if n := strings.Count(s, secret.Value); n > 0 {
+			s = strings.ReplaceAll(s, secret.Value, Placeholder(secret.Name))
+			report[secret.Name] += n
+		}
+	}
+
+	for _, pattern := range r.patterns {
+		placeholder := Placeholder(pattern.Name)
+		s = replaceAllSubmatch(pattern.Regexp, s, func(match string) string {
+			// Don't redact again what an earlier secret or pattern did.
+			if strings.HasPrefix(match, "[REDACTED:") {
+				return match
+			}
+			report[pattern.Name]++
+			return placeholder
+		})
+	}
+	return s, report
+}
+
+// RedactJSON redacts the string values of a JSON document, like tool
+// metadata. Documents that aren't valid JSON are redacted as text.
+func (r *Redactor) RedactJSON(s string) (string, Report) {
+	if r == nil || s == "" {
+		return s, make(Report)
+	}
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return r.Redact(s)
+	}
+	report := make(Report)
+	v = r.redactValue(v, report)
+	if len(report) == 0 {
+		return s, report
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return r.Redact(s)
+	}
+	return string(b), report
+}
+
+func (r *Redactor) redactValue(v any, report Report) any {
+	switch v := v.(type) {
+	case string:
+		redacted, rep := r.Redact(v)
+		report.Add(rep)
+		return redacted
+	case []any:
+		for i := range v {
+			v[i] = r.redactValue(v[i], report)
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = r.redactValue(v[k], report)
+		}
+	}
+	return v
+}
+
+// replaceAllSubmatch is like regexp.ReplaceAllStringFunc, but replaces only
+// the first capturing group of the matches when the expression has one.
+func replaceAllSubmatch(re *regexp.Regexp, s string, repl func(string) string) string {
+	if re.NumSubexp() == 0 {
+		return re.ReplaceAllStringFunc(s, repl)
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+		start, end := loc[2], loc[3]
+		if start < 0 {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(repl(s[start:end]))
+		last = end
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+var defaultRedactor atomic.Pointer[Redactor]
+
+// SetDefault sets the Redactor used by String, e.g. to scrub logs.
+func SetDefault(r *Redactor) {
+	defaultRedactor.Store(r)
+}
+
+// String redacts s with the default Redactor, if one was set.
+func String(s string) string {
+	s, _ = defaultRedactor.Load().Redact(s)
+	return s
+}
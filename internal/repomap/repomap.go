@@ -0,0 +1,252 @@
+// Package repomap renders a map of a repository for the system prompt: its
+// directory tree and the top-level definitions of its files, within a budget
+// of tokens. When the repository doesn't fit, the files closest to the ones
+// edited recently are kept, so the agent can orient itself without listing
+// directories first.
+package repomap
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mudaaaa/crushplus/internal/codeindex"
+	"github.com/mudaaaa/crushplus/internal/history"
+)
+
+const (
+	// recentFiles is the number of recently edited files the files are
+	// ranked by.
+	recentFiles = 20
+	// maxSymbols is the number of definitions listed per file.
+	maxSymbols = 8
+	// charsPerToken estimates the number of tokens of the map.
+	charsPerToken = 4
+)
+
+// Map renders the map of the files of a code index. The map is cached until
+// the index changes, which happens when files are edited.
+type Map struct {
+	index   *codeindex.Index
+	history history.Service
+
+	mu         sync.Mutex
+	generation uint64
+	maxTokens  int
+	rendered   string
+}
+
+// New returns the map of the files of the index, ranked by the files
+// recently changed according to history, which can be nil.
+func New(index *codeindex.Index, history history.Service) *Map {
+	return &Map{index: index, history: history}
+}
+
+// Changed reports whether the files changed since the map was last
+// rendered.
+func (m *Map) Changed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.index.Generation() != m.generation
+}
+
+// Render returns the map in about maxTokens tokens at most. It's empty until
+// the index is built.
+func (m *Map) Render(ctx context.Context, maxTokens int) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	generation := m.index.Generation()
+	if generation == m.generation && maxTokens == m.maxTokens {
+		return m.rendered
+	}
+	files := m.index.Outline()
+	m.rendered = render(files, m.recent(ctx), maxTokens*charsPerToken)
+	m.generation = generation
+	m.maxTokens = maxTokens
+	return m.rendered
+}
+
+// recent returns the paths of the recently edited files, relative to the
+// root of the index.
+func (m *Map) recent(ctx context.Context) []string {
+	if m.history == nil {
+		return nil
+	}
+	paths, err := m.history.ListRecentPaths(ctx, recentFiles)
+	if err != nil {
+		slog.Warn("Failed to list recently edited files", "error", err)
+		return nil
+	}
+	recent := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(m.index.Root(), p)
+		}
+		rel, err := filepath.Rel(m.index.Root(), p)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		recent = append(recent, filepath.ToSlash(rel))
+	}
+	return recent
+}
+
+// render lists the files that fit in budget characters, the most relevant
+// first, as a tree.
+func render(files []codeindex.FileSymbols, recent []string, budget int) string {
+	if len(files) == 0 || budget <= 0 {
+		return ""
+	}
+	scores := make([]float64, len(files))
+	order := make([]int, len(files))
+	for i, f := range files {
+		scores[i] = relevance(f.Path, recent)
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(scores[b], scores[a])
+	})
+
+	// Files are picked until the budget is spent, counting the lines of the
+	// directories they add to the tree.
+	picked := make([]bool, len(files))
+	shown := make(map[string]bool)
+	used := 0
+	for _, i := range order {
+		dirs := newDirs(files[i].Path, shown)
+		cost := len(fileLine(files[i])) + 1
+		for _, dir := range dirs {
+			cost += len(dirLine(dir)) + 1
+		}
+		if used+cost > budget {
+			continue
+		}
+		used += cost
+		picked[i] = true
+		for _, dir := range dirs {
+			shown[dir] = true
+		}
+	}
+
+	var sb strings.Builder
+	printed := make(map[string]bool)
+	omitted := 0
+	for i, f := range files {
+		if !picked[i] {
+			omitted++
+			continue
+		}
+		for _, dir := range newDirs(f.Path, printed) {
+			sb.WriteString(dirLine(dir) + "\n")
+			printed[dir] = true
+		}
+		sb.WriteString(fileLine(f) + "\n")
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&sb, "(%d more files not shown)\n", omitted)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// relevance scores a file by its distance to the recently edited files, the
+// latest weighing the most. Files near the root come first otherwise, and
+// tests last.
+func relevance(file string, recent []string) float64 {
+	base := 0.1 / float64(1+depth(file))
+	score := base
+	for i, r := range recent {
+		weight := 1 / float64(i+1)
+		if file == r {
+			score = max(score, 2*weight)
+			continue
+		}
+		score = max(score, weight/float64(1+distance(path.Dir(file), path.Dir(r)))+base)
+	}
+	if isTest(file) {
+		score /= 2
+	}
+	return score
+}
+
+func isTest(file string) bool {
+	name := path.Base(file)
+	return strings.Contains(name, "_test.") || strings.Contains(name, ".test.") || strings.Contains(name, ".spec.") || strings.HasPrefix(name, "test_")
+}
+
+// distance is the number of directories between two directories.
+func distance(a, b string) int {
+	as, bs := splitDir(a), splitDir(b)
+	shared := 0
+	for shared < len(as) && shared < len(bs) && as[shared] == bs[shared] {
+		shared++
+	}
+	return len(as) - shared + len(bs) - shared
+}
+
+func depth(file string) int {
+	return strings.Count(file, "/")
+}
+
+func splitDir(dir string) []string {
+	if dir == "." {
+		return nil
+	}
+	return strings.Split(dir, "/")
+}
+
+// newDirs returns the directories of the file that aren't in the tree yet,
+// outermost first.
+func newDirs(file string, shown map[string]bool) []string {
+	var dirs []string
+	for dir := path.Dir(file); dir != "."; dir = path.Dir(dir) {
+		if shown[dir] {
+			break
+		}
+		dirs = append(dirs, dir)
+	}
+	slices.Reverse(dirs)
+	return dirs
+}
+
+func dirLine(dir string) string {
+	return strings.Repeat("  ", depth(dir)) + path.Base(dir) + "/"
+}
+
+// fileLine lists the top-level definitions of a file: its types first, then
+// its functions and the rest.
+func fileLine(f codeindex.FileSymbols) string {
+	var names []string
+	symbols := slices.DeleteFunc(slices.Clone(f.Symbols), func(s codeindex.Symbol) bool {
+		return s.Kind == "method" || s.Kind == "heading"
+	})
+	slices.SortStableFunc(symbols, func(a, b codeindex.Symbol) int {
+		return cmp.Compare(kindOrder(a.Kind), kindOrder(b.Kind))
+	})
+	for _, s := range symbols[:min(len(symbols), maxSymbols)] {
+		names = append(names, s.Name)
+	}
+	line := strings.Repeat("  ", depth(f.Path)) + path.Base(f.Path)
+	if len(names) > 0 {
+		line += ": " + strings.Join(names, ", ")
+	}
+	if more := len(symbols) - maxSymbols; more > 0 {
+		line += fmt.Sprintf(" (+%d)", more)
+	}
+	return line
+}
+
+func kindOrder(kind string) int {
+	switch kind {
+	case "type", "class", "module":
+		return 0
+	case "function", "macro":
+		return 1
+	}
+	return 2
+}
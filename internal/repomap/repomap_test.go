@@ -0,0 +1,107 @@
+package repomap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mudaaaa/crushplus/internal/codeindex"
+	"github.com/mudaaaa/crushplus/internal/history"
+	"github.com/stretchr/testify/require"
+)
+
+type recentHistory struct {
+	history.Service
+	paths []string
+}
+
+func (h *recentHistory) ListRecentPaths(ctx context.Context, limit int) ([]string, error) {
+	return h.paths[:min(len(h.paths), limit)], nil
+}
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+
+	files := []codeindex.FileSymbols{
+		{Path: "README.md", Symbols: []codeindex.Symbol{{Name: "Usage", Kind: "heading"}}},
+		{Path: "cmd/main.go", Symbols: []codeindex.Symbol{{Name: "main", Kind: "function"}}},
+		{Path: "internal/agent/agent.go", Symbols: []codeindex.Symbol{
+			{Name: "New", Kind: "function"},
+			{Name: "Agent.Run", Kind: "method"},
+			{Name: "Agent", Kind: "type"},
+		}},
+		{Path: "internal/agent/tools/bash.go", Symbols: []codeindex.Symbol{{Name: "NewBashTool", Kind: "function"}}},
+		{Path: "internal/ui/view.go", Symbols: []codeindex.Symbol{{Name: "View", Kind: "type"}}},
+	}
+
+	require.Equal(t, strings.Join([]string{
+		"README.md",
+		"cmd/",
+		"  main.go: main",
+		"internal/",
+		"  agent/",
+		"    agent.go: Agent, New",
+		"    tools/",
+		"      bash.go: NewBashTool",
+		"  ui/",
+		"    view.go: View",
+	}, "\n"), render(files, nil, 10_000))
+
+	// With a small budget, the files next to the edited ones are kept.
+	got := render(files, []string{"internal/agent/tools/bash.go"}, 60)
+	require.Equal(t, strings.Join([]string{
+		"internal/",
+		"  agent/",
+		"    tools/",
+		"      bash.go: NewBashTool",
+		"(4 more files not shown)",
+	}, "\n"), got)
+
+	require.Empty(t, render(nil, nil, 10_000))
+}
+
+func TestRelevance(t *testing.T) {
+	t.Parallel()
+
+	recent := []string{"a/b/c.go", "x/y.go"}
+	require.Greater(t, relevance("a/b/c.go", recent), relevance("a/b/d.go", recent))
+	require.Greater(t, relevance("a/b/d.go", recent), relevance("a/e.go", recent))
+	require.Greater(t, relevance("a/e.go", recent), relevance("z/w/v.go", recent))
+	require.Greater(t, relevance("a/b/d.go", recent), relevance("x/z.go", recent), "the latest edits weigh the most")
+	require.Greater(t, relevance("main.go", nil), relevance("a/b.go", nil))
+}
+
+func TestMap(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"main.go":         "package main\n\nfunc main() {}\n",
+		"server/serve.go": "package server\n\ntype Server struct{}\n",
+	} {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	idx := codeindex.New(root, t.TempDir())
+	m := New(idx, &recentHistory{paths: []string{filepath.Join(root, "server/serve.go"), "/elsewhere/file.go"}})
+
+	// Nothing is shown before the index is built.
+	require.Empty(t, m.Render(t.Context(), 1000))
+	require.False(t, m.Changed())
+
+	require.NoError(t, idx.Refresh(t.Context()))
+	require.True(t, m.Changed())
+	require.Equal(t, "main.go: main\nserver/\n  serve.go: Server", m.Render(t.Context(), 1000))
+	require.False(t, m.Changed())
+	require.Equal(t, []string{"server/serve.go"}, m.recent(t.Context()))
+
+	// Edits invalidate the map.
+	path := filepath.Join(root, "server/serve.go")
+	require.NoError(t, os.WriteFile(path, []byte("package server\n\ntype Server struct{}\n\nfunc Listen() {}\n"), 0o644))
+	idx.Update(path)
+	require.True(t, m.Changed())
+	require.Equal(t, "main.go: main\nserver/\n  serve.go: Server, Listen", m.Render(t.Context(), 1000))
+}
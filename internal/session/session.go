@@ -21,8 +21,14 @@ type Session struct {
 	CompletionTokens int64
 	SummaryMessageID string
 	Cost             float64
-	CreatedAt        int64
-	UpdatedAt        int64
+	// TaskTokens are the tokens spent by the task sub-agents of the session,
+	// whose cost is part of Cost.
+	TaskTokens int64
+	// Plan is the approved plan pinned to the session while it's carried
+	// out, empty when there's none. It's set with SetPlan only, not Save.
+	Plan      string
+	CreatedAt int64
+	UpdatedAt int64
 }
 
 type Service interface {
@@ -33,6 +39,7 @@ type Service interface {
 	Get(ctx context.Context, id string) (Session, error)
 	List(ctx context.Context) ([]Session, error)
 	Save(ctx context.Context, session Session) (Session, error)
+	SetPlan(ctx context.Context, id, plan string) error
 	Delete(ctx context.Context, id string) error
 
 	// Agent tool session management
@@ -120,7 +127,8 @@ func (s *service) Save(ctx context.Context, session Session) (Session, error) {
 			String: session.SummaryMessageID,
 			Valid:  session.SummaryMessageID != "",
 		},
-		Cost: session.Cost,
+		Cost:       session.Cost,
+		TaskTokens: session.TaskTokens,
 	})
 	if err != nil {
 		return Session{}, err
@@ -130,6 +138,16 @@ func (s *service) Save(ctx context.Context, session Session) (Session, error) {
 	return session, nil
 }
 
+// SetPlan pins the plan to the session, or unpins it when it's empty. It
+// doesn't go through Save, so that the runs saving their session meanwhile
+// don't overwrite it.
+func (s *service) SetPlan(ctx context.Context, id, plan string) error {
+	return s.q.UpdateSessionPlan(ctx, db.UpdateSessionPlanParams{
+		ID:   id,
+		Plan: plan,
+	})
+}
+
 func (s *service) List(ctx context.Context) ([]Session, error) {
 	dbSessions, err := s.q.ListSessions(ctx)
 	if err != nil {
@@ -152,6 +170,8 @@ func (s service) fromDBItem(item db.Session) Session {
 		CompletionTokens: item.CompletionTokens,
 		SummaryMessageID: item.SummaryMessageID.String,
 		Cost:             item.Cost,
+		TaskTokens:       item.TaskTokens,
+		Plan:             item.Plan,
 		CreatedAt:        item.CreatedAt,
 		UpdatedAt:        item.UpdatedAt,
 	}
@@ -1,14 +1,18 @@
 package shell
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/mudaaaa/crushplus/internal/csync"
+	"github.com/mudaaaa/crushplus/internal/pubsub"
 )
 
 const (
@@ -16,35 +20,62 @@ const (
 	MaxBackgroundJobs = 50
 	// CompletedJobRetentionMinutes is how long to keep completed jobs before auto-cleanup (8 hours)
 	CompletedJobRetentionMinutes = 8 * 60
+	// ptyDrainTimeout is how long to wait for the rest of the output of a
+	// pseudo-terminal once the command completed, in case a process it left
+	// behind keeps the tty open.
+	ptyDrainTimeout = time.Second
 )
 
+// ErrNoInput is returned when writing input to a shell that doesn't run in a
+// pseudo-terminal.
+var ErrNoInput = errors.New("the shell doesn't run in a pseudo-terminal")
+
 // BackgroundShell represents a shell running in the background.
 type BackgroundShell struct {
-	ID          string
+	ID string
+	// SessionID is the session that started the shell.
+	SessionID   string
 	Command     string
 	Description string
 	Shell       *Shell
 	WorkingDir  string
-	ctx         context.Context
-	cancel      context.CancelFunc
-	stdout      *bytes.Buffer
-	stderr      *bytes.Buffer
+	StartedAt   time.Time
+	// PTY is true when the shell runs in a pseudo-terminal, which merges
+	// stderr into stdout and takes input.
+	PTY    bool
+	ctx    context.Context
+	cancel context.CancelFunc
+	stdout *OutputBuffer
+	stderr *OutputBuffer
+	// output interleaves stdout and stderr, as they'd show in a terminal.
+	output *OutputBuffer
+	// input is the master side of the pseudo-terminal, if any.
+	input       *os.File
 	done        chan struct{}
 	exitErr     error
-	completedAt int64 // Unix timestamp when job completed (0 if still running)
+	completedAt int64 // Unix timestamp in milliseconds when job completed (0 if still running)
 }
 
 // BackgroundShellManager manages background shell instances.
 type BackgroundShellManager struct {
 	shells *csync.Map[string, *BackgroundShell]
+	// outputDir is where the output of the jobs is spilled.
+	outputDir atomic.Value
 }
 
 var (
 	backgroundManager     *BackgroundShellManager
 	backgroundManagerOnce sync.Once
 	idCounter             atomic.Uint64
+	jobsBroker            = pubsub.NewBroker[BackgroundShellInfo]()
 )
 
+// SubscribeJobs returns a channel for the events of the background shells:
+// created when started, updated when completed and deleted when removed.
+func SubscribeJobs(ctx context.Context) <-chan pubsub.Event[BackgroundShellInfo] {
+	return jobsBroker.Subscribe(ctx)
+}
+
 // GetBackgroundShellManager returns the singleton background shell manager.
 func GetBackgroundShellManager() *BackgroundShellManager {
 	backgroundManagerOnce.Do(func() {
@@ -55,49 +86,109 @@ func GetBackgroundShellManager() *BackgroundShellManager {
 	return backgroundManager
 }
 
-// Start creates and starts a new background shell with the given command.
-func (m *BackgroundShellManager) Start(ctx context.Context, workingDir string, blockFuncs []BlockFunc, command string, description string) (*BackgroundShell, error) {
+// SetOutputDir sets the directory the output of the jobs started from now on
+// is spilled to, the temporary directory otherwise.
+func (m *BackgroundShellManager) SetOutputDir(dir string) {
+	m.outputDir.Store(dir)
+}
+
+func (m *BackgroundShellManager) spillDir() string {
+	if dir, ok := m.outputDir.Load().(string); ok && dir != "" {
+		return dir
+	}
+	return os.TempDir()
+}
+
+// Start creates and starts a new background shell with the given command, on
+// behalf of the session.
+func (m *BackgroundShellManager) Start(ctx context.Context, sessionID, workingDir string, blockFuncs []BlockFunc, command string, description string) (*BackgroundShell, error) {
+	return m.StartShell(ctx, sessionID, NewShell(&Options{WorkingDir: workingDir, BlockFuncs: blockFuncs}), command, description, false)
+}
+
+// StartPTY is like Start, but runs the command in a pseudo-terminal, for
+// commands that need a TTY, and takes input with WriteInput.
+func (m *BackgroundShellManager) StartPTY(ctx context.Context, sessionID, workingDir string, blockFuncs []BlockFunc, command string, description string) (*BackgroundShell, error) {
+	return m.StartShell(ctx, sessionID, NewShell(&Options{WorkingDir: workingDir, BlockFuncs: blockFuncs}), command, description, true)
+}
+
+// StartShell starts the command in the shell, like a copy of the shell of the
+// session, in a pseudo-terminal if asked. The state the command leaves is
+// kept in the shell.
+func (m *BackgroundShellManager) StartShell(ctx context.Context, sessionID string, shell *Shell, command string, description string, usePTY bool) (*BackgroundShell, error) {
 	// Check job limit
 	if m.shells.Len() >= MaxBackgroundJobs {
 		return nil, fmt.Errorf("maximum number of background jobs (%d) reached. Please terminate or wait for some jobs to complete", MaxBackgroundJobs)
 	}
 
-	id := fmt.Sprintf("%03X", idCounter.Add(1))
+	var master, tty *os.File
+	if usePTY {
+		var err error
+		if master, tty, err = openPTY(); err != nil {
+			return nil, err
+		}
+	}
 
-	shell := NewShell(&Options{
-		WorkingDir: workingDir,
-		BlockFuncs: blockFuncs,
-	})
+	id := fmt.Sprintf("%03X", idCounter.Add(1))
 
 	shellCtx, cancel := context.WithCancel(ctx)
 
 	bgShell := &BackgroundShell{
 		ID:          id,
+		SessionID:   sessionID,
 		Command:     command,
 		Description: description,
-		WorkingDir:  workingDir,
+		WorkingDir:  shell.GetWorkingDir(),
+		StartedAt:   time.Now(),
+		PTY:         usePTY,
 		Shell:       shell,
 		ctx:         shellCtx,
 		cancel:      cancel,
-		stdout:      &bytes.Buffer{},
-		stderr:      &bytes.Buffer{},
+		stdout:      NewOutputBuffer(MaxOutputBufferSize, ""),
+		stderr:      NewOutputBuffer(MaxOutputBufferSize, ""),
+		output:      NewOutputBuffer(MaxOutputBufferSize, m.spillDir()),
+		input:       master,
 		done:        make(chan struct{}),
 	}
 
 	m.shells.Set(id, bgShell)
+	jobsBroker.Publish(pubsub.CreatedEvent, bgShell.Info())
 
 	go func() {
-		defer close(bgShell.done)
-
-		err := shell.ExecStream(shellCtx, command, bgShell.stdout, bgShell.stderr)
+		var err error
+		if usePTY {
+			err = bgShell.execPTY(tty)
+		} else {
+			err = shell.ExecStream(shellCtx, command, io.MultiWriter(bgShell.stdout, bgShell.output), io.MultiWriter(bgShell.stderr, bgShell.output))
+		}
 
 		bgShell.exitErr = err
-		atomic.StoreInt64(&bgShell.completedAt, time.Now().Unix())
+		atomic.StoreInt64(&bgShell.completedAt, time.Now().UnixMilli())
+		close(bgShell.done)
+		jobsBroker.Publish(pubsub.UpdatedEvent, bgShell.Info())
 	}()
 
 	return bgShell, nil
 }
 
+// execPTY runs the command with the tty, copying the output of the
+// pseudo-terminal until the command completes and the tty is closed.
+func (bs *BackgroundShell) execPTY(tty *os.File) error {
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		_, _ = io.Copy(io.MultiWriter(bs.stdout, bs.output), bs.input)
+	}()
+
+	err := bs.Shell.ExecTTY(bs.ctx, bs.Command, tty)
+	tty.Close()
+	select {
+	case <-copied:
+	case <-time.After(ptyDrainTimeout):
+	}
+	bs.input.Close()
+	return err
+}
+
 // Get retrieves a background shell by ID.
 func (m *BackgroundShellManager) Get(id string) (*BackgroundShell, bool) {
 	return m.shells.Get(id)
@@ -106,10 +197,12 @@ func (m *BackgroundShellManager) Get(id string) (*BackgroundShell, bool) {
 // Remove removes a background shell from the manager without terminating it.
 // This is useful when a shell has already completed and you just want to clean up tracking.
 func (m *BackgroundShellManager) Remove(id string) error {
-	_, ok := m.shells.Take(id)
+	shell, ok := m.shells.Take(id)
 	if !ok {
 		return fmt.Errorf("background shell not found: %s", id)
 	}
+	shell.output.Close()
+	jobsBroker.Publish(pubsub.DeletedEvent, shell.Info())
 	return nil
 }
 
@@ -122,14 +215,61 @@ func (m *BackgroundShellManager) Kill(id string) error {
 
 	shell.cancel()
 	<-shell.done
+	shell.output.Close()
+	jobsBroker.Publish(pubsub.DeletedEvent, shell.Info())
 	return nil
 }
 
+// KillSession terminates the background shells the session started, and
+// returns how many there were.
+func (m *BackgroundShellManager) KillSession(sessionID string) int {
+	jobs := m.Jobs(sessionID)
+	for _, job := range jobs {
+		_ = m.Kill(job.ID)
+	}
+	return len(jobs)
+}
+
+// Jobs returns the background shells the session started, running or
+// completed, oldest first.
+func (m *BackgroundShellManager) Jobs(sessionID string) []*BackgroundShell {
+	var jobs []*BackgroundShell
+	for shell := range m.shells.Seq() {
+		if shell.SessionID == sessionID {
+			jobs = append(jobs, shell)
+		}
+	}
+	slices.SortFunc(jobs, func(a, b *BackgroundShell) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+	return jobs
+}
+
 // BackgroundShellInfo contains information about a background shell.
 type BackgroundShellInfo struct {
 	ID          string
+	SessionID   string
 	Command     string
 	Description string
+	WorkingDir  string
+	StartedAt   time.Time
+	PTY         bool
+	// CompletedAt is zero while the shell is running.
+	CompletedAt time.Time
+	ExitCode    int
+}
+
+// Done reports whether the shell had completed.
+func (i BackgroundShellInfo) Done() bool {
+	return !i.CompletedAt.IsZero()
+}
+
+// Runtime returns how long the shell ran, or has been running so far.
+func (i BackgroundShellInfo) Runtime() time.Duration {
+	if i.Done() {
+		return i.CompletedAt.Sub(i.StartedAt)
+	}
+	return time.Since(i.StartedAt)
 }
 
 // List returns all background shell IDs.
@@ -143,13 +283,13 @@ func (m *BackgroundShellManager) List() []string {
 
 // Cleanup removes completed jobs that have been finished for more than the retention period
 func (m *BackgroundShellManager) Cleanup() int {
-	now := time.Now().Unix()
-	retentionSeconds := int64(CompletedJobRetentionMinutes * 60)
+	now := time.Now().UnixMilli()
+	retention := int64(CompletedJobRetentionMinutes * 60 * 1000)
 
 	var toRemove []string
 	for shell := range m.shells.Seq() {
 		completedAt := atomic.LoadInt64(&shell.completedAt)
-		if completedAt > 0 && now-completedAt > retentionSeconds {
+		if completedAt > 0 && now-completedAt > retention {
 			toRemove = append(toRemove, shell.ID)
 		}
 	}
@@ -172,10 +312,13 @@ func (m *BackgroundShellManager) KillAll() {
 	for _, shell := range shells {
 		shell.cancel()
 		<-shell.done
+		shell.output.Close()
+		jobsBroker.Publish(pubsub.DeletedEvent, shell.Info())
 	}
 }
 
-// GetOutput returns the current output of a background shell.
+// GetOutput returns the current output of a background shell. Only the
+// latest MaxOutputBufferSize bytes of stdout and stderr are kept.
 func (bs *BackgroundShell) GetOutput() (stdout string, stderr string, done bool, err error) {
 	select {
 	case <-bs.done:
@@ -200,3 +343,54 @@ func (bs *BackgroundShell) Wait() {
 	<-bs.done
 }
 
+// Info returns the information about the background shell.
+func (bs *BackgroundShell) Info() BackgroundShellInfo {
+	info := BackgroundShellInfo{
+		ID:          bs.ID,
+		SessionID:   bs.SessionID,
+		Command:     bs.Command,
+		Description: bs.Description,
+		WorkingDir:  bs.WorkingDir,
+		StartedAt:   bs.StartedAt,
+		PTY:         bs.PTY,
+	}
+	if bs.IsDone() {
+		info.CompletedAt = time.UnixMilli(atomic.LoadInt64(&bs.completedAt))
+		info.ExitCode = ExitCode(bs.exitErr)
+	}
+	return info
+}
+
+// WriteInput writes the input to the pseudo-terminal of the background shell,
+// as if typed. It returns ErrNoInput when the shell doesn't run in one.
+func (bs *BackgroundShell) WriteInput(input []byte) error {
+	if bs.input == nil {
+		return ErrNoInput
+	}
+	if bs.IsDone() {
+		return errors.New("the shell has completed")
+	}
+	_, err := bs.input.Write(input)
+	return err
+}
+
+// Done returns a channel closed when the background shell completes.
+func (bs *BackgroundShell) Done() <-chan struct{} {
+	return bs.done
+}
+
+// Output returns the output of the background shell, stdout and stderr
+// interleaved, to read incrementally.
+func (bs *BackgroundShell) Output() *OutputBuffer {
+	return bs.output
+}
+
+// ExitErr returns the error the background shell exited with, once done.
+func (bs *BackgroundShell) ExitErr() error {
+	select {
+	case <-bs.done:
+		return bs.exitErr
+	default:
+		return nil
+	}
+}
@@ -2,9 +2,12 @@ package shell
 
 import (
 	"context"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/require"
 )
 
 func TestBackgroundShellManager_Start(t *testing.T) {
@@ -15,7 +18,7 @@ func TestBackgroundShellManager_Start(t *testing.T) {
 	workingDir := t.TempDir()
 	manager := GetBackgroundShellManager()
 
-	bgShell, err := manager.Start(ctx, workingDir, nil, "echo 'hello world'", "")
+	bgShell, err := manager.Start(ctx, "", workingDir, nil, "echo 'hello world'", "")
 	if err != nil {
 		t.Fatalf("failed to start background shell: %v", err)
 	}
@@ -52,7 +55,7 @@ func TestBackgroundShellManager_Get(t *testing.T) {
 	workingDir := t.TempDir()
 	manager := GetBackgroundShellManager()
 
-	bgShell, err := manager.Start(ctx, workingDir, nil, "echo 'test'", "")
+	bgShell, err := manager.Start(ctx, "", workingDir, nil, "echo 'test'", "")
 	if err != nil {
 		t.Fatalf("failed to start background shell: %v", err)
 	}
@@ -79,7 +82,7 @@ func TestBackgroundShellManager_Kill(t *testing.T) {
 	manager := GetBackgroundShellManager()
 
 	// Start a long-running command
-	bgShell, err := manager.Start(ctx, workingDir, nil, "sleep 10", "")
+	bgShell, err := manager.Start(ctx, "", workingDir, nil, "sleep 10", "")
 	if err != nil {
 		t.Fatalf("failed to start background shell: %v", err)
 	}
@@ -120,7 +123,7 @@ func TestBackgroundShell_IsDone(t *testing.T) {
 	workingDir := t.TempDir()
 	manager := GetBackgroundShellManager()
 
-	bgShell, err := manager.Start(ctx, workingDir, nil, "echo 'quick'", "")
+	bgShell, err := manager.Start(ctx, "", workingDir, nil, "echo 'quick'", "")
 	if err != nil {
 		t.Fatalf("failed to start background shell: %v", err)
 	}
@@ -147,7 +150,7 @@ func TestBackgroundShell_WithBlockFuncs(t *testing.T) {
 		CommandsBlocker([]string{"curl", "wget"}),
 	}
 
-	bgShell, err := manager.Start(ctx, workingDir, blockFuncs, "curl example.com", "")
+	bgShell, err := manager.Start(ctx, "", workingDir, blockFuncs, "curl example.com", "")
 	if err != nil {
 		t.Fatalf("failed to start background shell: %v", err)
 	}
@@ -178,12 +181,12 @@ func TestBackgroundShellManager_List(t *testing.T) {
 	manager := GetBackgroundShellManager()
 
 	// Start two shells
-	bgShell1, err := manager.Start(ctx, workingDir, nil, "sleep 1", "")
+	bgShell1, err := manager.Start(ctx, "", workingDir, nil, "sleep 1", "")
 	if err != nil {
 		t.Fatalf("failed to start first background shell: %v", err)
 	}
 
-	bgShell2, err := manager.Start(ctx, workingDir, nil, "sleep 1", "")
+	bgShell2, err := manager.Start(ctx, "", workingDir, nil, "sleep 1", "")
 	if err != nil {
 		t.Fatalf("failed to start second background shell: %v", err)
 	}
@@ -222,17 +225,17 @@ func TestBackgroundShellManager_KillAll(t *testing.T) {
 	manager := GetBackgroundShellManager()
 
 	// Start multiple long-running shells
-	shell1, err := manager.Start(ctx, workingDir, nil, "sleep 10", "")
+	shell1, err := manager.Start(ctx, "", workingDir, nil, "sleep 10", "")
 	if err != nil {
 		t.Fatalf("failed to start shell 1: %v", err)
 	}
 
-	shell2, err := manager.Start(ctx, workingDir, nil, "sleep 10", "")
+	shell2, err := manager.Start(ctx, "", workingDir, nil, "sleep 10", "")
 	if err != nil {
 		t.Fatalf("failed to start shell 2: %v", err)
 	}
 
-	shell3, err := manager.Start(ctx, workingDir, nil, "sleep 10", "")
+	shell3, err := manager.Start(ctx, "", workingDir, nil, "sleep 10", "")
 	if err != nil {
 		t.Fatalf("failed to start shell 3: %v", err)
 	}
@@ -275,3 +278,91 @@ func TestBackgroundShellManager_KillAll(t *testing.T) {
 		}
 	}
 }
+
+func TestBackgroundShellManager_Sessions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	workingDir := t.TempDir()
+	manager := GetBackgroundShellManager()
+
+	shell1, err := manager.Start(ctx, "session-jobs-1", workingDir, nil, "sleep 10", "first")
+	if err != nil {
+		t.Fatalf("failed to start shell 1: %v", err)
+	}
+	shell2, err := manager.Start(ctx, "session-jobs-1", workingDir, nil, "sleep 10", "second")
+	if err != nil {
+		t.Fatalf("failed to start shell 2: %v", err)
+	}
+	other, err := manager.Start(ctx, "session-jobs-2", workingDir, nil, "sleep 10", "other")
+	if err != nil {
+		t.Fatalf("failed to start other shell: %v", err)
+	}
+	defer manager.Kill(other.ID)
+
+	jobs := manager.Jobs("session-jobs-1")
+	if len(jobs) != 2 || jobs[0].ID != shell1.ID || jobs[1].ID != shell2.ID {
+		t.Fatalf("expected the two jobs of the session in start order, got %d", len(jobs))
+	}
+
+	info := shell1.Info()
+	if info.SessionID != "session-jobs-1" || info.Description != "first" || info.Done() {
+		t.Errorf("unexpected info: %+v", info)
+	}
+
+	if killed := manager.KillSession("session-jobs-1"); killed != 2 {
+		t.Errorf("expected 2 jobs killed, got %d", killed)
+	}
+	if !shell1.IsDone() || !shell2.IsDone() {
+		t.Error("the jobs of the session should be done after KillSession")
+	}
+	if len(manager.Jobs("session-jobs-1")) != 0 {
+		t.Error("the jobs of the session should be removed from the manager")
+	}
+	if other.IsDone() {
+		t.Error("the jobs of other sessions should keep running")
+	}
+}
+
+func TestBackgroundShellManager_StartPTY(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("pseudo-terminals are not supported on Windows")
+	}
+
+	manager := GetBackgroundShellManager()
+	bgShell, err := manager.StartPTY(t.Context(), "", t.TempDir(), nil, `sh -c 'test -t 0 && test -t 1 && echo "in a tty"'; read line; echo "got $line"; sleep 10`, "")
+	require.NoError(t, err)
+	defer manager.Kill(bgShell.ID)
+
+	require.True(t, bgShell.PTY)
+	require.Eventually(t, func() bool {
+		return strings.Contains(bgShell.Output().String(), "in a tty")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, bgShell.WriteInput([]byte("hello\r")))
+	require.Eventually(t, func() bool {
+		return strings.Contains(bgShell.Output().String(), "got hello")
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Ctrl+C interrupts the command in the foreground of the terminal, once
+	// it started.
+	require.Eventually(t, func() bool {
+		_ = bgShell.WriteInput([]byte{0x03})
+		return bgShell.IsDone()
+	}, 5*time.Second, 100*time.Millisecond)
+	require.Equal(t, 130, ExitCode(bgShell.ExitErr()))
+	require.ErrorContains(t, bgShell.WriteInput([]byte("late")), "completed")
+}
+
+func TestBackgroundShell_WriteInputWithoutPTY(t *testing.T) {
+	t.Parallel()
+
+	manager := GetBackgroundShellManager()
+	bgShell, err := manager.Start(t.Context(), "", t.TempDir(), nil, "sleep 10", "")
+	require.NoError(t, err)
+	defer manager.Kill(bgShell.ID)
+
+	require.ErrorIs(t, bgShell.WriteInput([]byte("input")), ErrNoInput)
+}
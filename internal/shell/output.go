@@ -0,0 +1,238 @@
+package shell
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxOutputBufferSize is how much of the latest output of a background
+	// job is kept in memory.
+	MaxOutputBufferSize = 1024 * 1024
+	// MaxOutputSpillSize is how much output of a background job is spilled to
+	// its file once it outgrows its memory buffer. Past that, only the latest
+	// output is kept.
+	MaxOutputSpillSize = 100 * 1024 * 1024
+	// JobOutputDir is the directory, inside the data directory, where the
+	// output of background jobs is spilled.
+	JobOutputDir = "job-output"
+	// staleJobOutputAge is how long a spill file must have been left alone
+	// to be taken for one of a previous run.
+	staleJobOutputAge = time.Hour
+	// minRingGrowth is the smallest allocation of a growing ring buffer.
+	minRingGrowth = 4 * 1024
+)
+
+// PruneJobOutput removes the spill files that previous runs left in dir, when
+// they didn't exit cleanly.
+func PruneJobOutput(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err == nil && !e.IsDir() && time.Since(info.ModTime()) > staleJobOutputAge {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
+
+// OutputBuffer keeps the latest output of a command in a ring buffer of
+// bounded size, which grows with the output up to its size. Offsets are
+// counted in bytes from the start of the output.
+//
+// When the output outgrows the ring buffer and spilling is on, all of it is
+// also written to a file, up to MaxOutputSpillSize, so that older output can
+// still be read.
+type OutputBuffer struct {
+	mu sync.Mutex
+	// ring holds the latest output. It grows with the output until it
+	// reaches size, and wraps around from then on.
+	ring     []byte
+	size     int
+	total    int64
+	spill    bool
+	spillDir string
+	file     *os.File
+	spilled  int64
+	changed  chan struct{}
+	closed   bool
+}
+
+// NewOutputBuffer returns a buffer keeping the latest size bytes of output,
+// spilling all of it to a file in spillDir when it's not empty. The directory
+// is created if needed.
+func NewOutputBuffer(size int, spillDir string) *OutputBuffer {
+	return &OutputBuffer{
+		size:     size,
+		spill:    spillDir != "",
+		spillDir: spillDir,
+		changed:  make(chan struct{}),
+	}
+}
+
+// Write appends output to the buffer.
+func (b *OutputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	size := int64(b.size)
+	if b.spill && !b.closed && b.total+int64(len(p)) > size {
+		b.spillOutput(p)
+	}
+	b.grow(min(b.total+int64(len(p)), size))
+
+	// Only the last bytes of writes larger than the ring survive.
+	data := p
+	offset := b.total
+	if int64(len(data)) > size {
+		offset += int64(len(data)) - size
+		data = data[int64(len(data))-size:]
+	}
+	for len(data) > 0 {
+		n := copy(b.ring[offset%size:], data)
+		data = data[n:]
+		offset += int64(n)
+	}
+	b.total += int64(len(p))
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+	return len(p), nil
+}
+
+// grow extends the ring buffer, while it's not full, to hold n bytes of
+// output. Until the ring is full, the output is at the offsets it has in the
+// ring, so it wraps around correctly once it's full.
+func (b *OutputBuffer) grow(n int64) {
+	if n <= int64(len(b.ring)) {
+		return
+	}
+	if n > int64(cap(b.ring)) {
+		capacity := min(int64(b.size), max(n, 2*int64(cap(b.ring)), minRingGrowth))
+		ring := make([]byte, len(b.ring), capacity)
+		copy(ring, b.ring)
+		b.ring = ring
+	}
+	b.ring = b.ring[:n]
+}
+
+// spillOutput writes the output to the spill file, creating it with the
+// output so far on the first spill. Spilling stops when the file is full or
+// can't be written.
+func (b *OutputBuffer) spillOutput(p []byte) {
+	if b.file == nil {
+		if b.spilled > 0 {
+			return
+		}
+		if err := os.MkdirAll(b.spillDir, 0o755); err != nil {
+			b.spill = false
+			return
+		}
+		file, err := os.CreateTemp(b.spillDir, "crush-job-*.log")
+		if err != nil {
+			b.spill = false
+			return
+		}
+		b.file = file
+		// Nothing was dropped from the ring yet.
+		if _, err := file.Write(b.ring[:b.total]); err != nil {
+			b.closeFile()
+			return
+		}
+		b.spilled = b.total
+	}
+	p = p[:min(int64(len(p)), MaxOutputSpillSize-b.spilled)]
+	n, err := b.file.Write(p)
+	b.spilled += int64(n)
+	if err != nil || b.spilled >= MaxOutputSpillSize {
+		// Keep the file to read from, but stop writing to it.
+		b.spill = false
+	}
+}
+
+// Len returns the size of all the output written so far, which is the
+// offset of the next output.
+func (b *OutputBuffer) Len() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.total
+}
+
+// String returns the output still in memory.
+func (b *OutputBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	start := max(0, b.total-int64(len(b.ring)))
+	return string(b.readRing(start, b.total))
+}
+
+// Read returns up to limit bytes of output from the offset, and the offset
+// they start at. The start is past the offset when the output at the offset
+// is no longer available, either in memory or in the spill file.
+func (b *OutputBuffer) Read(offset int64, limit int) ([]byte, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	offset = max(0, min(offset, b.total))
+	end := min(b.total, offset+int64(limit))
+
+	ringStart := max(0, b.total-int64(len(b.ring)))
+	if offset >= ringStart {
+		return b.readRing(offset, end), offset
+	}
+	if b.file != nil && offset < b.spilled {
+		data := make([]byte, min(end, b.spilled)-offset)
+		if n, err := b.file.ReadAt(data, offset); err == nil || errors.Is(err, io.EOF) {
+			return data[:n], offset
+		}
+	}
+	end = min(b.total, ringStart+int64(limit))
+	return b.readRing(ringStart, end), ringStart
+}
+
+// readRing returns the output between the offsets, which must be in memory.
+func (b *OutputBuffer) readRing(start, end int64) []byte {
+	size := int64(len(b.ring))
+	data := make([]byte, 0, end-start)
+	for start < end {
+		i := start % size
+		j := min(size, i+end-start)
+		data = append(data, b.ring[i:j]...)
+		start += j - i
+	}
+	return data
+}
+
+// Changed returns a channel closed on the next write to the buffer.
+func (b *OutputBuffer) Changed() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.changed
+}
+
+// Close removes the spill file. Output written afterwards is only kept in
+// memory.
+func (b *OutputBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return b.closeFile()
+}
+
+func (b *OutputBuffer) closeFile() error {
+	b.spill = false
+	if b.file == nil {
+		return nil
+	}
+	err := errors.Join(b.file.Close(), os.Remove(b.file.Name()))
+	b.file = nil
+	return err
+}
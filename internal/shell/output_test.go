@@ -0,0 +1,109 @@
+package shell
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputBuffer(t *testing.T) {
+	t.Parallel()
+
+	b := NewOutputBuffer(8, "")
+	_, err := b.Write([]byte("hello "))
+	require.NoError(t, err)
+	_, err = b.Write([]byte("world"))
+	require.NoError(t, err)
+
+	require.Equal(t, int64(11), b.Len())
+	require.Equal(t, "lo world", b.String())
+
+	data, start := b.Read(6, 100)
+	require.Equal(t, "world", string(data))
+	require.Equal(t, int64(6), start)
+
+	// The start was dropped from the ring.
+	data, start = b.Read(0, 4)
+	require.Equal(t, "lo w", string(data))
+	require.Equal(t, int64(3), start)
+
+	data, start = b.Read(20, 4)
+	require.Empty(t, data)
+	require.Equal(t, int64(11), start)
+
+	_, err = b.Write([]byte("0123456789"))
+	require.NoError(t, err)
+	require.Equal(t, "23456789", b.String())
+}
+
+func TestOutputBufferSpill(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	b := NewOutputBuffer(8, dir)
+	t.Cleanup(func() { require.NoError(t, b.Close()) })
+
+	changed := b.Changed()
+	_, err := b.Write([]byte("line 1\n"))
+	require.NoError(t, err)
+	select {
+	case <-changed:
+	default:
+		t.Fatal("expected the write to be notified")
+	}
+
+	_, err = b.Write([]byte(strings.Repeat("line 2\n", 3)))
+	require.NoError(t, err)
+	require.Equal(t, "\nline 2\n", b.String())
+
+	// The output dropped from the ring is read from the spill file.
+	data, start := b.Read(0, 14)
+	require.Equal(t, "line 1\nline 2\n", string(data))
+	require.Equal(t, int64(0), start)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+}
+
+func TestOutputBufferGrowth(t *testing.T) {
+	t.Parallel()
+
+	// The ring only takes the memory of the output so far.
+	b := NewOutputBuffer(MaxOutputBufferSize, "")
+	_, err := b.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.Equal(t, minRingGrowth, cap(b.ring))
+
+	chunk := strings.Repeat("x", 3000)
+	for range 400 {
+		_, err = b.Write([]byte(chunk))
+		require.NoError(t, err)
+	}
+	require.Equal(t, MaxOutputBufferSize, cap(b.ring))
+	require.Equal(t, int64(5+400*3000), b.Len())
+	require.Equal(t, strings.Repeat("x", MaxOutputBufferSize), b.String())
+
+	data, start := b.Read(b.Len()-3, 10)
+	require.Equal(t, "xxx", string(data))
+	require.Equal(t, b.Len()-3, start)
+}
+
+func TestPruneJobOutput(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	old, recent := filepath.Join(dir, "old.log"), filepath.Join(dir, "recent.log")
+	require.NoError(t, os.WriteFile(old, nil, 0o644))
+	require.NoError(t, os.WriteFile(recent, nil, 0o644))
+	past := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(old, past, past))
+
+	PruneJobOutput(dir)
+	require.NoFileExists(t, old)
+	require.FileExists(t, recent)
+}
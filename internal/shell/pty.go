@@ -0,0 +1,16 @@
+package shell
+
+import "errors"
+
+const (
+	// PTYRows and PTYCols are the size of the pseudo-terminals commands run
+	// in.
+	PTYRows = 40
+	PTYCols = 120
+	// PTYTerm is the terminal type of the pseudo-terminals.
+	PTYTerm = "xterm-256color"
+)
+
+// ErrPTYUnsupported is returned when pseudo-terminals aren't available on the
+// platform.
+var ErrPTYUnsupported = errors.New("pseudo-terminals are not supported on this platform")
@@ -0,0 +1,108 @@
+//go:build !windows
+
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/creack/pty"
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/interp"
+)
+
+// openPTY opens a pseudo-terminal, returning its master side, to read the
+// output and write the input, and its tty side, for the commands.
+func openPTY() (master, tty *os.File, err error) {
+	master, tty, err = pty.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open pseudo-terminal: %w", err)
+	}
+	if err := pty.Setsize(master, &pty.Winsize{Rows: PTYRows, Cols: PTYCols}); err != nil {
+		master.Close()
+		tty.Close()
+		return nil, nil, fmt.Errorf("could not size pseudo-terminal: %w", err)
+	}
+	return master, tty, nil
+}
+
+// ttyExecHandler runs the commands reading from the tty in a new session with
+// the tty as their controlling terminal, so that they get the signals of keys
+// like ctrl+c and can open /dev/tty. Other commands, like the later ones of a
+// pipeline, run as usual.
+func ttyExecHandler(tty *os.File) func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+		return func(ctx context.Context, args []string) error {
+			hc := interp.HandlerCtx(ctx)
+			if hc.Stdin != tty {
+				return next(ctx, args)
+			}
+			path, err := interp.LookPathDir(hc.Dir, hc.Env, args[0])
+			if err != nil {
+				fmt.Fprintln(hc.Stderr, err)
+				return interp.ExitStatus(127)
+			}
+
+			newCmd := func(ctty bool) *exec.Cmd {
+				return &exec.Cmd{
+					Path:        path,
+					Args:        args,
+					Env:         ttyEnv(hc.Env),
+					Dir:         hc.Dir,
+					Stdin:       hc.Stdin,
+					Stdout:      hc.Stdout,
+					Stderr:      hc.Stderr,
+					SysProcAttr: &syscall.SysProcAttr{Setsid: true, Setctty: ctty},
+				}
+			}
+			cmd := newCmd(true)
+			err = cmd.Start()
+			if errors.Is(err, syscall.EPERM) {
+				// The tty is already the controlling terminal of another
+				// command running alongside, e.g. with &.
+				cmd = newCmd(false)
+				err = cmd.Start()
+			}
+			if err != nil {
+				fmt.Fprintln(hc.Stderr, err)
+				return interp.ExitStatus(127)
+			}
+
+			// The command leads its own session and process group, so kill
+			// the whole group when cancelled.
+			stop := context.AfterFunc(ctx, func() {
+				_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			})
+			defer stop()
+
+			err = cmd.Wait()
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					return interp.ExitStatus(128 + status.Signal())
+				}
+				return interp.ExitStatus(exitErr.ExitCode())
+			}
+			return err
+		}
+	}
+}
+
+// ttyEnv returns the exported variables of the environment, with the terminal
+// type of the pseudo-terminal.
+func ttyEnv(env expand.Environ) []string {
+	list := []string{"TERM=" + PTYTerm}
+	for name, vr := range env.Each {
+		if vr.Exported && vr.IsSet() && vr.Kind == expand.String && name != "TERM" {
+			list = append(list, name+"="+vr.String())
+		}
+	}
+	return list
+}
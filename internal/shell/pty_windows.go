@@ -0,0 +1,22 @@
+//go:build windows
+
+package shell
+
+import (
+	"os"
+
+	"mvdan.cc/sh/v3/interp"
+)
+
+// openPTY returns ErrPTYUnsupported, as pseudo-terminals aren't supported on
+// Windows.
+func openPTY() (master, tty *os.File, err error) {
+	return nil, nil, ErrPTYUnsupported
+}
+
+// ttyExecHandler runs the commands as usual, as there are no ttys on Windows.
+func ttyExecHandler(tty *os.File) func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+	return func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+		return next
+	}
+}
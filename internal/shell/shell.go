@@ -15,6 +15,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"slices"
 	"strings"
@@ -53,11 +54,21 @@ type BlockFunc func(args []string) bool
 type Shell struct {
 	env        []string
 	cwd        string
+	funcs      map[string]*syntax.Stmt
 	mu         sync.Mutex
 	logger     Logger
 	blockFuncs []BlockFunc
 }
 
+// State is what a shell carries from one command to the next.
+type State struct {
+	WorkingDir string
+	// Env holds the exported variables, as "name=value".
+	Env []string
+	// Funcs holds the definitions of the shell functions, as shell source.
+	Funcs string
+}
+
 // Options for creating a new shell
 type Options struct {
 	WorkingDir string
@@ -111,6 +122,78 @@ func (s *Shell) ExecStream(ctx context.Context, command string, stdout, stderr i
 	return s.execStream(ctx, command, stdout, stderr)
 }
 
+// ExecTTY executes a command in the shell with the tty of a pseudo-terminal
+// as its standard input, output and error, so that it runs as in a terminal.
+func (s *Shell) ExecTTY(ctx context.Context, command string, tty *os.File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.execCommon(ctx, command, tty, tty, tty)
+}
+
+// Clone returns a copy of the shell, with its own state, to run commands
+// without affecting the shell, like a subshell.
+func (s *Shell) Clone() *Shell {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &Shell{
+		env:        slices.Clone(s.env),
+		cwd:        s.cwd,
+		funcs:      maps.Clone(s.funcs),
+		logger:     s.logger,
+		blockFuncs: s.blockFuncs,
+	}
+}
+
+// State returns the working directory, exported variables and functions of
+// the shell.
+func (s *Shell) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var funcs strings.Builder
+	printer := syntax.NewPrinter()
+	for _, name := range slices.Sorted(maps.Keys(s.funcs)) {
+		decl := &syntax.FuncDecl{Parens: true, Name: &syntax.Lit{Value: name}, Body: s.funcs[name]}
+		if err := printer.Print(&funcs, &syntax.Stmt{Cmd: decl}); err != nil {
+			s.logger.InfoPersist("could not print shell function", "name", name, "err", err)
+			continue
+		}
+		funcs.WriteByte('\n')
+	}
+	return State{
+		WorkingDir: s.cwd,
+		Env:        slices.Clone(s.env),
+		Funcs:      funcs.String(),
+	}
+}
+
+// SetState restores the working directory, exported variables and functions
+// of the shell.
+func (s *Shell) SetState(state State) error {
+	funcs := make(map[string]*syntax.Stmt)
+	if state.Funcs != "" {
+		file, err := syntax.NewParser().Parse(strings.NewReader(state.Funcs), "")
+		if err != nil {
+			return fmt.Errorf("could not parse shell functions: %w", err)
+		}
+		for _, stmt := range file.Stmts {
+			if decl, ok := stmt.Cmd.(*syntax.FuncDecl); ok {
+				funcs[decl.Name.Value] = decl.Body
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cwd = state.WorkingDir
+	s.env = slices.Clone(state.Env)
+	s.funcs = funcs
+	return nil
+}
+
 // GetWorkingDir returns the current working directory
 func (s *Shell) GetWorkingDir() string {
 	s.mu.Lock()
@@ -236,34 +319,51 @@ func (s *Shell) blockHandler() func(next interp.ExecHandlerFunc) interp.ExecHand
 	}
 }
 
-// newInterp creates a new interpreter with the current shell state
-func (s *Shell) newInterp(stdout, stderr io.Writer) (*interp.Runner, error) {
-	return interp.New(
-		interp.StdIO(nil, stdout, stderr),
+// newInterp creates a new interpreter with the current shell state. The tty,
+// if any, is the standard input of the commands.
+func (s *Shell) newInterp(tty *os.File, stdout, stderr io.Writer) (*interp.Runner, error) {
+	var stdin io.Reader
+	if tty != nil {
+		stdin = tty
+	}
+	runner, err := interp.New(
+		interp.StdIO(stdin, stdout, stderr),
 		interp.Interactive(false),
 		interp.Env(expand.ListEnviron(s.env...)),
 		interp.Dir(s.cwd),
-		interp.ExecHandlers(s.execHandlers()...),
+		interp.ExecHandlers(s.execHandlers(tty)...),
 	)
+	if err != nil {
+		return nil, err
+	}
+	// Reset now rather than on the first run, which would drop the functions.
+	runner.Reset()
+	runner.Funcs = maps.Clone(s.funcs)
+	return runner, nil
 }
 
-// updateShellFromRunner updates the shell from the interpreter after execution
+// updateShellFromRunner updates the shell from the interpreter after
+// execution, keeping the exported variables and the functions.
 func (s *Shell) updateShellFromRunner(runner *interp.Runner) {
 	s.cwd = runner.Dir
 	s.env = nil
 	for name, vr := range runner.Vars {
-		s.env = append(s.env, fmt.Sprintf("%s=%s", name, vr.Str))
+		if vr.Exported && vr.IsSet() && vr.Kind == expand.String {
+			s.env = append(s.env, fmt.Sprintf("%s=%s", name, vr.Str))
+		}
 	}
+	slices.Sort(s.env)
+	s.funcs = maps.Clone(runner.Funcs)
 }
 
 // execCommon is the shared implementation for executing commands
-func (s *Shell) execCommon(ctx context.Context, command string, stdout, stderr io.Writer) error {
+func (s *Shell) execCommon(ctx context.Context, command string, tty *os.File, stdout, stderr io.Writer) error {
 	line, err := syntax.NewParser().Parse(strings.NewReader(command), "")
 	if err != nil {
 		return fmt.Errorf("could not parse command: %w", err)
 	}
 
-	runner, err := s.newInterp(stdout, stderr)
+	runner, err := s.newInterp(tty, stdout, stderr)
 	if err != nil {
 		return fmt.Errorf("could not run command: %w", err)
 	}
@@ -277,19 +377,22 @@ func (s *Shell) execCommon(ctx context.Context, command string, stdout, stderr i
 // exec executes commands using a cross-platform shell interpreter.
 func (s *Shell) exec(ctx context.Context, command string) (string, string, error) {
 	var stdout, stderr bytes.Buffer
-	err := s.execCommon(ctx, command, &stdout, &stderr)
+	err := s.execCommon(ctx, command, nil, &stdout, &stderr)
 	return stdout.String(), stderr.String(), err
 }
 
 // execStream executes commands using POSIX shell emulation with streaming output
 func (s *Shell) execStream(ctx context.Context, command string, stdout, stderr io.Writer) error {
-	return s.execCommon(ctx, command, stdout, stderr)
+	return s.execCommon(ctx, command, nil, stdout, stderr)
 }
 
-func (s *Shell) execHandlers() []func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
+func (s *Shell) execHandlers(tty *os.File) []func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
 	handlers := []func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc{
 		s.blockHandler(),
 	}
+	if tty != nil {
+		handlers = append(handlers, ttyExecHandler(tty))
+	}
 	if useGoCoreUtils {
 		handlers = append(handlers, coreutils.ExecHandler)
 	}
@@ -2,8 +2,10 @@ package shell
 
 import (
 	"context"
+	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -118,3 +120,42 @@ func TestCrossPlatformExecution(t *testing.T) {
 		t.Errorf("Echo output should contain 'hello', got: %q", stdout)
 	}
 }
+
+func TestShellState(t *testing.T) {
+	tempDir := t.TempDir()
+
+	shell := NewShell(&Options{WorkingDir: t.TempDir(), Env: []string{"PATH=" + os.Getenv("PATH")}})
+	if _, _, err := shell.Exec(t.Context(), "export FOO=bar; LOCAL=1; greet() { echo \"hello $1\"; }; cd "+filepath.ToSlash(tempDir)); err != nil {
+		t.Fatalf("failed to set state: %v", err)
+	}
+
+	state := shell.State()
+	if state.WorkingDir != tempDir {
+		t.Fatalf("expected working dir %q, got %q", tempDir, state.WorkingDir)
+	}
+	if !slices.Contains(state.Env, "FOO=bar") || slices.Contains(state.Env, "LOCAL=1") {
+		t.Fatalf("expected only the exported variables, got %v", state.Env)
+	}
+
+	// A new shell picks up where the other left.
+	restored := NewShell(&Options{})
+	if err := restored.SetState(state); err != nil {
+		t.Fatalf("failed to restore state: %v", err)
+	}
+	out, _, err := restored.Exec(t.Context(), "greet $FOO; pwd")
+	if err != nil {
+		t.Fatalf("failed to run: %v", err)
+	}
+	if expect := "hello bar\n" + tempDir + "\n"; out != expect {
+		t.Fatalf("expected output %q, got %q", expect, out)
+	}
+
+	// Clones don't affect the shell they're copied from.
+	clone := restored.Clone()
+	if _, _, err := clone.Exec(t.Context(), "export FOO=baz; unset -f greet"); err != nil {
+		t.Fatalf("failed to change clone: %v", err)
+	}
+	if out, _, _ := restored.Exec(t.Context(), "greet $FOO"); out != "hello bar\n" {
+		t.Fatalf("expected the shell to be unchanged, got %q", out)
+	}
+}
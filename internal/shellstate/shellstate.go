@@ -0,0 +1,163 @@
+// Package shellstate keeps the shell of each session, so that the working
+// directory, exported variables and functions a command leaves carry over to
+// the next commands of the session, and are restored when it's resumed.
+package shellstate
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mudaaaa/crushplus/internal/db"
+	"github.com/mudaaaa/crushplus/internal/shell"
+)
+
+type Service interface {
+	// Shell returns the shell of the session, restored from its saved state
+	// the first time, or starting in the working directory.
+	Shell(ctx context.Context, sessionID, workingDir string) (*shell.Shell, error)
+	// Update sets the state of the shell of the session and saves it.
+	Update(ctx context.Context, sessionID string, state shell.State) error
+}
+
+type service struct {
+	q *db.Queries
+	// baseEnv is the environment the shells start from. Only the variables
+	// changed from it are saved, to keep the secrets it may hold out of the
+	// database.
+	baseEnv []string
+
+	mu     sync.Mutex
+	shells map[string]*shell.Shell
+}
+
+func NewService(q *db.Queries) Service {
+	return &service{
+		q:       q,
+		baseEnv: os.Environ(),
+		shells:  make(map[string]*shell.Shell),
+	}
+}
+
+func (s *service) Shell(ctx context.Context, sessionID, workingDir string) (*shell.Shell, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sh, ok := s.shells[sessionID]; ok {
+		return sh, nil
+	}
+
+	sh := shell.NewShell(&shell.Options{
+		WorkingDir: workingDir,
+		Env:        slices.Clone(s.baseEnv),
+	})
+	saved, err := s.q.GetShellState(ctx, sessionID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return nil, fmt.Errorf("failed to load shell state: %w", err)
+	default:
+		state, err := s.fromDBItem(saved)
+		if err != nil {
+			return nil, err
+		}
+		// The directory may be gone since, like a removed worktree.
+		if info, err := os.Stat(state.WorkingDir); err != nil || !info.IsDir() {
+			slog.Warn("Shell working directory no longer exists", "session_id", sessionID, "dir", state.WorkingDir)
+			state.WorkingDir = workingDir
+		}
+		if err := sh.SetState(state); err != nil {
+			return nil, err
+		}
+	}
+	s.shells[sessionID] = sh
+	return sh, nil
+}
+
+func (s *service) Update(ctx context.Context, sessionID string, state shell.State) error {
+	sh, err := s.Shell(ctx, sessionID, state.WorkingDir)
+	if err != nil {
+		return err
+	}
+	if err := sh.SetState(state); err != nil {
+		return err
+	}
+
+	env, err := json.Marshal(diffEnv(s.baseEnv, state.Env))
+	if err != nil {
+		return fmt.Errorf("failed to encode shell environment: %w", err)
+	}
+	return s.q.UpsertShellState(ctx, db.UpsertShellStateParams{
+		SessionID:  sessionID,
+		WorkingDir: state.WorkingDir,
+		Env:        string(env),
+		Funcs:      state.Funcs,
+	})
+}
+
+func (s *service) fromDBItem(item db.ShellState) (shell.State, error) {
+	var diff map[string]*string
+	if err := json.Unmarshal([]byte(item.Env), &diff); err != nil {
+		return shell.State{}, fmt.Errorf("failed to decode shell environment: %w", err)
+	}
+	return shell.State{
+		WorkingDir: item.WorkingDir,
+		Env:        applyEnv(s.baseEnv, diff),
+		Funcs:      item.Funcs,
+	}, nil
+}
+
+// diffEnv returns the variables of env set or changed from base, and those
+// unset, as nil.
+func diffEnv(base, env []string) map[string]*string {
+	baseVars := envMap(base)
+	vars := envMap(env)
+	diff := make(map[string]*string)
+	for name, value := range vars {
+		if baseValue, ok := baseVars[name]; !ok || baseValue != value {
+			diff[name] = &value
+		}
+	}
+	for name := range baseVars {
+		if _, ok := vars[name]; !ok {
+			diff[name] = nil
+		}
+	}
+	return diff
+}
+
+// applyEnv returns base with the variables of the diff set, or unset when
+// nil.
+func applyEnv(base []string, diff map[string]*string) []string {
+	vars := envMap(base)
+	for name, value := range diff {
+		if value == nil {
+			delete(vars, name)
+		} else {
+			vars[name] = *value
+		}
+	}
+	env := make([]string, 0, len(vars))
+	for name, value := range vars {
+		env = append(env, name+"="+value)
+	}
+	slices.Sort(env)
+	return env
+}
+
+func envMap(env []string) map[string]string {
+	vars := make(map[string]string, len(env))
+	for _, kv := range env {
+		if name, value, ok := strings.Cut(kv, "="); ok {
+			vars[name] = value
+		}
+	}
+	return vars
+}
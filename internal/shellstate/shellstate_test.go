@@ -0,0 +1,72 @@
+package shellstate
+
+import (
+	"testing"
+
+	"github.com/mudaaaa/crushplus/internal/db"
+	"github.com/mudaaaa/crushplus/internal/session"
+	"github.com/mudaaaa/crushplus/internal/shell"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService(t *testing.T) {
+	t.Parallel()
+
+	conn, err := db.Connect(t.Context(), t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	q := db.New(conn)
+	sessions := session.NewService(q)
+	sess1, err := sessions.Create(t.Context(), "one")
+	require.NoError(t, err)
+	sess2, err := sessions.Create(t.Context(), "two")
+	require.NoError(t, err)
+
+	workingDir := t.TempDir()
+	otherDir := t.TempDir()
+	shells := &service{
+		q:       q,
+		baseEnv: []string{"HOME=/home/crush", "SECRET=hunter2", "TERM=dumb"},
+		shells:  make(map[string]*shell.Shell),
+	}
+
+	sh, err := shells.Shell(t.Context(), sess1.ID, workingDir)
+	require.NoError(t, err)
+	_, _, err = sh.Exec(t.Context(), "export FOO=bar; unset TERM; greet() { echo hello; }; cd "+otherDir)
+	require.NoError(t, err)
+	require.NoError(t, shells.Update(t.Context(), sess1.ID, sh.State()))
+
+	// The variables from the environment aren't saved, only the changes.
+	saved, err := q.GetShellState(t.Context(), sess1.ID)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"FOO":"bar","TERM":null}`, saved.Env)
+
+	// Other sessions have their own shell.
+	other, err := shells.Shell(t.Context(), sess2.ID, workingDir)
+	require.NoError(t, err)
+	require.Equal(t, workingDir, other.GetWorkingDir())
+	require.NotContains(t, other.GetEnv(), "FOO=bar")
+
+	// The state is restored after a restart.
+	restarted := &service{q: q, baseEnv: shells.baseEnv, shells: make(map[string]*shell.Shell)}
+	sh, err = restarted.Shell(t.Context(), sess1.ID, workingDir)
+	require.NoError(t, err)
+	require.Equal(t, otherDir, sh.GetWorkingDir())
+	require.ElementsMatch(t, []string{"FOO=bar", "HOME=/home/crush", "SECRET=hunter2"}, sh.GetEnv())
+	out, _, err := sh.Exec(t.Context(), "greet")
+	require.NoError(t, err)
+	require.Equal(t, "hello\n", out)
+}
+
+func TestDiffEnv(t *testing.T) {
+	t.Parallel()
+
+	base := []string{"A=1", "B=2", "C=3"}
+	env := []string{"A=1", "B=changed", "D=4"}
+	diff := diffEnv(base, env)
+	require.Len(t, diff, 3)
+	require.Equal(t, "changed", *diff["B"])
+	require.Nil(t, diff["C"])
+	require.Equal(t, env, applyEnv(base, diff))
+}
@@ -0,0 +1,159 @@
+// Package todo keeps the checklist the agent maintains for each session to
+// track the progress of multi-step tasks.
+package todo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/mudaaaa/crushplus/internal/db"
+	"github.com/mudaaaa/crushplus/internal/pubsub"
+	"github.com/google/uuid"
+)
+
+type Status string
+
+const (
+	StatusPending    Status = "pending"
+	StatusInProgress Status = "in_progress"
+	StatusDone       Status = "done"
+)
+
+// Valid reports whether the status is a known one.
+func (s Status) Valid() bool {
+	switch s {
+	case StatusPending, StatusInProgress, StatusDone:
+		return true
+	}
+	return false
+}
+
+type Todo struct {
+	ID        string
+	SessionID string
+	Content   string
+	Status    Status
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+// List is the checklist of a session.
+type List struct {
+	SessionID string
+	Todos     []Todo
+}
+
+// Progress returns how many todos of the list are done, out of all of them.
+func (l List) Progress() (done, total int) {
+	for _, t := range l.Todos {
+		if t.Status == StatusDone {
+			done++
+		}
+	}
+	return done, len(l.Todos)
+}
+
+// String renders the list as a markdown checklist, marking the todos in
+// progress with a tilde.
+func (l List) String() string {
+	var sb strings.Builder
+	for i, t := range l.Todos {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		mark := " "
+		switch t.Status {
+		case StatusInProgress:
+			mark = "~"
+		case StatusDone:
+			mark = "x"
+		}
+		fmt.Fprintf(&sb, "- [%s] %s", mark, t.Content)
+	}
+	return sb.String()
+}
+
+type Service interface {
+	pubsub.Suscriber[List]
+	Get(ctx context.Context, sessionID string) (List, error)
+	// Set replaces the checklist of the session with the todos, in order.
+	Set(ctx context.Context, sessionID string, todos []Todo) (List, error)
+}
+
+type service struct {
+	*pubsub.Broker[List]
+	db *sql.DB
+	q  *db.Queries
+}
+
+func NewService(q *db.Queries, db *sql.DB) Service {
+	return &service{
+		Broker: pubsub.NewBroker[List](),
+		q:      q,
+		db:     db,
+	}
+}
+
+func (s *service) Get(ctx context.Context, sessionID string) (List, error) {
+	dbTodos, err := s.q.ListTodosBySession(ctx, sessionID)
+	if err != nil {
+		return List{}, err
+	}
+	list := List{SessionID: sessionID, Todos: make([]Todo, len(dbTodos))}
+	for i, dbTodo := range dbTodos {
+		list.Todos[i] = s.fromDBItem(dbTodo)
+	}
+	return list, nil
+}
+
+func (s *service) Set(ctx context.Context, sessionID string, todos []Todo) (List, error) {
+	for _, t := range todos {
+		if !t.Status.Valid() {
+			return List{}, fmt.Errorf("invalid todo status %q", t.Status)
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return List{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	qtx := s.q.WithTx(tx)
+	if err := qtx.DeleteSessionTodos(ctx, sessionID); err != nil {
+		return List{}, err
+	}
+	list := List{SessionID: sessionID, Todos: make([]Todo, 0, len(todos))}
+	for i, t := range todos {
+		dbTodo, err := qtx.CreateTodo(ctx, db.CreateTodoParams{
+			ID:        uuid.New().String(),
+			SessionID: sessionID,
+			Position:  int64(i),
+			Content:   t.Content,
+			Status:    string(t.Status),
+		})
+		if err != nil {
+			return List{}, err
+		}
+		list.Todos = append(list.Todos, s.fromDBItem(dbTodo))
+	}
+	if err := tx.Commit(); err != nil {
+		return List{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.Publish(pubsub.UpdatedEvent, list)
+	return list, nil
+}
+
+func (s *service) fromDBItem(item db.Todo) Todo {
+	return Todo{
+		ID:        item.ID,
+		SessionID: item.SessionID,
+		Content:   item.Content,
+		Status:    Status(item.Status),
+		CreatedAt: item.CreatedAt,
+		UpdatedAt: item.UpdatedAt,
+	}
+}
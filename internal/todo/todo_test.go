@@ -0,0 +1,54 @@
+package todo
+
+import (
+	"testing"
+
+	"github.com/mudaaaa/crushplus/internal/db"
+	"github.com/mudaaaa/crushplus/internal/session"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService(t *testing.T) {
+	t.Parallel()
+
+	conn, err := db.Connect(t.Context(), t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	q := db.New(conn)
+	sess, err := session.NewService(q).Create(t.Context(), "test")
+	require.NoError(t, err)
+	todos := NewService(q, conn)
+
+	list, err := todos.Set(t.Context(), sess.ID, []Todo{
+		{Content: "Write the test", Status: StatusDone},
+		{Content: "Make it pass", Status: StatusInProgress},
+		{Content: "Refactor", Status: StatusPending},
+	})
+	require.NoError(t, err)
+	done, total := list.Progress()
+	require.Equal(t, 1, done)
+	require.Equal(t, 3, total)
+	require.Equal(t, "- [x] Write the test\n- [~] Make it pass\n- [ ] Refactor", list.String())
+
+	got, err := todos.Get(t.Context(), sess.ID)
+	require.NoError(t, err)
+	require.Equal(t, list, got)
+
+	t.Run("replaces the list", func(t *testing.T) {
+		_, err := todos.Set(t.Context(), sess.ID, []Todo{{Content: "Ship it", Status: StatusPending}})
+		require.NoError(t, err)
+		got, err := todos.Get(t.Context(), sess.ID)
+		require.NoError(t, err)
+		require.Len(t, got.Todos, 1)
+		require.Equal(t, "Ship it", got.Todos[0].Content)
+	})
+
+	t.Run("rejects unknown statuses", func(t *testing.T) {
+		_, err := todos.Set(t.Context(), sess.ID, []Todo{{Content: "Nope", Status: "skipped"}})
+		require.Error(t, err)
+		got, err := todos.Get(t.Context(), sess.ID)
+		require.NoError(t, err)
+		require.Len(t, got.Todos, 1)
+	})
+}
@@ -387,6 +387,8 @@ func (m *messageListCmp) handleNewMessage(msg message.Message) tea.Cmd {
 		return m.handleNewAssistantMessage(msg)
 	case message.Tool:
 		return m.handleToolMessage(msg)
+	case message.System:
+		return m.listCmp.AppendItem(messages.NewMessageCmp(msg))
 	}
 	return nil
 }
@@ -612,6 +614,8 @@ func (m *messageListCmp) convertMessagesToUI(sessionMessages []message.Message,
 			if msg.FinishPart() != nil && msg.FinishPart().Reason == message.FinishReasonEndTurn {
 				uiMessages = append(uiMessages, messages.NewAssistantSection(msg, time.Unix(m.lastUserMessageTime, 0)))
 			}
+		case message.System:
+			uiMessages = append(uiMessages, messages.NewMessageCmp(msg))
 		}
 	}
 
@@ -1,6 +1,7 @@
 package editor
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"math/rand"
@@ -18,6 +19,7 @@ import (
 	"charm.land/bubbles/v2/textarea"
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
+	"github.com/mudaaaa/crushplus/internal/agent/tools/mcp"
 	"github.com/mudaaaa/crushplus/internal/app"
 	"github.com/mudaaaa/crushplus/internal/fsext"
 	"github.com/mudaaaa/crushplus/internal/message"
@@ -41,6 +43,8 @@ type Editor interface {
 	layout.Positional
 
 	SetSession(session session.Session) tea.Cmd
+	// SetPlanMode shows whether prompts are sent in plan mode.
+	SetPlanMode(on bool)
 	IsCompletionsOpen() bool
 	HasAttachments() bool
 	Cursor() *tea.Cursor
@@ -50,6 +54,15 @@ type FileCompletionItem struct {
 	Path string // The file path
 }
 
+// ResourceCompletionItem is an MCP resource that is attached to the prompt
+// when selected.
+type ResourceCompletionItem struct {
+	MCPName  string
+	URI      string
+	Name     string
+	MIMEType string
+}
+
 type editorCmp struct {
 	width              int
 	height             int
@@ -59,6 +72,7 @@ type editorCmp struct {
 	textarea           textarea.Model
 	attachments        []message.Attachment
 	deleteMode         bool
+	planMode           bool
 	readyPlaceholder   string
 	workingPlaceholder string
 	placeholderFrame   int       // Animation frame (0-3)
@@ -152,6 +166,17 @@ func (m *editorCmp) send() tea.Cmd {
 		return util.CmdHandler(dialogs.OpenDialogMsg{Model: quit.NewQuitDialog()})
 	}
 
+	if instructions, ok := compactCommand(value); ok {
+		if m.session.ID == "" {
+			return util.ReportWarn("There is no session to summarize yet")
+		}
+		m.textarea.Reset()
+		return util.CmdHandler(commands.CompactMsg{
+			SessionID:    m.session.ID,
+			Instructions: instructions,
+		})
+	}
+
 	m.textarea.Reset()
 	attachments := m.attachments
 
@@ -171,6 +196,16 @@ func (m *editorCmp) send() tea.Cmd {
 	)
 }
 
+// compactCommand parses "/compact [instructions]", which summarizes the
+// session focusing on the instructions.
+func compactCommand(value string) (string, bool) {
+	rest, ok := strings.CutPrefix(value, "/compact")
+	if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\n') {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
+
 func (m *editorCmp) repositionCompletions() tea.Msg {
 	x, y := m.completionsPosition()
 	return completions.RepositionCompletionsMsg{X: x, Y: y}
@@ -224,6 +259,21 @@ func (m *editorCmp) Update(msg tea.Msg) (util.Model, tea.Cmd) {
 				m.completionsStartIndex = 0
 			}
 		}
+		if item, ok := msg.Value.(ResourceCompletionItem); ok {
+			word := m.textarea.Word()
+			value := m.textarea.Value()
+			value = value[:m.completionsStartIndex] +
+				"@" + item.Name +
+				value[m.completionsStartIndex+len(word):]
+			m.textarea.SetValue(value)
+			m.textarea.MoveToEnd()
+			if !msg.Insert {
+				m.isCompletionsOpen = false
+				m.currentQuery = ""
+				m.completionsStartIndex = 0
+				return m, m.attachResource(item)
+			}
+		}
 
 	case commands.OpenExternalEditorMsg:
 		if m.app.AgentCoordinator.IsSessionBusy(m.session.ID) {
@@ -384,7 +434,17 @@ func (m *editorCmp) Update(msg tea.Msg) (util.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// SetPlanMode implements Editor.
+func (m *editorCmp) SetPlanMode(on bool) {
+	m.planMode = on
+	m.setEditorPrompt()
+}
+
 func (m *editorCmp) setEditorPrompt() {
+	if m.planMode {
+		m.textarea.SetPromptFunc(4, planPromptFunc)
+		return
+	}
 	if m.app.Permissions.SkipRequests() {
 		m.textarea.SetPromptFunc(4, yoloPromptFunc)
 		return
@@ -525,6 +585,9 @@ func (m *editorCmp) View() string {
 	if m.app.Permissions.SkipRequests() {
 		m.textarea.Placeholder = "Yolo mode!"
 	}
+	if m.planMode {
+		m.textarea.Placeholder = "Plan mode: describe the change to plan..."
+	}
 	if len(m.attachments) == 0 {
 		content := t.S().Base.Padding(1).Render(
 			m.textarea.View(),
@@ -597,6 +660,21 @@ func (m *editorCmp) startCompletions() tea.Msg {
 		})
 	}
 
+	for mcpName, resources := range mcp.Resources() {
+		for _, r := range resources {
+			name := cmp.Or(r.Name, r.URI)
+			completionItems = append(completionItems, completions.Completion{
+				Title: fmt.Sprintf("%s (%s)", name, mcpName),
+				Value: ResourceCompletionItem{
+					MCPName:  mcpName,
+					URI:      r.URI,
+					Name:     name,
+					MIMEType: r.MIMEType,
+				},
+			})
+		}
+	}
+
 	x, y := m.completionsPosition()
 	return completions.OpenCompletionsMsg{
 		Completions: completionItems,
@@ -606,6 +684,38 @@ func (m *editorCmp) startCompletions() tea.Msg {
 	}
 }
 
+// attachResource reads an MCP resource and attaches its contents to the
+// prompt, the same way files are attached.
+func (m *editorCmp) attachResource(item ResourceCompletionItem) tea.Cmd {
+	return func() tea.Msg {
+		contents, err := mcp.ReadResource(context.Background(), item.MCPName, item.URI)
+		if err != nil {
+			return util.InfoMsg{
+				Type: util.InfoTypeError,
+				Msg:  fmt.Sprintf("failed to read resource %s: %v", item.URI, err),
+			}
+		}
+		mimeType := cmp.Or(item.MIMEType, "text/plain")
+		var content []byte
+		for _, c := range contents {
+			if c.Blob != nil {
+				mimeType = cmp.Or(c.MIMEType, mimeType)
+				content = c.Blob
+				break
+			}
+			content = append(content, c.Text...)
+		}
+		return filepicker.FilePickedMsg{
+			Attachment: message.Attachment{
+				FilePath: item.URI,
+				FileName: item.Name,
+				MimeType: mimeType,
+				Content:  content,
+			},
+		}
+	}
+}
+
 // Blur implements Container.
 func (c *editorCmp) Blur() tea.Cmd {
 	c.textarea.Blur()
@@ -653,6 +763,20 @@ func normalPromptFunc(info textarea.PromptInfo) string {
 	return t.S().Muted.Render("::: ")
 }
 
+func planPromptFunc(info textarea.PromptInfo) string {
+	t := styles.CurrentTheme()
+	if info.LineNumber == 0 {
+		if info.Focused {
+			return t.S().Base.Foreground(t.Blue).Render("  ≡ ")
+		}
+		return t.S().Muted.Render("  ≡ ")
+	}
+	if info.Focused {
+		return t.S().Base.Foreground(t.Blue).Render("::: ")
+	}
+	return t.S().Muted.Render("::: ")
+}
+
 func yoloPromptFunc(info textarea.PromptInfo) string {
 	t := styles.CurrentTheme()
 	if info.LineNumber == 0 {
@@ -132,6 +132,8 @@ func (m *messageCmp) View() string {
 		switch m.message.Role {
 		case message.User:
 			return m.renderUserMessage()
+		case message.System:
+			return m.renderSystemMessage()
 		default:
 			return m.renderAssistantMessage()
 		}
@@ -262,6 +264,14 @@ func (m *messageCmp) renderUserMessage() string {
 	return m.style().Render(joined)
 }
 
+// renderSystemMessage renders messages the app logged in the session, like
+// requests from MCP servers, which are not part of the conversation.
+func (m *messageCmp) renderSystemMessage() string {
+	t := styles.CurrentTheme()
+	content := t.S().Subtle.Width(m.textWidth()).Render(m.message.Content().String())
+	return m.style().Render(content)
+}
+
 // toMarkdown converts text content to rendered markdown using the configured renderer
 func (m *messageCmp) toMarkdown(content string) string {
 	r := styles.GetMarkdownRenderer(m.textWidth())
@@ -166,6 +166,8 @@ func init() {
 	registry.register(tools.BashToolName, func() renderer { return bashRenderer{} })
 	registry.register(tools.JobOutputToolName, func() renderer { return bashOutputRenderer{} })
 	registry.register(tools.JobKillToolName, func() renderer { return bashKillRenderer{} })
+	registry.register(tools.JobWaitToolName, func() renderer { return bashWaitRenderer{} })
+	registry.register(tools.JobInputToolName, func() renderer { return bashInputRenderer{} })
 	registry.register(tools.DownloadToolName, func() renderer { return downloadRenderer{} })
 	registry.register(tools.ViewToolName, func() renderer { return viewRenderer{} })
 	registry.register(tools.EditToolName, func() renderer { return editRenderer{} })
@@ -176,9 +178,19 @@ func init() {
 	registry.register(tools.WebFetchToolName, func() renderer { return webFetchRenderer{} })
 	registry.register(tools.GlobToolName, func() renderer { return globRenderer{} })
 	registry.register(tools.GrepToolName, func() renderer { return grepRenderer{} })
+	registry.register(tools.CodeSearchToolName, func() renderer { return codeSearchRenderer{} })
 	registry.register(tools.LSToolName, func() renderer { return lsRenderer{} })
 	registry.register(tools.SourcegraphToolName, func() renderer { return sourcegraphRenderer{} })
+	registry.register(tools.TestToolName, func() renderer { return testRenderer{} })
+	registry.register(tools.GitStatusToolName, func() renderer { return gitStatusRenderer{} })
+	registry.register(tools.GitDiffToolName, func() renderer { return gitDiffRenderer{} })
+	registry.register(tools.GitCommitToolName, func() renderer { return gitCommitRenderer{} })
+	registry.register(tools.TodosToolName, func() renderer { return todosRenderer{} })
+	registry.register(tools.MergeAgentPatchToolName, func() renderer { return mergeAgentPatchRenderer{} })
+	registry.register(agent.ParallelAgentsToolName, func() renderer { return parallelAgentsRenderer{} })
 	registry.register(tools.DiagnosticsToolName, func() renderer { return diagnosticsRenderer{} })
+	registry.register(tools.MCPListResourcesToolName, func() renderer { return mcpListResourcesRenderer{} })
+	registry.register(tools.MCPReadResourceToolName, func() renderer { return mcpReadResourceRenderer{} })
 	registry.register(agent.AgentToolName, func() renderer { return agentRenderer{} })
 }
 
@@ -384,6 +396,85 @@ func (bkr bashKillRenderer) Render(v *toolCallCmp) string {
 	return joinHeaderBody(header, body)
 }
 
+// -----------------------------------------------------------------------------
+//  Bash Wait renderer
+// -----------------------------------------------------------------------------
+
+// bashWaitRenderer handles the display of waiting for a background process
+type bashWaitRenderer struct {
+	baseRenderer
+}
+
+// Render displays the shell ID, what's waited for and the latest output
+func (bwr bashWaitRenderer) Render(v *toolCallCmp) string {
+	var params tools.JobWaitParams
+	if err := bwr.unmarshalParams(v.call.Input, &params); err != nil {
+		return bwr.renderError(v, "Invalid job_wait parameters")
+	}
+
+	var meta tools.JobWaitResponseMetadata
+	description := params.Pattern
+	if v.result.Metadata != "" {
+		if err := bwr.unmarshalParams(v.result.Metadata, &meta); err == nil {
+			if meta.Description != "" {
+				description = meta.Description
+			} else {
+				description = meta.Command
+			}
+		}
+	}
+
+	width := v.textWidth()
+	if v.isNested {
+		width -= 4 // Adjust for nested tool call indentation
+	}
+	header := makeJobHeader(v, "Wait", fmt.Sprintf("PID %s", params.ShellID), description, width)
+	if v.isNested {
+		return v.style().Render(header)
+	}
+	if res, done := earlyState(header, v); done {
+		return res
+	}
+	body := renderPlainContent(v, v.result.Content)
+	return joinHeaderBody(header, body)
+}
+
+// -----------------------------------------------------------------------------
+//  Bash Input renderer
+// -----------------------------------------------------------------------------
+
+// bashInputRenderer handles the display of input sent to a background process
+type bashInputRenderer struct {
+	baseRenderer
+}
+
+// Render displays the shell ID, the input sent and the output it printed
+func (bir bashInputRenderer) Render(v *toolCallCmp) string {
+	var params tools.JobInputParams
+	if err := bir.unmarshalParams(v.call.Input, &params); err != nil {
+		return bir.renderError(v, "Invalid job_input parameters")
+	}
+
+	input := strings.TrimSpace(params.Input)
+	if len(params.Keys) > 0 {
+		input = strings.TrimSpace(input + " " + strings.Join(params.Keys, " "))
+	}
+
+	width := v.textWidth()
+	if v.isNested {
+		width -= 4 // Adjust for nested tool call indentation
+	}
+	header := makeJobHeader(v, "Input", fmt.Sprintf("PID %s", params.ShellID), input, width)
+	if v.isNested {
+		return v.style().Render(header)
+	}
+	if res, done := earlyState(header, v); done {
+		return res
+	}
+	body := renderPlainContent(v, v.result.Content)
+	return joinHeaderBody(header, body)
+}
+
 // -----------------------------------------------------------------------------
 //  View renderer
 // -----------------------------------------------------------------------------
@@ -778,6 +869,31 @@ func (gr grepRenderer) Render(v *toolCallCmp) string {
 	})
 }
 
+// -----------------------------------------------------------------------------
+//  Code search renderer
+// -----------------------------------------------------------------------------
+
+// codeSearchRenderer handles searches of the code index
+type codeSearchRenderer struct {
+	baseRenderer
+}
+
+// Render displays the query with the path filter and the ranked snippets
+func (cr codeSearchRenderer) Render(v *toolCallCmp) string {
+	var params tools.CodeSearchParams
+	var args []string
+	if err := cr.unmarshalParams(v.call.Input, &params); err == nil {
+		args = newParamBuilder().
+			addMain(params.Query).
+			addKeyValue("path", params.Path).
+			build()
+	}
+
+	return cr.renderWithParams(v, "Code Search", args, func() string {
+		return renderPlainContent(v, v.result.Content)
+	})
+}
+
 // -----------------------------------------------------------------------------
 //  LS renderer
 // -----------------------------------------------------------------------------
@@ -806,6 +922,81 @@ func (lr lsRenderer) Render(v *toolCallCmp) string {
 	})
 }
 
+// -----------------------------------------------------------------------------
+//  Todos renderer
+// -----------------------------------------------------------------------------
+
+// todosRenderer handles the todo list updates with their progress
+type todosRenderer struct {
+	baseRenderer
+}
+
+// Render displays the progress of the list and the updated checklist
+func (tr todosRenderer) Render(v *toolCallCmp) string {
+	var args []string
+	var meta tools.TodosResponseMetadata
+	if v.result.Metadata != "" {
+		if err := tr.unmarshalParams(v.result.Metadata, &meta); err == nil && meta.Total > 0 {
+			args = newParamBuilder().addMain(fmt.Sprintf("%d/%d done", meta.Done, meta.Total)).build()
+		}
+	}
+
+	return tr.renderWithParams(v, "Todos", args, func() string {
+		return renderPlainContent(v, v.result.Content)
+	})
+}
+
+// -----------------------------------------------------------------------------
+//  Parallel agents renderer
+// -----------------------------------------------------------------------------
+
+// parallelAgentsRenderer handles the sub-agents run in worktrees
+type parallelAgentsRenderer struct {
+	baseRenderer
+}
+
+// Render displays the number of tasks and the report of the sub-agents
+func (pr parallelAgentsRenderer) Render(v *toolCallCmp) string {
+	var params agent.ParallelAgentsParams
+	var args []string
+	if err := pr.unmarshalParams(v.call.Input, &params); err == nil {
+		tasks := fmt.Sprintf("%d tasks", len(params.Tasks))
+		if len(params.Tasks) == 1 {
+			tasks = "1 task"
+		}
+		args = newParamBuilder().addMain(tasks).build()
+	}
+
+	return pr.renderWithParams(v, prettifyToolName(v.call.Name), args, func() string {
+		return renderMarkdownContent(v, v.result.Content)
+	})
+}
+
+// -----------------------------------------------------------------------------
+//  Merge agent patch renderer
+// -----------------------------------------------------------------------------
+
+// mergeAgentPatchRenderer handles the patches of the sub-agents merged or discarded
+type mergeAgentPatchRenderer struct {
+	baseRenderer
+}
+
+// Render displays the patch ID and whether it's discarded
+func (mr mergeAgentPatchRenderer) Render(v *toolCallCmp) string {
+	var params tools.MergeAgentPatchParams
+	var args []string
+	if err := mr.unmarshalParams(v.call.Input, &params); err == nil {
+		args = newParamBuilder().
+			addMain(params.PatchID).
+			addFlag("discard", params.Discard).
+			build()
+	}
+
+	return mr.renderWithParams(v, prettifyToolName(v.call.Name), args, func() string {
+		return renderPlainContent(v, v.result.Content)
+	})
+}
+
 // -----------------------------------------------------------------------------
 //  Sourcegraph renderer
 // -----------------------------------------------------------------------------
@@ -832,6 +1023,106 @@ func (sr sourcegraphRenderer) Render(v *toolCallCmp) string {
 	})
 }
 
+// -----------------------------------------------------------------------------
+//  Test renderer
+// -----------------------------------------------------------------------------
+
+// testRenderer handles test runs with their structured results
+type testRenderer struct {
+	baseRenderer
+}
+
+// Render displays the tested path with the name filter and the summary of the results
+func (tr testRenderer) Render(v *toolCallCmp) string {
+	var params tools.TestParams
+	var args []string
+	if err := tr.unmarshalParams(v.call.Input, &params); err == nil {
+		args = newParamBuilder().
+			addMain(cmp.Or(params.Path, "project")).
+			addKeyValue("name", params.Name).
+			addKeyValue("framework", params.Framework).
+			build()
+	}
+
+	return tr.renderWithParams(v, "Test", args, func() string {
+		return renderPlainContent(v, v.result.Content)
+	})
+}
+
+// -----------------------------------------------------------------------------
+//  Git renderers
+// -----------------------------------------------------------------------------
+
+// gitStatusRenderer handles the status of the repository
+type gitStatusRenderer struct {
+	baseRenderer
+}
+
+// Render displays the path and the status of the repository
+func (gr gitStatusRenderer) Render(v *toolCallCmp) string {
+	var params tools.GitStatusParams
+	var args []string
+	if err := gr.unmarshalParams(v.call.Input, &params); err == nil {
+		args = newParamBuilder().addMain(cmp.Or(params.Path, "repository")).build()
+	}
+
+	return gr.renderWithParams(v, "Git: Status", args, func() string {
+		return renderPlainContent(v, v.result.Content)
+	})
+}
+
+// gitDiffRenderer handles diffs of the repository
+type gitDiffRenderer struct {
+	baseRenderer
+}
+
+// Render displays the diffed paths with the diff highlighted, or the summary in stat mode
+func (gr gitDiffRenderer) Render(v *toolCallCmp) string {
+	var params tools.GitDiffParams
+	var args []string
+	if err := gr.unmarshalParams(v.call.Input, &params); err == nil {
+		main := "working tree"
+		if len(params.Paths) > 0 {
+			main = strings.Join(params.Paths, " ")
+		}
+		args = newParamBuilder().
+			addMain(main).
+			addKeyValue("ref", params.Ref).
+			addFlag("staged", params.Staged).
+			addFlag("stat", params.Stat).
+			build()
+	}
+
+	return gr.renderWithParams(v, "Git: Diff", args, func() string {
+		if params.Stat || !strings.HasPrefix(v.result.Content, "diff ") {
+			return renderPlainContent(v, v.result.Content)
+		}
+		return renderCodeContent(v, "changes.diff", v.result.Content, 0)
+	})
+}
+
+// gitCommitRenderer handles the commits created
+type gitCommitRenderer struct {
+	baseRenderer
+}
+
+// Render displays the subject of the commit with its hash and files
+func (gr gitCommitRenderer) Render(v *toolCallCmp) string {
+	var params tools.GitCommitParams
+	var args []string
+	if err := gr.unmarshalParams(v.call.Input, &params); err == nil {
+		subject, _, _ := strings.Cut(strings.TrimSpace(params.Message), "\n")
+		args = newParamBuilder().
+			addMain(subject).
+			addFlag("all", params.All).
+			build()
+	}
+
+	return gr.renderWithParams(v, "Git: Commit", args, func() string {
+		return renderPlainContent(v, v.result.Content)
+	})
+}
+
 // -----------------------------------------------------------------------------
 //  Diagnostics renderer
 // -----------------------------------------------------------------------------
@@ -850,6 +1141,49 @@ func (dr diagnosticsRenderer) Render(v *toolCallCmp) string {
 	})
 }
 
+// -----------------------------------------------------------------------------
+//  MCP resources renderers
+// -----------------------------------------------------------------------------
+
+// mcpListResourcesRenderer handles listing MCP resources
+type mcpListResourcesRenderer struct {
+	baseRenderer
+}
+
+// Render displays the MCP server filter and the list of resources
+func (mr mcpListResourcesRenderer) Render(v *toolCallCmp) string {
+	var params tools.MCPListResourcesParams
+	var args []string
+	if err := mr.unmarshalParams(v.call.Input, &params); err == nil {
+		args = newParamBuilder().addMain(cmp.Or(params.MCPName, "all")).build()
+	}
+
+	return mr.renderWithParams(v, prettifyToolName(v.call.Name), args, func() string {
+		return renderPlainContent(v, v.result.Content)
+	})
+}
+
+// mcpReadResourceRenderer handles reading a single MCP resource
+type mcpReadResourceRenderer struct {
+	baseRenderer
+}
+
+// Render displays the resource URI and its contents
+func (mr mcpReadResourceRenderer) Render(v *toolCallCmp) string {
+	var params tools.MCPReadResourceParams
+	var args []string
+	if err := mr.unmarshalParams(v.call.Input, &params); err == nil {
+		args = newParamBuilder().
+			addMain(params.URI).
+			addKeyValue("mcp", params.MCPName).
+			build()
+	}
+
+	return mr.renderWithParams(v, prettifyToolName(v.call.Name), args, func() string {
+		return renderPlainContent(v, v.result.Content)
+	})
+}
+
 // -----------------------------------------------------------------------------
 //  Task renderer
 // -----------------------------------------------------------------------------
@@ -1169,6 +1503,10 @@ func prettifyToolName(name string) string {
 		return "Job: Output"
 	case tools.JobKillToolName:
 		return "Job: Kill"
+	case tools.JobWaitToolName:
+		return "Job: Wait"
+	case tools.JobInputToolName:
+		return "Job: Input"
 	case tools.DownloadToolName:
 		return "Download"
 	case tools.EditToolName:
@@ -1185,10 +1523,30 @@ func prettifyToolName(name string) string {
 		return "Glob"
 	case tools.GrepToolName:
 		return "Grep"
+	case tools.CodeSearchToolName:
+		return "Code Search"
 	case tools.LSToolName:
 		return "List"
 	case tools.SourcegraphToolName:
 		return "Sourcegraph"
+	case tools.TestToolName:
+		return "Test"
+	case tools.GitStatusToolName:
+		return "Git: Status"
+	case tools.GitDiffToolName:
+		return "Git: Diff"
+	case tools.GitCommitToolName:
+		return "Git: Commit"
+	case tools.TodosToolName:
+		return "Todos"
+	case agent.ParallelAgentsToolName:
+		return "Parallel Agents"
+	case tools.MergeAgentPatchToolName:
+		return "Merge Patch"
+	case tools.MCPListResourcesToolName:
+		return "MCP: Resources"
+	case tools.MCPReadResourceToolName:
+		return "MCP: Read Resource"
 	case tools.ViewToolName:
 		return "View"
 	case tools.WriteToolName:
@@ -1,6 +1,7 @@
 package sidebar
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"slices"
@@ -9,6 +10,8 @@ import (
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
 	"github.com/charmbracelet/catwalk/pkg/catwalk"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/mudaaaa/crushplus/internal/agent"
 	"github.com/mudaaaa/crushplus/internal/config"
 	"github.com/mudaaaa/crushplus/internal/csync"
 	"github.com/mudaaaa/crushplus/internal/diff"
@@ -18,6 +21,8 @@ import (
 	"github.com/mudaaaa/crushplus/internal/lsp"
 	"github.com/mudaaaa/crushplus/internal/pubsub"
 	"github.com/mudaaaa/crushplus/internal/session"
+	"github.com/mudaaaa/crushplus/internal/shell"
+	"github.com/mudaaaa/crushplus/internal/todo"
 	"github.com/mudaaaa/crushplus/internal/tui/components/chat"
 	"github.com/mudaaaa/crushplus/internal/tui/components/core"
 	"github.com/mudaaaa/crushplus/internal/tui/components/core/layout"
@@ -44,6 +49,8 @@ const (
 	DefaultMaxFilesShown = 10
 	DefaultMaxLSPsShown  = 8
 	DefaultMaxMCPsShown  = 8
+	DefaultMaxTodosShown = 10
+	DefaultMaxJobsShown  = 3
 	MinItemsPerSection   = 2 // Minimum items to show per section
 )
 
@@ -57,6 +64,11 @@ type SessionFilesMsg struct {
 	Files []SessionFile
 }
 
+// SessionTodosMsg carries the todo list of the session, once it's loaded.
+type SessionTodosMsg struct {
+	List todo.List
+}
+
 type Sidebar interface {
 	util.Model
 	layout.Sizeable
@@ -73,12 +85,18 @@ type sidebarCmp struct {
 	compactMode   bool
 	history       history.Service
 	files         *csync.Map[string, SessionFile]
+	todoService   todo.Service
+	todos         todo.List
+	jobs          []shell.BackgroundShellInfo
+	// nextRequest is the estimated tokens of the next request of the session.
+	nextRequest int64
 }
 
-func New(history history.Service, lspClients *csync.Map[string, *lsp.Client], compact bool) Sidebar {
+func New(history history.Service, todos todo.Service, lspClients *csync.Map[string, *lsp.Client], compact bool) Sidebar {
 	return &sidebarCmp{
 		lspClients:  lspClients,
 		history:     history,
+		todoService: todos,
 		compactMode: compact,
 		files:       csync.NewMap[string, SessionFile](),
 	}
@@ -96,9 +114,29 @@ func (m *sidebarCmp) Update(msg tea.Msg) (util.Model, tea.Cmd) {
 			m.files.Set(file.FilePath, file)
 		}
 		return m, nil
+	case SessionTodosMsg:
+		if m.session.ID == msg.List.SessionID {
+			m.todos = msg.List
+		}
+		return m, nil
 
 	case chat.SessionClearedMsg:
 		m.session = session.Session{}
+		m.todos = todo.List{}
+		m.jobs = nil
+		m.nextRequest = 0
+	case pubsub.Event[todo.List]:
+		if m.session.ID == msg.Payload.SessionID {
+			m.todos = msg.Payload
+		}
+	case pubsub.Event[shell.BackgroundShellInfo]:
+		if m.session.ID == msg.Payload.SessionID {
+			m.loadSessionJobs()
+		}
+	case pubsub.Event[agent.TokenEstimate]:
+		if m.session.ID == msg.Payload.SessionID {
+			m.nextRequest = msg.Payload.Tokens
+		}
 	case pubsub.Event[history.File]:
 		return m, m.handleFileHistoryEvent(msg)
 	case pubsub.Event[session.Session]:
@@ -153,12 +191,24 @@ func (m *sidebarCmp) View() string {
 	// Check if we should use horizontal layout for sections
 	if m.compactMode && m.width > m.height {
 		// Horizontal layout for compact mode when width > height
+		if len(m.todos.Todos) > 0 {
+			parts = append(parts, "", m.todosBlock())
+		}
+		if len(m.jobs) > 0 {
+			parts = append(parts, "", m.jobsBlock())
+		}
 		sectionsContent := m.renderSectionsHorizontal()
 		if sectionsContent != "" {
 			parts = append(parts, "", sectionsContent)
 		}
 	} else {
 		// Vertical layout (default)
+		if len(m.todos.Todos) > 0 {
+			parts = append(parts, "", m.todosBlock())
+		}
+		if len(m.jobs) > 0 {
+			parts = append(parts, "", m.jobsBlock())
+		}
 		if m.session.ID != "" {
 			parts = append(parts, "", m.filesBlock())
 		}
@@ -265,6 +315,17 @@ func (m *sidebarCmp) loadSessionFiles() tea.Msg {
 	}
 }
 
+func (m *sidebarCmp) loadSessionTodos() tea.Msg {
+	list, err := m.todoService.Get(context.Background(), m.session.ID)
+	if err != nil {
+		return util.InfoMsg{
+			Type: util.InfoTypeError,
+			Msg:  err.Error(),
+		}
+	}
+	return SessionTodosMsg{List: list}
+}
+
 func (m *sidebarCmp) SetSize(width, height int) tea.Cmd {
 	m.logo = m.logoBlock()
 	m.cwd = cwd()
@@ -318,6 +379,13 @@ func (m *sidebarCmp) calculateAvailableHeight() int {
 
 	usedHeight += 2 // Model info
 
+	if len(m.todos.Todos) > 0 {
+		usedHeight += 3 + min(len(m.todos.Todos), DefaultMaxTodosShown+1) // Empty line, header, empty line and todos
+	}
+	if len(m.jobs) > 0 {
+		usedHeight += 3 + min(len(m.jobs), DefaultMaxJobsShown+1) // Empty line, header, empty line and jobs
+	}
+
 	usedHeight += 6 // 3 sections × 2 lines each (header + empty line)
 
 	// Base padding
@@ -435,7 +503,7 @@ func (m *sidebarCmp) lspBlockCompact(maxWidth int) string {
 // mcpBlockCompact renders the MCP block with limited width and height for horizontal layout
 func (m *sidebarCmp) mcpBlockCompact(maxWidth int) string {
 	// Limit items for horizontal layout
-	maxItems := min(5, len(config.Get().MCP.Sorted()))
+	maxItems := min(5, len(config.Get().MCPs().Sorted()))
 	availableHeight := m.height - 8
 	if availableHeight > 0 {
 		maxItems = min(maxItems, availableHeight)
@@ -477,6 +545,88 @@ func (m *sidebarCmp) filesBlock() string {
 	}, true)
 }
 
+// todosBlock renders the todo list of the session with its progress.
+func (m *sidebarCmp) todosBlock() string {
+	t := styles.CurrentTheme()
+	maxWidth := m.getMaxWidth()
+	done, total := m.todos.Progress()
+
+	section := t.S().Subtle.Render(core.Section(fmt.Sprintf("Todos %d/%d", done, total), maxWidth))
+	todoList := []string{section, ""}
+	for i, item := range m.todos.Todos {
+		if i >= DefaultMaxTodosShown {
+			todoList = append(todoList,
+				t.S().Base.Foreground(t.FgSubtle).Render(fmt.Sprintf("…and %d more", total-i)),
+			)
+			break
+		}
+		icon := t.S().Base.Foreground(t.FgSubtle).Render(styles.TodoPending)
+		style := t.S().Base.Foreground(t.FgMuted)
+		switch item.Status {
+		case todo.StatusInProgress:
+			icon = t.S().Base.Foreground(t.Primary).Render(styles.TodoInProgress)
+			style = t.S().Base.Foreground(t.FgBase)
+		case todo.StatusDone:
+			icon = t.S().Base.Foreground(t.Success).Render(styles.TodoDone)
+			style = t.S().Base.Foreground(t.FgSubtle).Strikethrough(true)
+		}
+		content := ansi.Truncate(item.Content, maxWidth-2, "…")
+		todoList = append(todoList, icon+" "+style.Render(content))
+	}
+
+	return lipgloss.NewStyle().Width(maxWidth).Render(
+		lipgloss.JoinVertical(lipgloss.Left, todoList...),
+	)
+}
+
+// jobsBlock renders the background jobs of the session.
+func (m *sidebarCmp) jobsBlock() string {
+	t := styles.CurrentTheme()
+	maxWidth := m.getMaxWidth()
+
+	running := 0
+	for _, job := range m.jobs {
+		if !job.Done() {
+			running++
+		}
+	}
+	section := t.S().Subtle.Render(core.Section(fmt.Sprintf("Jobs %d running · ctrl+b", running), maxWidth))
+	jobList := []string{section, ""}
+	for i, job := range m.jobs {
+		if i >= DefaultMaxJobsShown {
+			jobList = append(jobList,
+				t.S().Base.Foreground(t.FgSubtle).Render(fmt.Sprintf("…and %d more", len(m.jobs)-i)),
+			)
+			break
+		}
+		icon := t.S().Base.Foreground(t.GreenLight).Render(styles.ToolPending)
+		status := "running"
+		if job.Done() {
+			icon = t.S().Base.Foreground(t.Success).Render(styles.ToolSuccess)
+			if job.ExitCode != 0 {
+				icon = t.S().Base.Foreground(t.Error).Render(styles.ToolError)
+			}
+			status = fmt.Sprintf("exit %d", job.ExitCode)
+		}
+		label := cmp.Or(job.Description, job.Command)
+		status = t.S().Subtle.Render(" " + status)
+		label = ansi.Truncate(label, max(0, maxWidth-lipgloss.Width(status)-len(job.ID)-3), "…")
+		jobList = append(jobList, icon+" "+t.S().Base.Foreground(t.FgMuted).Render(job.ID+" "+label)+status)
+	}
+
+	return lipgloss.NewStyle().Width(maxWidth).Render(
+		lipgloss.JoinVertical(lipgloss.Left, jobList...),
+	)
+}
+
+// loadSessionJobs loads the background jobs of the session, kept in memory.
+func (m *sidebarCmp) loadSessionJobs() {
+	m.jobs = nil
+	for _, job := range shell.GetBackgroundShellManager().Jobs(m.session.ID) {
+		m.jobs = append(m.jobs, job.Info())
+	}
+}
+
 func (m *sidebarCmp) lspBlock() string {
 	// Limit the number of LSPs shown
 	_, maxLSPs, _ := m.getDynamicLimits()
@@ -494,7 +644,7 @@ func (m *sidebarCmp) lspBlock() string {
 func (m *sidebarCmp) mcpBlock() string {
 	// Limit the number of MCPs shown
 	_, _, maxMCPs := m.getDynamicLimits()
-	mcps := config.Get().MCP.Sorted()
+	mcps := config.Get().MCPs().Sorted()
 	maxMCPs = min(len(mcps), maxMCPs)
 
 	return mcp.RenderMCPBlock(mcp.RenderOptions{
@@ -505,9 +655,8 @@ func (m *sidebarCmp) mcpBlock() string {
 	}, true)
 }
 
-func formatTokensAndCost(tokens, contextWindow int64, cost float64) string {
-	t := styles.CurrentTheme()
-	// Format tokens in human-readable format (e.g., 110K, 1.2M)
+// formatTokens formats tokens in human-readable format (e.g., 110K, 1.2M).
+func formatTokens(tokens int64) string {
 	var formattedTokens string
 	switch {
 	case tokens >= 1_000_000:
@@ -525,6 +674,12 @@ func formatTokensAndCost(tokens, contextWindow int64, cost float64) string {
 	if strings.HasSuffix(formattedTokens, ".0M") {
 		formattedTokens = strings.Replace(formattedTokens, ".0M", "M", 1)
 	}
+	return formattedTokens
+}
+
+func formatTokensAndCost(tokens, nextRequest, taskTokens, contextWindow int64, cost float64) string {
+	t := styles.CurrentTheme()
+	formattedTokens := formatTokens(tokens)
 
 	percentage := (float64(tokens) / float64(contextWindow)) * 100
 
@@ -540,7 +695,16 @@ func formatTokensAndCost(tokens, contextWindow int64, cost float64) string {
 		formattedTokens = fmt.Sprintf("%s %s", styles.WarningIcon, formattedTokens)
 	}
 
-	return fmt.Sprintf("%s %s", formattedTokens, formattedCost)
+	formatted := fmt.Sprintf("%s %s", formattedTokens, formattedCost)
+	if nextRequest > 0 {
+		next := baseStyle.Foreground(t.FgSubtle).Render(fmt.Sprintf("next request ≈ %s tokens", formatTokens(nextRequest)))
+		formatted = lipgloss.JoinVertical(lipgloss.Left, formatted, next)
+	}
+	if taskTokens > 0 {
+		tasks := baseStyle.Foreground(t.FgSubtle).Render(fmt.Sprintf("sub-agents used %s tokens", formatTokens(taskTokens)))
+		formatted = lipgloss.JoinVertical(lipgloss.Left, formatted, tasks)
+	}
+	return formatted
 }
 
 func (s *sidebarCmp) currentModelBlock() string {
@@ -584,6 +748,8 @@ func (s *sidebarCmp) currentModelBlock() string {
 			parts,
 			"  "+formatTokensAndCost(
 				s.session.CompletionTokens+s.session.PromptTokens,
+				s.nextRequest,
+				s.session.TaskTokens,
 				model.ContextWindow,
 				s.session.Cost,
 			),
@@ -597,8 +763,13 @@ func (s *sidebarCmp) currentModelBlock() string {
 
 // SetSession implements Sidebar.
 func (m *sidebarCmp) SetSession(session session.Session) tea.Cmd {
+	if m.session.ID != session.ID {
+		m.nextRequest = 0
+		m.todos = todo.List{}
+	}
 	m.session = session
-	return m.loadSessionFiles
+	m.loadSessionJobs()
+	return tea.Batch(m.loadSessionFiles, m.loadSessionTodos)
 }
 
 // SetCompactMode sets the compact mode for the sidebar.
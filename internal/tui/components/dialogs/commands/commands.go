@@ -83,8 +83,14 @@ type (
 	OpenReasoningDialogMsg struct{}
 	OpenExternalEditorMsg  struct{}
 	ToggleYoloModeMsg      struct{}
+	TogglePlanModeMsg      struct{}
+	OpenJobsDialogMsg      struct{}
 	CompactMsg             struct {
-		SessionID string
+		SessionID    string
+		Instructions string
+	}
+	MCPLoginMsg struct {
+		Name string
 	}
 )
 
@@ -152,6 +158,17 @@ func (c *commandDialogCmp) Update(msg tea.Msg) (util.Model, tea.Cmd) {
 	case tea.KeyPressMsg:
 		switch {
 		case key.Matches(msg, c.keyMap.Select):
+			// "/compact <instructions>" summarizes the session, focusing on
+			// the instructions.
+			if instructions, ok := strings.CutPrefix(c.commandList.Query(), "compact "); ok && c.sessionID != "" {
+				return c, tea.Sequence(
+					util.CmdHandler(dialogs.CloseDialogMsg{}),
+					util.CmdHandler(CompactMsg{
+						SessionID:    c.sessionID,
+						Instructions: strings.TrimSpace(instructions),
+					}),
+				)
+			}
 			selectedItem := c.commandList.SelectedItem()
 			if selectedItem == nil {
 				return c, nil // No item selected, do nothing
@@ -348,7 +365,7 @@ func (c *commandDialogCmp) defaultCommands() []Command {
 		commands = append(commands, Command{
 			ID:          "Summarize",
 			Title:       "Summarize Session",
-			Description: "Summarize the current session and create a new one with the summary",
+			Description: "Summarize the current session, focusing on what you choose, and continue from the summary",
 			Handler: func(cmd Command) tea.Cmd {
 				return util.CmdHandler(CompactMsg{
 					SessionID: c.sessionID,
@@ -421,6 +438,33 @@ func (c *commandDialogCmp) defaultCommands() []Command {
 		}
 	}
 
+	if c.sessionID != "" {
+		commands = append(commands, Command{
+			ID:          "background_jobs",
+			Title:       "Background Jobs",
+			Shortcut:    "ctrl+b",
+			Description: "List the background jobs of the session, tail their output, kill them or pin their output to the prompt",
+			Handler: func(cmd Command) tea.Cmd {
+				return util.CmdHandler(OpenJobsDialogMsg{})
+			},
+		})
+	}
+
+	// Add login commands for MCPs waiting for authorization
+	for _, m := range config.Get().MCPs().Sorted() {
+		if state, ok := mcp.GetState(m.Name); !ok || state.State != mcp.StateNeedsAuth {
+			continue
+		}
+		commands = append(commands, Command{
+			ID:          "mcp_login_" + m.Name,
+			Title:       "Login to MCP: " + m.Name,
+			Description: fmt.Sprintf("Authorize access to the %s MCP server", m.Name),
+			Handler: func(cmd Command) tea.Cmd {
+				return util.CmdHandler(MCPLoginMsg{Name: m.Name})
+			},
+		})
+	}
+
 	// Add external editor command if $EDITOR is available
 	if os.Getenv("EDITOR") != "" {
 		commands = append(commands, Command{
@@ -443,6 +487,15 @@ func (c *commandDialogCmp) defaultCommands() []Command {
 				return util.CmdHandler(ToggleYoloModeMsg{})
 			},
 		},
+		{
+			ID:          "toggle_plan",
+			Title:       "Toggle Plan Mode",
+			Shortcut:    "shift+tab",
+			Description: "Plan changes with read-only tools and review the plan before they are made",
+			Handler: func(cmd Command) tea.Cmd {
+				return util.CmdHandler(TogglePlanModeMsg{})
+			},
+		},
 		{
 			ID:          "toggle_help",
 			Title:       "Toggle Help",
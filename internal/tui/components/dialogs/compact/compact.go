@@ -0,0 +1,276 @@
+// Package compact provides the dialog that summarizes a session on demand,
+// letting the user steer the summary and edit it before it replaces the
+// history sent to the model.
+package compact
+
+import (
+	"charm.land/bubbles/v2/help"
+	"charm.land/bubbles/v2/key"
+	"charm.land/bubbles/v2/spinner"
+	"charm.land/bubbles/v2/textarea"
+	"charm.land/bubbles/v2/textinput"
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs"
+	"github.com/mudaaaa/crushplus/internal/tui/styles"
+	"github.com/mudaaaa/crushplus/internal/tui/util"
+)
+
+const CompactDialogID dialogs.DialogID = "compact"
+
+// GenerateSummaryMsg asks for a summary of the session, focused on the
+// instructions. The result is sent back with SummaryGeneratedMsg.
+type GenerateSummaryMsg struct {
+	SessionID    string
+	Instructions string
+}
+
+// SummaryGeneratedMsg carries a generated summary to the dialog.
+type SummaryGeneratedMsg struct {
+	Summary string
+	Err     error
+}
+
+// CancelSummaryMsg cancels the generation of a summary.
+type CancelSummaryMsg struct {
+	SessionID string
+}
+
+// ApplySummaryMsg replaces the history of the session sent to the model with
+// the summary.
+type ApplySummaryMsg struct {
+	SessionID string
+	Summary   string
+}
+
+// CompactDialog is the dialog that compacts a session.
+type CompactDialog interface {
+	dialogs.DialogModel
+}
+
+type state int
+
+const (
+	stateInstructions state = iota
+	stateGenerating
+	statePreview
+)
+
+type compactDialogCmp struct {
+	wWidth, wHeight int
+	width           int
+
+	sessionID string
+	state     state
+	err       string
+
+	instructions textinput.Model
+	summary      textarea.Model
+	spinner      spinner.Model
+
+	keys KeyMap
+	help help.Model
+}
+
+// NewCompactDialog returns the dialog to compact the session. When
+// instructions are given, the summary is generated right away.
+func NewCompactDialog(sessionID, instructions string) CompactDialog {
+	t := styles.CurrentTheme()
+
+	ti := textinput.New()
+	ti.Placeholder = "What the summary should focus on (optional)"
+	ti.SetVirtualCursor(true)
+	ti.Prompt = ""
+	ti.SetStyles(t.S().TextInput)
+	ti.SetValue(instructions)
+	ti.Focus()
+
+	ta := textarea.New()
+	ta.SetStyles(t.S().TextArea)
+	ta.ShowLineNumbers = false
+	ta.CharLimit = -1
+	ta.SetVirtualCursor(true)
+
+	c := &compactDialogCmp{
+		sessionID:    sessionID,
+		instructions: ti,
+		summary:      ta,
+		spinner: spinner.New(
+			spinner.WithSpinner(spinner.Dot),
+			spinner.WithStyle(t.S().Base.Foreground(t.Green)),
+		),
+		width: 60,
+		keys:  DefaultKeyMap(),
+		help:  help.New(),
+	}
+	if instructions != "" {
+		c.state = stateGenerating
+	}
+	return c
+}
+
+// Init implements CompactDialog.
+func (c *compactDialogCmp) Init() tea.Cmd {
+	if c.state == stateGenerating {
+		return c.generate()
+	}
+	return nil
+}
+
+func (c *compactDialogCmp) generate() tea.Cmd {
+	c.state = stateGenerating
+	c.err = ""
+	return tea.Batch(
+		c.spinner.Tick,
+		util.CmdHandler(GenerateSummaryMsg{
+			SessionID:    c.sessionID,
+			Instructions: c.instructions.Value(),
+		}),
+	)
+}
+
+// Update implements CompactDialog.
+func (c *compactDialogCmp) Update(msg tea.Msg) (util.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		c.wWidth = msg.Width
+		c.wHeight = msg.Height
+		c.width = min(100, c.wWidth)
+		c.instructions.SetWidth(c.width - 6)
+		c.summary.SetWidth(c.width - 6)
+		c.summary.SetHeight(max(5, min(20, c.wHeight-14)))
+	case spinner.TickMsg:
+		if c.state == stateGenerating {
+			var cmd tea.Cmd
+			c.spinner, cmd = c.spinner.Update(msg)
+			return c, cmd
+		}
+	case SummaryGeneratedMsg:
+		if c.state != stateGenerating {
+			return c, nil
+		}
+		if msg.Err != nil {
+			c.state = stateInstructions
+			c.err = msg.Err.Error()
+			return c, nil
+		}
+		c.state = statePreview
+		c.summary.SetValue(msg.Summary)
+		c.summary.MoveToBegin()
+		c.summary.Focus()
+	case tea.KeyPressMsg:
+		return c, c.handleKey(msg)
+	case tea.PasteMsg:
+		var cmd tea.Cmd
+		switch c.state {
+		case stateInstructions:
+			c.instructions, cmd = c.instructions.Update(msg)
+		case statePreview:
+			c.summary, cmd = c.summary.Update(msg)
+		}
+		return c, cmd
+	}
+	return c, nil
+}
+
+func (c *compactDialogCmp) handleKey(msg tea.KeyPressMsg) tea.Cmd {
+	if key.Matches(msg, c.keys.Close) {
+		cmds := []tea.Cmd{util.CmdHandler(dialogs.CloseDialogMsg{})}
+		if c.state == stateGenerating {
+			cmds = append(cmds, util.CmdHandler(CancelSummaryMsg{SessionID: c.sessionID}))
+		}
+		return tea.Sequence(cmds...)
+	}
+
+	var cmd tea.Cmd
+	switch c.state {
+	case stateInstructions:
+		if key.Matches(msg, c.keys.Generate) {
+			return c.generate()
+		}
+		c.instructions, cmd = c.instructions.Update(msg)
+	case statePreview:
+		switch {
+		case key.Matches(msg, c.keys.Apply):
+			if c.summary.Value() == "" {
+				c.err = "The summary is empty"
+				return nil
+			}
+			return tea.Sequence(
+				util.CmdHandler(dialogs.CloseDialogMsg{}),
+				util.CmdHandler(ApplySummaryMsg{
+					SessionID: c.sessionID,
+					Summary:   c.summary.Value(),
+				}),
+			)
+		case key.Matches(msg, c.keys.Regenerate):
+			c.state = stateInstructions
+			c.summary.Blur()
+			return nil
+		}
+		c.summary, cmd = c.summary.Update(msg)
+	}
+	return cmd
+}
+
+// View implements CompactDialog.
+func (c *compactDialogCmp) View() string {
+	t := styles.CurrentTheme()
+	baseStyle := t.S().Base
+
+	title := lipgloss.NewStyle().
+		Foreground(t.Primary).
+		Bold(true).
+		Padding(0, 1).
+		Render("Summarize Session")
+
+	var description string
+	var body []string
+	var bindings []key.Binding
+	switch c.state {
+	case stateInstructions:
+		description = "The summary replaces the history sent to the model. Earlier messages stay in the chat."
+		label := baseStyle.Padding(1, 1, 0, 1).Foreground(t.FgBase).Bold(true).Render("Focus on:")
+		body = []string{label, t.S().Text.Padding(0, 1).Render(c.instructions.View())}
+		bindings = []key.Binding{c.keys.Generate, c.keys.Close}
+	case stateGenerating:
+		description = "Summarizing the conversation..."
+		body = []string{"", baseStyle.Padding(0, 1).Render(c.spinner.View() + " " + t.S().Subtle.Render("This may take a moment"))}
+		bindings = []key.Binding{c.keys.Close}
+	case statePreview:
+		description = "Review and edit the summary before it replaces the history sent to the model."
+		body = []string{"", baseStyle.Padding(0, 1).Render(c.summary.View())}
+		bindings = []key.Binding{c.keys.Apply, c.keys.Regenerate, c.keys.Close}
+	}
+
+	elements := []string{
+		title,
+		t.S().Text.Padding(0, 1).Width(c.width - 4).Render(description),
+	}
+	elements = append(elements, body...)
+	if c.err != "" {
+		elements = append(elements, "", baseStyle.Foreground(t.Error).Padding(0, 1).Width(c.width-4).Render(c.err))
+	}
+
+	c.help.ShowAll = false
+	elements = append(elements, "", baseStyle.Padding(0, 1).Render(c.help.ShortHelpView(bindings)))
+
+	return baseStyle.Padding(1, 1, 0, 1).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(t.BorderFocus).
+		Width(c.width).
+		Render(lipgloss.JoinVertical(lipgloss.Left, elements...))
+}
+
+// Position implements CompactDialog.
+func (c *compactDialogCmp) Position() (int, int) {
+	height := lipgloss.Height(c.View())
+	row := (c.wHeight / 2) - (height / 2)
+	col := (c.wWidth / 2) - (c.width / 2)
+	return row, col
+}
+
+// ID implements CompactDialog.
+func (c *compactDialogCmp) ID() dialogs.DialogID {
+	return CompactDialogID
+}
@@ -0,0 +1,53 @@
+package compact
+
+import (
+	"charm.land/bubbles/v2/key"
+)
+
+type KeyMap struct {
+	Generate   key.Binding
+	Apply      key.Binding
+	Regenerate key.Binding
+	Close      key.Binding
+}
+
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Generate: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "summarize"),
+		),
+		Apply: key.NewBinding(
+			key.WithKeys("ctrl+s"),
+			key.WithHelp("ctrl+s", "apply"),
+		),
+		Regenerate: key.NewBinding(
+			key.WithKeys("ctrl+r"),
+			key.WithHelp("ctrl+r", "change instructions"),
+		),
+		Close: key.NewBinding(
+			key.WithKeys("esc", "alt+esc"),
+			key.WithHelp("esc", "cancel"),
+		),
+	}
+}
+
+// KeyBindings implements layout.KeyMapProvider
+func (k KeyMap) KeyBindings() []key.Binding {
+	return []key.Binding{
+		k.Generate,
+		k.Apply,
+		k.Regenerate,
+		k.Close,
+	}
+}
+
+// FullHelp implements help.KeyMap.
+func (k KeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{k.KeyBindings()}
+}
+
+// ShortHelp implements help.KeyMap.
+func (k KeyMap) ShortHelp() []key.Binding {
+	return k.KeyBindings()
+}
@@ -0,0 +1,357 @@
+// Package elicitation provides the dialog that asks the user for the
+// structured input an MCP server requested.
+package elicitation
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"charm.land/bubbles/v2/help"
+	"charm.land/bubbles/v2/key"
+	"charm.land/bubbles/v2/textinput"
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+	"github.com/mudaaaa/crushplus/internal/permission"
+	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs"
+	"github.com/mudaaaa/crushplus/internal/tui/styles"
+	"github.com/mudaaaa/crushplus/internal/tui/util"
+)
+
+const ElicitationDialogID dialogs.DialogID = "elicitation"
+
+// ResponseMsg is sent when the user answers an elicitation request.
+type ResponseMsg struct {
+	Request  permission.ElicitationRequest
+	Response permission.ElicitationResponse
+}
+
+// ElicitationDialog is the form dialog for elicitation requests.
+type ElicitationDialog interface {
+	dialogs.DialogModel
+}
+
+type field struct {
+	name        string
+	title       string
+	description string
+	typ         string
+	required    bool
+
+	// Free-form fields use the input, while booleans and enums cycle through
+	// their options.
+	input   textinput.Model
+	options []string
+	labels  []string
+	option  int
+}
+
+func (f field) isChoice() bool {
+	return len(f.options) > 0
+}
+
+type elicitationDialogCmp struct {
+	wWidth, wHeight int
+	width           int
+
+	request permission.ElicitationRequest
+	fields  []field
+	focused int
+	err     string
+
+	keys KeyMap
+	help help.Model
+}
+
+func NewElicitationDialog(request permission.ElicitationRequest) ElicitationDialog {
+	c := &elicitationDialogCmp{
+		request: request,
+		fields:  parseFields(request.Schema),
+		width:   60,
+		keys:    DefaultKeyMap(),
+		help:    help.New(),
+	}
+	c.focus(0)
+	return c
+}
+
+// parseFields builds the form fields from the flat JSON schema of the
+// request, required fields first.
+func parseFields(schema map[string]any) []field {
+	t := styles.CurrentTheme()
+	props, _ := schema["properties"].(map[string]any)
+	var required []string
+	if req, ok := schema["required"].([]any); ok {
+		for _, v := range req {
+			if s, ok := v.(string); ok {
+				required = append(required, s)
+			}
+		}
+	}
+
+	fields := make([]field, 0, len(props))
+	for name, raw := range props {
+		prop, _ := raw.(map[string]any)
+		f := field{
+			name:     name,
+			title:    cmp.Or(stringValue(prop["title"]), name),
+			typ:      cmp.Or(stringValue(prop["type"]), "string"),
+			required: slices.Contains(required, name),
+		}
+		f.description = stringValue(prop["description"])
+
+		switch {
+		case f.typ == "boolean":
+			f.options = []string{"false", "true"}
+			f.labels = []string{"No", "Yes"}
+			if v, ok := prop["default"].(bool); ok && v {
+				f.option = 1
+			}
+		case prop["enum"] != nil:
+			enum, _ := prop["enum"].([]any)
+			names, _ := prop["enumNames"].([]any)
+			for i, v := range enum {
+				option := fmt.Sprint(v)
+				label := option
+				if i < len(names) {
+					label = cmp.Or(stringValue(names[i]), option)
+				}
+				f.options = append(f.options, option)
+				f.labels = append(f.labels, label)
+			}
+			if i := slices.Index(f.options, fmt.Sprint(prop["default"])); i >= 0 {
+				f.option = i
+			}
+		default:
+			ti := textinput.New()
+			ti.Placeholder = cmp.Or(f.description, "Enter "+f.typ)
+			ti.SetVirtualCursor(true)
+			ti.Prompt = ""
+			ti.SetStyles(t.S().TextInput)
+			if v, ok := prop["default"]; ok {
+				ti.SetValue(fmt.Sprint(v))
+			}
+			f.input = ti
+		}
+		fields = append(fields, f)
+	}
+
+	slices.SortStableFunc(fields, func(a, b field) int {
+		if a.required != b.required {
+			if a.required {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.name, b.name)
+	})
+	return fields
+}
+
+func stringValue(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+// Init implements ElicitationDialog.
+func (c *elicitationDialogCmp) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements ElicitationDialog.
+func (c *elicitationDialogCmp) Update(msg tea.Msg) (util.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		c.wWidth = msg.Width
+		c.wHeight = msg.Height
+		c.width = min(90, c.wWidth)
+		for i := range c.fields {
+			c.fields[i].input.SetWidth(c.width - 6)
+		}
+	case tea.KeyPressMsg:
+		switch {
+		case key.Matches(msg, c.keys.Close):
+			return c, c.respond(permission.ElicitationCancel, nil)
+		case key.Matches(msg, c.keys.Decline):
+			return c, c.respond(permission.ElicitationDecline, nil)
+		case key.Matches(msg, c.keys.Confirm):
+			if len(c.fields) > 0 && c.focused < len(c.fields)-1 {
+				c.focus(c.focused + 1)
+				return c, nil
+			}
+			content, err := c.content()
+			if err != nil {
+				c.err = err.Error()
+				return c, nil
+			}
+			return c, c.respond(permission.ElicitationAccept, content)
+		case key.Matches(msg, c.keys.Next):
+			c.focus(c.focused + 1)
+		case key.Matches(msg, c.keys.Previous):
+			c.focus(c.focused - 1)
+		case len(c.fields) > 0 && c.fields[c.focused].isChoice() && key.Matches(msg, c.keys.Toggle):
+			f := &c.fields[c.focused]
+			step := 1
+			if msg.String() == "left" {
+				step = -1
+			}
+			f.option = (f.option + step + len(f.options)) % len(f.options)
+		default:
+			if len(c.fields) > 0 && !c.fields[c.focused].isChoice() {
+				var cmd tea.Cmd
+				c.fields[c.focused].input, cmd = c.fields[c.focused].input.Update(msg)
+				return c, cmd
+			}
+		}
+	case tea.PasteMsg:
+		if len(c.fields) > 0 && !c.fields[c.focused].isChoice() {
+			var cmd tea.Cmd
+			c.fields[c.focused].input, cmd = c.fields[c.focused].input.Update(msg)
+			return c, cmd
+		}
+	}
+	return c, nil
+}
+
+func (c *elicitationDialogCmp) focus(i int) {
+	if len(c.fields) == 0 {
+		return
+	}
+	c.fields[c.focused].input.Blur()
+	c.focused = (i + len(c.fields)) % len(c.fields)
+	if !c.fields[c.focused].isChoice() {
+		c.fields[c.focused].input.Focus()
+	}
+}
+
+// content validates the form and converts its values to the types the
+// schema asks for.
+func (c *elicitationDialogCmp) content() (map[string]any, error) {
+	content := make(map[string]any, len(c.fields))
+	for _, f := range c.fields {
+		if f.isChoice() {
+			value := f.options[f.option]
+			if f.typ == "boolean" {
+				content[f.name] = value == "true"
+			} else {
+				content[f.name] = value
+			}
+			continue
+		}
+
+		value := strings.TrimSpace(f.input.Value())
+		if value == "" {
+			if f.required {
+				return nil, fmt.Errorf("%s is required", f.title)
+			}
+			continue
+		}
+		switch f.typ {
+		case "integer":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be an integer", f.title)
+			}
+			content[f.name] = n
+		case "number":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a number", f.title)
+			}
+			content[f.name] = n
+		default:
+			content[f.name] = f.input.Value()
+		}
+	}
+	return content, nil
+}
+
+func (c *elicitationDialogCmp) respond(action permission.ElicitationAction, content map[string]any) tea.Cmd {
+	return tea.Sequence(
+		util.CmdHandler(dialogs.CloseDialogMsg{}),
+		util.CmdHandler(ResponseMsg{
+			Request: c.request,
+			Response: permission.ElicitationResponse{
+				Action:  action,
+				Content: content,
+			},
+		}),
+	)
+}
+
+// View implements ElicitationDialog.
+func (c *elicitationDialogCmp) View() string {
+	t := styles.CurrentTheme()
+	baseStyle := t.S().Base
+
+	title := lipgloss.NewStyle().
+		Foreground(t.Primary).
+		Bold(true).
+		Padding(0, 1).
+		Render(fmt.Sprintf("%s needs your input", c.request.Source))
+
+	message := t.S().Text.
+		Padding(1, 1, 0, 1).
+		Width(c.width - 4).
+		Render(c.request.Message)
+
+	elements := []string{title, message}
+	for i, f := range c.fields {
+		labelStyle := baseStyle.Padding(1, 1, 0, 1)
+		if i == c.focused {
+			labelStyle = labelStyle.Foreground(t.FgBase).Bold(true)
+		} else {
+			labelStyle = labelStyle.Foreground(t.FgMuted)
+		}
+		name := f.title
+		if f.required {
+			name += "*"
+		}
+		label := labelStyle.Render(name + ":")
+
+		var value string
+		if f.isChoice() {
+			options := make([]string, len(f.labels))
+			for j, l := range f.labels {
+				if j == f.option {
+					options[j] = t.S().Text.Foreground(t.FgBase).Background(t.Primary).Padding(0, 1).Render(l)
+				} else {
+					options[j] = t.S().Subtle.Padding(0, 1).Render(l)
+				}
+			}
+			value = strings.Join(options, " ")
+		} else {
+			value = f.input.View()
+		}
+		field := t.S().Text.Padding(0, 1).Render(value)
+		elements = append(elements, lipgloss.JoinVertical(lipgloss.Left, label, field))
+	}
+
+	if c.err != "" {
+		elements = append(elements, "", t.S().Base.Foreground(t.Error).Padding(0, 1).Render(c.err))
+	}
+
+	c.help.ShowAll = false
+	elements = append(elements, "", baseStyle.Padding(0, 1).Render(c.help.View(c.keys)))
+
+	return baseStyle.Padding(1, 1, 0, 1).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(t.BorderFocus).
+		Width(c.width).
+		Render(lipgloss.JoinVertical(lipgloss.Left, elements...))
+}
+
+// Position implements ElicitationDialog.
+func (c *elicitationDialogCmp) Position() (int, int) {
+	height := lipgloss.Height(c.View())
+	row := (c.wHeight / 2) - (height / 2)
+	col := (c.wWidth / 2) - (c.width / 2)
+	return row, col
+}
+
+// ID implements ElicitationDialog.
+func (c *elicitationDialogCmp) ID() dialogs.DialogID {
+	return ElicitationDialogID
+}
@@ -0,0 +1,335 @@
+// Package jobs provides the dialog listing the background jobs of the
+// session, to tail their output, kill them, and pin their output to the
+// prompt.
+package jobs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"charm.land/bubbles/v2/help"
+	"charm.land/bubbles/v2/key"
+	"charm.land/bubbles/v2/viewport"
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/mudaaaa/crushplus/internal/ansiext"
+	"github.com/mudaaaa/crushplus/internal/message"
+	"github.com/mudaaaa/crushplus/internal/shell"
+	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs"
+	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/filepicker"
+	"github.com/mudaaaa/crushplus/internal/tui/styles"
+	"github.com/mudaaaa/crushplus/internal/tui/util"
+)
+
+const (
+	JobsDialogID dialogs.DialogID = "jobs"
+
+	// refreshInterval is how often the jobs and their output are refreshed.
+	refreshInterval = time.Second
+	// maxPinnedOutput is the most output of a job pinned to the prompt.
+	maxPinnedOutput = 32 * 1024
+)
+
+// refreshMsg refreshes the jobs and the output shown.
+type refreshMsg struct {
+	// tick is set for the periodic refreshes, which schedule the next one.
+	tick bool
+}
+
+// JobsDialog is the dialog listing the background jobs of the session.
+type JobsDialog interface {
+	dialogs.DialogModel
+}
+
+type jobsDialogCmp struct {
+	wWidth, wHeight int
+	width           int
+
+	sessionID string
+	jobs      []shell.BackgroundShellInfo
+	selected  int
+	// tailing is the ID of the job whose output is shown, if any.
+	tailing string
+
+	viewport viewport.Model
+	keys     KeyMap
+	help     help.Model
+}
+
+// NewJobsDialog returns the dialog listing the background jobs of the
+// session.
+func NewJobsDialog(sessionID string) JobsDialog {
+	t := styles.CurrentTheme()
+	h := help.New()
+	h.Styles = t.S().Help
+	d := &jobsDialogCmp{
+		sessionID: sessionID,
+		viewport:  viewport.New(),
+		width:     80,
+		keys:      DefaultKeyMap(),
+		help:      h,
+	}
+	d.refresh()
+	return d
+}
+
+// Init implements JobsDialog.
+func (d *jobsDialogCmp) Init() tea.Cmd {
+	return d.tick()
+}
+
+func (d *jobsDialogCmp) tick() tea.Cmd {
+	return tea.Tick(refreshInterval, func(time.Time) tea.Msg {
+		return refreshMsg{tick: true}
+	})
+}
+
+// Update implements JobsDialog.
+func (d *jobsDialogCmp) Update(msg tea.Msg) (util.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		d.wWidth = msg.Width
+		d.wHeight = msg.Height
+		d.width = min(120, d.wWidth-4)
+		d.viewport.SetWidth(d.width - 6)
+		d.viewport.SetHeight(max(5, d.wHeight-14))
+		d.refresh()
+	case refreshMsg:
+		d.refresh()
+		if msg.tick {
+			return d, d.tick()
+		}
+	case tea.KeyPressMsg:
+		return d, d.handleKey(msg)
+	case tea.MouseWheelMsg:
+		if d.tailing != "" {
+			var cmd tea.Cmd
+			d.viewport, cmd = d.viewport.Update(msg)
+			return d, cmd
+		}
+	}
+	return d, nil
+}
+
+func (d *jobsDialogCmp) handleKey(msg tea.KeyPressMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, d.keys.Close):
+		if d.tailing != "" {
+			d.tailing = ""
+			return nil
+		}
+		return util.CmdHandler(dialogs.CloseDialogMsg{})
+	case key.Matches(msg, d.keys.Kill):
+		job, ok := d.current()
+		if !ok || job.Done() {
+			return nil
+		}
+		return func() tea.Msg {
+			if err := shell.GetBackgroundShellManager().Kill(job.ID); err != nil {
+				return util.ReportError(err)()
+			}
+			return refreshMsg{}
+		}
+	case key.Matches(msg, d.keys.Pin):
+		job, ok := d.current()
+		if !ok {
+			return nil
+		}
+		return d.pin(job)
+	}
+
+	if d.tailing != "" {
+		var cmd tea.Cmd
+		d.viewport, cmd = d.viewport.Update(msg)
+		return cmd
+	}
+	switch {
+	case key.Matches(msg, d.keys.Next):
+		d.selected = min(d.selected+1, len(d.jobs)-1)
+	case key.Matches(msg, d.keys.Previous):
+		d.selected = max(d.selected-1, 0)
+	case key.Matches(msg, d.keys.View):
+		if job, ok := d.current(); ok {
+			d.tailing = job.ID
+			d.refreshOutput(true)
+		}
+	}
+	return nil
+}
+
+// current returns the selected job, or the one being tailed.
+func (d *jobsDialogCmp) current() (shell.BackgroundShellInfo, bool) {
+	if d.selected < 0 || d.selected >= len(d.jobs) {
+		return shell.BackgroundShellInfo{}, false
+	}
+	return d.jobs[d.selected], true
+}
+
+func (d *jobsDialogCmp) refresh() {
+	var selectedID string
+	if job, ok := d.current(); ok {
+		selectedID = job.ID
+	}
+	d.jobs = d.jobs[:0]
+	for _, job := range shell.GetBackgroundShellManager().Jobs(d.sessionID) {
+		d.jobs = append(d.jobs, job.Info())
+	}
+	d.selected = min(d.selected, max(0, len(d.jobs)-1))
+	for i, job := range d.jobs {
+		if job.ID == selectedID {
+			d.selected = i
+		}
+	}
+	if d.tailing != "" {
+		d.refreshOutput(false)
+	}
+}
+
+// refreshOutput shows the latest output of the job being tailed, following
+// it when the view is at the bottom.
+func (d *jobsDialogCmp) refreshOutput(follow bool) {
+	job, ok := shell.GetBackgroundShellManager().Get(d.tailing)
+	if !ok {
+		d.tailing = ""
+		return
+	}
+	follow = follow || d.viewport.AtBottom()
+	output := strings.TrimRight(jobOutput(job), "\n")
+	if output == "" {
+		output = styles.CurrentTheme().S().Subtle.Render("No output yet")
+	}
+	d.viewport.SetContent(ansi.Hardwrap(output, d.viewport.Width(), true))
+	if follow {
+		d.viewport.GotoBottom()
+	}
+}
+
+// pin attaches the latest output of the job to the prompt.
+func (d *jobsDialogCmp) pin(info shell.BackgroundShellInfo) tea.Cmd {
+	job, ok := shell.GetBackgroundShellManager().Get(info.ID)
+	if !ok {
+		return nil
+	}
+	output := jobOutput(job)
+	if len(output) > maxPinnedOutput {
+		output = output[len(output)-maxPinnedOutput:]
+		if i := strings.IndexByte(output, '\n'); i >= 0 {
+			output = output[i+1:]
+		}
+	}
+	content := fmt.Sprintf("Output of background job %s (%s), %s:\n\n%s", info.ID, info.Command, jobStatus(info), output)
+	name := fmt.Sprintf("job-%s.log", info.ID)
+	return tea.Sequence(
+		util.CmdHandler(dialogs.CloseDialogMsg{}),
+		util.CmdHandler(filepicker.FilePickedMsg{
+			Attachment: message.Attachment{
+				FilePath: name,
+				FileName: name,
+				MimeType: "text/plain",
+				Content:  []byte(content),
+			},
+		}),
+	)
+}
+
+// View implements JobsDialog.
+func (d *jobsDialogCmp) View() string {
+	t := styles.CurrentTheme()
+	baseStyle := t.S().Base
+
+	title := "Background Jobs"
+	var content string
+	bindings := d.keys.ShortHelp()
+	if job, ok := d.current(); ok && d.tailing != "" {
+		title = fmt.Sprintf("Job %s: %s", job.ID, jobStatus(job))
+		content = lipgloss.JoinVertical(
+			lipgloss.Left,
+			t.S().Subtle.Render(ansi.Truncate(job.Command, d.width-6, "…")),
+			"",
+			d.viewport.View(),
+		)
+		back := d.keys.Close
+		back.SetHelp("esc", "back")
+		bindings = []key.Binding{d.keys.Kill, d.keys.Pin, back}
+	} else {
+		content = d.jobsList()
+	}
+
+	elements := []string{
+		lipgloss.NewStyle().Foreground(t.Primary).Bold(true).Padding(0, 1).Render(title),
+		"",
+		baseStyle.Padding(0, 1).Render(content),
+		"",
+		baseStyle.Padding(0, 1).Render(d.help.ShortHelpView(bindings)),
+	}
+	return baseStyle.Padding(1, 1, 0, 1).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(t.BorderFocus).
+		Width(d.width).
+		Render(lipgloss.JoinVertical(lipgloss.Left, elements...))
+}
+
+func (d *jobsDialogCmp) jobsList() string {
+	t := styles.CurrentTheme()
+	if len(d.jobs) == 0 {
+		return t.S().Subtle.Render("No background jobs in this session")
+	}
+	width := d.width - 6
+	lines := make([]string, 0, len(d.jobs))
+	for i, job := range d.jobs {
+		icon := t.S().Base.Foreground(t.GreenLight).Render(styles.ToolPending)
+		if job.Done() && job.ExitCode == 0 {
+			icon = t.S().Base.Foreground(t.Green).Render(styles.ToolSuccess)
+		} else if job.Done() {
+			icon = t.S().Base.Foreground(t.Error).Render(styles.ToolError)
+		}
+		status := jobStatus(job)
+		label := job.Command
+		if job.Description != "" {
+			label = job.Description + " · " + job.Command
+		}
+		label = ansi.Truncate(label, max(10, width-lipgloss.Width(status)-len(job.ID)-6), "…")
+		line := fmt.Sprintf("%s %s %s", icon, job.ID, label)
+		gap := max(1, width-lipgloss.Width(line)-lipgloss.Width(status))
+		line += strings.Repeat(" ", gap) + t.S().Subtle.Render(status)
+		if i == d.selected {
+			line = t.S().TextSelected.Width(width).Render(ansi.Strip(line))
+		}
+		lines = append(lines, line)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, lines...)
+}
+
+// jobOutput returns the output of the job, as plain text for the jobs running
+// in a pseudo-terminal.
+func jobOutput(job *shell.BackgroundShell) string {
+	if job.PTY {
+		return ansiext.Strip(job.Output().String())
+	}
+	return job.Output().String()
+}
+
+// jobStatus describes whether the job is running, its runtime and its exit
+// code.
+func jobStatus(job shell.BackgroundShellInfo) string {
+	runtime := job.Runtime().Round(time.Second).String()
+	if !job.Done() {
+		return "running for " + runtime
+	}
+	return fmt.Sprintf("exited %d after %s", job.ExitCode, runtime)
+}
+
+// Position implements JobsDialog.
+func (d *jobsDialogCmp) Position() (int, int) {
+	height := lipgloss.Height(d.View())
+	row := (d.wHeight / 2) - (height / 2)
+	col := (d.wWidth / 2) - (d.width / 2)
+	return row, col
+}
+
+// ID implements JobsDialog.
+func (d *jobsDialogCmp) ID() dialogs.DialogID {
+	return JobsDialogID
+}
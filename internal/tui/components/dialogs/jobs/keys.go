@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"charm.land/bubbles/v2/key"
+)
+
+type KeyMap struct {
+	Next,
+	Previous,
+	View,
+	Kill,
+	Pin,
+	Close key.Binding
+}
+
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Next: key.NewBinding(
+			key.WithKeys("down", "ctrl+n", "j"),
+			key.WithHelp("↓", "next job"),
+		),
+		Previous: key.NewBinding(
+			key.WithKeys("up", "ctrl+p", "k"),
+			key.WithHelp("↑", "previous job"),
+		),
+		View: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "tail output"),
+		),
+		Kill: key.NewBinding(
+			key.WithKeys("x", "ctrl+x"),
+			key.WithHelp("x", "kill"),
+		),
+		Pin: key.NewBinding(
+			key.WithKeys("p", "ctrl+a"),
+			key.WithHelp("p", "pin output to prompt"),
+		),
+		Close: key.NewBinding(
+			key.WithKeys("esc", "alt+esc"),
+			key.WithHelp("esc", "close"),
+		),
+	}
+}
+
+// KeyBindings implements layout.KeyMapProvider
+func (k KeyMap) KeyBindings() []key.Binding {
+	return []key.Binding{
+		k.Next,
+		k.Previous,
+		k.View,
+		k.Kill,
+		k.Pin,
+		k.Close,
+	}
+}
+
+// FullHelp implements help.KeyMap.
+func (k KeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{k.KeyBindings()}
+}
+
+// ShortHelp implements help.KeyMap.
+func (k KeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{
+		key.NewBinding(
+			key.WithKeys("down", "up"),
+			key.WithHelp("↑↓", "choose"),
+		),
+		k.View,
+		k.Kill,
+		k.Pin,
+		k.Close,
+	}
+}
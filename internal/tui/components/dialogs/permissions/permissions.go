@@ -419,6 +419,21 @@ func (p *permissionDialogCmp) renderHeader() string {
 			),
 			baseStyle.Render(strings.Repeat(" ", p.width)),
 		)
+	case tools.GitCommitToolName:
+		params := p.permission.Params.(tools.GitCommitPermissionsParams)
+		filesKey := t.S().Muted.Render("Files")
+		filesValue := t.S().Text.
+			Width(p.width - lipgloss.Width(filesKey)).
+			Render(fmt.Sprintf(" %d staged", len(params.Files)))
+		headerParts = append(headerParts,
+			lipgloss.JoinHorizontal(
+				lipgloss.Left,
+				filesKey,
+				filesValue,
+			),
+			baseStyle.Render(strings.Repeat(" ", p.width)),
+			t.S().Muted.Width(p.width).Bold(true).Render("Commit"),
+		)
 	}
 
 	return baseStyle.Render(lipgloss.JoinVertical(lipgloss.Left, headerParts...))
@@ -451,6 +466,10 @@ func (p *permissionDialogCmp) getOrGenerateContent() string {
 		content = p.generateViewContent()
 	case tools.LSToolName:
 		content = p.generateLSContent()
+	case tools.MergeAgentPatchToolName:
+		content = p.generateMergeAgentPatchContent()
+	case tools.GitCommitToolName:
+		content = p.generateGitCommitContent()
 	default:
 		content = p.generateDefaultContent()
 	}
@@ -654,6 +673,65 @@ func (p *permissionDialogCmp) generateLSContent() string {
 	return ""
 }
 
+func (p *permissionDialogCmp) generateMergeAgentPatchContent() string {
+	t := styles.CurrentTheme()
+	baseStyle := t.S().Base.Background(t.BgSubtle)
+	if pr, ok := p.permission.Params.(tools.MergeAgentPatchPermissionsParams); ok {
+		width := p.contentViewPort.Width() - 4
+		return baseStyle.
+			Padding(1, 2).
+			Width(p.contentViewPort.Width()).
+			Render(strings.Join(renderPatchLines(pr.Patch, width), "\n"))
+	}
+	return ""
+}
+
+func (p *permissionDialogCmp) generateGitCommitContent() string {
+	t := styles.CurrentTheme()
+	baseStyle := t.S().Base.Background(t.BgSubtle)
+	if pr, ok := p.permission.Params.(tools.GitCommitPermissionsParams); ok {
+		width := p.contentViewPort.Width() - 4
+		var out []string
+		for ln := range strings.SplitSeq(strings.TrimRight(pr.Message, "\n"), "\n") {
+			out = append(out, baseStyle.Foreground(t.FgBase).Width(width).Render(ansi.Truncate(ln, width, "…")))
+		}
+		out = append(out, baseStyle.Width(width).Render(""))
+		for ln := range strings.SplitSeq(pr.Stat, "\n") {
+			out = append(out, baseStyle.Foreground(t.FgMuted).Width(width).Render(ansi.Truncate(ln, width, "…")))
+		}
+		out = append(out, baseStyle.Width(width).Render(""))
+		out = append(out, renderPatchLines(pr.Diff, width)...)
+
+		return baseStyle.
+			Padding(1, 2).
+			Width(p.contentViewPort.Width()).
+			Render(strings.Join(out, "\n"))
+	}
+	return ""
+}
+
+// renderPatchLines colors the lines of a unified diff, truncated to width.
+func renderPatchLines(patch string, width int) []string {
+	t := styles.CurrentTheme()
+	baseStyle := t.S().Base.Background(t.BgSubtle)
+	var out []string
+	for ln := range strings.SplitSeq(strings.TrimRight(patch, "\n"), "\n") {
+		style := baseStyle.Foreground(t.FgBase)
+		switch {
+		case strings.HasPrefix(ln, "+++"), strings.HasPrefix(ln, "---"), strings.HasPrefix(ln, "diff "):
+			style = baseStyle.Foreground(t.FgBase).Bold(true)
+		case strings.HasPrefix(ln, "+"):
+			style = baseStyle.Foreground(t.Success)
+		case strings.HasPrefix(ln, "-"):
+			style = baseStyle.Foreground(t.Error)
+		case strings.HasPrefix(ln, "@@"):
+			style = baseStyle.Foreground(t.FgMuted)
+		}
+		out = append(out, style.Width(width).Render(ansi.Truncate(ln, width, "…")))
+	}
+	return out
+}
+
 func (p *permissionDialogCmp) generateDefaultContent() string {
 	t := styles.CurrentTheme()
 	baseStyle := t.S().Base.Background(t.BgSubtle)
@@ -830,6 +908,12 @@ func (p *permissionDialogCmp) SetSize() tea.Cmd {
 	case tools.LSToolName:
 		p.width = int(float64(p.wWidth) * 0.8)
 		p.height = int(float64(p.wHeight) * 0.4)
+	case tools.MergeAgentPatchToolName:
+		p.width = int(float64(p.wWidth) * 0.8)
+		p.height = int(float64(p.wHeight) * 0.8)
+	case tools.GitCommitToolName:
+		p.width = int(float64(p.wWidth) * 0.8)
+		p.height = int(float64(p.wHeight) * 0.8)
 	default:
 		p.width = int(float64(p.wWidth) * 0.7)
 		p.height = int(float64(p.wHeight) * 0.5)
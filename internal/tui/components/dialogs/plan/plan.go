@@ -0,0 +1,206 @@
+// Package plan provides the dialog to review the plan the agent came up with
+// in plan mode, and to approve it, as is or edited, before it's carried out.
+package plan
+
+import (
+	"strings"
+
+	"charm.land/bubbles/v2/help"
+	"charm.land/bubbles/v2/key"
+	"charm.land/bubbles/v2/textarea"
+	"charm.land/bubbles/v2/viewport"
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs"
+	"github.com/mudaaaa/crushplus/internal/tui/styles"
+	"github.com/mudaaaa/crushplus/internal/tui/util"
+)
+
+const PlanDialogID dialogs.DialogID = "plan"
+
+// ApprovePlanMsg asks to carry out the approved plan in the session.
+type ApprovePlanMsg struct {
+	SessionID string
+	Plan      string
+}
+
+// PlanDialog is the dialog to review a plan.
+type PlanDialog interface {
+	dialogs.DialogModel
+}
+
+type planDialogCmp struct {
+	wWidth, wHeight int
+	width           int
+
+	sessionID string
+	editing   bool
+	err       string
+
+	viewport viewport.Model
+	editor   textarea.Model
+
+	keys KeyMap
+	help help.Model
+}
+
+// NewPlanDialog returns the dialog to review the plan of the session.
+func NewPlanDialog(sessionID, plan string) PlanDialog {
+	t := styles.CurrentTheme()
+
+	ta := textarea.New()
+	ta.SetStyles(t.S().TextArea)
+	ta.ShowLineNumbers = false
+	ta.CharLimit = -1
+	ta.SetVirtualCursor(true)
+	ta.SetValue(strings.TrimSpace(plan))
+	ta.MoveToBegin()
+
+	return &planDialogCmp{
+		sessionID: sessionID,
+		viewport:  viewport.New(),
+		editor:    ta,
+		width:     60,
+		keys:      DefaultKeyMap(),
+		help:      help.New(),
+	}
+}
+
+// Init implements PlanDialog.
+func (p *planDialogCmp) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements PlanDialog.
+func (p *planDialogCmp) Update(msg tea.Msg) (util.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		p.wWidth = msg.Width
+		p.wHeight = msg.Height
+		p.width = min(120, p.wWidth-4)
+		height := max(5, p.wHeight-12)
+		p.editor.SetWidth(p.width - 6)
+		p.editor.SetHeight(height)
+		p.viewport.SetWidth(p.width - 6)
+		p.viewport.SetHeight(height)
+		p.renderPlan()
+	case tea.KeyPressMsg:
+		return p, p.handleKey(msg)
+	case tea.PasteMsg:
+		if p.editing {
+			var cmd tea.Cmd
+			p.editor, cmd = p.editor.Update(msg)
+			return p, cmd
+		}
+	case tea.MouseWheelMsg:
+		if !p.editing {
+			var cmd tea.Cmd
+			p.viewport, cmd = p.viewport.Update(msg)
+			return p, cmd
+		}
+	}
+	return p, nil
+}
+
+func (p *planDialogCmp) handleKey(msg tea.KeyPressMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, p.keys.Close):
+		return util.CmdHandler(dialogs.CloseDialogMsg{})
+	case key.Matches(msg, p.keys.Approve):
+		plan := strings.TrimSpace(p.editor.Value())
+		if plan == "" {
+			p.err = "The plan is empty"
+			return nil
+		}
+		return tea.Sequence(
+			util.CmdHandler(dialogs.CloseDialogMsg{}),
+			util.CmdHandler(ApprovePlanMsg{
+				SessionID: p.sessionID,
+				Plan:      plan,
+			}),
+		)
+	case key.Matches(msg, p.keys.Edit):
+		p.editing = !p.editing
+		if p.editing {
+			return p.editor.Focus()
+		}
+		p.editor.Blur()
+		p.renderPlan()
+		return nil
+	}
+
+	var cmd tea.Cmd
+	if p.editing {
+		p.editor, cmd = p.editor.Update(msg)
+	} else {
+		p.viewport, cmd = p.viewport.Update(msg)
+	}
+	return cmd
+}
+
+// renderPlan renders the plan as markdown for review.
+func (p *planDialogCmp) renderPlan() {
+	width := p.viewport.Width()
+	if width <= 0 {
+		return
+	}
+	rendered, err := styles.GetMarkdownRenderer(width).Render(p.editor.Value())
+	if err != nil {
+		rendered = p.editor.Value()
+	}
+	p.viewport.SetContent(strings.TrimSpace(rendered))
+}
+
+// View implements PlanDialog.
+func (p *planDialogCmp) View() string {
+	t := styles.CurrentTheme()
+	baseStyle := t.S().Base
+
+	title := lipgloss.NewStyle().
+		Foreground(t.Primary).
+		Bold(true).
+		Padding(0, 1).
+		Render("Review Plan")
+
+	description := "Approve the plan to carry it out with all tools, or close this to keep planning."
+	content := p.viewport.View()
+	editBinding := p.keys.Edit
+	if p.editing {
+		description = "Edit the plan, then approve it or go back to the preview."
+		content = p.editor.View()
+		editBinding.SetHelp("ctrl+e", "preview")
+	}
+
+	elements := []string{
+		title,
+		t.S().Text.Padding(0, 1).Width(p.width - 4).Render(description),
+		"",
+		baseStyle.Padding(0, 1).Render(content),
+	}
+	if p.err != "" {
+		elements = append(elements, "", baseStyle.Foreground(t.Error).Padding(0, 1).Width(p.width-4).Render(p.err))
+	}
+
+	p.help.ShowAll = false
+	bindings := []key.Binding{p.keys.Approve, editBinding, p.keys.Close}
+	elements = append(elements, "", baseStyle.Padding(0, 1).Render(p.help.ShortHelpView(bindings)))
+
+	return baseStyle.Padding(1, 1, 0, 1).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(t.BorderFocus).
+		Width(p.width).
+		Render(lipgloss.JoinVertical(lipgloss.Left, elements...))
+}
+
+// Position implements PlanDialog.
+func (p *planDialogCmp) Position() (int, int) {
+	height := lipgloss.Height(p.View())
+	row := (p.wHeight / 2) - (height / 2)
+	col := (p.wWidth / 2) - (p.width / 2)
+	return row, col
+}
+
+// ID implements PlanDialog.
+func (p *planDialogCmp) ID() dialogs.DialogID {
+	return PlanDialogID
+}
@@ -34,7 +34,7 @@ func RenderMCPList(opts RenderOptions) []string {
 		mcpList = append(mcpList, section, "")
 	}
 
-	mcps := config.Get().MCP.Sorted()
+	mcps := config.Get().MCPs().Sorted()
 	if len(mcps) == 0 {
 		mcpList = append(mcpList, t.S().Base.Foreground(t.Border).Render("None"))
 		return mcpList
@@ -74,6 +74,12 @@ func RenderMCPList(opts RenderOptions) []string {
 				if count := state.Counts.Prompts; count > 0 {
 					extraContent = append(extraContent, t.S().Subtle.Render(fmt.Sprintf("%d prompts", count)))
 				}
+				if count := state.Counts.Resources; count > 0 {
+					extraContent = append(extraContent, t.S().Subtle.Render(fmt.Sprintf("%d resources", count)))
+				}
+			case mcp.StateNeedsAuth:
+				icon = t.ItemBusyIcon
+				description = t.S().Subtle.Render("needs auth")
 			case mcp.StateError:
 				icon = t.ItemErrorIcon
 				if state.Error != nil {
@@ -109,7 +115,7 @@ func RenderMCPBlock(opts RenderOptions, showTruncationIndicator bool) string {
 
 	// Add truncation indicator if needed
 	if showTruncationIndicator && opts.MaxItems > 0 {
-		mcps := config.Get().MCP.Sorted()
+		mcps := config.Get().MCPs().Sorted()
 		if len(mcps) > opts.MaxItems {
 			remaining := len(mcps) - opts.MaxItems
 			if remaining == 1 {
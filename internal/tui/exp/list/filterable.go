@@ -29,6 +29,7 @@ type FilterableList[T FilterableItem] interface {
 	SetInputPlaceholder(string)
 	SetResultsSize(int)
 	Filter(q string) tea.Cmd
+	Query() string
 	fuzzy.Source
 }
 
@@ -277,6 +278,11 @@ func (f *filterableList[T]) SetItems(items []T) tea.Cmd {
 	return f.list.SetItems(items)
 }
 
+// Query returns the text typed in the filter input.
+func (f *filterableList[T]) Query() string {
+	return f.input.Value()
+}
+
 func (f *filterableList[T]) Cursor() *tea.Cursor {
 	if f.inputHidden {
 		return nil
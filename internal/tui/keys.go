@@ -11,6 +11,7 @@ type KeyMap struct {
 	Suspend  key.Binding
 	Models   key.Binding
 	Sessions key.Binding
+	Jobs     key.Binding
 
 	pageBindings []key.Binding
 }
@@ -41,5 +42,9 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("ctrl+s"),
 			key.WithHelp("ctrl+s", "sessions"),
 		),
+		Jobs: key.NewBinding(
+			key.WithKeys("ctrl+b"),
+			key.WithHelp("ctrl+b", "jobs"),
+		),
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"charm.land/bubbles/v2/help"
@@ -11,6 +12,7 @@ import (
 	"charm.land/bubbles/v2/spinner"
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
+	"github.com/mudaaaa/crushplus/internal/agent"
 	"github.com/mudaaaa/crushplus/internal/app"
 	"github.com/mudaaaa/crushplus/internal/config"
 	"github.com/mudaaaa/crushplus/internal/history"
@@ -18,6 +20,8 @@ import (
 	"github.com/mudaaaa/crushplus/internal/permission"
 	"github.com/mudaaaa/crushplus/internal/pubsub"
 	"github.com/mudaaaa/crushplus/internal/session"
+	"github.com/mudaaaa/crushplus/internal/shell"
+	"github.com/mudaaaa/crushplus/internal/todo"
 	"github.com/mudaaaa/crushplus/internal/tui/components/anim"
 	"github.com/mudaaaa/crushplus/internal/tui/components/chat"
 	"github.com/mudaaaa/crushplus/internal/tui/components/chat/editor"
@@ -32,6 +36,7 @@ import (
 	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/commands"
 	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/filepicker"
 	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/models"
+	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/plan"
 	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/reasoning"
 	"github.com/mudaaaa/crushplus/internal/tui/page"
 	"github.com/mudaaaa/crushplus/internal/tui/styles"
@@ -115,6 +120,7 @@ type chatPage struct {
 	splashFullScreen bool
 	isOnboarding     bool
 	isProjectInit    bool
+	planMode         bool
 }
 
 func New(app *app.App) ChatPage {
@@ -122,7 +128,7 @@ func New(app *app.App) ChatPage {
 		app:         app,
 		keyMap:      DefaultKeyMap(),
 		header:      header.New(app.LSPClients),
-		sidebar:     sidebar.New(app.History, app.LSPClients, false),
+		sidebar:     sidebar.New(app.History, app.Todos, app.LSPClients, false),
 		chat:        chat.New(app),
 		editor:      editor.New(app),
 		splash:      splash.New(),
@@ -319,7 +325,15 @@ func (p *chatPage) Update(msg tea.Msg) (util.Model, tea.Cmd) {
 		u, cmd := p.editor.Update(msg)
 		p.editor = u.(editor.Editor)
 		return p, cmd
-	case pubsub.Event[history.File], sidebar.SessionFilesMsg:
+	case commands.TogglePlanModeMsg:
+		p.setPlanMode(!p.planMode)
+		if p.planMode {
+			return p, util.ReportInfo("Plan mode on: the agent only reads and plans until you approve its plan")
+		}
+		return p, util.ReportInfo("Plan mode off")
+	case plan.ApprovePlanMsg:
+		return p, p.executePlan(msg.SessionID, msg.Plan)
+	case pubsub.Event[history.File], pubsub.Event[agent.TokenEstimate], pubsub.Event[todo.List], pubsub.Event[shell.BackgroundShellInfo], sidebar.SessionFilesMsg, sidebar.SessionTodosMsg:
 		u, cmd := p.sidebar.Update(msg)
 		p.sidebar = u.(sidebar.Sidebar)
 		cmds = append(cmds, cmd)
@@ -393,6 +407,8 @@ func (p *chatPage) Update(msg tea.Msg) (util.Model, tea.Cmd) {
 		case key.Matches(msg, p.keyMap.Details):
 			p.toggleDetails()
 			return p, nil
+		case key.Matches(msg, p.keyMap.PlanMode):
+			return p, util.CmdHandler(commands.TogglePlanModeMsg{})
 		}
 
 		switch p.focusedPane {
@@ -754,28 +770,74 @@ func (p *chatPage) sendMessage(text string, attachments []message.Attachment) te
 		return util.ReportError(fmt.Errorf("coder agent is not initialized"))
 	}
 	cmds = append(cmds, p.chat.GoToBottom())
-	cmds = append(cmds, func() tea.Msg {
-		_, err := p.app.AgentCoordinator.Run(context.Background(), session.ID, text, attachments...)
-		if err != nil {
-			isCancelErr := errors.Is(err, context.Canceled)
-			isPermissionErr := errors.Is(err, permission.ErrorPermissionDenied)
-			if isCancelErr || isPermissionErr {
+	if p.planMode {
+		cmds = append(cmds, func() tea.Msg {
+			result, err := p.app.AgentCoordinator.Plan(context.Background(), session.ID, text, attachments...)
+			if err != nil {
+				return agentErrorMsg(err)
+			}
+			// A nil result means the prompt was queued.
+			if result == nil || strings.TrimSpace(result.Response.Content.Text()) == "" {
 				return nil
 			}
-			return util.InfoMsg{
-				Type: util.InfoTypeError,
-				Msg:  err.Error(),
+			return dialogs.OpenDialogMsg{
+				Model: plan.NewPlanDialog(session.ID, result.Response.Content.Text()),
 			}
+		})
+		return tea.Batch(cmds...)
+	}
+	cmds = append(cmds, func() tea.Msg {
+		_, err := p.app.AgentCoordinator.Run(context.Background(), session.ID, text, attachments...)
+		if err != nil {
+			return agentErrorMsg(err)
 		}
 		return nil
 	})
 	return tea.Batch(cmds...)
 }
 
+// executePlan leaves plan mode and has the agent carry out the approved plan.
+func (p *chatPage) executePlan(sessionID, approved string) tea.Cmd {
+	if p.app.AgentCoordinator == nil {
+		return util.ReportError(fmt.Errorf("coder agent is not initialized"))
+	}
+	p.setPlanMode(false)
+	return tea.Batch(
+		p.chat.GoToBottom(),
+		func() tea.Msg {
+			_, err := p.app.AgentCoordinator.ExecutePlan(context.Background(), sessionID, approved)
+			if err != nil {
+				return agentErrorMsg(err)
+			}
+			return nil
+		},
+	)
+}
+
+func (p *chatPage) setPlanMode(on bool) {
+	p.planMode = on
+	p.editor.SetPlanMode(on)
+}
+
+// agentErrorMsg reports the error of a run of the agent, unless the user
+// caused it.
+func agentErrorMsg(err error) tea.Msg {
+	isCancelErr := errors.Is(err, context.Canceled)
+	isPermissionErr := errors.Is(err, permission.ErrorPermissionDenied)
+	if isCancelErr || isPermissionErr {
+		return nil
+	}
+	return util.InfoMsg{
+		Type: util.InfoTypeError,
+		Msg:  err.Error(),
+	}
+}
+
 func (p *chatPage) Bindings() []key.Binding {
 	bindings := []key.Binding{
 		p.keyMap.NewSession,
 		p.keyMap.AddAttachment,
+		p.keyMap.PlanMode,
 	}
 	if p.app.AgentCoordinator != nil && p.app.AgentCoordinator.IsBusy() {
 		cancelBinding := p.keyMap.Cancel
@@ -10,6 +10,7 @@ type KeyMap struct {
 	Cancel        key.Binding
 	Tab           key.Binding
 	Details       key.Binding
+	PlanMode      key.Binding
 }
 
 func DefaultKeyMap() KeyMap {
@@ -34,5 +35,9 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("ctrl+d"),
 			key.WithHelp("ctrl+d", "toggle details"),
 		),
+		PlanMode: key.NewBinding(
+			key.WithKeys("shift+tab"),
+			key.WithHelp("shift+tab", "plan mode"),
+		),
 	}
 }
@@ -16,6 +16,11 @@ const (
 	ToolSuccess string = "✓"
 	ToolError   string = "×"
 
+	// Todo icons
+	TodoPending    string = "○"
+	TodoInProgress string = "●"
+	TodoDone       string = "✓"
+
 	BorderThin  string = "│"
 	BorderThick string = "▌"
 )
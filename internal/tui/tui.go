@@ -25,7 +25,10 @@ import (
 	"github.com/mudaaaa/crushplus/internal/tui/components/core/status"
 	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs"
 	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/commands"
+	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/compact"
+	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/elicitation"
 	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/filepicker"
+	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/jobs"
 	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/models"
 	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/permissions"
 	"github.com/mudaaaa/crushplus/internal/tui/components/dialogs/quit"
@@ -153,6 +156,8 @@ func (a *appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return a, handleMCPPromptsEvent(context.Background(), msg.Payload.Name)
 		case mcp.EventToolsListChanged:
 			return a, handleMCPToolsEvent(context.Background(), msg.Payload.Name)
+		case mcp.EventResourcesListChanged:
+			return a, handleMCPResourcesEvent(context.Background(), msg.Payload.Name)
 		}
 
 	// Completions messages
@@ -236,6 +241,14 @@ func (a *appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 		}
 
+	case commands.OpenJobsDialogMsg:
+		if a.selectedSessionID == "" {
+			return a, nil
+		}
+		return a, util.CmdHandler(dialogs.OpenDialogMsg{
+			Model: jobs.NewJobsDialog(a.selectedSessionID),
+		})
+
 	case commands.SwitchModelMsg:
 		return a, util.CmdHandler(
 			dialogs.OpenDialogMsg{
@@ -244,13 +257,34 @@ func (a *appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		)
 	// Compact
 	case commands.CompactMsg:
+		return a, util.CmdHandler(dialogs.OpenDialogMsg{
+			Model: compact.NewCompactDialog(msg.SessionID, msg.Instructions),
+		})
+	case compact.GenerateSummaryMsg:
 		return a, func() tea.Msg {
-			err := a.app.AgentCoordinator.Summarize(context.Background(), msg.SessionID)
-			if err != nil {
+			summary, err := a.app.AgentCoordinator.GenerateSummary(context.Background(), msg.SessionID, msg.Instructions)
+			return compact.SummaryGeneratedMsg{Summary: summary, Err: err}
+		}
+	case compact.CancelSummaryMsg:
+		a.app.AgentCoordinator.Cancel(msg.SessionID)
+		return a, nil
+	case compact.ApplySummaryMsg:
+		return a, func() tea.Msg {
+			if err := a.app.AgentCoordinator.ApplySummary(context.Background(), msg.SessionID, msg.Summary); err != nil {
 				return util.ReportError(err)()
 			}
-			return nil
+			return util.ReportInfo("Session summarized")()
 		}
+	case commands.MCPLoginMsg:
+		return a, tea.Batch(
+			util.ReportInfo(fmt.Sprintf("Opening browser to authorize %s...", msg.Name)),
+			func() tea.Msg {
+				if err := mcp.Login(context.Background(), msg.Name); err != nil {
+					return util.ReportError(err)()
+				}
+				return util.ReportInfo(fmt.Sprintf("Authorized %s", msg.Name))()
+			},
+		)
 	case commands.QuitMsg:
 		return a, util.CmdHandler(dialogs.OpenDialogMsg{
 			Model: quit.NewQuitDialog(),
@@ -319,6 +353,13 @@ func (a *appModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			a.app.Permissions.Deny(msg.Permission)
 		}
 		return a, nil
+	case pubsub.Event[permission.ElicitationRequest]:
+		return a, util.CmdHandler(dialogs.OpenDialogMsg{
+			Model: elicitation.NewElicitationDialog(msg.Payload),
+		})
+	case elicitation.ResponseMsg:
+		a.app.Permissions.RespondElicitation(msg.Request, msg.Response)
+		return a, nil
 	case splash.OnboardingCompleteMsg:
 		item, ok := a.pages[a.currentPage]
 		if !ok {
@@ -533,6 +574,17 @@ func (a *appModel) handleKeyPressMsg(msg tea.KeyPressMsg) tea.Cmd {
 			},
 		)
 		return tea.Sequence(cmds...)
+	case key.Matches(msg, a.keyMap.Jobs):
+		if !a.isConfigured || a.selectedSessionID == "" {
+			return nil
+		}
+		if a.dialog.ActiveDialogID() == jobs.JobsDialogID {
+			return util.CmdHandler(dialogs.CloseDialogMsg{})
+		}
+		if a.dialog.HasDialogs() && a.dialog.ActiveDialogID() != commands.CommandsDialogID {
+			return nil
+		}
+		return util.CmdHandler(commands.OpenJobsDialogMsg{})
 	case key.Matches(msg, a.keyMap.Suspend):
 		if a.app.AgentCoordinator != nil && a.app.AgentCoordinator.IsBusy() {
 			return util.ReportWarn("Agent is busy, please wait...")
@@ -683,6 +735,13 @@ func handleMCPToolsEvent(ctx context.Context, name string) tea.Cmd {
 	}
 }
 
+func handleMCPResourcesEvent(ctx context.Context, name string) tea.Cmd {
+	return func() tea.Msg {
+		mcp.RefreshResources(ctx, name)
+		return nil
+	}
+}
+
 // New creates and initializes a new TUI application model.
 func New(app *app.App) *appModel {
 	chatPage := chat.New(app)
@@ -0,0 +1,122 @@
+// Package worktree runs work apart from the main working tree in git
+// worktrees, and brings it back as patches to review and apply.
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mudaaaa/crushplus/internal/gitcmd"
+)
+
+// ErrNotRepository is returned when the directory isn't in a git repository.
+var ErrNotRepository = gitcmd.ErrNotRepository
+
+// Worktree is a git worktree checked out at the base of a repository.
+type Worktree struct {
+	ID   string
+	Path string
+	// Dir is the directory of the worktree matching the one it was created
+	// from, which may be a subdirectory of the repository.
+	Dir string
+	// Base is the commit the worktree was checked out at.
+	Base string
+}
+
+// Dir returns the directory that holds the worktrees and their patches in
+// the data directory.
+func Dir(dataDir string) string {
+	return filepath.Join(dataDir, "worktrees")
+}
+
+// PatchPath returns the path of the patch with the given ID.
+func PatchPath(dataDir, id string) string {
+	return filepath.Join(Dir(dataDir), id+".patch")
+}
+
+// Base returns the commit to check the worktrees out at: the current state
+// of the tracked files of the repository, uncommitted changes included.
+// Untracked files aren't part of it.
+func Base(ctx context.Context, repoDir string) (string, error) {
+	if err := gitcmd.CheckRepository(ctx, repoDir); err != nil {
+		return "", err
+	}
+	// Stash create records the uncommitted changes in a commit without
+	// touching the working tree, and prints nothing when there are none.
+	stash, err := gitcmd.Run(ctx, repoDir, "", "stash", "create")
+	if err != nil {
+		return "", err
+	}
+	if stash != "" {
+		return stash, nil
+	}
+	return gitcmd.Run(ctx, repoDir, "", "rev-parse", "HEAD")
+}
+
+// Create checks out a new worktree of the repository at the base commit in
+// the worktrees directory of the data directory. repoDir may be any directory
+// of the repository.
+func Create(ctx context.Context, repoDir, dataDir, id, base string) (*Worktree, error) {
+	if err := os.MkdirAll(Dir(dataDir), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create worktrees directory: %w", err)
+	}
+	prefix, err := gitcmd.Run(ctx, repoDir, "", "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(Dir(dataDir), id)
+	if _, err := gitcmd.Run(ctx, repoDir, "", "worktree", "add", "--detach", path, base); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(path, filepath.FromSlash(prefix))
+	// The directory has no tracked files when it's missing from the
+	// checkout.
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory in worktree: %w", err)
+	}
+	return &Worktree{ID: id, Path: path, Dir: dir, Base: base}, nil
+}
+
+// Diff returns the changes made in the worktree since its base, new files
+// included, as a patch, along with a summary of them.
+func (w *Worktree) Diff(ctx context.Context) (patch, stat string, err error) {
+	if _, err := gitcmd.Run(ctx, w.Path, "", "add", "--all"); err != nil {
+		return "", "", err
+	}
+	if patch, err = gitcmd.Run(ctx, w.Path, "", "diff", "--cached", "--binary", w.Base); err != nil {
+		return "", "", err
+	}
+	if stat, err = gitcmd.Run(ctx, w.Path, "", "diff", "--cached", "--shortstat", w.Base); err != nil {
+		return "", "", err
+	}
+	if patch != "" {
+		patch += "\n"
+	}
+	return patch, stat, nil
+}
+
+// Remove deletes the worktree and its checkout.
+func (w *Worktree) Remove(ctx context.Context, repoDir string) error {
+	_, err := gitcmd.Run(ctx, repoDir, "", "worktree", "remove", "--force", w.Path)
+	return err
+}
+
+// Apply applies the patch to the working tree of the repository repoDir is
+// in. Nothing is applied when any part of the patch doesn't apply cleanly.
+func Apply(ctx context.Context, repoDir, patch string) error {
+	if strings.TrimSpace(patch) == "" {
+		return errors.New("the patch is empty")
+	}
+	// The paths of the patch are relative to the root of the repository, and
+	// git apply skips the ones outside of the directory it runs in.
+	root, err := gitcmd.Run(ctx, repoDir, "", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	_, err = gitcmd.Run(ctx, root, patch, "apply", "--whitespace=nowarn", "-")
+	return err
+}
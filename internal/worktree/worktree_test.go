@@ -0,0 +1,96 @@
+package worktree
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func initRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"config", "user.name", "Test"},
+		{"config", "user.email", "test@example.com"},
+	} {
+		require.NoError(t, exec.Command("git", append([]string{"-C", dir}, args...)...).Run())
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644))
+	require.NoError(t, exec.Command("git", "-C", dir, "add", ".").Run())
+	require.NoError(t, exec.Command("git", "-C", dir, "commit", "--quiet", "-m", "init").Run())
+	return dir
+}
+
+func TestWorktree(t *testing.T) {
+	t.Parallel()
+
+	repo := initRepo(t)
+	dataDir := t.TempDir()
+
+	// Uncommitted changes are carried over to the worktree.
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+
+	base, err := Base(t.Context(), repo)
+	require.NoError(t, err)
+	wt, err := Create(t.Context(), repo, dataDir, "task-1", base)
+	require.NoError(t, err)
+
+	content, err := os.ReadFile(filepath.Join(wt.Path, "main.go"))
+	require.NoError(t, err)
+	require.Equal(t, "package main\n\nfunc main() {}\n", string(content))
+
+	require.NoError(t, os.WriteFile(filepath.Join(wt.Path, "util.go"), []byte("package main\n\nfunc util() {}\n"), 0o644))
+	patch, stat, err := wt.Diff(t.Context())
+	require.NoError(t, err)
+	require.Contains(t, patch, "+func util() {}")
+	require.Contains(t, stat, "1 file changed")
+
+	require.NoError(t, wt.Remove(t.Context(), repo))
+	require.NoDirExists(t, wt.Path)
+
+	require.NoError(t, Apply(t.Context(), repo, patch))
+	content, err = os.ReadFile(filepath.Join(repo, "util.go"))
+	require.NoError(t, err)
+	require.Equal(t, "package main\n\nfunc util() {}\n", string(content))
+
+	require.Error(t, Apply(t.Context(), repo, patch), "the patch was already applied")
+}
+
+func TestWorktreeFromSubdirectory(t *testing.T) {
+	t.Parallel()
+
+	repo := initRepo(t)
+	sub := filepath.Join(repo, "pkg", "util")
+	require.NoError(t, os.MkdirAll(sub, 0o755))
+
+	base, err := Base(t.Context(), sub)
+	require.NoError(t, err)
+	wt, err := Create(t.Context(), sub, t.TempDir(), "task-1", base)
+	require.NoError(t, err)
+	defer wt.Remove(t.Context(), repo)
+	require.Equal(t, filepath.Join(wt.Path, "pkg", "util"), wt.Dir)
+	require.DirExists(t, wt.Dir)
+
+	// Changes outside of the subdirectory are applied too.
+	require.NoError(t, os.WriteFile(filepath.Join(wt.Path, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(wt.Dir, "util.go"), []byte("package util\n"), 0o644))
+	patch, _, err := wt.Diff(t.Context())
+	require.NoError(t, err)
+
+	require.NoError(t, Apply(t.Context(), sub, patch))
+	content, err := os.ReadFile(filepath.Join(repo, "main.go"))
+	require.NoError(t, err)
+	require.Equal(t, "package main\n\nfunc main() {}\n", string(content))
+	require.FileExists(t, filepath.Join(sub, "util.go"))
+}
+
+func TestBaseOutsideRepository(t *testing.T) {
+	t.Parallel()
+
+	_, err := Base(t.Context(), t.TempDir())
+	require.ErrorIs(t, err, ErrNotRepository)
+}